@@ -2,82 +2,250 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"auth-microservice/internal/config"
 	"auth-microservice/internal/handler"
+	"auth-microservice/internal/health"
+	"auth-microservice/internal/lifecycle"
+	"auth-microservice/internal/mailer"
+	"auth-microservice/internal/metrics"
 	"auth-microservice/internal/middleware"
 	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/ratelimit"
 	"auth-microservice/internal/repository"
 	"auth-microservice/internal/service"
+	"auth-microservice/internal/tracing"
 
 	"github.com/cdipaolo/sentiment"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func main() {
 	// load config
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
+		fatal("failed to load config", err)
+	}
+	slog.SetDefault(config.NewLogger(cfg))
+
+	// metrics: Go runtime and process stats plus the service's own collectors
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	m := metrics.New(registry)
+
+	// tracing: W3C trace context in and out, spans exported over OTLP when configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.ServiceName, cfg.OTLPEndpoint)
+	if err != nil {
+		fatal("tracing init failed", err)
 	}
 
 	// connect mongo
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	client, err := config.NewMongoClient(ctx, cfg)
+	client, err := config.NewMongoClient(ctx, cfg, m.MongoPoolMonitor())
 	if err != nil {
-		log.Fatalf("mongo connect error: %v", err)
+		fatal("mongo connect error", err)
 	}
 	db := client.Database(cfg.DBName)
 	//Create Index for Email
-	if err := config.EnsureIndexes(ctx, db); err != nil {
-		log.Fatal(err)
+	if err := config.EnsureIndexes(ctx, db, cfg); err != nil {
+		fatal("failed to ensure indexes", err)
 	}
 	//PgSql Initialized
-	config.ConnectToPostgres(cfg)
+	if err := config.ConnectToPostgres(cfg); err != nil {
+		fatal("Postgres connect error", err)
+	}
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := config.GetDB().Ping(ctx); err != nil {
-		log.Fatalf("Postgres not ready: %v", err)
+		fatal("Postgres not ready", err)
+	}
+	slog.Info("Postgres ready")
+	m.RegisterPgxPool(config.GetDB())
+	if err := config.RunMigrations(ctx, config.GetDB()); err != nil {
+		fatal("Postgres migrations failed", err)
 	}
-	log.Println("✅ Postgres ready")
 	//Analysis Model init
 	model, err := sentiment.Restore()
 	if err != nil {
-		log.Fatalf("failed to load sentiment model: %v", err)
+		fatal("failed to load sentiment model", err)
 	}
 	pkg.SetSentimentModel(&model)
 
+	// on SIGTERM: drain HTTP, stop workers, then close Mongo, Postgres and the mailer
+	app := lifecycle.New(cfg.ShutdownTimeout)
+	app.OnClose("mongo", config.CloseMongo)
+	app.OnClose("postgres", func(context.Context) error {
+		config.ClosePostgres()
+		return nil
+	})
+
 	// repositories
 	userRepo := repository.NewUserRepo(db, cfg.UserCol)
 	tokenRepo := repository.NewTokenRepo(db, cfg.TokenCol)
 	promptRepo := repository.NewPromptRepo(config.GetDB())
+	llmUsageRepo := repository.NewLLMUsageRepo(config.GetDB())
+	workspaceRepo := repository.NewWorkspaceRepo(db, cfg.WorkspaceCol)
+	memberRepo := repository.NewMemberRepo(db, cfg.MemberCol)
+	projectRepo := repository.NewProjectRepo(db, cfg.ProjectCol)
+	apiKeyRepo := repository.NewAPIKeyRepo(db, cfg.APIKeyCol)
+	outboxRepo := repository.NewEmailOutboxRepo(db, cfg.EmailOutboxCol)
+	auditRepo := repository.NewAuditRepo(db, cfg.AuditCol)
+
+	// rate limits and quotas: in memory per instance, or shared through Mongo
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimitStore == "mongo" {
+		limitStore = repository.NewRateLimitRepo(db, cfg.RateLimitCol)
+	}
+	limiter := ratelimit.New(limitStore)
+
+	// mail transport
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		fatal("mailer init failed", err)
+	}
+	app.OnClose("mailer", func(context.Context) error { return mailer.Close(mail) })
+	slog.Info("mail transport ready", "transport", cfg.MailTransport)
+	emailTemplates, err := mailer.NewTemplates(mailer.Brand{
+		Name:         cfg.BrandName,
+		URL:          cfg.BrandURL,
+		SupportEmail: cfg.SupportEmail,
+	})
+	if err != nil {
+		fatal("email templates failed to load", err)
+	}
+	// services queue email; the sender delivers it through the transport with retries
+	emailQueue := service.NewEmailOutboxService(outboxRepo, mail, cfg.EmailMaxAttempts, m)
+	app.Go("email sender", emailQueue.Run)
+	m.RegisterQueue("email", func(ctx context.Context) (map[string]int64, error) {
+		return outboxRepo.CountByStatus(ctx, repository.OutboxFilter{})
+	})
 
 	// services
-	authSvc := service.NewAuthService(userRepo, tokenRepo, cfg)
-	userSvc := service.NewUserService(userRepo, cfg.OpenApiKey)
-	promptSvc := service.NewPromptService(promptRepo, cfg.OpenApiKey)
+	auditSvc := service.NewAuditService(auditRepo)
+	authSvc := service.NewAuthService(userRepo, tokenRepo, emailQueue, emailTemplates, auditSvc, m, limiter, cfg)
+	llmUsageSvc := service.NewLLMUsageService(llmUsageRepo, workspaceRepo, cfg)
+	userSvc := service.NewUserService(userRepo, cfg.OpenApiKey, m, llmUsageSvc, auditSvc)
+	promptSvc := service.NewPromptService(promptRepo, cfg.OpenApiKey, auditSvc, m, llmUsageSvc)
+	projectSvc := service.NewProjectService(projectRepo, workspaceRepo, promptRepo, auditSvc)
+	sessionSvc := service.NewSessionService(userRepo, memberRepo, workspaceRepo)
+	workspaceSvc := service.NewWorkspaceService(workspaceRepo, memberRepo, userRepo, tokenRepo, promptRepo, projectSvc, sessionSvc, emailQueue, emailTemplates, auditSvc, cfg)
+	apiKeySvc := service.NewAPIKeyService(apiKeyRepo, memberRepo, auditSvc)
+	mfaSvc := service.NewMFAService(userRepo, auditSvc, cfg)
+	accountSvc := service.NewAccountService(userRepo, workspaceRepo, memberRepo, projectRepo, apiKeyRepo, tokenRepo, outboxRepo, promptRepo,
+		emailQueue, emailTemplates, sessionSvc, auditSvc, cfg)
+	backfillCtx, cancelBackfill := context.WithTimeout(context.Background(), 5*time.Minute)
+	if err := accountSvc.BackfillUserIDs(backfillCtx); err != nil {
+		fatal("user ID backfill failed", err)
+	}
+	if err := projectSvc.BackfillDefaults(backfillCtx); err != nil {
+		fatal("default project backfill failed", err)
+	}
+	cancelBackfill()
+	operatorSvc := service.NewOperatorService(userRepo, workspaceRepo, memberRepo, projectRepo, apiKeyRepo, promptRepo, sessionSvc, llmUsageSvc, auditSvc, cfg)
+	quotaSvc := service.NewQuotaService(limiter, workspaceRepo, cfg)
+	app.Go("account purger", accountSvc.Run) // purges accounts whose deletion grace period has ended
 
 	// handlers
-	h := handler.NewHandler(authSvc, userSvc, cfg, promptSvc)
+	h := handler.NewHandler(authSvc, userSvc, cfg, promptSvc, workspaceSvc, projectSvc, apiKeySvc, mfaSvc, emailQueue, accountSvc, auditSvc, sessionSvc, operatorSvc, quotaSvc, llmUsageSvc, limiter)
 
 	// routes
 	mux := http.NewServeMux()
 	h.RegisterRoutes(mux)
-
-	// ✅ Wrap mux with CORS middleware
-	corsMux := middleware.CORS(mux)
+	// Unversioned probes: liveness never looks at dependencies, readiness does
+	ready := health.NewChecker(cfg.ReadyCheckTimeout, cfg.ReadyCacheTTL,
+		health.Check{Name: "mongo", Fn: func(ctx context.Context) error { return client.Ping(ctx, nil) }},
+		health.Check{Name: "postgres", Fn: config.PingPostgres},
+		health.Check{Name: "migrations", Fn: func(ctx context.Context) error {
+			pending, err := config.PendingMigrations(ctx, config.GetDB())
+			if err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("pending migrations: %s", strings.Join(pending, ", "))
+			}
+			return nil
+		}},
+		health.Check{Name: "sentiment_model", Fn: func(context.Context) error {
+			if !pkg.SentimentModelLoaded() {
+				return errors.New("sentiment model not loaded")
+			}
+			return nil
+		}},
+	)
+	mux.HandleFunc("GET /livez", health.Livez)
+	mux.HandleFunc("GET /health", health.Livez) // older probes
+	mux.HandleFunc("GET /readyz", ready.Readyz)
+	mux.Handle("GET /metrics", metrics.Handler(registry, cfg.MetricsToken))
+	if cfg.DevEndpoints {
+		// Development only, which config enforces: preview templates with
+		// sample data, and read captured email instead of checking an inbox
+		mux.Handle("GET /emails/preview", handler.EmailPreviewHandler(emailTemplates))
+		if outbox, ok := mail.(*mailer.Outbox); ok {
+			mux.Handle("GET /dev/outbox", handler.OutboxHandler(outbox))
+			mux.Handle("DELETE /dev/outbox", handler.OutboxHandler(outbox))
+		}
+		slog.Warn("development endpoints are enabled")
+	}
 
 	addr := "0.0.0.0:" + cfg.Port
 	srv := &http.Server{
-		Addr:    addr,
-		Handler: corsMux, // 👈 use corsMux here
+		Addr:              addr,
+		Handler:           serverHandler(cfg, m, mux),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	app.OnClose("tracing", shutdownTracing) // last, to flush spans from the shutdown itself
+	slog.Info("listening", "addr", addr)
+	if err := app.Serve(srv); err != nil {
+		fatal("server error", err)
 	}
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// serverHandler wraps mux in the middleware every request goes through
+func serverHandler(cfg *config.Config, m *metrics.Metrics, mux *http.ServeMux) http.Handler {
+	// CORS outermost; request ID, IP and user agent feed the audit log and the
+	// request logger; Route hands the matched pattern to the access log and tracing
+	traced := otelhttp.NewHandler(middleware.Route(mux), "http", otelhttp.WithSpanNameFormatter(routeSpanName))
+	// Probes are public; every other route follows the configured policy
+	publicCORS := middleware.CORSPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}}
+	return middleware.CORS(middleware.CORSPolicy{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   cfg.CORSExposedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	}, []middleware.CORSRoute{
+		{Prefix: "/livez", Policy: publicCORS},
+		{Prefix: "/readyz", Policy: publicCORS},
+		{Prefix: "/health", Policy: publicCORS},
+	}, middleware.RequestContext(cfg.TrustedProxyHops, middleware.AccessLog(m, traced)))
+}
 
-	log.Printf("listening on %s", addr)
-	if err := srv.ListenAndServe(); err != nil {
-		log.Fatalf("server error: %v", err)
+// routeSpanName names a request's span after the route it matched, e.g.
+// "GET /v1/projects/{id}", so spans group by endpoint rather than by URL
+func routeSpanName(_ string, r *http.Request) string {
+	if r.Pattern != "" {
+		return r.Pattern
 	}
+	return r.Method
 }
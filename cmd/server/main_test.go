@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRouteSpanName(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/projects/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	traced := otelhttp.NewHandler(mux, "http", otelhttp.WithSpanNameFormatter(routeSpanName), otelhttp.WithTracerProvider(tp))
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/v1/projects/abc123", "GET /v1/projects/{id}"},
+		{http.MethodGet, "/nowhere", "GET"},
+		{http.MethodPost, "/v1/projects/abc123", "POST"}, // method not allowed
+	}
+	for _, tt := range tests {
+		exporter.Reset()
+		traced.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 {
+			t.Fatalf("%s %s: got %d spans, want 1", tt.method, tt.path, len(spans))
+		}
+		if spans[0].Name != tt.want {
+			t.Errorf("%s %s: span name %q, want %q", tt.method, tt.path, spans[0].Name, tt.want)
+		}
+	}
+}
+
+func TestServerHandlerSeesRoute(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	var logs bytes.Buffer
+	prevLog := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prevLog) })
+
+	reg := prometheus.NewRegistry()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/projects/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	h := serverHandler(&config.Config{}, metrics.New(reg), mux)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/projects/abc123", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+
+	want := `
+# HELP http_requests_total HTTP requests by method, route pattern and status code.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="GET /v1/projects/{id}",status="200"} 1
+http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "http_requests_total"); err != nil {
+		t.Error(err)
+	}
+
+	var routes []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry struct{ Msg, Route string }
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		if entry.Msg == "request" {
+			routes = append(routes, entry.Route)
+		}
+	}
+	if len(routes) != 2 || routes[0] != "GET /v1/projects/{id}" || routes[1] != "" {
+		t.Errorf("access log routes %q, want [\"GET /v1/projects/{id}\" \"\"]", routes)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "GET /v1/projects/{id}" {
+		t.Errorf("spans %v, want the first named after its route", spans.Snapshots())
+	}
+}
@@ -0,0 +1,62 @@
+package apperr
+
+import (
+	"fmt"
+	"time"
+)
+
+// Kind classifies an error for the transport layer, which maps it to a status code
+type Kind string
+
+const (
+	Internal     Kind = "internal"
+	NotFound     Kind = "not_found"
+	Validation   Kind = "validation"
+	Conflict     Kind = "conflict"
+	Unauthorized Kind = "unauthorized"
+	Forbidden    Kind = "forbidden"
+	RateLimited  Kind = "rate_limited"
+	Upstream     Kind = "upstream" // a dependency such as the LLM failed
+)
+
+// Error is an error that is safe to show to clients. Code is stable and
+// machine-readable; Message is for people. Err, the cause, is only logged.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  map[string]string // per-field validation messages
+	Err     error
+
+	// RetryAfter tells rate-limited clients how long to wait
+	RetryAfter time.Duration
+}
+
+// New returns an error without a cause, typically a package-level sentinel
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// Wrap returns an error that reports message to clients and keeps err for logs
+func Wrap(kind Kind, code, message string, err error) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Err: err}
+}
+
+// Invalid returns a validation error, with fields naming the bad input
+func Invalid(message string, fields map[string]string) *Error {
+	return &Error{Kind: Validation, Code: "invalid_request", Message: message, Fields: fields}
+}
+
+// Retry returns a rate-limit error telling the client to come back after d
+func Retry(code, message string, d time.Duration) *Error {
+	return &Error{Kind: RateLimited, Code: code, Message: message, RetryAfter: d}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"auth-microservice/internal/apperr"
+)
+
+// APIKeyPrefix starts every API key so they can be told apart from JWTs and
+// spotted by secret scanners.
+const APIKeyPrefix = "aeo_"
+
+// ErrInvalidAPIKey is returned for unknown, expired or revoked keys
+var ErrInvalidAPIKey = apperr.New(apperr.Unauthorized, "invalid_api_key", "invalid, expired or revoked API key")
+
+// ErrSessionRevoked is returned for tokens of disabled or deleted users, and
+// tokens issued before the user's sessions were revoked
+var ErrSessionRevoked = apperr.New(apperr.Unauthorized, "session_revoked", "session has been revoked")
+
+// Principal is the identity behind a request, however it authenticated
+type Principal struct {
+	Email       string
+	UserID      string
+	WorkspaceID string
+	Role        string
+	// Scopes further restricts Role when non-empty (API keys only)
+	Scopes []string
+	// MFA is set when the session completed a second factor
+	MFA bool
+	// APIKeyID is the hex ID of the key used, empty for interactive sessions
+	APIKeyID string
+	// SysRole is the user's platform role; only set for interactive sessions
+	SysRole string
+	// ImpersonatorID and ImpersonatorEmail identify the operator when the
+	// session is an impersonation; empty otherwise
+	ImpersonatorID    string
+	ImpersonatorEmail string
+}
+
+// GenerateAPIKey returns a new key of the form aeo_<id>_<secret>, the
+// identifying prefix (aeo_<id>) that is safe to store and display, and the
+// SHA-256 hash of the full key that is stored in place of the key itself.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = APIKeyPrefix + hex.EncodeToString(id)
+	key = prefix + "_" + hex.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hex SHA-256 of a key. Keys carry 192 bits of
+// randomness so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether a credential looks like an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	shape := regexp.MustCompile(`^aeo_[0-9a-f]{8}_[0-9a-f]{48}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		key, prefix, hash, err := GenerateAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !shape.MatchString(key) {
+			t.Fatalf("key %q is not aeo_<8 hex>_<48 hex>", key)
+		}
+		if key[:len(prefix)+1] != prefix+"_" || len(prefix) != len(APIKeyPrefix)+8 {
+			t.Errorf("prefix %q does not identify key %q", prefix, key)
+		}
+		if hash != HashAPIKey(key) || len(hash) != 64 {
+			t.Errorf("hash %q is not the SHA-256 of the key", hash)
+		}
+		if !IsAPIKey(key) {
+			t.Errorf("IsAPIKey(%q) = false", key)
+		}
+		if seen[key] {
+			t.Fatalf("key %q generated twice", key)
+		}
+		seen[key] = true
+	}
+	if IsAPIKey("eyJhbGciOiJIUzI1NiJ9.e30.x") {
+		t.Error("IsAPIKey accepted a JWT")
+	}
+	if HashAPIKey("aeo_a") == HashAPIKey("aeo_b") {
+		t.Error("different keys hash alike")
+	}
+}
@@ -6,22 +6,39 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// Step-up token types. An access token has no type; typed tokens are only
+// accepted by the MFA endpoints that expect them.
+const (
+	TokenTypeMFAPending = "mfa_pending" // first factor passed, exchange at /auth/mfa/verify
+	TokenTypeMFAEnroll  = "mfa_enroll"  // workspace requires MFA, may only enrol
+)
+
 type JWTClaims struct {
-	Email  string `json:"email"`
-	UserID string `json:"user_id"`
+	Email       string `json:"email"`
+	UserID      string `json:"user_id"`
+	WorkspaceID string `json:"workspace_id,omitempty"` // active workspace
+	Role        string `json:"role,omitempty"`         // role in the active workspace
+	TokenType   string `json:"typ,omitempty"`          // empty for access tokens
+	MFA         bool   `json:"mfa,omitempty"`          // second factor completed
+	SysRole     string `json:"sys_role,omitempty"`     // platform role, e.g. operator
+	SessionGen  int64  `json:"sgen,omitempty"`         // user's session generation at issue
+	// Act names the operator behind an impersonation token (RFC 8693 actor
+	// claim). Such tokens are read-only.
+	Act *JWTActor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateAccessToken(secret string, email string, userID string, ttl time.Duration) (string, error) {
+// JWTActor identifies who is acting on behalf of the token's subject
+type JWTActor struct {
+	UserID string `json:"sub"`
+	Email  string `json:"email,omitempty"`
+}
+
+// GenerateAccessToken signs claims with the issued-at and expiry set from ttl
+func GenerateAccessToken(secret string, claims JWTClaims, ttl time.Duration) (string, error) {
 	now := time.Now().UTC()
-	claims := JWTClaims{
-		Email:  email,
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
-		},
-	}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(secret))
 }
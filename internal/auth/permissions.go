@@ -0,0 +1,119 @@
+package auth
+
+import "strings"
+
+// Permission names an action on a resource as "resource:action".
+// A trailing "*" grants every action on the resource; "*" alone grants everything.
+type Permission string
+
+const (
+	PermReportsRead      Permission = "reports:read"      // overviews, analyses, prompt history
+	PermPromptsWrite     Permission = "prompts:write"     // run and add prompts (LLM-backed)
+	PermCompetitorsRead  Permission = "competitors:read"  // list competitors
+	PermCompetitorsWrite Permission = "competitors:write" // add or generate competitors
+	PermProjectsRead     Permission = "projects:read"     // list projects
+	PermProjectsWrite    Permission = "projects:write"    // create projects, edit brand profile
+	PermMembersRead      Permission = "members:read"      // list workspace members
+	PermAdminMembers     Permission = "admin:members"     // invite, re-role and remove members
+	PermAdminAPIKeys     Permission = "admin:api_keys"    // manage workspace-owned API keys
+	PermAdminSecurity    Permission = "admin:security"    // workspace security policy, e.g. require MFA
+	PermAdminEmails      Permission = "admin:emails"      // delivery status of the workspace's email
+	PermAdminAudit       Permission = "admin:audit"       // query and export the workspace's audit log
+	PermAdminBilling     Permission = "admin:billing"     // LLM usage and spend of the workspace
+	PermAdminAll         Permission = "admin:*"           // every workspace administration action
+	PermAll              Permission = "*"
+)
+
+// Platform permissions, granted by a user's system role rather than a
+// workspace role. Workspace roles and API key scopes never grant them.
+const (
+	PermSystemUsers       Permission = "system:users"       // search users, view profiles and prompt history
+	PermSystemAccounts    Permission = "system:accounts"    // force-verify, disable, revoke sessions
+	PermSystemAnalyses    Permission = "system:analyses"    // re-run a user's analyses
+	PermSystemStats       Permission = "system:stats"       // platform usage statistics
+	PermSystemEmails      Permission = "system:emails"      // delivery status and dead letters of all email
+	PermSystemImpersonate Permission = "system:impersonate" // read-only token acting as a user
+	PermSystemAll         Permission = "system:*"
+)
+
+// SysRoleOperator is the system role of support staff
+const SysRoleOperator = "operator"
+
+// sysRolePermissions maps each system role to the platform permissions it grants
+var sysRolePermissions = map[string][]Permission{
+	SysRoleOperator: {PermSystemAll},
+}
+
+// rolePermissions maps each workspace role (see repository.Role*) to the permissions it grants.
+var rolePermissions = map[string][]Permission{
+	"owner": {PermAll},
+	"admin": {
+		PermReportsRead, PermPromptsWrite,
+		PermCompetitorsRead, PermCompetitorsWrite,
+		PermProjectsRead, PermProjectsWrite,
+		PermMembersRead, PermAdminAll,
+	},
+	"editor": {
+		PermReportsRead, PermPromptsWrite,
+		PermCompetitorsRead, PermCompetitorsWrite,
+		PermProjectsRead, PermMembersRead,
+	},
+	"viewer": {
+		PermReportsRead, PermCompetitorsRead,
+		PermProjectsRead, PermMembersRead,
+	},
+}
+
+// RoleHasPermission reports whether role grants perm
+func RoleHasPermission(role string, perm Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted.Grants(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// SysRoleHasPermission reports whether a system role grants a platform permission
+func SysRoleHasPermission(sysRole string, perm Permission) bool {
+	for _, granted := range sysRolePermissions[sysRole] {
+		if granted.Grants(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Grants reports whether p covers perm, honouring "*" and "resource:*" wildcards
+func (p Permission) Grants(perm Permission) bool {
+	if p == PermAll || p == perm {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(string(p), "*"); ok {
+		return strings.HasPrefix(string(perm), prefix)
+	}
+	return false
+}
+
+// ScopesAllow reports whether a scope list permits perm. An empty list places
+// no restriction beyond the role.
+func ScopesAllow(scopes []string, perm Permission) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if Permission(scope).Grants(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidScope reports whether s is shaped like a permission ("*" or "resource:action")
+func ValidScope(s string) bool {
+	if s == string(PermAll) {
+		return true
+	}
+	resource, action, ok := strings.Cut(s, ":")
+	return ok && resource != "" && action != ""
+}
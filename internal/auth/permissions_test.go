@@ -0,0 +1,93 @@
+package auth
+
+import "testing"
+
+func TestRoleHasPermission(t *testing.T) {
+	perms := []Permission{
+		PermReportsRead, PermPromptsWrite, PermCompetitorsRead, PermCompetitorsWrite,
+		PermProjectsRead, PermProjectsWrite, PermMembersRead,
+		PermAdminMembers, PermAdminAPIKeys, PermAdminSecurity, PermAdminEmails, PermAdminAudit, PermAdminBilling,
+	}
+	// granted lists what each role may do; everything else in perms is refused
+	granted := map[string][]Permission{
+		"owner": perms,
+		"admin": perms,
+		"editor": {
+			PermReportsRead, PermPromptsWrite, PermCompetitorsRead, PermCompetitorsWrite,
+			PermProjectsRead, PermMembersRead,
+		},
+		"viewer":  {PermReportsRead, PermCompetitorsRead, PermProjectsRead, PermMembersRead},
+		"":        nil,
+		"unknown": nil,
+	}
+	for role, allowed := range granted {
+		want := map[Permission]bool{}
+		for _, p := range allowed {
+			want[p] = true
+		}
+		for _, p := range perms {
+			if got := RoleHasPermission(role, p); got != want[p] {
+				t.Errorf("RoleHasPermission(%q, %q) = %v, want %v", role, p, got, want[p])
+			}
+		}
+	}
+}
+
+func TestSysRoleHasPermission(t *testing.T) {
+	tests := []struct {
+		sysRole string
+		perm    Permission
+		want    bool
+	}{
+		{SysRoleOperator, PermSystemUsers, true},
+		{SysRoleOperator, PermSystemImpersonate, true},
+		{SysRoleOperator, PermSystemEmails, true},
+		{SysRoleOperator, PermReportsRead, false},
+		{"", PermSystemUsers, false},
+		{"owner", PermSystemUsers, false},
+		{"owner", PermSystemEmails, false},
+	}
+	for _, tt := range tests {
+		if got := SysRoleHasPermission(tt.sysRole, tt.perm); got != tt.want {
+			t.Errorf("SysRoleHasPermission(%q, %q) = %v, want %v", tt.sysRole, tt.perm, got, tt.want)
+		}
+	}
+}
+
+func TestScopesAllow(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		perm   Permission
+		want   bool
+	}{
+		{"no scopes", nil, PermAdminMembers, true},
+		{"exact scope", []string{"reports:read"}, PermReportsRead, true},
+		{"other scope", []string{"reports:read"}, PermPromptsWrite, false},
+		{"resource wildcard", []string{"admin:*"}, PermAdminAudit, true},
+		{"resource wildcard elsewhere", []string{"admin:*"}, PermReportsRead, false},
+		{"all", []string{"*"}, PermAdminBilling, true},
+		{"any of several", []string{"reports:read", "prompts:write"}, PermPromptsWrite, true},
+	}
+	for _, tt := range tests {
+		if got := ScopesAllow(tt.scopes, tt.perm); got != tt.want {
+			t.Errorf("%s: ScopesAllow(%v, %q) = %v, want %v", tt.name, tt.scopes, tt.perm, got, tt.want)
+		}
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	for scope, want := range map[string]bool{
+		"*":            true,
+		"reports:read": true,
+		"admin:*":      true,
+		"reports":      false,
+		":read":        false,
+		"reports:":     false,
+		"":             false,
+	} {
+		if got := ValidScope(scope); got != want {
+			t.Errorf("ValidScope(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
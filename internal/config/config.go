@@ -3,7 +3,12 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,15 +20,52 @@ type Config struct {
 	UserCol   string
 	TokenCol  string
 	PromptCol string
+	// Workspaces
+	WorkspaceCol string
+	MemberCol    string
+	ProjectCol   string
+	APIKeyCol    string
+	AuditCol     string
+	// Email delivery queue
+	EmailOutboxCol   string
+	EmailMaxAttempts int // delivery attempts before an email is dead-lettered
+	// Account deletion
+	AccountDeletionGraceDays int // days a deleted account can be restored before it is purged
 	//PostgreSQL
 	PostgresURL string
 	// Server
-	Port string
+	Port              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration // covers analysis requests waiting on the LLM
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // drain deadline after SIGTERM
+	ReadyCheckTimeout time.Duration // per-dependency limit in /readyz
+	ReadyCacheTTL     time.Duration // how long a /readyz result is reused
+	LogLevel          string        // debug, info, warn or error
+	LogFormat         string        // "json" or "text"
+	MetricsToken      string        // Bearer token required on /metrics; empty leaves it open
+	ServiceName       string        // reported with traces
+	OTLPEndpoint      string        // OTLP/HTTP collector; empty disables trace export
+	Environment       string        // "production" or "development"
+	DevEndpoints      bool          // serve /dev/outbox and /emails/preview; development only
 
 	// Email
-	Email       string
-	EmailKey    string
-	EmailSecret string
+	Email         string // sender address
+	EmailKey      string // SendGrid API key
+	EmailSecret   string
+	MailTransport string // "sendgrid", "smtp" or "outbox"
+	MailFromName  string
+	SMTPHost      string
+	SMTPPort      int
+	SMTPUsername  string
+	SMTPPassword  string
+	MailOutboxDir string // outbox transport: also write messages here as JSON
+
+	// Branding used in emails
+	BrandName    string
+	BrandURL     string
+	SupportEmail string
 
 	// JWT / Auth
 	AccessSecret string
@@ -34,10 +76,63 @@ type Config struct {
 	GoogleRedirectURL  string
 	FrontendURL        string
 
+	// MFA
+	MFAIssuer string // shown as the account issuer in authenticator apps
+
+	// Magic links
+	MagicLinkBaseURLs       []string // permitted base URLs for emailed links; defaults to FrontendURL
+	MagicLinkPerEmailHour   int      // links sent to one address per hour
+	MagicLinkPerIPHour      int      // links requested from one IP per hour
+	MagicLinkMaxOutstanding int      // unexpired links kept per address; older ones stop working
+	LoginCodePerEmailMinute int      // sign-in codes one address may try per minute; 0 turns the limit off
+	TrustedProxyHops        int      // proxies in front of the server appending to X-Forwarded-For; 0 ignores the header
+
+	// CORS
+	CORSAllowedOrigins   []string // exact origins, "https://*.example.com" patterns or "*"; defaults to FrontendURL
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSExposedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration // how long browsers may cache a preflight
+
+	// Rate limits: token buckets per user (or API key) and per client IP
+	RateLimitStore         string // "memory" (per instance) or "mongo" (shared)
+	RateLimitCol           string
+	RateLimitUserBurst     int // 0 turns the per-user limit off
+	RateLimitUserPerMinute int
+	RateLimitIPBurst       int // 0 turns the per-IP limit off
+	RateLimitIPPerMinute   int
+	// Plans maps each workspace plan to its quotas on LLM-backed operations
+	Plans map[string]PlanQuota
+
+	// LLM cost accounting
+	LLMPrices                 map[string]LLMPrice // by model; calls to unpriced models cost 0
+	LLMMonthlyBudgetUSD       float64             // default per-workspace budget a calendar month; 0 means none
+	LLMPlatformDailyBudgetUSD float64             // USD all workspaces together may spend a UTC day; 0 means none
+
 	// Other optional keys
 	OpenApiKey string
 }
 
+// Workspace plans
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanEnterprise = "enterprise"
+)
+
+// LLMPrice is what a model costs in USD per million tokens
+type LLMPrice struct {
+	InputPerMTok  float64
+	OutputPerMTok float64
+}
+
+// PlanQuota caps LLM calls per UTC day and calendar month; 0 means unlimited
+type PlanQuota struct {
+	DailyLLMCalls   int
+	MonthlyLLMCalls int
+}
+
 // Load reads environment variables and validates required ones.
 func Load() (*Config, error) {
 	// Load .env file if it exists (optional)
@@ -57,6 +152,55 @@ func Load() (*Config, error) {
 		return os.Getenv(key)
 	}
 
+	getDefault := func(key, def string) string {
+		if val := os.Getenv(key); val != "" {
+			return val
+		}
+		return def
+	}
+
+	var invalid []string
+
+	getInt := func(key string, def int) int {
+		val := os.Getenv(key)
+		if val == "" {
+			return def
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			invalid = append(invalid, key)
+			return def
+		}
+		return n
+	}
+
+	getFloat := func(key string, def float64) float64 {
+		val := os.Getenv(key)
+		if val == "" {
+			return def
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil || f < 0 {
+			invalid = append(invalid, key)
+			return def
+		}
+		return f
+	}
+
+	getSeconds := func(key string, def int) time.Duration {
+		return time.Duration(getInt(key, def)) * time.Second
+	}
+	// getList splits a comma-separated variable, def when it is unset
+	getList := func(key, def string) []string {
+		var list []string
+		for _, v := range strings.Split(getDefault(key, def), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+		return list
+	}
+
 	cfg := &Config{
 		// Required
 		MongoURI:     getRequired("MONGO_URI"),
@@ -66,27 +210,211 @@ func Load() (*Config, error) {
 		PromptCol:    getRequired("PROMPT_COL"),
 		PostgresURL:  getRequired("POSTGRES_URL"),
 		Port:         getRequired("PORT"),
-		Email:        getRequired("EMAIL"),
-		EmailKey:     getRequired("EMAIL_KEY"),
 		AccessSecret: getRequired("ACCESS_SECRET"),
 		EmailSecret:  getRequired("EMAIL_SECRET"),
 		OpenApiKey:   getRequired("OPENAI_API_KEY"),
 
 		// Optional
+		Email:              getOptional("EMAIL"),
+		EmailKey:           getOptional("EMAIL_KEY"),
+		SMTPHost:           getOptional("SMTP_HOST"),
+		SMTPUsername:       getOptional("SMTP_USERNAME"),
+		SMTPPassword:       getOptional("SMTP_PASSWORD"),
+		MailOutboxDir:      getOptional("MAIL_OUTBOX_DIR"),
+		BrandURL:           getOptional("BRAND_URL"),
+		SupportEmail:       getOptional("SUPPORT_EMAIL"),
+		MailFromName:       getOptional("MAIL_FROM_NAME"),
 		GoogleClientID:     getOptional("GOOGLE_CLIENT_ID"),
 		GoogleClientSecret: getOptional("GOOGLE_CLIENT_SECRET"),
 		GoogleRedirectURL:  getOptional("GOOGLE_REDIRECT_URL"),
 		FrontendURL:        getOptional("FrontendURL"),
+
+		// Defaulted
+		WorkspaceCol: getDefault("WORKSPACE_COL", "workspaces"),
+		MemberCol:    getDefault("MEMBER_COL", "workspace_members"),
+		ProjectCol:   getDefault("PROJECT_COL", "projects"),
+		APIKeyCol:    getDefault("API_KEY_COL", "api_keys"),
+		AuditCol:     getDefault("AUDIT_COL", "audit_events"),
+		MFAIssuer:    getDefault("MFA_ISSUER", "AEORANK"),
+
+		EmailOutboxCol:   getDefault("EMAIL_OUTBOX_COL", "email_outbox"),
+		EmailMaxAttempts: getInt("EMAIL_MAX_ATTEMPTS", 8),
+
+		AccountDeletionGraceDays: getInt("ACCOUNT_DELETION_GRACE_DAYS", 30),
+
+		MailTransport: getDefault("MAIL_TRANSPORT", "sendgrid"),
+		BrandName:     getDefault("BRAND_NAME", "AEORANK"),
+		SMTPPort:      getInt("SMTP_PORT", 587),
+
+		MagicLinkPerEmailHour:   getInt("MAGIC_LINK_PER_EMAIL_HOUR", 5),
+		MagicLinkPerIPHour:      getInt("MAGIC_LINK_PER_IP_HOUR", 20),
+		MagicLinkMaxOutstanding: getInt("MAGIC_LINK_MAX_OUTSTANDING", 5),
+		LoginCodePerEmailMinute: getInt("LOGIN_CODE_PER_EMAIL_MINUTE", 3),
+		TrustedProxyHops:        getInt("TRUSTED_PROXY_HOPS", 0),
+
+		ReadHeaderTimeout: getSeconds("SERVER_READ_HEADER_TIMEOUT", 10),
+		ReadTimeout:       getSeconds("SERVER_READ_TIMEOUT", 30),
+		WriteTimeout:      getSeconds("SERVER_WRITE_TIMEOUT", 180),
+		IdleTimeout:       getSeconds("SERVER_IDLE_TIMEOUT", 120),
+		ShutdownTimeout:   getSeconds("SHUTDOWN_TIMEOUT", 60),
+		ReadyCheckTimeout: getSeconds("READY_CHECK_TIMEOUT", 2),
+		ReadyCacheTTL:     getSeconds("READY_CACHE_TTL", 5),
+		LogLevel:          getDefault("LOG_LEVEL", "info"),
+		LogFormat:         getDefault("LOG_FORMAT", "json"),
+		MetricsToken:      getOptional("METRICS_TOKEN"),
+		ServiceName:       getDefault("OTEL_SERVICE_NAME", "auth-microservice"),
+		OTLPEndpoint:      getOptional("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"),
+		Environment:       getDefault("APP_ENV", "production"),
+		DevEndpoints:      getOptional("DEV_ENDPOINTS") == "true",
+
+		CORSAllowedOrigins:   getList("CORS_ALLOWED_ORIGINS", ""),
+		CORSAllowedMethods:   getList("CORS_ALLOWED_METHODS", "GET, POST, PUT, PATCH, DELETE"),
+		CORSAllowedHeaders:   getList("CORS_ALLOWED_HEADERS", "Authorization, Content-Type, X-API-Key, X-Request-ID"),
+		CORSExposedHeaders:   getList("CORS_EXPOSED_HEADERS", "X-Request-ID, Deprecation, Link, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset"),
+		CORSAllowCredentials: getOptional("CORS_ALLOW_CREDENTIALS") == "true",
+		CORSMaxAge:           getSeconds("CORS_MAX_AGE", 600),
+
+		RateLimitStore:         getDefault("RATE_LIMIT_STORE", "memory"),
+		RateLimitCol:           getDefault("RATE_LIMIT_COL", "rate_limits"),
+		RateLimitUserBurst:     getInt("RATE_LIMIT_USER_BURST", 60),
+		RateLimitUserPerMinute: getInt("RATE_LIMIT_USER_PER_MINUTE", 60),
+		RateLimitIPBurst:       getInt("RATE_LIMIT_IP_BURST", 120),
+		RateLimitIPPerMinute:   getInt("RATE_LIMIT_IP_PER_MINUTE", 120),
+		Plans: map[string]PlanQuota{
+			PlanFree:       {DailyLLMCalls: getInt("PLAN_FREE_DAILY_LLM_CALLS", 50), MonthlyLLMCalls: getInt("PLAN_FREE_MONTHLY_LLM_CALLS", 500)},
+			PlanPro:        {DailyLLMCalls: getInt("PLAN_PRO_DAILY_LLM_CALLS", 1000), MonthlyLLMCalls: getInt("PLAN_PRO_MONTHLY_LLM_CALLS", 20000)},
+			PlanEnterprise: {DailyLLMCalls: getInt("PLAN_ENTERPRISE_DAILY_LLM_CALLS", 0), MonthlyLLMCalls: getInt("PLAN_ENTERPRISE_MONTHLY_LLM_CALLS", 0)},
+		},
+
+		LLMMonthlyBudgetUSD:       getFloat("LLM_MONTHLY_BUDGET_USD", 0),
+		LLMPlatformDailyBudgetUSD: getFloat("LLM_PLATFORM_DAILY_BUDGET_USD", 0),
+	}
+
+	// Mail settings depend on the transport; the outbox needs none
+	switch cfg.MailTransport {
+	case "sendgrid":
+		getRequired("EMAIL")
+		getRequired("EMAIL_KEY")
+	case "smtp":
+		getRequired("EMAIL")
+		getRequired("SMTP_HOST")
+	case "outbox":
+	default:
+		invalid = append(invalid, "MAIL_TRANSPORT")
+	}
+
+	if cfg.OTLPEndpoint == "" {
+		cfg.OTLPEndpoint = getOptional("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	// TRUST_PROXY predates hop counts and meant a single proxy
+	if cfg.TrustedProxyHops == 0 && getOptional("TRUST_PROXY") == "true" {
+		cfg.TrustedProxyHops = 1
+	}
+
+	// The frontend is the one origin allowed unless told otherwise
+	if len(cfg.CORSAllowedOrigins) == 0 && cfg.FrontendURL != "" {
+		if u, err := url.Parse(cfg.FrontendURL); err == nil && u.Scheme != "" && u.Host != "" {
+			cfg.CORSAllowedOrigins = []string{u.Scheme + "://" + u.Host}
+		}
+	}
+	// Browsers refuse credentials with a wildcard origin, and echoing every
+	// origin instead would let any site call the API as the user
+	if cfg.CORSAllowCredentials && slices.Contains(cfg.CORSAllowedOrigins, "*") {
+		invalid = append(invalid, "CORS_ALLOW_CREDENTIALS")
+	}
+	// Trimming links an address was sent within the hour would void links the
+	// user may still be about to click
+	if cfg.MagicLinkMaxOutstanding < cfg.MagicLinkPerEmailHour {
+		invalid = append(invalid, "MAGIC_LINK_MAX_OUTSTANDING")
+	}
+	if cfg.RateLimitStore != "memory" && cfg.RateLimitStore != "mongo" {
+		invalid = append(invalid, "RATE_LIMIT_STORE")
+	}
+	// A bucket that never refills would lock callers out for good
+	if cfg.RateLimitUserBurst > 0 && cfg.RateLimitUserPerMinute == 0 {
+		invalid = append(invalid, "RATE_LIMIT_USER_PER_MINUTE")
+	}
+	if cfg.RateLimitIPBurst > 0 && cfg.RateLimitIPPerMinute == 0 {
+		invalid = append(invalid, "RATE_LIMIT_IP_PER_MINUTE")
+	}
+	prices, err := parseLLMPrices(getDefault("LLM_PRICES", defaultLLMPrices))
+	if err != nil {
+		invalid = append(invalid, "LLM_PRICES")
+	}
+	cfg.LLMPrices = prices
+	if _, err := parseLogLevel(cfg.LogLevel); err != nil {
+		invalid = append(invalid, "LOG_LEVEL")
+	}
+	if cfg.LogFormat != "json" && cfg.LogFormat != "text" {
+		invalid = append(invalid, "LOG_FORMAT")
+	}
+	if cfg.Environment != "production" && cfg.Environment != "development" {
+		invalid = append(invalid, "APP_ENV")
+	}
+	// The dev endpoints are unauthenticated and show every sign-in link and
+	// code sent, so a deployment must say it is for development to get them
+	if cfg.DevEndpoints && cfg.Environment != "development" {
+		invalid = append(invalid, "DEV_ENDPOINTS")
 	}
 
 	if len(missing) > 0 {
 		return nil, errors.New("missing required environment variables: " + fmt.Sprint(missing))
 	}
+	if len(invalid) > 0 {
+		return nil, errors.New("invalid environment variables: " + fmt.Sprint(invalid))
+	}
+
+	// Emails are sent as the brand and link to the frontend unless told otherwise
+	if cfg.MailFromName == "" {
+		cfg.MailFromName = cfg.BrandName
+	}
+	if cfg.BrandURL == "" {
+		cfg.BrandURL = cfg.FrontendURL
+	}
+
+	// Magic links may only point at known frontends
+	for _, u := range strings.Split(getOptional("MAGIC_LINK_BASE_URLS"), ",") {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			cfg.MagicLinkBaseURLs = append(cfg.MagicLinkBaseURLs, u)
+		}
+	}
+	if len(cfg.MagicLinkBaseURLs) == 0 && cfg.FrontendURL != "" {
+		cfg.MagicLinkBaseURLs = []string{strings.TrimRight(cfg.FrontendURL, "/")}
+	}
 
 	// Set a default for GoogleRedirectURL if Google OAuth is partially configured
 	if cfg.GoogleRedirectURL == "" && cfg.GoogleClientID != "" && cfg.GoogleClientSecret != "" {
-		cfg.GoogleRedirectURL = "http://localhost:" + cfg.Port + "/auth/google/callback"
+		cfg.GoogleRedirectURL = "http://localhost:" + cfg.Port + "/v1/oauth/google/callback"
 	}
 
 	return cfg, nil
 }
+
+// defaultLLMPrices are list prices of the models the service calls
+const defaultLLMPrices = "gpt-4o-mini=0.15/0.60, gpt-4o=2.50/10.00"
+
+// parseLLMPrices reads "model=input/output" entries, comma-separated, with
+// prices in USD per million tokens
+func parseLLMPrices(s string) (map[string]LLMPrice, error) {
+	prices := map[string]LLMPrice{}
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		model, price, ok := strings.Cut(entry, "=")
+		in, out, ok2 := strings.Cut(price, "/")
+		if !ok || !ok2 || strings.TrimSpace(model) == "" {
+			return nil, fmt.Errorf("invalid price %q", entry)
+		}
+		input, err := strconv.ParseFloat(strings.TrimSpace(in), 64)
+		if err != nil || input < 0 {
+			return nil, fmt.Errorf("invalid input price %q", entry)
+		}
+		output, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+		if err != nil || output < 0 {
+			return nil, fmt.Errorf("invalid output price %q", entry)
+		}
+		prices[strings.TrimSpace(model)] = LLMPrice{InputPerMTok: input, OutputPerMTok: output}
+	}
+	return prices, nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// setRequiredEnv sets every variable Load requires, with the outbox transport
+// so no mail credentials are needed
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{"MONGO_URI", "DB_NAME", "USER_COL", "TOKEN_COL", "PROMPT_COL", "POSTGRES_URL",
+		"PORT", "ACCESS_SECRET", "EMAIL_SECRET", "OPENAI_API_KEY"} {
+		t.Setenv(key, "x")
+	}
+	t.Setenv("MAIL_TRANSPORT", "outbox")
+}
+
+func TestLoadDevEndpoints(t *testing.T) {
+	tests := []struct {
+		env, devEndpoints string
+		wantErr           string
+		want              bool
+	}{
+		{"", "", "", false},
+		{"development", "", "", false},
+		{"development", "true", "", true},
+		{"", "true", "DEV_ENDPOINTS", false},
+		{"production", "true", "DEV_ENDPOINTS", false},
+		{"staging", "", "APP_ENV", false},
+	}
+	for _, tt := range tests {
+		setRequiredEnv(t)
+		t.Setenv("APP_ENV", tt.env)
+		t.Setenv("DEV_ENDPOINTS", tt.devEndpoints)
+
+		cfg, err := Load()
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("APP_ENV=%q DEV_ENDPOINTS=%q: err %v, want one naming %s", tt.env, tt.devEndpoints, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("APP_ENV=%q DEV_ENDPOINTS=%q: %v", tt.env, tt.devEndpoints, err)
+			continue
+		}
+		if cfg.DevEndpoints != tt.want {
+			t.Errorf("APP_ENV=%q DEV_ENDPOINTS=%q: DevEndpoints = %v, want %v", tt.env, tt.devEndpoints, cfg.DevEndpoints, tt.want)
+		}
+	}
+}
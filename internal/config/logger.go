@@ -0,0 +1,22 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+)
+
+// NewLogger builds the process logger from LOG_LEVEL and LOG_FORMAT
+func NewLogger(cfg *Config) *slog.Logger {
+	level, _ := parseLogLevel(cfg.LogLevel) // validated by Load
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.LogFormat == "text" {
+		return slog.New(slog.NewTextHandler(os.Stdout, opts))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, opts))
+}
+
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
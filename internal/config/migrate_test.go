@@ -0,0 +1,85 @@
+package config
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPostgres connects to POSTGRES_TEST_URL, skipping the test without it.
+// Migrating is left to the test.
+func testPostgres(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatalf("connect to postgres: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestRunMigrationsConcurrently(t *testing.T) {
+	db := testPostgres(t)
+	ctx := context.Background()
+
+	// Instances starting together must not apply the same migration twice
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = RunMigrations(ctx, db)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("run %d: %v", i, err)
+		}
+	}
+	pending, err := PendingMigrations(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("pending after migrating: %v", pending)
+	}
+}
+
+func TestRunMigrationsWaitsForLock(t *testing.T) {
+	db := testPostgres(t)
+	ctx := context.Background()
+	if err := RunMigrations(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	holder, err := db.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Release()
+	if _, err := holder.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		t.Fatal(err)
+	}
+	short, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := RunMigrations(short, db); err == nil {
+		t.Fatal("migrations ran while another instance held the lock")
+	}
+
+	if _, err := holder.Exec(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunMigrations(ctx, db); err != nil {
+		t.Fatalf("after the lock was released: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+-- Baseline schema for the analysis tables. Existing databases already have
+-- these, so every statement is idempotent.
+
+CREATE TABLE IF NOT EXISTS prompt_response_entry (
+    id         SERIAL PRIMARY KEY,
+    user_email TEXT NOT NULL,
+    prompt     TEXT NOT NULL,
+    response   TEXT NOT NULL,
+    country    TEXT NOT NULL DEFAULT '',
+    added      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS prompt_meta (
+    id         SERIAL PRIMARY KEY,
+    prompt_id  INTEGER NOT NULL REFERENCES prompt_response_entry (id) ON DELETE CASCADE,
+    user_email TEXT NOT NULL,
+    prompt     TEXT NOT NULL,
+    mentions   JSONB NOT NULL DEFAULT '{}'::jsonb,
+    volume     INTEGER NOT NULL DEFAULT 0,
+    tags       TEXT[],
+    location   TEXT NOT NULL DEFAULT '',
+    added      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS brand_analysis (
+    id         SERIAL PRIMARY KEY,
+    prompt_id  INTEGER NOT NULL REFERENCES prompt_response_entry (id) ON DELETE CASCADE,
+    user_email TEXT NOT NULL,
+    brand_name TEXT NOT NULL,
+    visibility DOUBLE PRECISION NOT NULL DEFAULT 0,
+    sentiment  INTEGER NOT NULL DEFAULT 0,
+    position   INTEGER NOT NULL DEFAULT 0,
+    added      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS domain_analysis (
+    id            SERIAL PRIMARY KEY,
+    prompt_id     INTEGER NOT NULL REFERENCES prompt_response_entry (id) ON DELETE CASCADE,
+    domain        TEXT NOT NULL,
+    used          INTEGER NOT NULL DEFAULT 0,
+    avg_citations DOUBLE PRECISION NOT NULL DEFAULT 0,
+    type          TEXT NOT NULL DEFAULT '',
+    added         TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,11 @@
+-- Analysis rows belong to a workspace rather than to the user who ran them.
+-- workspace_id is the hex ObjectID of the Mongo workspace document; existing
+-- rows are backfilled when their owner's personal workspace is created.
+
+ALTER TABLE prompt_response_entry ADD COLUMN IF NOT EXISTS workspace_id TEXT;
+ALTER TABLE prompt_meta           ADD COLUMN IF NOT EXISTS workspace_id TEXT;
+ALTER TABLE brand_analysis        ADD COLUMN IF NOT EXISTS workspace_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_prompt_response_entry_workspace ON prompt_response_entry (workspace_id, added DESC);
+CREATE INDEX IF NOT EXISTS idx_prompt_meta_workspace           ON prompt_meta (workspace_id, added DESC);
+CREATE INDEX IF NOT EXISTS idx_brand_analysis_workspace        ON brand_analysis (workspace_id, added DESC);
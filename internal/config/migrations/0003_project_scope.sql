@@ -0,0 +1,11 @@
+-- Analysis rows belong to a project (one brand in one market) within a
+-- workspace. project_id is the hex ObjectID of the Mongo project document;
+-- existing rows are backfilled when their workspace's default project is created.
+
+ALTER TABLE prompt_response_entry ADD COLUMN IF NOT EXISTS project_id TEXT;
+ALTER TABLE prompt_meta           ADD COLUMN IF NOT EXISTS project_id TEXT;
+ALTER TABLE brand_analysis        ADD COLUMN IF NOT EXISTS project_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_prompt_response_entry_project ON prompt_response_entry (project_id, added DESC);
+CREATE INDEX IF NOT EXISTS idx_prompt_meta_project           ON prompt_meta (project_id, added DESC);
+CREATE INDEX IF NOT EXISTS idx_brand_analysis_project        ON brand_analysis (project_id, added DESC);
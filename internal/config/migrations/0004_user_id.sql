@@ -0,0 +1,16 @@
+-- Analysis rows are keyed by the user's hex ObjectID instead of their email,
+-- so changing an email keeps the history. Existing rows are backfilled from
+-- the users collection at startup; user_email is no longer written and stays
+-- only on rows whose user could not be found.
+
+ALTER TABLE prompt_response_entry ADD COLUMN IF NOT EXISTS user_id TEXT;
+ALTER TABLE prompt_meta           ADD COLUMN IF NOT EXISTS user_id TEXT;
+ALTER TABLE brand_analysis        ADD COLUMN IF NOT EXISTS user_id TEXT;
+
+ALTER TABLE prompt_response_entry ALTER COLUMN user_email DROP NOT NULL;
+ALTER TABLE prompt_meta           ALTER COLUMN user_email DROP NOT NULL;
+ALTER TABLE brand_analysis        ALTER COLUMN user_email DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_prompt_response_entry_user ON prompt_response_entry (user_id, added);
+CREATE INDEX IF NOT EXISTS idx_prompt_meta_user           ON prompt_meta (user_id, added);
+CREATE INDEX IF NOT EXISTS idx_brand_analysis_user        ON brand_analysis (user_id, added);
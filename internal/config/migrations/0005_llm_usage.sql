@@ -0,0 +1,37 @@
+-- Every LLM call with its tokens and cost, and a per-day rollup that spend
+-- reports and budgets read. workspace_id and user_id are hex ObjectIDs, empty
+-- when a call ran outside a request (e.g. a background job).
+
+CREATE TABLE IF NOT EXISTS llm_call (
+    id                BIGSERIAL PRIMARY KEY,
+    workspace_id      TEXT NOT NULL DEFAULT '',
+    user_id           TEXT NOT NULL DEFAULT '',
+    purpose           TEXT NOT NULL,
+    provider          TEXT NOT NULL,
+    model             TEXT NOT NULL,
+    prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    cost_usd          NUMERIC(14, 6) NOT NULL DEFAULT 0,
+    failed            BOOLEAN NOT NULL DEFAULT false,
+    latency_ms        INTEGER NOT NULL DEFAULT 0,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_llm_call_workspace ON llm_call (workspace_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS llm_usage_daily (
+    day               DATE NOT NULL,
+    workspace_id      TEXT NOT NULL DEFAULT '',
+    user_id           TEXT NOT NULL DEFAULT '',
+    purpose           TEXT NOT NULL,
+    provider          TEXT NOT NULL,
+    model             TEXT NOT NULL,
+    calls             INTEGER NOT NULL DEFAULT 0,
+    failed_calls      INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens     BIGINT NOT NULL DEFAULT 0,
+    completion_tokens BIGINT NOT NULL DEFAULT 0,
+    cost_usd          NUMERIC(14, 6) NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, workspace_id, user_id, purpose, provider, model)
+);
+
+CREATE INDEX IF NOT EXISTS idx_llm_usage_daily_workspace ON llm_usage_daily (workspace_id, day);
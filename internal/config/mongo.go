@@ -3,20 +3,22 @@ package config
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 var mongoClient *mongo.Client
 
-// NewMongoClient initializes and pings the MongoDB client.
-func NewMongoClient(ctx context.Context, cfg *Config) (*mongo.Client, error) {
-	clientOpts := options.Client().ApplyURI(cfg.MongoURI)
-
-	client, err := mongo.Connect(ctx, clientOpts)
+// NewMongoClient initializes and pings the MongoDB client. Every command is
+// traced; monitor, which may be nil, watches the connection pool.
+func NewMongoClient(ctx context.Context, cfg *Config, monitor *event.PoolMonitor) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, mongoClientOptions(cfg, monitor))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
@@ -30,26 +32,168 @@ func NewMongoClient(ctx context.Context, cfg *Config) (*mongo.Client, error) {
 	}
 
 	mongoClient = client
-	fmt.Println("✅ Connected to MongoDB successfully")
+	slog.Info("connected to MongoDB")
 	return client, nil
 }
 
+// mongoClientOptions returns the client options for cfg, with a span for
+// every command
+func mongoClientOptions(cfg *Config, monitor *event.PoolMonitor) *options.ClientOptions {
+	return options.Client().ApplyURI(cfg.MongoURI).
+		SetPoolMonitor(monitor).
+		SetMonitor(otelmongo.NewMonitor())
+}
+
 // EnsureIndexes creates necessary indexes for your collections.
-func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
-	userCol := db.Collection("users")
+func EnsureIndexes(ctx context.Context, db *mongo.Database, cfg *Config) error {
+	userCol := db.Collection(cfg.UserCol)
 
 	userIndexes := []mongo.IndexModel{
 		{
 			Keys:    bson.M{"email": 1},              // ascending index on email
 			Options: options.Index().SetUnique(true), // enforce unique email
 		},
+		{
+			Keys:    bson.M{"deletion.purge_after": 1}, // accounts due for purging
+			Options: options.Index().SetSparse(true),
+		},
 	}
 
 	if _, err := userCol.Indexes().CreateMany(ctx, userIndexes); err != nil {
 		return fmt.Errorf("failed to create user indexes: %w", err)
 	}
 
-	fmt.Println("✅ MongoDB indexes ensured successfully")
+	tokenCol := db.Collection(cfg.TokenCol)
+
+	tokenIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.M{"token_hash": 1}, // link lookup
+		},
+		{
+			Keys:    bson.M{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0), // Mongo purges expired tokens
+		},
+		{
+			Keys: bson.D{{Key: "email", Value: 1}, {Key: "purpose", Value: 1}, {Key: "created_at", Value: -1}},
+			// matches the case-insensitive per-email rate limit queries
+			Options: options.Index().SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+		},
+		{
+			Keys: bson.D{{Key: "request_ip", Value: 1}, {Key: "created_at", Value: -1}}, // per-IP rate limit
+		},
+	}
+
+	if _, err := tokenCol.Indexes().CreateMany(ctx, tokenIndexes); err != nil {
+		return fmt.Errorf("failed to create token indexes: %w", err)
+	}
+
+	memberCol := db.Collection(cfg.MemberCol)
+
+	memberIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "workspace_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true), // one membership per user per workspace
+		},
+		{
+			Keys: bson.M{"user_id": 1}, // list a user's workspaces
+		},
+	}
+
+	if _, err := memberCol.Indexes().CreateMany(ctx, memberIndexes); err != nil {
+		return fmt.Errorf("failed to create member indexes: %w", err)
+	}
+
+	projectCol := db.Collection(cfg.ProjectCol)
+
+	projectIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "created_at", Value: 1}}, // list a workspace's projects
+		},
+		{
+			Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "default", Value: 1}}, // one default project per workspace
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"default": true}),
+		},
+	}
+
+	if _, err := projectCol.Indexes().CreateMany(ctx, projectIndexes); err != nil {
+		return fmt.Errorf("failed to create project indexes: %w", err)
+	}
+
+	apiKeyCol := db.Collection(cfg.APIKeyCol)
+
+	apiKeyIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"hash": 1},
+			Options: options.Index().SetUnique(true), // lookup on every API-key request
+		},
+		{
+			Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "created_at", Value: -1}}, // list a workspace's keys
+		},
+	}
+
+	if _, err := apiKeyCol.Indexes().CreateMany(ctx, apiKeyIndexes); err != nil {
+		return fmt.Errorf("failed to create api key indexes: %w", err)
+	}
+
+	outboxCol := db.Collection(cfg.EmailOutboxCol)
+
+	outboxIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"idempotency_key": 1},
+			Options: options.Index().SetUnique(true), // queue each email once
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}, // sender polling
+		},
+		{
+			Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "created_at", Value: -1}}, // admin status queries
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}}, // operator dead-letter queries
+		},
+		{
+			Keys:    bson.M{"sent_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32((30 * 24 * time.Hour).Seconds())), // keep sent mail 30 days
+		},
+	}
+
+	if _, err := outboxCol.Indexes().CreateMany(ctx, outboxIndexes); err != nil {
+		return fmt.Errorf("failed to create email outbox indexes: %w", err)
+	}
+
+	auditCol := db.Collection(cfg.AuditCol)
+
+	auditIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "at", Value: -1}}, // admin queries by time range
+		},
+		{
+			Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "action", Value: 1}, {Key: "at", Value: -1}}, // ... and action
+		},
+		{
+			Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "at", Value: -1}},
+		},
+	}
+
+	if _, err := auditCol.Indexes().CreateMany(ctx, auditIndexes); err != nil {
+		return fmt.Errorf("failed to create audit indexes: %w", err)
+	}
+
+	rateLimitCol := db.Collection(cfg.RateLimitCol)
+
+	rateLimitIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0), // full buckets and past quota periods
+		},
+	}
+
+	if _, err := rateLimitCol.Indexes().CreateMany(ctx, rateLimitIndexes); err != nil {
+		return fmt.Errorf("failed to create rate limit indexes: %w", err)
+	}
+
+	slog.Info("MongoDB indexes ensured")
 	return nil
 }
 
@@ -67,7 +211,7 @@ func CloseMongo(ctx context.Context) error {
 		if err := mongoClient.Disconnect(ctx); err != nil {
 			return fmt.Errorf("failed to disconnect MongoDB: %w", err)
 		}
-		fmt.Println("🧹 MongoDB connection closed")
+		slog.Info("MongoDB connection closed")
 	}
 	return nil
 }
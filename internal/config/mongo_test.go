@@ -0,0 +1,75 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMongoCommandSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	monitor := mongoClientOptions(&Config{MongoURI: "mongodb://localhost:27017"}, nil).Monitor
+	if monitor == nil {
+		t.Fatal("client options have no command monitor")
+	}
+
+	find, err := bson.Marshal(bson.D{{Key: "find", Value: "users"}, {Key: "filter", Value: bson.D{{Key: "email", Value: "a@example.com"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: find, DatabaseName: "auth", CommandName: "find", RequestID: 1, ConnectionID: "c1"})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1, ConnectionID: "c1"}})
+
+	insert, err := bson.Marshal(bson.D{{Key: "insert", Value: "tokens"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: insert, DatabaseName: "auth", CommandName: "insert", RequestID: 2, ConnectionID: "c1"})
+	monitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "insert", RequestID: 2, ConnectionID: "c1"}, Failure: "E11000 duplicate key"})
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	tests := []struct {
+		name, collection string
+		status           codes.Code
+	}{
+		{"users.find", "users", codes.Unset},
+		{"tokens.insert", "tokens", codes.Error},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.Name != tt.name {
+			t.Errorf("span %d name %q, want %q", i, span.Name, tt.name)
+		}
+		if span.SpanKind != trace.SpanKindClient {
+			t.Errorf("%s: span kind %v, want client", tt.name, span.SpanKind)
+		}
+		if span.Status.Code != tt.status {
+			t.Errorf("%s: status %v, want %v", tt.name, span.Status.Code, tt.status)
+		}
+		attrs := map[attribute.Key]string{}
+		for _, kv := range span.Attributes {
+			attrs[kv.Key] = kv.Value.Emit()
+		}
+		// Attribute names follow OTEL_SEMCONV_STABILITY_OPT_IN: old or stable
+		if attrs["db.system"] != "mongodb" && attrs["db.system.name"] != "mongodb" {
+			t.Errorf("%s: no mongodb db.system attribute in %v", tt.name, attrs)
+		}
+		if attrs["db.mongodb.collection"] != tt.collection && attrs["db.collection.name"] != tt.collection {
+			t.Errorf("%s: no collection attribute %q in %v", tt.name, tt.collection, attrs)
+		}
+	}
+}
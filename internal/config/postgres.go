@@ -2,44 +2,63 @@ package config
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"time"
 
+	"auth-microservice/internal/tracing"
+
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var dbPool *pgxpool.Pool
 
+// ErrPostgresNotConnected is returned when the pool is used before ConnectToPostgres
+var ErrPostgresNotConnected = errors.New("PostgreSQL connection pool is not initialized")
+
 // ConnectToPostgres initializes the PostgreSQL connection pool
-func ConnectToPostgres(cfg *Config) {
+func ConnectToPostgres(cfg *Config) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var err error
-	dbPool, err = pgxpool.New(ctx, cfg.PostgresURL)
+	poolCfg, err := pgxpool.ParseConfig(cfg.PostgresURL)
 	if err != nil {
-		log.Fatalf("Unable to connect to database: %v", err)
+		return fmt.Errorf("invalid PostgreSQL URL: %w", err)
 	}
+	poolCfg.ConnConfig.Tracer = tracing.PgxTracer{}
 
-	if err = dbPool.Ping(ctx); err != nil {
-		log.Fatalf("Unable to ping database: %v", err)
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return fmt.Errorf("unable to connect to PostgreSQL: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return fmt.Errorf("unable to ping PostgreSQL: %w", err)
 	}
 
-	log.Println("✅ Connected to PostgreSQL database successfully")
+	dbPool = pool
+	slog.Info("connected to PostgreSQL")
+	return nil
 }
 
-// GetDB returns the global PostgreSQL pool
+// GetDB returns the global PostgreSQL pool, nil before ConnectToPostgres
 func GetDB() *pgxpool.Pool {
+	return dbPool
+}
+
+// PingPostgres checks that the pool can reach the database
+func PingPostgres(ctx context.Context) error {
 	if dbPool == nil {
-		log.Fatal("❌ Database connection pool is not initialized")
+		return ErrPostgresNotConnected
 	}
-	return dbPool
+	return dbPool.Ping(ctx)
 }
 
 // ClosePostgres safely closes the PostgreSQL pool
 func ClosePostgres() {
 	if dbPool != nil {
 		dbPool.Close()
-		log.Println("🧹 PostgreSQL connection closed")
+		slog.Info("PostgreSQL connection closed")
 	}
 }
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"auth-microservice/internal/middleware"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/service"
+)
+
+// DeleteAccount schedules the caller's account for deletion (DELETE /v1/me).
+// The account can be restored until the grace period ends and is then purged.
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	principal := middleware.PrincipalFromContext(r.Context())
+	deletion, err := h.account.RequestDeletion(r.Context(), principal.UserID)
+	if err != nil {
+		writeError(w, r, "failed to delete account", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"deletion": deletion,
+		"message":  "account scheduled for deletion; POST /v1/me/restore before purge_after to keep it",
+	})
+}
+
+// RestoreAccount cancels a pending account deletion
+func (h *Handler) RestoreAccount(w http.ResponseWriter, r *http.Request) {
+	principal := middleware.PrincipalFromContext(r.Context())
+	if err := h.account.CancelDeletion(r.Context(), principal.UserID); err != nil {
+		writeError(w, r, "failed to restore account", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "account restored"})
+}
+
+// ExportAccount streams a ZIP of the caller's data
+func (h *Handler) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	principal := middleware.PrincipalFromContext(r.Context())
+	filename := fmt.Sprintf("aeorank-export-%s.zip", time.Now().UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if err := h.account.Export(r.Context(), principal.UserID, w); err != nil {
+		// Headers may already be sent; the client gets a truncated archive
+		pkg.Logger(r.Context()).Warn("account export failed", "err", err)
+		if errors.Is(err, service.ErrUserNotFound) {
+			w.Header().Del("Content-Disposition")
+			middleware.WriteError(w, r, err)
+		}
+	}
+}
+
+// ChangeEmail emails a confirmation link to a new address for the caller's
+// account. The address only changes once the link is confirmed.
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	principal := middleware.PrincipalFromContext(r.Context())
+	if err := h.account.RequestEmailChange(r.Context(), principal.UserID, req.Email, r.Header.Get("Accept-Language")); err != nil {
+		writeError(w, r, "failed to request email change", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "confirmation link sent to the new address"})
+}
+
+// ConfirmEmailChange applies an email change with the token from the
+// confirmation link. Every session of the account is signed out.
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token" validate:"required"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.account.ConfirmEmailChange(r.Context(), req.Token); err != nil {
+		writeError(w, r, "failed to change email", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "email changed; sign in with the new address"})
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"auth-microservice/internal/middleware"
+	"auth-microservice/internal/service"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// CreateAPIKey mints a key for the active workspace and returns it once
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name          string   `json:"name" validate:"required,max=100"`
+		ScopeType     string   `json:"scope_type" validate:"required,oneof=user workspace"`
+		Role          string   `json:"role,omitempty"`
+		Scopes        []string `json:"scopes,omitempty"`
+		ExpiresInDays int      `json:"expires_in_days,omitempty" validate:"gte=0,lte=3650"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	key, rec, err := h.keys.Create(r.Context(), middleware.PrincipalFromContext(r.Context()), service.CreateAPIKeyInput{
+		Name:      req.Name,
+		ScopeType: req.ScopeType,
+		Role:      req.Role,
+		Scopes:    req.Scopes,
+		ExpiresIn: time.Duration(req.ExpiresInDays) * 24 * time.Hour,
+	})
+	if err != nil {
+		writeError(w, r, "failed to create api key", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "store this key now; it will not be shown again",
+		"key":     key,
+		"api_key": rec,
+	})
+}
+
+// ListAPIKeys returns the keys the caller may manage in the active workspace
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.keys.List(r.Context(), middleware.PrincipalFromContext(r.Context()))
+	if err != nil {
+		writeError(w, r, "failed to list api keys", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(keys)
+}
+
+// RevokeAPIKey disables a key
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.keys.Revoke(r.Context(), middleware.PrincipalFromContext(r.Context()), id); err != nil {
+		writeError(w, r, "failed to revoke api key", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "api key revoked"})
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-microservice/internal/middleware"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/service"
+)
+
+// AuditLog returns the active workspace's audit events, newest first.
+// Query: from, to (RFC 3339), action (comma-separated), limit.
+// With format=csv or format=ndjson every matching event is downloaded instead,
+// oldest first.
+func (h *Handler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	principal := middleware.PrincipalFromContext(r.Context())
+	q := r.URL.Query()
+	query := service.AuditQuery{From: q.Get("from"), To: q.Get("to"), Actions: q.Get("action")}
+
+	if format := q.Get("format"); format != "" && format != "json" {
+		contentType := "text/csv"
+		if format == service.AuditFormatNDJSON {
+			contentType = "application/x-ndjson"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.%s"`, time.Now().UTC().Format("2006-01-02"), format))
+
+		if err := h.audit.Export(r.Context(), principal.WorkspaceID, query, format, w); err != nil {
+			// Filter errors happen before anything is written; later ones truncate the file
+			pkg.Logger(r.Context()).Warn("audit export failed", "workspace_id", principal.WorkspaceID, "err", err)
+			w.Header().Del("Content-Disposition")
+			writeError(w, r, "failed to export audit events", err)
+		}
+		return
+	}
+
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			badRequest(w, r, "limit must be a positive number")
+			return
+		}
+		query.Limit = n
+	}
+
+	events, err := h.audit.List(r.Context(), principal.WorkspaceID, query)
+	if err != nil {
+		writeError(w, r, "failed to list audit events", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"events": events})
+}
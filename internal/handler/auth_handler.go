@@ -8,10 +8,13 @@ import (
 	"net/url"
 	"time"
 
+	"auth-microservice/internal/apperr"
 	"auth-microservice/internal/auth"
 	"auth-microservice/internal/config"
 	"auth-microservice/internal/middleware"
 	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/ratelimit"
+	"auth-microservice/internal/repository"
 	"auth-microservice/internal/service"
 
 	"github.com/go-playground/validator/v10"
@@ -24,63 +27,200 @@ type Handler struct {
 	svc      *service.AuthService
 	usvc     *service.UserService
 	p        *service.PromptService
+	wsvc     *service.WorkspaceService
+	proj     *service.ProjectService
+	keys     *service.APIKeyService
+	mfa      *service.MFAService
+	emails   *service.EmailOutboxService
+	account  *service.AccountService
+	audit    *service.AuditService
+	sessions *service.SessionService
+	ops      *service.OperatorService
+	quota    *service.QuotaService
+	llmUsage *service.LLMUsageService
+	limiter  *ratelimit.Limiter
 	validate *validator.Validate
 	cfg      *config.Config
 }
 
-func NewHandler(svc *service.AuthService, usvc *service.UserService, cfg *config.Config, p *service.PromptService) *Handler {
+func NewHandler(svc *service.AuthService, usvc *service.UserService, cfg *config.Config, p *service.PromptService, wsvc *service.WorkspaceService, proj *service.ProjectService, keys *service.APIKeyService, mfa *service.MFAService, emails *service.EmailOutboxService, account *service.AccountService, audit *service.AuditService, sessions *service.SessionService, ops *service.OperatorService, quota *service.QuotaService, llmUsage *service.LLMUsageService, limiter *ratelimit.Limiter) *Handler {
 	validate := validator.New()
+	validate.RegisterTagNameFunc(jsonFieldName)
 	return &Handler{
 		svc:      svc,
 		p:        p,
 		usvc:     usvc,
+		wsvc:     wsvc,
+		proj:     proj,
+		keys:     keys,
+		mfa:      mfa,
+		emails:   emails,
+		account:  account,
+		audit:    audit,
+		sessions: sessions,
+		ops:      ops,
+		quota:    quota,
+		llmUsage: llmUsage,
+		limiter:  limiter,
 		validate: validate,
 		cfg:      cfg,
 	}
 }
 
+// route declares a method and /v1 path pattern, the permission it requires
+// and its handler. Public routes skip authentication; an empty perm only
+// requires a valid token. Session-only routes refuse API keys and need a JWT
+// from an interactive login; mfaEnroll routes are session-only but also accept
+// an mfa_enroll token. System routes are for platform operators; perm is then
+// a system permission.
+// legacy is the route's pre-/v1 path, still served but deprecated; legacyID
+// names the query parameter or body field it took the {id} path value from,
+// and legacyMethod the verb it took when that differs from method.
+type route struct {
+	method       string
+	path         string
+	legacy       string
+	legacyID     string
+	legacyMethod string
+	public       bool
+	sessionOnly  bool
+	mfaEnroll    bool
+	system       bool
+	perm         auth.Permission
+	handler      http.HandlerFunc
+}
+
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	// Public routes
-	mux.HandleFunc("/send-verify", h.SendVerify) // accepts email, base_url optional
-	mux.HandleFunc("/verify", h.Verify)          // GET ?token=...
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("ok"))
-	})
-	//oAuth Routes
-	mux.HandleFunc("/oauth/google", h.GoogleOAuthRedirect)
-	mux.HandleFunc("/oauth/google/callback", h.GoogleOAuthCallback)
-	// Authenticated routes (requires JWT)
-	mux.Handle("/me", middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.Me)))
-	//Onbaoridng
-	mux.Handle("/user/brand",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.AddBrandDetails))) //Add Brand details
-	mux.Handle("/competitor/generate",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.GetCompetitorSuggestions))) //generate competitor sugg
-	mux.Handle("/prompts/generate",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.GetPromptSuggestions))) // generate prompts sugg
-	mux.Handle("/prompts/analysis",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.HandlePromptsEntry))) // store prompt & analyse them
-	// Competitor page
-	mux.Handle("/user/getcompetitor",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.GetCompetitor))) //get competitor
-	mux.Handle("/user/competitor",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.AddCompetitor))) //Add competitor
-	//prompts page
-	mux.Handle("/prompt/meta/get",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.GetPromptMeta))) // get promptmeta
-	mux.Handle("/analyse/brand/prompt/get",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.GetBrandOverviewByPrompt))) //get brand per prompt
-	mux.Handle("/analyse/domain/prompt/get",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.GetDomainOverviewByPrompt))) //get domain per prompt
-	mux.Handle("/prompt/add",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.AddPrompt))) //Add prompt
-	//Overview
-	mux.Handle("/analyse/brand/get",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.GetBrandOverview))) // get brands
-	mux.Handle("/analyse/domain/get",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.GetDomainAnalysis))) // get domain //TODO:Unique Domain might be
-	mux.Handle("/prompts/get",
-		middleware.JWTAuth(h.cfg.AccessSecret, http.HandlerFunc(h.GetPromptResponses))) // get promptResponse
+	routes := []route{
+		// Public routes
+		{method: http.MethodPost, path: "/v1/auth/magic-link", legacy: "/send-verify", public: true, handler: h.SendVerify},  // accepts email, base_url optional
+		{method: http.MethodGet, path: "/v1/auth/verify", legacy: "/verify", public: true, handler: h.CheckVerifyToken},      // ?token=... checks without using it
+		{method: http.MethodPost, path: "/v1/auth/verify", legacy: "/verify", public: true, handler: h.Verify},               // {token} signs in
+		{method: http.MethodPost, path: "/v1/auth/verify-code", legacy: "/verify-code", public: true, handler: h.VerifyCode}, // {email, code}
+		//oAuth Routes
+		{method: http.MethodGet, path: "/v1/oauth/google", legacy: "/oauth/google", public: true, handler: h.GoogleOAuthRedirect},
+		{method: http.MethodGet, path: "/v1/oauth/google/callback", legacy: "/oauth/google/callback", public: true, handler: h.GoogleOAuthCallback},
+		{method: http.MethodPost, path: "/v1/auth/mfa/verify", legacy: "/auth/mfa/verify", public: true, handler: h.MFAVerify},      // exchange mfa_pending token + code
+		{method: http.MethodPost, path: "/v1/email/confirm", legacy: "/email/confirm", public: true, handler: h.ConfirmEmailChange}, // {token} from the email change link
+
+		// Authenticated routes (JWT or API key)
+		{method: http.MethodGet, path: "/v1/me", legacy: "/me", handler: h.Me},
+		{method: http.MethodDelete, path: "/v1/me", legacy: "/me", sessionOnly: true, handler: h.DeleteAccount},                // schedules account deletion
+		{method: http.MethodPost, path: "/v1/me/restore", legacy: "/me/restore", sessionOnly: true, handler: h.RestoreAccount}, // cancel a pending deletion
+		{method: http.MethodGet, path: "/v1/me/export", legacy: "/me/export", sessionOnly: true, handler: h.ExportAccount},     // ZIP of the caller's data
+		{method: http.MethodPost, path: "/v1/me/email", legacy: "/me/email", sessionOnly: true, handler: h.ChangeEmail},        // {email}, confirmed by link
+		{method: http.MethodGet, path: "/v1/usage", handler: h.Usage},                                                          // plan quotas used and remaining
+		//Onbaoridng
+		{method: http.MethodPut, path: "/v1/brand", legacy: "/user/brand", legacyMethod: http.MethodPost, perm: auth.PermProjectsWrite, handler: h.AddBrandDetails},          //Add Brand details
+		{method: http.MethodPost, path: "/v1/competitors/suggestions", legacy: "/competitor/generate", perm: auth.PermCompetitorsWrite, handler: h.GetCompetitorSuggestions}, //generate competitor sugg
+		{method: http.MethodPost, path: "/v1/prompts/suggestions", legacy: "/prompts/generate", perm: auth.PermPromptsWrite, handler: h.GetPromptSuggestions},                // generate prompts sugg
+		{method: http.MethodPost, path: "/v1/prompts/batch", legacy: "/prompts/analysis", perm: auth.PermPromptsWrite, handler: h.HandlePromptsEntry},                        // store prompt & analyse them
+		// Competitor page
+		{method: http.MethodGet, path: "/v1/competitors", legacy: "/user/getcompetitor", perm: auth.PermCompetitorsRead, handler: h.GetCompetitor}, //get competitor
+		{method: http.MethodPost, path: "/v1/competitors", legacy: "/user/competitor", perm: auth.PermCompetitorsWrite, handler: h.AddCompetitor},  //Add competitor
+		{method: http.MethodDelete, path: "/v1/competitors/{id}", perm: auth.PermCompetitorsWrite, handler: h.DeleteCompetitor},                    // id is the competitor's domain
+		//prompts page
+		{method: http.MethodGet, path: "/v1/prompts/meta", legacy: "/prompt/meta/get", perm: auth.PermReportsRead, handler: h.GetPromptMeta},                                                      // get promptmeta
+		{method: http.MethodGet, path: "/v1/prompts/{id}/brands", legacy: "/analyse/brand/prompt/get", legacyID: "prompt_id", perm: auth.PermReportsRead, handler: h.GetBrandOverviewByPrompt},    //get brand per prompt
+		{method: http.MethodGet, path: "/v1/prompts/{id}/domains", legacy: "/analyse/domain/prompt/get", legacyID: "prompt_id", perm: auth.PermReportsRead, handler: h.GetDomainOverviewByPrompt}, //get domain per prompt
+		{method: http.MethodPost, path: "/v1/prompts", legacy: "/prompt/add", perm: auth.PermPromptsWrite, handler: h.AddPrompt},                                                                  //Add prompt
+		//Overview
+		{method: http.MethodGet, path: "/v1/brands", legacy: "/analyse/brand/get", perm: auth.PermReportsRead, handler: h.GetBrandOverview},    // get brands
+		{method: http.MethodGet, path: "/v1/domains", legacy: "/analyse/domain/get", perm: auth.PermReportsRead, handler: h.GetDomainAnalysis}, // get domain //TODO:Unique Domain might be
+		{method: http.MethodGet, path: "/v1/prompts", legacy: "/prompts/get", perm: auth.PermReportsRead, handler: h.GetPromptResponses},       // get promptResponse
+		//Workspaces (any signed-in user, across workspaces)
+		{method: http.MethodGet, path: "/v1/workspaces", legacy: "/workspaces", sessionOnly: true, handler: h.ListWorkspaces},
+		{method: http.MethodPost, path: "/v1/workspaces", legacy: "/workspaces", sessionOnly: true, handler: h.CreateWorkspace},
+		{method: http.MethodPost, path: "/v1/workspaces/{id}/switch", legacy: "/workspaces/switch", legacyID: "workspace_id", sessionOnly: true, handler: h.SwitchWorkspace}, // re-issue token for another workspace
+		{method: http.MethodPost, path: "/v1/invites/accept", legacy: "/workspace/invite/accept", sessionOnly: true, handler: h.AcceptInvite},                                // accept invitation token
+		//Members of the active workspace
+		{method: http.MethodGet, path: "/v1/workspace/members", legacy: "/workspace/members", perm: auth.PermMembersRead, handler: h.ListMembers},                                                                       // list members
+		{method: http.MethodPost, path: "/v1/workspace/members", legacy: "/workspace/members/invite", perm: auth.PermAdminMembers, handler: h.InviteMember},                                                             // invite by email
+		{method: http.MethodPatch, path: "/v1/workspace/members/{id}", legacy: "/workspace/members/role", legacyID: "user_id", legacyMethod: http.MethodPost, perm: auth.PermAdminMembers, handler: h.UpdateMemberRole}, // change a member's role
+		{method: http.MethodDelete, path: "/v1/workspace/members/{id}", legacy: "/workspace/members/remove", legacyID: "user_id", legacyMethod: http.MethodPost, perm: auth.PermAdminMembers, handler: h.RemoveMember},  // remove a member
+		{method: http.MethodGet, path: "/v1/workspace/emails", legacy: "/workspace/emails", perm: auth.PermAdminEmails, handler: h.ListWorkspaceEmails},                                                                 // email delivery status
+		{method: http.MethodGet, path: "/v1/workspace/audit", legacy: "/workspace/audit", perm: auth.PermAdminAudit, handler: h.AuditLog},                                                                               // query or export audit events
+		{method: http.MethodGet, path: "/v1/workspace/llm-usage", perm: auth.PermAdminBilling, handler: h.LLMSpend},                                                                                                     // ?days= tokens and cost
+		//Projects (data routes above take ?project_id=, defaulting to the workspace's first project)
+		{method: http.MethodGet, path: "/v1/projects", legacy: "/projects", perm: auth.PermProjectsRead, handler: h.ListProjects},           // list projects
+		{method: http.MethodPost, path: "/v1/projects", legacy: "/projects/create", perm: auth.PermProjectsWrite, handler: h.CreateProject}, // create project
+		//Two-factor authentication
+		{method: http.MethodPost, path: "/v1/auth/mfa/setup", legacy: "/auth/mfa/setup", mfaEnroll: true, handler: h.MFASetup},                                                                    // new TOTP secret + otpauth URI
+		{method: http.MethodPost, path: "/v1/auth/mfa/enable", legacy: "/auth/mfa/enable", mfaEnroll: true, handler: h.MFAEnable},                                                                 // confirm with a code, get recovery codes
+		{method: http.MethodPost, path: "/v1/auth/mfa/disable", legacy: "/auth/mfa/disable", sessionOnly: true, handler: h.MFADisable},                                                            // turn MFA off
+		{method: http.MethodPost, path: "/v1/auth/mfa/recovery-codes", legacy: "/auth/mfa/recovery-codes", sessionOnly: true, handler: h.MFARecoveryCodes},                                        // replace recovery codes
+		{method: http.MethodPut, path: "/v1/workspace/mfa", legacy: "/workspace/mfa", legacyMethod: http.MethodPost, sessionOnly: true, perm: auth.PermAdminSecurity, handler: h.SetWorkspaceMFA}, // require MFA for members
+		//API keys (managed from an interactive session only)
+		{method: http.MethodGet, path: "/v1/api-keys", legacy: "/api-keys", sessionOnly: true, handler: h.ListAPIKeys},                                                                // list keys
+		{method: http.MethodPost, path: "/v1/api-keys", legacy: "/api-keys/create", sessionOnly: true, handler: h.CreateAPIKey},                                                       // mint key, shown once
+		{method: http.MethodDelete, path: "/v1/api-keys/{id}", legacy: "/api-keys/revoke", legacyID: "id", legacyMethod: http.MethodPost, sessionOnly: true, handler: h.RevokeAPIKey}, // revoke key
+		//Platform operators (sys_role claim, MFA required)
+		{method: http.MethodGet, path: "/v1/admin/users", legacy: "/admin/users", system: true, perm: auth.PermSystemUsers, handler: h.AdminSearchUsers},                                                                  // ?q=&limit=&offset=
+		{method: http.MethodGet, path: "/v1/admin/users/{id}", legacy: "/admin/users/get", legacyID: "id", system: true, perm: auth.PermSystemUsers, handler: h.AdminGetUser},                                             // profile, workspaces, projects
+		{method: http.MethodGet, path: "/v1/admin/users/{id}/prompts", legacy: "/admin/users/prompts", legacyID: "id", system: true, perm: auth.PermSystemUsers, handler: h.AdminUserPrompts},                             // prompt history
+		{method: http.MethodPost, path: "/v1/admin/users/{id}/verify", legacy: "/admin/users/verify", legacyID: "user_id", system: true, perm: auth.PermSystemAccounts, handler: h.AdminVerifyUser},                       // force-verify email
+		{method: http.MethodPost, path: "/v1/admin/users/{id}/disable", legacy: "/admin/users/disable", legacyID: "user_id", system: true, perm: auth.PermSystemAccounts, handler: h.AdminDisableUser},                    // disable or re-enable
+		{method: http.MethodPost, path: "/v1/admin/users/{id}/revoke-sessions", legacy: "/admin/users/revoke-sessions", legacyID: "user_id", system: true, perm: auth.PermSystemAccounts, handler: h.AdminRevokeSessions}, // log out everywhere
+		{method: http.MethodPost, path: "/v1/admin/users/{id}/reanalyse", legacy: "/admin/users/reanalyse", legacyID: "user_id", system: true, perm: auth.PermSystemAnalyses, handler: h.AdminReanalyse},                  // re-run analyses
+		{method: http.MethodPost, path: "/v1/admin/users/{id}/impersonate", legacy: "/admin/users/impersonate", legacyID: "user_id", system: true, perm: auth.PermSystemImpersonate, handler: h.AdminImpersonate},         // read-only token as the user
+		{method: http.MethodPut, path: "/v1/admin/workspaces/{id}/plan", system: true, perm: auth.PermSystemAccounts, handler: h.AdminSetWorkspacePlan},                                                                   // {plan}
+		{method: http.MethodPut, path: "/v1/admin/workspaces/{id}/llm-budget", system: true, perm: auth.PermSystemAccounts, handler: h.AdminSetWorkspaceBudget},                                                           // {monthly_usd}, null for the default
+		{method: http.MethodGet, path: "/v1/admin/llm-usage", system: true, perm: auth.PermSystemStats, handler: h.AdminLLMUsage},                                                                                         // ?days= spend across workspaces
+		{method: http.MethodGet, path: "/v1/admin/emails", system: true, perm: auth.PermSystemEmails, handler: h.AdminListEmails},                                                                                         // ?status=&to=&workspace= delivery status and dead letters
+		{method: http.MethodGet, path: "/v1/admin/stats", legacy: "/admin/stats", system: true, perm: auth.PermSystemStats, handler: h.AdminStats},                                                                        // ?days= system stats
+	}
+
+	for _, rt := range routes {
+		next := h.protect(rt)
+		mux.Handle(rt.method+" "+rt.path, next)
+		if rt.legacy != "" {
+			mux.Handle(rt.legacyRoute(), deprecated(rt.path, rt.legacyID, next))
+		}
+	}
+}
+
+// legacyRoute is the mux pattern of the route's deprecated path
+func (rt route) legacyRoute() string {
+	method := rt.legacyMethod
+	if method == "" {
+		method = rt.method
+	}
+	return method + " " + rt.legacy
+}
+
+// protect wraps a route's handler with the per-IP rate limit, authentication,
+// the per-user rate limit and its permission check
+func (h *Handler) protect(rt route) http.Handler {
+	ipLimit := ratelimit.PerMinute(h.cfg.RateLimitIPBurst, h.cfg.RateLimitIPPerMinute)
+	return middleware.RateLimit(h.limiter, ipLimit, middleware.ByIP, h.authenticate(rt))
+}
+
+func (h *Handler) authenticate(rt route) http.Handler {
+	if rt.public {
+		return rt.handler
+	}
+	userLimit := ratelimit.PerMinute(h.cfg.RateLimitUserBurst, h.cfg.RateLimitUserPerMinute)
+	if rt.system {
+		return middleware.JWTAuth(h.cfg.AccessSecret, h.sessions,
+			middleware.RateLimit(h.limiter, userLimit, middleware.ByPrincipal, middleware.RequireSystemPermission(rt.perm, rt.handler)))
+	}
+	// Impersonation tokens may only read, never use the user's own account
+	// routes, and each request they make is logged
+	var next http.Handler = middleware.ReadOnly(h.audit, rt.handler)
+	if rt.sessionOnly {
+		next = middleware.NoImpersonation(h.audit, rt.handler)
+	}
+	if rt.perm != "" {
+		next = middleware.RequirePermission(rt.perm, next)
+	}
+	next = middleware.RateLimit(h.limiter, userLimit, middleware.ByPrincipal, next)
+	if rt.mfaEnroll {
+		return middleware.MFAEnrollAuth(h.cfg.AccessSecret, h.sessions, next)
+	}
+	if rt.sessionOnly {
+		return middleware.JWTAuth(h.cfg.AccessSecret, h.sessions, next)
+	}
+	return middleware.Authenticate(h.cfg.AccessSecret, h.sessions, h.keys, next)
 }
 
 type UserProfile struct {
@@ -101,113 +241,179 @@ type UserProfile struct {
 // --- handlers ---
 
 func (h *Handler) SendVerify(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "use POST", http.StatusMethodNotAllowed)
-		return
-	}
 	var body struct {
-		Email   string `json:"email" validate:"required,email"`
-		BaseURL string `json:"baseURL" validate:"required"`
+		Email    string `json:"email" validate:"required,email"`
+		BaseURL  string `json:"baseURL" validate:"omitempty,url"` // must be an allowed base; defaults to the first
+		WithCode bool   `json:"with_code"`                        // also email a 6-digit code for /v1/auth/verify-code
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	if !h.decodeJSON(w, r, &body) {
 		return
 	}
-	if err := h.validate.Struct(&body); err != nil {
-		http.Error(w, "validation: "+err.Error(), http.StatusBadRequest)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	err := h.svc.SendEmailVerification(ctx, body.Email, body.BaseURL, middleware.ClientIP(r, h.cfg.TrustedProxyHops), r.Header.Get("Accept-Language"), body.WithCode)
+	if err != nil {
+		writeError(w, r, "failed to send verification email", err)
 		return
 	}
-	base := body.BaseURL
-	if base == "" {
-		base = fmt.Sprintf("http://%s", r.Host)
+	// The link is only delivered by email; returning it would let anyone sign in as any address
+	json.NewEncoder(w).Encode(map[string]string{"message": "verification email sent"})
+}
+
+// CheckVerifyToken checks a magic link token without using it, so email
+// scanners that pre-fetch links cannot burn it
+func (h *Handler) CheckVerifyToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		badRequest(w, r, "missing token")
+		return
 	}
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
-	verifyURL, err := h.svc.SendEmailVerification(ctx, body.Email, base)
+
+	rec, err := h.svc.CheckEmailToken(ctx, token)
 	if err != nil {
-		http.Error(w, "error: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to check token", err)
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]string{"verify_url": verifyURL})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":   true,
+		"email":   rec.Email,
+		"message": "POST the token to /v1/auth/verify to sign in",
+	})
 }
 
+// Verify signs the user in with a magic link token
 func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if r.Method != http.MethodGet {
-		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var body struct {
+		Token string `json:"token" validate:"required"`
+	}
+	if !h.decodeJSON(w, r, &body) {
 		return
 	}
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		http.Error(w, `{"error": "missing token"}`, http.StatusBadRequest)
+	rec, err := h.svc.VerifyEmailToken(ctx, body.Token)
+	if err != nil {
+		writeError(w, r, "failed to verify token", err)
+		return
+	}
+	h.signIn(ctx, w, r, rec.Email)
+}
+
+// VerifyCode signs the user in with the 6-digit code from their sign-in email
+func (h *Handler) VerifyCode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		Email string `json:"email" validate:"required,email"`
+		Code  string `json:"code" validate:"required,len=6,numeric"`
+	}
+	if !h.decodeJSON(w, r, &body) {
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	rec, err := h.svc.VerifyEmailToken(ctx, token)
+	rec, err := h.svc.VerifyLoginCode(ctx, body.Email, body.Code)
 	if err != nil {
-		http.Error(w, `{"error": "invalid or expired token"}`, http.StatusBadRequest)
+		writeError(w, r, "failed to verify code", err)
 		return
 	}
 
-	user, err := h.svc.GetUserByEmail(ctx, rec.Email)
+	h.signIn(ctx, w, r, rec.Email)
+}
+
+// signIn finishes a passwordless sign-in for a verified email, creating the
+// user on first sign-in
+func (h *Handler) signIn(ctx context.Context, w http.ResponseWriter, r *http.Request, email string) {
+	user, err := h.svc.GetUserByEmail(ctx, email)
 	if err != nil {
-		http.Error(w, `{"error": "error fetching user"}`, http.StatusInternalServerError)
+		writeError(w, r, "failed to fetch user", err)
 		return
 	}
 
 	if user == nil {
 		// New user → signup
-		user, err = h.svc.SignupUser(ctx, rec.Email)
+		user, err = h.svc.SignupUser(ctx, email)
 		if err != nil {
-			http.Error(w, `{"error": "failed to signup user"}`, http.StatusInternalServerError)
+			writeError(w, r, "failed to sign up user", err)
 			return
 		}
 	}
 
-	accessToken, err := auth.GenerateAccessToken(h.cfg.AccessSecret, user.Email, user.ID.Hex(), 24*time.Hour)
+	ws, member, err := h.wsvc.ResolveActive(ctx, user)
 	if err != nil {
-		http.Error(w, `{"error": "failed to generate access token"}`, http.StatusInternalServerError)
+		writeError(w, r, "failed to resolve workspace", err)
 		return
 	}
 
-	// Determine action based on whether the user has a brand
+	accessToken, step, err := h.svc.SignIn(ctx, user, ws, member)
+	if err != nil {
+		writeError(w, r, "failed to generate access token", err)
+		return
+	}
+	if step != "" {
+		// Second factor still needed; the client continues at /auth/mfa/*
+		json.NewEncoder(w).Encode(map[string]string{
+			"email":        email,
+			"mfa_token":    accessToken,
+			"workspace_id": ws.ID.Hex(),
+			"action":       step,
+			"message":      "two-factor authentication required",
+		})
+		return
+	}
+
+	h.writeLogin(ctx, w, r, email, accessToken, ws)
+}
+
+// writeLogin writes the sign-in response for an access token
+func (h *Handler) writeLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, email, accessToken string, ws *repository.Workspace) {
+	project, err := h.proj.Default(ctx, ws)
+	if err != nil {
+		writeError(w, r, "failed to resolve project", err)
+		return
+	}
+
+	// Determine action based on whether the default project has a brand
 	action := "signup"
-	if user.BrandName != "" { // single brand string
+	if project.BrandName != "" { // single brand string
 		action = "login"
 	}
 
 	json.NewEncoder(w).Encode(map[string]string{
-		"email":        rec.Email,
+		"email":        email,
 		"access_token": accessToken,
+		"workspace_id": ws.ID.Hex(),
+		"project_id":   project.ID.Hex(),
 		"action":       action,
 		"message":      "Welcome to AEORANK",
 	})
 }
 
 func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "use GET", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Extract email from context (set by JWT middleware)
-	email, ok := pkg.GetEmailFromContext(r.Context())
+	// Extract user ID from context (set by JWT middleware)
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "email not found in context", http.StatusUnauthorized)
+		middleware.WriteError(w, r, errMissingUser)
 		return
 	}
 
 	// Fetch full user details
-	user, err := h.svc.GetUserByEmail(r.Context(), email)
+	user, err := h.svc.GetUserByID(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "failed to fetch user: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to fetch user", err)
 		return
 	}
 	if user == nil {
-		http.Error(w, "user not found", http.StatusNotFound)
+		middleware.WriteError(w, r, service.ErrUserNotFound)
 		return
 	}
 
@@ -230,7 +436,7 @@ func (h *Handler) GoogleOAuthRedirect(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GoogleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 	code := r.URL.Query().Get("code")
 	if code == "" {
-		http.Error(w, "missing code", http.StatusBadRequest)
+		badRequest(w, r, "missing code")
 		return
 	}
 
@@ -245,7 +451,7 @@ func (h *Handler) GoogleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 	// Exchange code for token
 	token, err := conf.Exchange(context.Background(), code)
 	if err != nil {
-		http.Error(w, "code exchange failed: "+err.Error(), http.StatusInternalServerError)
+		middleware.WriteError(w, r, apperr.Wrap(apperr.Upstream, "oauth_failed", "Google sign-in failed", fmt.Errorf("code exchange failed: %w", err)))
 		return
 	}
 
@@ -253,7 +459,7 @@ func (h *Handler) GoogleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 	client := conf.Client(context.Background(), token)
 	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
 	if err != nil {
-		http.Error(w, "fetch user info failed: "+err.Error(), http.StatusInternalServerError)
+		middleware.WriteError(w, r, apperr.Wrap(apperr.Upstream, "oauth_failed", "Google sign-in failed", fmt.Errorf("fetch user info failed: %w", err)))
 		return
 	}
 	defer resp.Body.Close()
@@ -264,43 +470,60 @@ func (h *Handler) GoogleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 		Name  string `json:"name"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&gUser); err != nil {
-		http.Error(w, "decode user info failed: "+err.Error(), http.StatusInternalServerError)
+		middleware.WriteError(w, r, apperr.Wrap(apperr.Upstream, "oauth_failed", "Google sign-in failed", fmt.Errorf("decode user info failed: %w", err)))
 		return
 	}
 
 	ctx := r.Context()
+	h.svc.RecordOAuthLogin(ctx, gUser.Email, "google")
 
 	// Check if user exists or create new
 	user, err := h.svc.GetUserByEmail(ctx, gUser.Email)
 	if err != nil {
-		http.Error(w, "error fetching user", http.StatusInternalServerError)
+		writeError(w, r, "failed to fetch user", err)
 		return
 	}
-
-	var action string
-	switch {
-	case user == nil:
+	if user == nil {
 		// New OAuth user → signup
 		user, err = h.svc.SignupOAuthUser(ctx, gUser.Email, "google", gUser.ID)
 		if err != nil {
-			http.Error(w, "failed to signup oauth user", http.StatusInternalServerError)
+			writeError(w, r, "failed to sign up oauth user", err)
 			return
 		}
-		action = "oauth_signup"
-		fmt.Println(user.BrandName, "not found")
-	case user.BrandName == "":
-		// Existing user but not onboarded yet
-		action = "oauth_signup"
+	}
 
-	default:
-		// Fully onboarded user
-		action = "oauth_login"
+	ws, member, err := h.wsvc.ResolveActive(ctx, user)
+	if err != nil {
+		writeError(w, r, "failed to resolve workspace", err)
+		return
+	}
+
+	project, err := h.proj.Default(ctx, ws)
+	if err != nil {
+		writeError(w, r, "failed to resolve project", err)
+		return
 	}
-	fmt.Println(action)
+
+	action := "oauth_login"
+	if project.BrandName == "" {
+		// New user, or existing user whose project is not onboarded yet
+		action = "oauth_signup"
+	}
+	pkg.Logger(ctx).Info("google sign-in", "action", action, "user_id", user.ID.Hex())
 	// Generate AEORANK JWT
-	accessToken, err := auth.GenerateAccessToken(h.cfg.AccessSecret, user.Email, user.ID.Hex(), 24*time.Hour)
+	accessToken, step, err := h.svc.SignIn(ctx, user, ws, member)
 	if err != nil {
-		http.Error(w, "token gen failed", http.StatusInternalServerError)
+		writeError(w, r, "token gen failed", err)
+		return
+	}
+	if step != "" {
+		// Second factor still needed; the frontend continues at /auth/mfa/*
+		http.Redirect(w, r, fmt.Sprintf("%s/oauth/callback?mfa_token=%s&email=%s&action=%s",
+			h.cfg.FrontendURL,
+			url.QueryEscape(accessToken),
+			url.QueryEscape(user.Email),
+			url.QueryEscape(step),
+		), http.StatusTemporaryRedirect)
 		return
 	}
 	// Final response
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/ratelimit"
+)
+
+// TestAccountRoutesRefuseAPIKeys checks the routes acting on the caller's own
+// account only take interactive sessions. The handler has no services, so a
+// key that got past authentication would panic rather than pass.
+func TestAccountRoutesRefuseAPIKeys(t *testing.T) {
+	mux := http.NewServeMux()
+	h := &Handler{cfg: &config.Config{RateLimitIPBurst: 100, RateLimitIPPerMinute: 100}, limiter: ratelimit.New(ratelimit.NewMemoryStore())}
+	h.RegisterRoutes(mux)
+
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodDelete, "/v1/me"},
+		{http.MethodDelete, "/me"},
+		{http.MethodPost, "/v1/me/restore"},
+		{http.MethodGet, "/v1/me/export"},
+		{http.MethodPost, "/v1/me/email"},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer aeo_00000000_secret")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s with an API key: status %d, want %d", tt.method, tt.path, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
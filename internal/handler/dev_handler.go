@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/mailer"
+	"auth-microservice/internal/middleware"
+	"encoding/json"
+	"net/http"
+)
+
+// OutboxHandler lists email captured by the outbox transport (GET ?to=) or
+// clears it (DELETE). It is only mounted in development with
+// MAIL_TRANSPORT=outbox.
+func OutboxHandler(outbox *mailer.Outbox) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(outbox.Messages(r.URL.Query().Get("to")))
+		case http.MethodDelete:
+			outbox.Clear()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// EmailPreviewHandler renders an email template with sample data, in
+// development only. GET ?template=verify_email&locale=es&format=html|text|json;
+// without a template it lists the available templates and locales.
+func EmailPreviewHandler(tpl *mailer.Templates) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		name := q.Get("template")
+		if name == "" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(tpl.Names())
+			return
+		}
+		if _, ok := tpl.Names()[name]; !ok {
+			middleware.WriteError(w, r, apperr.New(apperr.NotFound, "template_not_found", "unknown template: "+name))
+			return
+		}
+
+		locale := q.Get("locale")
+		if locale == "" {
+			locale = mailer.DefaultLocale
+		}
+		msg, err := tpl.Render(name, locale, "preview@example.com", mailer.SampleData(name))
+		if err != nil {
+			writeError(w, r, "render failed", err)
+			return
+		}
+
+		switch q.Get("format") {
+		case "", "html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(msg.HTML))
+		case "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte("Subject: " + msg.Subject + "\n\n" + msg.Text))
+		case "json":
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(msg)
+		default:
+			badRequest(w, r, "format must be html, text or json")
+		}
+	}
+}
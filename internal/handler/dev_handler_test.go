@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"auth-microservice/internal/mailer"
+)
+
+func TestEmailPreviewHandler(t *testing.T) {
+	tpl, err := mailer.NewTemplates(mailer.Brand{Name: "Acme Rank"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview := EmailPreviewHandler(tpl)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		preview(w, httptest.NewRequest(http.MethodGet, "/emails/preview"+query, nil))
+		return w
+	}
+
+	w := get("")
+	var names map[string][]string
+	if err := json.NewDecoder(w.Body).Decode(&names); err != nil || len(names[mailer.TemplateVerifyEmail]) == 0 {
+		t.Fatalf("template list %v, %v", names, err)
+	}
+
+	tests := []struct {
+		query, wantType, wantBody string
+		wantStatus                int
+	}{
+		{"?template=verify_email", "text/html; charset=utf-8", `<html lang="en">`, http.StatusOK},
+		{"?template=verify_email&locale=es&format=html", "text/html; charset=utf-8", `<html lang="es">`, http.StatusOK},
+		{"?template=workspace_invite&locale=de&format=text", "text/plain; charset=utf-8", "Subject: Einladung zu Acme Marketing", http.StatusOK},
+		{"?template=change_email&format=json", "application/json", `"template":"change_email"`, http.StatusOK},
+		{"?template=verify_email&locale=ja&format=html", "text/html; charset=utf-8", `<html lang="en">`, http.StatusOK},
+		{"?template=verify_email&format=pdf", "application/json", "format must be html, text or json", http.StatusBadRequest},
+		{"?template=password_reset", "application/json", "template_not_found", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := get(tt.query)
+		if w.Code != tt.wantStatus || !strings.HasPrefix(w.Header().Get("Content-Type"), tt.wantType) || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s: %d %s %q, want %d %s containing %q", tt.query, w.Code, w.Header().Get("Content-Type"), w.Body.String(), tt.wantStatus, tt.wantType, tt.wantBody)
+		}
+	}
+}
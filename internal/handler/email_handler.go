@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"auth-microservice/internal/middleware"
+)
+
+// ListWorkspaceEmails shows delivery status of the active workspace's email.
+// Optional filters: ?status=queued|sending|sent|dead and ?to=<address>
+func (h *Handler) ListWorkspaceEmails(w http.ResponseWriter, r *http.Request) {
+	principal := middleware.PrincipalFromContext(r.Context())
+	q := r.URL.Query()
+	status, err := h.emails.WorkspaceStatus(r.Context(), principal.WorkspaceID, q.Get("status"), q.Get("to"))
+	if err != nil {
+		writeError(w, r, "failed to list emails", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// AdminListEmails shows delivery status of email across the platform,
+// including sign-in email that belongs to no workspace. Optional filters:
+// ?status=, ?to= and ?workspace=<id>|none
+func (h *Handler) AdminListEmails(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status, err := h.emails.SystemStatus(r.Context(), q.Get("workspace"), q.Get("status"), q.Get("to"))
+	if err != nil {
+		writeError(w, r, "failed to list emails", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
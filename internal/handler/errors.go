@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/middleware"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	errMissingUser      = apperr.New(apperr.Unauthorized, "unauthorized", "missing user in token")
+	errMissingWorkspace = apperr.New(apperr.Unauthorized, "unauthorized", "missing workspace in token")
+	errUnknownUser      = apperr.New(apperr.Unauthorized, "unauthorized", "user not found")
+	errInvalidBody      = apperr.New(apperr.Validation, "invalid_body", "request body is not valid JSON")
+)
+
+// writeError sends err in the JSON error envelope. msg names the step that
+// failed; it is logged with internal errors but never returned.
+func writeError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	middleware.WriteError(w, r, fmt.Errorf("%s: %w", msg, err))
+}
+
+// badRequest rejects input that is wrong as a whole rather than in one field
+func badRequest(w http.ResponseWriter, r *http.Request, message string) {
+	middleware.WriteError(w, r, apperr.New(apperr.Validation, "bad_request", message))
+}
+
+// decodeJSON decodes the request body into req and validates it, writing the
+// error response itself. It reports whether the caller may continue.
+func (h *Handler) decodeJSON(w http.ResponseWriter, r *http.Request, req any) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		middleware.WriteError(w, r, errInvalidBody)
+		return false
+	}
+	if err := h.validate.Struct(req); err != nil {
+		middleware.WriteError(w, r, validationError(err))
+		return false
+	}
+	return true
+}
+
+// jsonFieldName makes validation errors use JSON field names
+func jsonFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
+
+// validationError lists the failed validator rules by JSON field name
+func validationError(err error) error {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return apperr.Invalid("invalid request", nil)
+	}
+	fields := make(map[string]string, len(verrs))
+	for _, fe := range verrs {
+		msg := "failed " + fe.Tag()
+		if fe.Param() != "" {
+			msg += "=" + fe.Param()
+		}
+		// Namespace is Type.field.sub; drop the type name
+		name := fe.Namespace()
+		if i := strings.Index(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		fields[name] = msg
+	}
+	return apperr.Invalid("invalid request", fields)
+}
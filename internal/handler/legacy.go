@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// legacyBodyLimit caps how much of a legacy request body is read to find its ID
+const legacyBodyLimit = 1 << 20
+
+// deprecated serves a route's pre-/v1 path. Responses carry a Deprecation
+// header, and a Link to the successor when it has no path parameters. When
+// idKey is set, the ID the old path read from that query parameter or JSON
+// body field is moved into the {id} path value the handler now reads.
+func deprecated(successor, idKey string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if !strings.Contains(successor, "{") {
+			w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+		if idKey != "" {
+			id := r.URL.Query().Get(idKey)
+			if id == "" {
+				id = bodyField(r, idKey)
+			}
+			r.SetPathValue("id", id)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyField returns a string field of a JSON request body, leaving the body
+// readable for the handler
+func bodyField(r *http.Request, key string) string {
+	if r.Body == nil {
+		return ""
+	}
+	b, err := io.ReadAll(io.LimitReader(r.Body, legacyBodyLimit))
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return ""
+	}
+	var fields map[string]any
+	if json.Unmarshal(b, &fields) != nil {
+		return ""
+	}
+	v, _ := fields[key].(string)
+	return v
+}
+
+// pathID returns the {id} path value, writing a 400 when it is empty. Only a
+// legacy path that was sent without its ID gets there.
+func pathID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if id == "" {
+		badRequest(w, r, "missing id")
+		return "", false
+	}
+	return id, true
+}
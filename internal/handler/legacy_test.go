@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-microservice/internal/config"
+)
+
+// TestLegacyRoutesKeepTheirVerbs calls each pre-/v1 path with the verb it
+// took before versioning and checks it reaches its deprecated alias
+func TestLegacyRoutesKeepTheirVerbs(t *testing.T) {
+	mux := http.NewServeMux()
+	h := &Handler{cfg: &config.Config{}}
+	h.RegisterRoutes(mux)
+
+	legacy := []struct{ method, path string }{
+		{http.MethodPost, "/send-verify"},
+		{http.MethodGet, "/verify"},
+		{http.MethodPost, "/verify"},
+		{http.MethodPost, "/verify-code"},
+		{http.MethodGet, "/oauth/google"},
+		{http.MethodGet, "/oauth/google/callback"},
+		{http.MethodPost, "/auth/mfa/verify"},
+		{http.MethodPost, "/email/confirm"},
+		{http.MethodGet, "/me"},
+		{http.MethodDelete, "/me"},
+		{http.MethodPost, "/me/restore"},
+		{http.MethodGet, "/me/export"},
+		{http.MethodPost, "/me/email"},
+		{http.MethodPost, "/user/brand"},
+		{http.MethodPost, "/competitor/generate"},
+		{http.MethodPost, "/prompts/generate"},
+		{http.MethodPost, "/prompts/analysis"},
+		{http.MethodGet, "/user/getcompetitor"},
+		{http.MethodPost, "/user/competitor"},
+		{http.MethodGet, "/prompt/meta/get"},
+		{http.MethodGet, "/analyse/brand/prompt/get"},
+		{http.MethodGet, "/analyse/domain/prompt/get"},
+		{http.MethodPost, "/prompt/add"},
+		{http.MethodGet, "/analyse/brand/get"},
+		{http.MethodGet, "/analyse/domain/get"},
+		{http.MethodGet, "/prompts/get"},
+		{http.MethodGet, "/workspaces"},
+		{http.MethodPost, "/workspaces"},
+		{http.MethodPost, "/workspaces/switch"},
+		{http.MethodPost, "/workspace/invite/accept"},
+		{http.MethodGet, "/workspace/members"},
+		{http.MethodPost, "/workspace/members/invite"},
+		{http.MethodPost, "/workspace/members/role"},
+		{http.MethodPost, "/workspace/members/remove"},
+		{http.MethodGet, "/workspace/emails"},
+		{http.MethodGet, "/workspace/audit"},
+		{http.MethodGet, "/projects"},
+		{http.MethodPost, "/projects/create"},
+		{http.MethodPost, "/auth/mfa/setup"},
+		{http.MethodPost, "/auth/mfa/enable"},
+		{http.MethodPost, "/auth/mfa/disable"},
+		{http.MethodPost, "/auth/mfa/recovery-codes"},
+		{http.MethodPost, "/workspace/mfa"},
+		{http.MethodGet, "/api-keys"},
+		{http.MethodPost, "/api-keys/create"},
+		{http.MethodPost, "/api-keys/revoke"},
+		{http.MethodGet, "/admin/users"},
+		{http.MethodGet, "/admin/users/get"},
+		{http.MethodGet, "/admin/users/prompts"},
+		{http.MethodPost, "/admin/users/verify"},
+		{http.MethodPost, "/admin/users/disable"},
+		{http.MethodPost, "/admin/users/revoke-sessions"},
+		{http.MethodPost, "/admin/users/reanalyse"},
+		{http.MethodPost, "/admin/users/impersonate"},
+		{http.MethodGet, "/admin/stats"},
+	}
+	for _, tt := range legacy {
+		_, pattern := mux.Handler(httptest.NewRequest(tt.method, tt.path, nil))
+		if want := tt.method + " " + tt.path; pattern != want {
+			t.Errorf("%s %s: matched %q, want %q", tt.method, tt.path, pattern, want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"auth-microservice/internal/middleware"
+	"auth-microservice/internal/repository"
+	"auth-microservice/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// currentUser loads the signed-in user
+func (h *Handler) currentUser(ctx context.Context, w http.ResponseWriter, r *http.Request, userID string) (*repository.User, bool) {
+	user, err := h.svc.GetUserByID(ctx, userID)
+	if err != nil {
+		writeError(w, r, "failed to fetch user", err)
+		return nil, false
+	}
+	if user == nil {
+		middleware.WriteError(w, r, errUnknownUser)
+		return nil, false
+	}
+	return user, true
+}
+
+// MFASetup starts TOTP enrolment and returns the secret and otpauth URI for a QR code
+func (h *Handler) MFASetup(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.currentUser(ctx, w, r, middleware.PrincipalFromContext(ctx).UserID)
+	if !ok {
+		return
+	}
+
+	secret, uri, err := h.mfa.Setup(ctx, user)
+	if err != nil {
+		writeError(w, r, "failed to start mfa setup", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": uri,
+		"message":     "scan the code, then confirm at /auth/mfa/enable",
+	})
+}
+
+// MFAEnable confirms enrolment with a code from the authenticator app. It
+// returns the recovery codes once and an access token with MFA completed.
+func (h *Handler) MFAEnable(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code" validate:"required,len=6,numeric"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	principal := middleware.PrincipalFromContext(ctx)
+	user, ok := h.currentUser(ctx, w, r, principal.UserID)
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfa.Enable(ctx, user, req.Code)
+	if err != nil {
+		writeError(w, r, "failed to enable mfa", err)
+		return
+	}
+
+	_, member, err := h.wsvc.Membership(ctx, user.ID.Hex(), principal.WorkspaceID)
+	if err != nil {
+		writeError(w, r, "failed to resolve workspace", err)
+		return
+	}
+	accessToken, err := h.svc.GenerateAccessToken(ctx, user, member, true)
+	if err != nil {
+		writeError(w, r, "failed to generate access token", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "two-factor authentication enabled; store these recovery codes now",
+		"recovery_codes": codes,
+		"access_token":   accessToken,
+	})
+}
+
+// MFAVerify exchanges an mfa_pending token and a TOTP or recovery code for an access token
+func (h *Handler) MFAVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req struct {
+		MFAToken     string `json:"mfa_token" validate:"required"`
+		Code         string `json:"code" validate:"omitempty,len=6,numeric"`
+		RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	claims, err := h.svc.ParseMFAPendingToken(req.MFAToken)
+	if err != nil {
+		writeError(w, r, "failed to parse mfa token", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.currentUser(ctx, w, r, claims.UserID)
+	if !ok {
+		return
+	}
+
+	if err := h.mfa.Verify(ctx, user, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, service.ErrMFANotEnabled) {
+			err = service.ErrInvalidMFACode // don't reveal that MFA was turned off meanwhile
+		}
+		writeError(w, r, "failed to verify code", err)
+		return
+	}
+
+	ws, member, err := h.wsvc.Membership(ctx, user.ID.Hex(), claims.WorkspaceID)
+	if err != nil {
+		writeError(w, r, "failed to resolve workspace", err)
+		return
+	}
+	accessToken, err := h.svc.GenerateAccessToken(ctx, user, member, true)
+	if err != nil {
+		writeError(w, r, "failed to generate access token", err)
+		return
+	}
+
+	h.writeLogin(ctx, w, r, user.Email, accessToken, ws)
+}
+
+// MFADisable turns off two-factor authentication after a fresh code check.
+// Refused while any of the user's workspaces requires MFA.
+func (h *Handler) MFADisable(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code         string `json:"code" validate:"omitempty,len=6,numeric"`
+		RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.currentUser(ctx, w, r, middleware.PrincipalFromContext(ctx).UserID)
+	if !ok {
+		return
+	}
+
+	required, err := h.wsvc.AnyRequiresMFA(ctx, user.ID.Hex())
+	if err != nil {
+		writeError(w, r, "failed to check workspaces", err)
+		return
+	}
+	if required {
+		writeError(w, r, "failed to disable mfa", service.ErrMFARequired)
+		return
+	}
+
+	if err := h.mfa.Disable(ctx, user, req.Code, req.RecoveryCode); err != nil {
+		writeError(w, r, "failed to disable mfa", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "two-factor authentication disabled"})
+}
+
+// MFARecoveryCodes replaces the caller's recovery codes and returns the new ones once
+func (h *Handler) MFARecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code" validate:"required,len=6,numeric"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.currentUser(ctx, w, r, middleware.PrincipalFromContext(ctx).UserID)
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfa.RegenerateRecoveryCodes(ctx, user, req.Code)
+	if err != nil {
+		writeError(w, r, "failed to regenerate recovery codes", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "store these recovery codes now; the old ones no longer work",
+		"recovery_codes": codes,
+	})
+}
+
+// SetWorkspaceMFA turns the active workspace's MFA requirement on or off
+func (h *Handler) SetWorkspaceMFA(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RequireMFA *bool `json:"require_mfa" validate:"required"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	principal := middleware.PrincipalFromContext(r.Context())
+	ws, err := h.wsvc.SetRequireMFA(r.Context(), principal.WorkspaceID, principal.Role, principal.MFA, *req.RequireMFA)
+	if err != nil {
+		writeError(w, r, "failed to update workspace", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ws)
+}
@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"auth-microservice/internal/middleware"
+)
+
+const adminStatsMaxDays = 366
+
+// queryInt reads a non-negative integer query parameter, def when it is absent
+func queryInt(r *http.Request, key string, def int) (int, bool) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// decodeAdminBody decodes an operator action's optional JSON body into req
+func (h *Handler) decodeAdminBody(w http.ResponseWriter, r *http.Request, req any) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		middleware.WriteError(w, r, errInvalidBody)
+		return false
+	}
+	if err := h.validate.Struct(req); err != nil {
+		middleware.WriteError(w, r, validationError(err))
+		return false
+	}
+	return true
+}
+
+// AdminSearchUsers lists users by email substring. Query: q, limit, offset.
+func (h *Handler) AdminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	limit, ok1 := queryInt(r, "limit", 0)
+	offset, ok2 := queryInt(r, "offset", 0)
+	if !ok1 || !ok2 {
+		badRequest(w, r, "limit and offset must be non-negative numbers")
+		return
+	}
+
+	users, total, err := h.ops.SearchUsers(r.Context(), r.URL.Query().Get("q"), limit, offset)
+	if err != nil {
+		writeError(w, r, "failed to search users", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"users": users, "total": total})
+}
+
+// AdminGetUser returns a user's profile, workspaces, projects and competitors
+func (h *Handler) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	profile, err := h.ops.UserProfile(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, "failed to fetch user", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(profile)
+}
+
+// AdminUserPrompts returns a user's prompt history, newest first. Query: limit, offset.
+func (h *Handler) AdminUserPrompts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	limit, ok1 := queryInt(r, "limit", 0)
+	offset, ok2 := queryInt(r, "offset", 0)
+	if !ok1 || !ok2 {
+		badRequest(w, r, "limit and offset must be non-negative numbers")
+		return
+	}
+
+	prompts, err := h.ops.UserPrompts(r.Context(), userID, limit, offset)
+	if err != nil {
+		writeError(w, r, "failed to fetch prompts", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"prompts": prompts})
+}
+
+// AdminVerifyUser marks a user's email as verified
+func (h *Handler) AdminVerifyUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.ops.ForceVerify(r.Context(), userID); err != nil {
+		writeError(w, r, "failed to verify user", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "user verified"})
+}
+
+// AdminDisableUser disables an account, or re-enables it with disabled=false
+func (h *Handler) AdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Disabled bool   `json:"disabled"`
+		Reason   string `json:"reason" validate:"max=500"`
+	}
+	if !h.decodeAdminBody(w, r, &req) {
+		return
+	}
+	if req.Disabled && req.Reason == "" {
+		badRequest(w, r, "reason is required to disable an account")
+		return
+	}
+
+	if err := h.ops.SetDisabled(r.Context(), userID, req.Disabled, req.Reason); err != nil {
+		writeError(w, r, "failed to update user", err)
+		return
+	}
+
+	message := "user enabled"
+	if req.Disabled {
+		message = "user disabled"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// AdminRevokeSessions signs a user out of every session
+func (h *Handler) AdminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.ops.RevokeSessions(r.Context(), userID); err != nil {
+		writeError(w, r, "failed to revoke sessions", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "sessions revoked"})
+}
+
+// AdminSetWorkspacePlan moves a workspace to another plan
+func (h *Handler) AdminSetWorkspacePlan(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Plan string `json:"plan" validate:"required"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.ops.SetWorkspacePlan(r.Context(), workspaceID, req.Plan); err != nil {
+		writeError(w, r, "failed to set plan", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "plan updated", "plan": req.Plan})
+}
+
+// AdminSetWorkspaceBudget sets a workspace's monthly LLM budget; null
+// returns it to the default
+func (h *Handler) AdminSetWorkspaceBudget(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		MonthlyUSD *float64 `json:"monthly_usd" validate:"omitempty,gte=0"`
+	}
+	if !h.decodeAdminBody(w, r, &req) {
+		return
+	}
+
+	if err := h.ops.SetWorkspaceBudget(r.Context(), workspaceID, req.MonthlyUSD); err != nil {
+		writeError(w, r, "failed to set budget", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"message": "budget updated", "monthly_usd": req.MonthlyUSD})
+}
+
+// AdminReanalyse recomputes a user's analyses from their stored responses,
+// optionally for one project only
+func (h *Handler) AdminReanalyse(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		ProjectID string `json:"project_id"`
+	}
+	if !h.decodeAdminBody(w, r, &req) {
+		return
+	}
+
+	count, err := h.ops.Reanalyse(r.Context(), userID, req.ProjectID)
+	if err != nil {
+		writeError(w, r, "failed to re-run analyses", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"message": "analyses re-run", "prompts": count})
+}
+
+// AdminImpersonate returns a read-only access token acting as the user in one
+// of their workspaces. A reason is required and recorded.
+func (h *Handler) AdminImpersonate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		WorkspaceID string `json:"workspace_id"`
+		Reason      string `json:"reason" validate:"required,max=500"`
+	}
+	if !h.decodeAdminBody(w, r, &req) {
+		return
+	}
+
+	imp, err := h.ops.Impersonate(r.Context(), userID, req.WorkspaceID, req.Reason)
+	if err != nil {
+		writeError(w, r, "failed to impersonate user", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(imp)
+}
+
+// AdminStats returns platform-wide stats for the last days (?days=, default 30)
+func (h *Handler) AdminStats(w http.ResponseWriter, r *http.Request) {
+	days, ok := queryInt(r, "days", 30)
+	if !ok || days < 1 || days > adminStatsMaxDays {
+		badRequest(w, r, "days must be between 1 and 366")
+		return
+	}
+
+	stats, err := h.ops.Stats(r.Context(), days)
+	if err != nil {
+		writeError(w, r, "failed to compute stats", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+// AdminLLMUsage reports LLM tokens and spend across workspaces. Query: days.
+func (h *Handler) AdminLLMUsage(w http.ResponseWriter, r *http.Request) {
+	days, ok := queryInt(r, "days", 30)
+	if !ok || days < 1 || days > adminStatsMaxDays {
+		badRequest(w, r, "days must be between 1 and 366")
+		return
+	}
+
+	overview, err := h.ops.LLMUsage(r.Context(), days)
+	if err != nil {
+		writeError(w, r, "failed to read llm usage", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(overview)
+}
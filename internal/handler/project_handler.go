@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"auth-microservice/internal/middleware"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+	"encoding/json"
+	"net/http"
+)
+
+// activeProject resolves the project a request targets: ?project_id= within the
+// active workspace, or the workspace's default project when omitted. It writes
+// the error response itself and reports whether the caller may continue.
+func (h *Handler) activeProject(w http.ResponseWriter, r *http.Request) (*repository.Project, bool) {
+	workspaceID, ok := pkg.GetWorkspaceIDFromContext(r.Context())
+	if !ok || workspaceID == "" {
+		middleware.WriteError(w, r, errMissingWorkspace)
+		return nil, false
+	}
+
+	project, err := h.proj.Resolve(r.Context(), workspaceID, r.URL.Query().Get("project_id"))
+	if err != nil {
+		writeError(w, r, "failed to resolve project", err)
+		return nil, false
+	}
+	return project, true
+}
+
+// ListProjects returns the projects of the active workspace
+func (h *Handler) ListProjects(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := pkg.GetWorkspaceIDFromContext(r.Context())
+	if !ok || workspaceID == "" {
+		middleware.WriteError(w, r, errMissingWorkspace)
+		return
+	}
+
+	projects, err := h.proj.List(r.Context(), workspaceID)
+	if err != nil {
+		writeError(w, r, "failed to list projects", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(projects)
+}
+
+// CreateProject adds a project to the active workspace
+func (h *Handler) CreateProject(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := pkg.GetWorkspaceIDFromContext(r.Context())
+	if !ok || workspaceID == "" {
+		middleware.WriteError(w, r, errMissingWorkspace)
+		return
+	}
+
+	var req struct {
+		Name      string `json:"name" validate:"required,max=100"`
+		BrandName string `json:"brand_name"`
+		Domain    string `json:"domain"`
+		Country   string `json:"country"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	project, err := h.proj.Create(r.Context(), workspaceID, req.Name, req.BrandName, req.Domain, req.Country)
+	if err != nil {
+		writeError(w, r, "failed to create project", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(project)
+}
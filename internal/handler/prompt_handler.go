@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"auth-microservice/internal/middleware"
 	"auth-microservice/internal/pkg"
 	"auth-microservice/internal/repository"
 	"context"
@@ -18,33 +19,29 @@ type SuggestPrompt struct {
 }
 
 func (h *Handler) GetPromptSuggestions(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+	//Resolve target project from the active workspace
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
-	//Get user email from context
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
+	//Get saved domain & country from the project
+	if project.Domain == "" || project.Country == "" {
+		badRequest(w, r, "domain and country not set for this project")
 		return
 	}
 
-	//Get saved domain & country from user service
-	userData, err := h.usvc.GetUserByEmail(r.Context(), email)
+	charge, err := h.quota.ConsumeLLMCalls(r.Context(), project.WorkspaceID.Hex(), 1)
 	if err != nil {
-		http.Error(w, "failed to get user data: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if userData.Domain == "" || userData.Country == "" {
-		http.Error(w, "domain and country not set for this user", http.StatusBadRequest)
+		writeError(w, r, "quota check failed", err)
 		return
 	}
 
 	// 3. Generate prompts
-	prompts, err := h.p.GeneratePrompts(r.Context(), userData.Domain, userData.Country)
+	prompts, err := h.p.GeneratePrompts(r.Context(), project.Domain, project.Country)
 	if err != nil {
-		http.Error(w, "failed to generate prompts: "+err.Error(), http.StatusInternalServerError)
+		h.quota.RefundLLMCalls(r.Context(), charge, 1)
+		writeError(w, r, "failed to generate prompts", err)
 		return
 	}
 
@@ -58,7 +55,7 @@ func (h *Handler) GetPromptSuggestions(w http.ResponseWriter, r *http.Request) {
 	for i, p := range prompts {
 		respPrompts[i] = PromptWithCountry{
 			Prompt:  p,
-			Country: userData.Country,
+			Country: project.Country,
 		}
 	}
 
@@ -70,57 +67,52 @@ type PromptRequest struct {
 	Prompts []struct {
 		Prompt  string `json:"prompt" validate:"required"`
 		Country string `json:"country" validate:"required"`
-	} `json:"prompts" validate:"required,dive"`
+	} `json:"prompts" validate:"required,min=1,dive"`
 }
 
 func (h *Handler) HandlePromptsEntry(w http.ResponseWriter, r *http.Request) {
-	// 1️⃣ Enforce POST method
-	if r.Method != http.MethodPost {
-		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+	// 1️⃣ Get user ID & target project from context
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		middleware.WriteError(w, r, errMissingUser)
 		return
 	}
-
-	// 2️⃣ Get user email from context
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
-	// 3️⃣ Parse request body
+	// 2️⃣ Parse request body
 	var req PromptRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+	if !h.decodeJSON(w, r, &req) {
 		return
 	}
 
-	// 4️⃣ Validate struct
-	if err := h.validate.Struct(&req); err != nil {
-		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// 5️⃣ Context with timeout
+	// 4️⃣ Context with timeout
 	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
 	defer cancel()
 
-	// 6️⃣ Fetch brand & competitors from MongoDB
-	userData, err := h.usvc.GetUserByEmail(ctx, email)
-	if err != nil {
-		http.Error(w, "failed to fetch user data: "+err.Error(), http.StatusInternalServerError)
+	// 5️⃣ Brand & competitors come from the project
+	if project.BrandName == "" {
+		badRequest(w, r, "brand not configured for this project")
 		return
 	}
-	if userData == nil || userData.BrandName == "" {
-		http.Error(w, "brand not configured for this user", http.StatusBadRequest)
+
+	// One LLM call per prompt, charged up front so a batch over quota makes no calls
+	charge, err := h.quota.ConsumeLLMCalls(ctx, project.WorkspaceID.Hex(), len(req.Prompts))
+	if err != nil {
+		writeError(w, r, "quota check failed", err)
 		return
 	}
 
 	// 1️⃣ Collect results from OpenAI
 	var results []pkg.PromptResponse
-	for _, p := range req.Prompts {
-		respText, err := h.p.SendToOpenAI(ctx, email, p.Prompt, p.Country)
+	for i, p := range req.Prompts {
+		respText, err := h.p.SendToOpenAI(ctx, userID, p.Prompt, p.Country)
 		if err != nil {
-			http.Error(w, "OpenAI API error: "+err.Error(), http.StatusInternalServerError)
+			// The failed call and those never made go back to the quota
+			h.quota.RefundLLMCalls(r.Context(), charge, len(req.Prompts)-i)
+			writeError(w, r, "OpenAI API error", err)
 			return
 		}
 		results = append(results, pkg.PromptResponse{Prompt: p.Prompt, Response: respText})
@@ -130,27 +122,29 @@ func (h *Handler) HandlePromptsEntry(w http.ResponseWriter, r *http.Request) {
 	var responseEntries []repository.PromptResponseEntry
 	for _, r := range results {
 		responseEntries = append(responseEntries, repository.PromptResponseEntry{
-			UserEmail: email,
-			Prompt:    r.Prompt,
-			Response:  r.Response,
-			Country:   req.Prompts[0].Country,
-			Added:     time.Now().UTC(),
+			WorkspaceID: project.WorkspaceID.Hex(),
+			ProjectID:   project.ID.Hex(),
+			UserID:      userID,
+			Prompt:      r.Prompt,
+			Response:    r.Response,
+			Country:     req.Prompts[0].Country,
+			Added:       time.Now().UTC(),
 		})
 	}
 
 	promptIDs, err := h.p.StorePromptResponses(ctx, responseEntries)
 	if err != nil {
-		http.Error(w, "failed to store prompt responses: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to store prompt responses", err)
 		return
 	}
 
 	// 3️⃣ Generate brand aliases and analyze responses
-	brandAliases := pkg.GenerateAliases(userData.BrandName)
+	brandAliases := pkg.GenerateAliases(project.BrandName)
 	competitorMap := make(map[string][]string)
-	for _, c := range userData.Competitor {
+	for _, c := range project.Competitor {
 		competitorMap[c.TrackedName] = pkg.GenerateAliases(c.TrackedName)
 	}
-	analysisResults := pkg.AnalyzeResponses(results, req.Prompts[0].Country, userData.BrandName, brandAliases, competitorMap)
+	analysisResults := pkg.AnalyzeResponses(ctx, results, req.Prompts[0].Country, project.BrandName, brandAliases, competitorMap)
 
 	// 4️⃣ Store analyses split across tables using promptIDs
 	var (
@@ -164,26 +158,30 @@ func (h *Handler) HandlePromptsEntry(w http.ResponseWriter, r *http.Request) {
 
 		// ✅ Prompt table (meta-level info)
 		promptEntries = append(promptEntries, repository.PromptMeta{
-			PromptID:  promptID,
-			UserEmail: email,
-			Prompt:    a.Prompt,
-			Mentions:  a.Mentions,
-			Volume:    a.Volume,
-			Tags:      a.Tags,
-			Location:  a.Location,
-			Added:     time.Now().UTC(),
+			PromptID:    promptID,
+			WorkspaceID: project.WorkspaceID.Hex(),
+			ProjectID:   project.ID.Hex(),
+			UserID:      userID,
+			Prompt:      a.Prompt,
+			Mentions:    a.Mentions,
+			Volume:      a.Volume,
+			Tags:        a.Tags,
+			Location:    a.Location,
+			Added:       time.Now().UTC(),
 		})
 
 		// ✅ Brand table
 		for _, b := range a.Brands {
 			brandEntries = append(brandEntries, repository.BrandAnalysis{
-				PromptID:   promptID,
-				UserEmail:  email,
-				BrandName:  b.BrandName,
-				Visibility: b.Visibility,
-				Sentiment:  b.Sentiment,
-				Position:   b.Position,
-				Added:      time.Now().UTC(),
+				PromptID:    promptID,
+				WorkspaceID: project.WorkspaceID.Hex(),
+				ProjectID:   project.ID.Hex(),
+				UserID:      userID,
+				BrandName:   b.BrandName,
+				Visibility:  b.Visibility,
+				Sentiment:   b.Sentiment,
+				Position:    b.Position,
+				Added:       time.Now().UTC(),
 			})
 		}
 
@@ -201,15 +199,15 @@ func (h *Handler) HandlePromptsEntry(w http.ResponseWriter, r *http.Request) {
 
 	// 5️⃣ Store in bulk
 	if err := h.p.StorePromptMeta(ctx, promptEntries); err != nil {
-		http.Error(w, "failed to store prompt metadata: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to store prompt metadata", err)
 		return
 	}
 	if err := h.p.StoreBrandAnalyses(ctx, brandEntries); err != nil {
-		http.Error(w, "failed to store brand analyses: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to store brand analyses", err)
 		return
 	}
 	if err := h.p.StoreDomainAnalyses(ctx, domainEntries); err != nil {
-		http.Error(w, "failed to store domain analyses: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to store domain analyses", err)
 		return
 	}
 
@@ -217,20 +215,13 @@ func (h *Handler) HandlePromptsEntry(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, `{"message":"prompts processed and analyzed successfully"}`)
 }
 func (h *Handler) GetPromptResponses(w http.ResponseWriter, r *http.Request) {
-	// 1️⃣ Enforce GET method
-	if r.Method != http.MethodGet {
-		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+	// 1️⃣ Resolve target project from the active workspace
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
-	// 2️⃣ Get user email from context
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
-		return
-	}
-
-	// 3️⃣ Parse query params for pagination
+	// 2️⃣ Parse query params for pagination
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
 
@@ -244,35 +235,28 @@ func (h *Handler) GetPromptResponses(w http.ResponseWriter, r *http.Request) {
 		limit = 10
 	}
 
-	// 4️⃣ Call service
-	prompts, err := h.p.GetPromptResponses(r.Context(), email, page, limit)
+	// 3️⃣ Call service
+	prompts, err := h.p.GetPromptResponses(r.Context(), project.ID.Hex(), page, limit)
 	if err != nil {
-		http.Error(w, "failed to get prompt responses: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to get prompt responses", err)
 		return
 	}
 
-	// 5️⃣ Return JSON response
+	// 4️⃣ Return JSON response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(prompts); err != nil {
-		http.Error(w, "failed to encode response: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to encode response", err)
 		return
 	}
 }
 func (h *Handler) GetBrandAnalysis(w http.ResponseWriter, r *http.Request) {
-	// 1️⃣ Allow only GET
-	if r.Method != http.MethodGet {
-		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+	// 1️⃣ Resolve target project from the active workspace
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
-	// 2️⃣ Extract user email from context
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
-		return
-	}
-
-	// 3️⃣ Parse pagination query params
+	// 2️⃣ Parse pagination query params
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
 
@@ -285,34 +269,27 @@ func (h *Handler) GetBrandAnalysis(w http.ResponseWriter, r *http.Request) {
 		limit = 10
 	}
 
-	// 4️⃣ Fetch brand analyses
-	analyses, err := h.p.GetBrandAnalyses(r.Context(), email, page, limit)
+	// 3️⃣ Fetch brand analyses
+	analyses, err := h.p.GetBrandAnalyses(r.Context(), project.ID.Hex(), page, limit)
 	if err != nil {
-		http.Error(w, "failed to get brand analyses: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to get brand analyses", err)
 		return
 	}
 
-	// 5️⃣ Return JSON response
+	// 4️⃣ Return JSON response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(analyses); err != nil {
-		http.Error(w, "failed to encode response: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to encode response", err)
 	}
 }
 func (h *Handler) GetDomainAnalysis(w http.ResponseWriter, r *http.Request) {
-	// 1️⃣ Enforce GET method
-	if r.Method != http.MethodGet {
-		http.Error(w, "use GET", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// 2️⃣ Extract user email from context
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
+	// 1️⃣ Resolve target project from the active workspace
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
-	// 3️⃣ Parse query params for pagination
+	// 2️⃣ Parse query params for pagination
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
 
@@ -325,57 +302,44 @@ func (h *Handler) GetDomainAnalysis(w http.ResponseWriter, r *http.Request) {
 		limit = 10
 	}
 
-	// 4️⃣ Fetch domain analyses
-	analyses, err := h.p.GetDomainAnalyses(r.Context(), email, page, limit)
+	// 3️⃣ Fetch domain analyses
+	analyses, err := h.p.GetDomainAnalyses(r.Context(), project.ID.Hex(), page, limit)
 	if err != nil {
-		http.Error(w, "failed to get domain analyses: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to get domain analyses", err)
 		return
 	}
 
-	// 5️⃣ Return JSON response
+	// 4️⃣ Return JSON response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(analyses); err != nil {
-		http.Error(w, "failed to encode response: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to encode response", err)
 	}
 }
 func (h *Handler) GetBrandOverview(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
-		return
-	}
-
-	overview, err := h.p.GetBrandOverview(r.Context(), email)
+	overview, err := h.p.GetBrandOverview(r.Context(), project.ID.Hex())
 	if err != nil {
-		http.Error(w, "failed to get brand overview: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to get brand overview", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(overview); err != nil {
-		http.Error(w, "failed to encode response: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to encode response", err)
 	}
 }
 func (h *Handler) GetPromptMeta(w http.ResponseWriter, r *http.Request) {
-	// 1️⃣ Allow only GET
-	if r.Method != http.MethodGet {
-		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+	// 1️⃣ Resolve target project from the active workspace
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
-	// 2️⃣ Get user email from context
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
-		return
-	}
-
-	// 3️⃣ Parse query params for pagination
+	// 2️⃣ Parse query params for pagination
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
 
@@ -390,106 +354,91 @@ func (h *Handler) GetPromptMeta(w http.ResponseWriter, r *http.Request) {
 
 	offset := (page - 1) * limit
 
-	// 4️⃣ Fetch from service
-	metas, err := h.p.GetPromptMetaByEmail(r.Context(), email, limit, offset)
+	// 3️⃣ Fetch from service
+	metas, err := h.p.GetPromptMeta(r.Context(), project.ID.Hex(), limit, offset)
 	if err != nil {
-		http.Error(w, "failed to get prompt metadata: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to get prompt metadata", err)
 		return
 	}
 
-	// 5️⃣ Send JSON response
+	// 4️⃣ Send JSON response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(metas); err != nil {
-		http.Error(w, "failed to encode response: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to encode response", err)
 	}
 }
 func (h *Handler) GetBrandOverviewByPrompt(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "use GET", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Get email from context
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
+	// Resolve target project from the active workspace
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
-	// Get prompt_id from query param
-	promptIDStr := r.URL.Query().Get("prompt_id")
-	if promptIDStr == "" {
-		http.Error(w, "missing prompt_id", http.StatusBadRequest)
+	// Prompt ID from the path
+	promptIDStr, ok := pathID(w, r)
+	if !ok {
 		return
 	}
 
 	promptID, err := strconv.Atoi(promptIDStr)
 	if err != nil {
-		http.Error(w, "invalid prompt_id", http.StatusBadRequest)
+		badRequest(w, r, "invalid prompt id")
 		return
 	}
 
 	// Call service
-	overview, err := h.p.GetBrandOverviewByPrompt(r.Context(), email, promptID)
+	overview, err := h.p.GetBrandOverviewByPrompt(r.Context(), project.ID.Hex(), promptID)
 	if err != nil {
-		http.Error(w, "failed to get brand overview: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to get brand overview", err)
 		return
 	}
 
 	// Return JSON
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(overview); err != nil {
-		http.Error(w, "failed to encode response: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to encode response", err)
 	}
 }
 func (h *Handler) GetDomainOverviewByPrompt(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+	// Resolve target project from the active workspace
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
-	// Get email from context
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
-		return
-	}
-
-	// Get prompt_id from query param
-	promptIDStr := r.URL.Query().Get("prompt_id")
-	if promptIDStr == "" {
-		http.Error(w, "missing prompt_id", http.StatusBadRequest)
+	// Prompt ID from the path
+	promptIDStr, ok := pathID(w, r)
+	if !ok {
 		return
 	}
 
 	promptID, err := strconv.Atoi(promptIDStr)
 	if err != nil {
-		http.Error(w, "invalid prompt_id", http.StatusBadRequest)
+		badRequest(w, r, "invalid prompt id")
 		return
 	}
 
 	// Call service
-	overview, err := h.p.GetDomainOverviewByPrompt(r.Context(), email, promptID)
+	overview, err := h.p.GetDomainOverviewByPrompt(r.Context(), project.ID.Hex(), promptID)
 	if err != nil {
-		http.Error(w, "failed to get domain overview: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to get domain overview", err)
 		return
 	}
 
 	// Return JSON
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(overview); err != nil {
-		http.Error(w, "failed to encode response: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to encode response", err)
 	}
 }
 func (h *Handler) AddPrompt(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		middleware.WriteError(w, r, errMissingUser)
 		return
 	}
-
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
@@ -499,64 +448,64 @@ func (h *Handler) AddPrompt(w http.ResponseWriter, r *http.Request) {
 		Country string   `json:"country" validate:"required"`
 		Tags    []string `json:"tags,omitempty"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-	if err := h.validate.Struct(&req); err != nil {
-		http.Error(w, "validation error: "+err.Error(), http.StatusBadRequest)
+	if !h.decodeJSON(w, r, &req) {
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
 	defer cancel()
 
-	// Get user info
-	userData, err := h.usvc.GetUserByEmail(ctx, email)
-	if err != nil {
-		http.Error(w, "failed to fetch user data: "+err.Error(), http.StatusInternalServerError)
+	// Project must have a brand configured
+	if project.BrandName == "" {
+		badRequest(w, r, "brand not configured for this project")
 		return
 	}
-	if userData == nil || userData.BrandName == "" {
-		http.Error(w, "brand not configured for this user", http.StatusBadRequest)
+
+	charge, err := h.quota.ConsumeLLMCalls(ctx, project.WorkspaceID.Hex(), 1)
+	if err != nil {
+		writeError(w, r, "quota check failed", err)
 		return
 	}
 
 	// Send prompt to OpenAI
-	respText, err := h.p.SendToOpenAI(ctx, email, req.Prompt, req.Country)
+	respText, err := h.p.SendToOpenAI(ctx, userID, req.Prompt, req.Country)
 	if err != nil {
-		http.Error(w, "OpenAI API error: "+err.Error(), http.StatusInternalServerError)
+		h.quota.RefundLLMCalls(r.Context(), charge, 1)
+		writeError(w, r, "OpenAI API error", err)
 		return
 	}
 
 	// Store prompt response
 	entry := repository.PromptResponseEntry{
-		UserEmail: email,
-		Prompt:    req.Prompt,
-		Response:  respText,
-		Country:   req.Country,
-		Added:     time.Now().UTC(),
+		WorkspaceID: project.WorkspaceID.Hex(),
+		ProjectID:   project.ID.Hex(),
+		UserID:      userID,
+		Prompt:      req.Prompt,
+		Response:    respText,
+		Country:     req.Country,
+		Added:       time.Now().UTC(),
 	}
 
 	promptIDs, err := h.p.StorePromptResponses(ctx, []repository.PromptResponseEntry{entry})
 	if err != nil {
-		http.Error(w, "failed to store prompt response: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to store prompt response", err)
 		return
 	}
 	promptID := promptIDs[0]
 
 	// Generate brand aliases & competitor aliases
-	brandAliases := pkg.GenerateAliases(userData.BrandName)
+	brandAliases := pkg.GenerateAliases(project.BrandName)
 	competitorMap := make(map[string][]string)
-	for _, c := range userData.Competitor {
+	for _, c := range project.Competitor {
 		competitorMap[c.TrackedName] = pkg.GenerateAliases(c.TrackedName)
 	}
 
 	// Analyze response
 	analysisResults := pkg.AnalyzeResponses(
+		ctx,
 		[]pkg.PromptResponse{{Prompt: req.Prompt, Response: respText}},
 		req.Country,
-		userData.BrandName,
+		project.BrandName,
 		brandAliases,
 		competitorMap,
 	)
@@ -565,17 +514,19 @@ func (h *Handler) AddPrompt(w http.ResponseWriter, r *http.Request) {
 	for _, a := range analysisResults {
 		// Prompt metadata
 		promptMeta := repository.PromptMeta{
-			PromptID:  promptID,
-			UserEmail: email,
-			Prompt:    a.Prompt,
-			Mentions:  a.Mentions,
-			Volume:    a.Volume,
-			Tags:      a.Tags,
-			Location:  a.Location,
-			Added:     time.Now().UTC(),
+			PromptID:    promptID,
+			WorkspaceID: project.WorkspaceID.Hex(),
+			ProjectID:   project.ID.Hex(),
+			UserID:      userID,
+			Prompt:      a.Prompt,
+			Mentions:    a.Mentions,
+			Volume:      a.Volume,
+			Tags:        a.Tags,
+			Location:    a.Location,
+			Added:       time.Now().UTC(),
 		}
 		if err := h.p.StorePromptMeta(ctx, []repository.PromptMeta{promptMeta}); err != nil {
-			http.Error(w, "failed to store prompt metadata: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, r, "failed to store prompt metadata", err)
 			return
 		}
 
@@ -583,17 +534,19 @@ func (h *Handler) AddPrompt(w http.ResponseWriter, r *http.Request) {
 		var brandEntries []repository.BrandAnalysis
 		for _, b := range a.Brands {
 			brandEntries = append(brandEntries, repository.BrandAnalysis{
-				PromptID:   promptID,
-				UserEmail:  email,
-				BrandName:  b.BrandName,
-				Visibility: b.Visibility,
-				Sentiment:  b.Sentiment,
-				Position:   b.Position,
-				Added:      time.Now().UTC(),
+				PromptID:    promptID,
+				WorkspaceID: project.WorkspaceID.Hex(),
+				ProjectID:   project.ID.Hex(),
+				UserID:      userID,
+				BrandName:   b.BrandName,
+				Visibility:  b.Visibility,
+				Sentiment:   b.Sentiment,
+				Position:    b.Position,
+				Added:       time.Now().UTC(),
 			})
 		}
 		if err := h.p.StoreBrandAnalyses(ctx, brandEntries); err != nil {
-			http.Error(w, "failed to store brand analyses: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, r, "failed to store brand analyses", err)
 			return
 		}
 
@@ -609,7 +562,7 @@ func (h *Handler) AddPrompt(w http.ResponseWriter, r *http.Request) {
 			})
 		}
 		if err := h.p.StoreDomainAnalyses(ctx, domainEntries); err != nil {
-			http.Error(w, "failed to store domain analyses: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, r, "failed to store domain analyses", err)
 			return
 		}
 	}
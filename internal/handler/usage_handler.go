@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"auth-microservice/internal/middleware"
+	"auth-microservice/internal/pkg"
+)
+
+// Usage returns the active workspace's plan and how much of its daily and
+// monthly LLM quotas is used and left
+func (h *Handler) Usage(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := pkg.GetWorkspaceIDFromContext(r.Context())
+	if !ok || workspaceID == "" {
+		middleware.WriteError(w, r, errMissingWorkspace)
+		return
+	}
+
+	usage, err := h.quota.Usage(r.Context(), workspaceID)
+	if err != nil {
+		writeError(w, r, "failed to fetch usage", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(usage)
+}
+
+// LLMSpend reports the active workspace's LLM tokens and cost per day,
+// purpose and model and per user, with its budget. Query: days.
+func (h *Handler) LLMSpend(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := pkg.GetWorkspaceIDFromContext(r.Context())
+	if !ok || workspaceID == "" {
+		middleware.WriteError(w, r, errMissingWorkspace)
+		return
+	}
+	days, ok := queryInt(r, "days", 30)
+	if !ok || days < 1 || days > adminStatsMaxDays {
+		badRequest(w, r, "days must be between 1 and 366")
+		return
+	}
+
+	spend, err := h.llmUsage.WorkspaceSpend(r.Context(), workspaceID, days)
+	if err != nil {
+		writeError(w, r, "failed to read llm usage", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(spend)
+}
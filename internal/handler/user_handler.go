@@ -1,7 +1,7 @@
 package handler
 
 import (
-	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/middleware"
 	"auth-microservice/internal/repository"
 	"context"
 	"encoding/json"
@@ -13,14 +13,8 @@ import (
 )
 
 func (h *Handler) AddCompetitor(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "use POST", http.StatusMethodNotAllowed)
-		return
-	}
-
-	email, ok := pkg.GetEmailFromContext(r.Context())
+	project, ok := h.activeProject(w, r)
 	if !ok {
-		http.Error(w, "email not found in context", http.StatusUnauthorized)
 		return
 	}
 
@@ -32,19 +26,19 @@ func (h *Handler) AddCompetitor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		middleware.WriteError(w, r, errInvalidBody)
 		return
 	}
 
 	if len(input) == 0 {
-		http.Error(w, "at least one competitor must be provided", http.StatusBadRequest)
+		badRequest(w, r, "at least one competitor must be provided")
 		return
 	}
 
 	var competitors []repository.Competitor
 	for _, item := range input {
 		if item.BrandName == "" || item.Domain == "" {
-			http.Error(w, "brand_name and domain are required for all entries", http.StatusBadRequest)
+			badRequest(w, r, "brand_name and domain are required for all entries")
 			return
 		}
 
@@ -64,8 +58,8 @@ func (h *Handler) AddCompetitor(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	if err := h.usvc.AddCompetitor(ctx, email, competitors); err != nil {
-		http.Error(w, "failed to add competitors: "+err.Error(), http.StatusInternalServerError)
+	if err := h.proj.AddCompetitor(ctx, project, competitors); err != nil {
+		writeError(w, r, "failed to add competitors", err)
 		return
 	}
 
@@ -75,14 +69,29 @@ func (h *Handler) AddCompetitor(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *Handler) GetCompetitor(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+// DeleteCompetitor removes a competitor, identified by its domain, from the target project
+func (h *Handler) DeleteCompetitor(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
-	email, ok := pkg.GetEmailFromContext(r.Context())
+	domain, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.proj.RemoveCompetitor(r.Context(), project, domain); err != nil {
+		writeError(w, r, "failed to remove competitor", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "competitor removed"})
+}
+
+func (h *Handler) GetCompetitor(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.activeProject(w, r)
 	if !ok {
-		http.Error(w, "email not found in context", http.StatusUnauthorized)
 		return
 	}
 
@@ -101,9 +110,9 @@ func (h *Handler) GetCompetitor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch paginated prompts
-	competitor, total, err := h.usvc.GetCompetitor(r.Context(), email, page, limit)
+	competitor, total, err := h.proj.GetCompetitor(r.Context(), project, page, limit)
 	if err != nil {
-		http.Error(w, "failed to get prompts: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to get prompts", err)
 		return
 	}
 
@@ -122,15 +131,9 @@ func (h *Handler) GetCompetitor(w http.ResponseWriter, r *http.Request) {
 	})
 }
 func (h *Handler) AddBrandDetails(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "use POST", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Get email from context
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
+	// Resolve target project from the active workspace
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
@@ -141,19 +144,19 @@ func (h *Handler) AddBrandDetails(w http.ResponseWriter, r *http.Request) {
 		Country   string `json:"country"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		middleware.WriteError(w, r, errInvalidBody)
 		return
 	}
 
 	if req.BrandName == "" || req.Domain == "" || req.Country == "" {
-		http.Error(w, "brand_name, domain, and country are required", http.StatusBadRequest)
+		badRequest(w, r, "brand_name, domain, and country are required")
 		return
 	}
 
 	// Call service
-	err := h.usvc.UpdateUserProfile(r.Context(), email, req.BrandName, req.Domain, req.Country)
+	err := h.proj.UpdateBrandProfile(r.Context(), project, req.BrandName, req.Domain, req.Country)
 	if err != nil {
-		http.Error(w, "failed to update profile: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, "failed to update profile", err)
 		return
 	}
 
@@ -165,33 +168,29 @@ func (h *Handler) AddBrandDetails(w http.ResponseWriter, r *http.Request) {
 	})
 }
 func (h *Handler) GetCompetitorSuggestions(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+	//Resolve target project from the active workspace
+	project, ok := h.activeProject(w, r)
+	if !ok {
 		return
 	}
 
-	//Get user email from context
-	email, ok := pkg.GetEmailFromContext(r.Context())
-	if !ok || email == "" {
-		http.Error(w, "unauthorized: missing email", http.StatusUnauthorized)
+	//Get saved domain & country from the project
+	if project.Domain == "" || project.Country == "" {
+		badRequest(w, r, "domain and country not set for this project")
 		return
 	}
 
-	//Get saved domain & country from user service
-	userData, err := h.usvc.GetUserByEmail(r.Context(), email)
+	charge, err := h.quota.ConsumeLLMCalls(r.Context(), project.WorkspaceID.Hex(), 1)
 	if err != nil {
-		http.Error(w, "failed to get user data: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if userData.Domain == "" || userData.Country == "" {
-		http.Error(w, "domain and country not set for this user", http.StatusBadRequest)
+		writeError(w, r, "quota check failed", err)
 		return
 	}
 
 	// 3. Generate prompts
-	competitor, err := h.usvc.GenerateCompetitor(r.Context(), userData.Domain, userData.Country)
+	competitor, err := h.usvc.GenerateCompetitor(r.Context(), project.Domain, project.Country)
 	if err != nil {
-		http.Error(w, "failed to generate prompts: "+err.Error(), http.StatusInternalServerError)
+		h.quota.RefundLLMCalls(r.Context(), charge, 1)
+		writeError(w, r, "failed to generate prompts", err)
 		return
 	}
 
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"auth-microservice/internal/middleware"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+	"auth-microservice/internal/service"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ListWorkspaces lists the caller's workspaces
+func (h *Handler) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		middleware.WriteError(w, r, errMissingUser)
+		return
+	}
+
+	workspaces, err := h.wsvc.ListForUser(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, "failed to list workspaces", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(workspaces)
+}
+
+// CreateWorkspace creates a workspace owned by the caller
+func (h *Handler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		middleware.WriteError(w, r, errMissingUser)
+		return
+	}
+	email, _ := pkg.GetEmailFromContext(r.Context())
+
+	var req struct {
+		Name string `json:"name" validate:"required,max=100"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	ws, member, err := h.wsvc.Create(r.Context(), userID, email, req.Name)
+	if err != nil {
+		writeError(w, r, "failed to create workspace", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(service.WorkspaceWithRole{Workspace: *ws, Role: member.Role})
+}
+
+// SwitchWorkspace issues a new access token scoped to another workspace the caller belongs to
+func (h *Handler) SwitchWorkspace(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		middleware.WriteError(w, r, errMissingUser)
+		return
+	}
+
+	workspaceID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.currentUser(ctx, w, r, userID)
+	if !ok {
+		return
+	}
+
+	ws, member, err := h.wsvc.Membership(ctx, user.ID.Hex(), workspaceID)
+	if err != nil {
+		writeError(w, r, "failed to switch workspace", err)
+		return
+	}
+
+	h.writeReissuedToken(w, r, user, ws, member)
+}
+
+// writeReissuedToken issues a token for another membership of the signed-in
+// user. A session that completed MFA keeps it; otherwise SignIn applies the
+// target workspace's MFA rule and may return a step-up token instead.
+func (h *Handler) writeReissuedToken(w http.ResponseWriter, r *http.Request, user *repository.User, ws *repository.Workspace, member *repository.Membership) {
+	var token, step string
+	var err error
+	if pkg.GetMFAFromContext(r.Context()) {
+		token, err = h.svc.GenerateAccessToken(r.Context(), user, member, true)
+	} else {
+		token, step, err = h.svc.SignIn(r.Context(), user, ws, member)
+	}
+	if err != nil {
+		writeError(w, r, "failed to generate access token", err)
+		return
+	}
+
+	resp := map[string]string{
+		"workspace_id": ws.ID.Hex(),
+		"role":         member.Role,
+	}
+	if step != "" {
+		resp["mfa_token"] = token
+		resp["action"] = step
+	} else {
+		resp["access_token"] = token
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// ListMembers returns the members of the active workspace
+func (h *Handler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := pkg.GetWorkspaceIDFromContext(r.Context())
+	if !ok || workspaceID == "" {
+		middleware.WriteError(w, r, errMissingWorkspace)
+		return
+	}
+
+	members, err := h.wsvc.ListMembers(r.Context(), workspaceID)
+	if err != nil {
+		writeError(w, r, "failed to list members", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(members)
+}
+
+// InviteMember emails an invitation to join the active workspace
+func (h *Handler) InviteMember(w http.ResponseWriter, r *http.Request) {
+	email, _ := pkg.GetEmailFromContext(r.Context())
+	role, _ := pkg.GetRoleFromContext(r.Context())
+	workspaceID, ok := pkg.GetWorkspaceIDFromContext(r.Context())
+	if !ok || workspaceID == "" {
+		middleware.WriteError(w, r, errMissingWorkspace)
+		return
+	}
+
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role" validate:"required"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	acceptURL, err := h.wsvc.Invite(ctx, workspaceID, role, email, req.Email, req.Role, r.Header.Get("Accept-Language"))
+	if err != nil {
+		writeError(w, r, "failed to invite member", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"message":    "invitation sent",
+		"accept_url": acceptURL,
+	})
+}
+
+// AcceptInvite adds the caller to the workspace of an invitation token and
+// returns a token scoped to that workspace
+func (h *Handler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pkg.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		middleware.WriteError(w, r, errMissingUser)
+		return
+	}
+
+	var req struct {
+		Token string `json:"token" validate:"required"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.currentUser(ctx, w, r, userID)
+	if !ok {
+		return
+	}
+
+	ws, member, err := h.wsvc.AcceptInvite(ctx, req.Token, user.ID.Hex(), user.Email)
+	if err != nil {
+		writeError(w, r, "failed to accept invitation", err)
+		return
+	}
+
+	h.writeReissuedToken(w, r, user, ws, member)
+}
+
+// UpdateMemberRole changes the role of a member of the active workspace
+func (h *Handler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	role, _ := pkg.GetRoleFromContext(r.Context())
+	workspaceID, ok := pkg.GetWorkspaceIDFromContext(r.Context())
+	if !ok || workspaceID == "" {
+		middleware.WriteError(w, r, errMissingWorkspace)
+		return
+	}
+
+	memberID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" validate:"required"`
+	}
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	if !repository.ValidRole(req.Role) {
+		badRequest(w, r, "invalid role")
+		return
+	}
+
+	if err := h.wsvc.UpdateMemberRole(r.Context(), workspaceID, role, memberID, req.Role); err != nil {
+		writeError(w, r, "failed to update role", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "role updated"})
+}
+
+// RemoveMember removes a member from the active workspace
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, _ := pkg.GetUserIDFromContext(r.Context())
+	role, _ := pkg.GetRoleFromContext(r.Context())
+	workspaceID, ok := pkg.GetWorkspaceIDFromContext(r.Context())
+	if !ok || workspaceID == "" {
+		middleware.WriteError(w, r, errMissingWorkspace)
+		return
+	}
+
+	memberID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.wsvc.RemoveMember(r.Context(), workspaceID, role, userID, memberID); err != nil {
+		writeError(w, r, "failed to remove member", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "member removed"})
+}
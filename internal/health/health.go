@@ -0,0 +1,113 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check is one dependency the instance needs to serve traffic
+type Check struct {
+	Name string
+	Fn   func(ctx context.Context) error
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status    string  `json:"status"` // "ok" or "fail"
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Report is the readiness body
+type Report struct {
+	Status    string            `json:"status"` // "ok" or "degraded"
+	Checks    map[string]Result `json:"checks"`
+	CheckedAt time.Time         `json:"checked_at"`
+}
+
+// Checker runs the readiness checks concurrently, each under its own timeout,
+// and reuses the last report for ttl so frequent probes don't load the
+// databases
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu   sync.Mutex
+	last *Report
+}
+
+func NewChecker(timeout, ttl time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout, ttl: ttl}
+}
+
+// Report returns the cached report, running the checks if it has expired
+func (c *Checker) Report(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last != nil && time.Since(c.last.CheckedAt) < c.ttl {
+		return *c.last
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, chk := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, chk)
+		}()
+	}
+	wg.Wait()
+
+	r := Report{Status: "ok", Checks: make(map[string]Result, len(c.checks)), CheckedAt: time.Now().UTC()}
+	for i, chk := range c.checks {
+		r.Checks[chk.Name] = results[i]
+		if results[i].Status != "ok" {
+			r.Status = "degraded"
+		}
+	}
+	c.last = &r
+	return r
+}
+
+func (c *Checker) run(ctx context.Context, chk Check) Result {
+	// a probe that gives up early must not leave a half-finished cached report
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := chk.Fn(ctx)
+	res := Result{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status, res.Error = "fail", err.Error()
+		slog.WarnContext(ctx, "readiness check failed", "check", chk.Name, "err", err)
+	}
+	return res
+}
+
+// Readyz answers 200 when every check passes and 503 otherwise, with the
+// report as JSON either way
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := c.Report(r.Context())
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// Livez answers 200 while the process can serve HTTP at all. It checks no
+// dependencies, so an outage elsewhere never gets healthy instances restarted.
+func Livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte(`{"status":"ok"}` + "\n"))
+}
@@ -0,0 +1,123 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckerCachesReport(t *testing.T) {
+	var runs atomic.Int32
+	c := NewChecker(time.Second, 50*time.Millisecond, Check{Name: "db", Fn: func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}})
+	ctx := context.Background()
+
+	first := c.Report(ctx)
+	second := c.Report(ctx)
+	if runs.Load() != 1 || !second.CheckedAt.Equal(first.CheckedAt) {
+		t.Fatalf("checks ran %d times within the ttl, want 1", runs.Load())
+	}
+	time.Sleep(60 * time.Millisecond)
+	if c.Report(ctx); runs.Load() != 2 {
+		t.Errorf("checks ran %d times after the ttl, want 2", runs.Load())
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	hang := Check{Name: "mongo", Fn: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	ok := Check{Name: "postgres", Fn: func(context.Context) error { return nil }}
+	c := NewChecker(50*time.Millisecond, time.Minute, hang, ok)
+
+	start := time.Now()
+	report := c.Report(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("report took %v with a 50ms check timeout", elapsed)
+	}
+	if report.Status != "degraded" {
+		t.Errorf("status %q, want degraded", report.Status)
+	}
+	if got := report.Checks["mongo"]; got.Status != "fail" || got.Error != context.DeadlineExceeded.Error() || got.LatencyMS < 50 {
+		t.Errorf("hung check %+v, want a failure after the 50ms timeout", got)
+	}
+	if got := report.Checks["postgres"]; got.Status != "ok" || got.Error != "" {
+		t.Errorf("passing check %+v, want ok", got)
+	}
+}
+
+func TestCheckerRunsChecksConcurrently(t *testing.T) {
+	// Each check waits for the other to start, so run one at a time they
+	// would both time out
+	var started sync.WaitGroup
+	started.Add(2)
+	all := make(chan struct{})
+	go func() { started.Wait(); close(all) }()
+	wait := func(ctx context.Context) error {
+		started.Done()
+		select {
+		case <-all:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	c := NewChecker(time.Second, time.Minute, Check{Name: "a", Fn: wait}, Check{Name: "b", Fn: wait})
+
+	if report := c.Report(context.Background()); report.Status != "ok" {
+		t.Errorf("report %+v, want both checks ok", report)
+	}
+}
+
+func TestCheckerIgnoresProbeCancellation(t *testing.T) {
+	c := NewChecker(time.Second, time.Minute, Check{Name: "db", Fn: func(ctx context.Context) error { return ctx.Err() }})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The report is cached, so a probe that gave up must not leave failures in it
+	if report := c.Report(ctx); report.Status != "ok" {
+		t.Errorf("report for a cancelled probe %+v, want ok", report)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{"dependencies up", nil, http.StatusOK, "ok"},
+		{"dependency down", errors.New("connection refused"), http.StatusServiceUnavailable, "degraded"},
+	} {
+		c := NewChecker(time.Second, time.Minute, Check{Name: "db", Fn: func(context.Context) error { return tt.err }})
+		w := httptest.NewRecorder()
+		c.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var report Report
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if w.Code != tt.wantStatus || report.Status != tt.wantBody || w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: status %d body %+v, want %d %q", tt.name, w.Code, report, tt.wantStatus, tt.wantBody)
+		}
+		if tt.err != nil && report.Checks["db"].Error != tt.err.Error() {
+			t.Errorf("%s: check %+v does not carry the error", tt.name, report.Checks["db"])
+		}
+	}
+
+	w := httptest.NewRecorder()
+	Livez(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"status":"ok"}`+"\n" {
+		t.Errorf("livez %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,103 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Manager runs the HTTP server and background workers. On SIGINT or SIGTERM
+// it shuts down in order: the server stops accepting requests and drains the
+// in-flight ones, workers are cancelled and awaited, then resources are closed
+// in the order they were registered. One deadline covers the whole shutdown.
+type Manager struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+	workers sync.WaitGroup
+	closers []closer
+}
+
+type closer struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// New returns a manager that gives shutdown at most timeout
+func New(timeout time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel, timeout: timeout}
+}
+
+// Go runs a background worker until shutdown. fn must return once ctx is done.
+func (m *Manager) Go(name string, fn func(ctx context.Context)) {
+	m.workers.Add(1)
+	go func() {
+		defer m.workers.Done()
+		fn(m.ctx)
+		slog.Info("worker stopped", "worker", name)
+	}()
+}
+
+// OnClose registers a resource to close once the server and workers have stopped
+func (m *Manager) OnClose(name string, fn func(ctx context.Context) error) {
+	m.closers = append(m.closers, closer{name: name, fn: fn})
+}
+
+// Serve runs srv until a shutdown signal arrives or the server fails, then
+// shuts everything down. It returns the server's error, nil after a signal.
+func (m *Manager) Serve(srv *http.Server) error {
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+
+	var serveErr error
+	select {
+	case <-sigCtx.Done():
+		slog.Info("shutdown signal received, draining")
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr = err
+		}
+	}
+	stop() // a second signal kills the process straight away
+
+	m.shutdown(srv)
+	return serveErr
+}
+
+func (m *Manager) shutdown(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("HTTP requests still running at the deadline", "err", err)
+		_ = srv.Close()
+	}
+
+	m.cancel()
+	done := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("background workers still running at the deadline")
+	}
+
+	for _, c := range m.closers {
+		if err := c.fn(ctx); err != nil {
+			slog.Error("closing resource failed", "resource", c.name, "err", err)
+		}
+	}
+	slog.Info("shutdown complete")
+}
@@ -0,0 +1,117 @@
+package lifecycle
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// events records the order things happened in
+type events struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (e *events) add(s string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, s)
+}
+
+func (e *events) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.list)
+}
+
+func TestShutdownOrder(t *testing.T) {
+	var ev events
+	inRequest, release := make(chan struct{}), make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inRequest)
+		<-release
+		ev.add("request finished")
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+
+	m := New(5 * time.Second)
+	m.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		ev.add("worker stopped")
+	})
+	m.OnClose("mongo", func(ctx context.Context) error { ev.add("mongo closed"); return nil })
+	m.OnClose("postgres", func(ctx context.Context) error { ev.add("postgres closed"); return nil })
+
+	go func() {
+		if resp, err := http.Get("http://" + ln.Addr().String()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-inRequest
+
+	done := make(chan struct{})
+	go func() {
+		m.shutdown(srv)
+		close(done)
+	}()
+	// Workers keep running while the server drains
+	time.Sleep(50 * time.Millisecond)
+	if got := ev.get(); len(got) != 0 {
+		t.Fatalf("%v before the in-flight request finished", got)
+	}
+	close(release)
+	<-done
+
+	want := []string{"request finished", "worker stopped", "mongo closed", "postgres closed"}
+	if got := ev.get(); !slices.Equal(got, want) {
+		t.Errorf("shutdown order %v, want %v", got, want)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	var ev events
+	m := New(50 * time.Millisecond)
+	stuck := make(chan struct{})
+	defer close(stuck)
+	m.Go("stuck", func(ctx context.Context) { <-stuck })
+	m.OnClose("mongo", func(ctx context.Context) error {
+		if ctx.Err() == nil {
+			t.Error("closer ran with time left after the deadline passed")
+		}
+		ev.add("mongo closed")
+		return nil
+	})
+
+	start := time.Now()
+	m.shutdown(&http.Server{})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("shutdown took %v with a 50ms deadline", elapsed)
+	}
+	// Resources are still closed when a worker does not stop in time
+	if got := ev.get(); !slices.Equal(got, []string{"mongo closed"}) {
+		t.Errorf("events %v, want the closer to run", got)
+	}
+}
+
+func TestServeReturnsListenError(t *testing.T) {
+	var ev events
+	m := New(time.Second)
+	m.Go("worker", func(ctx context.Context) { <-ctx.Done(); ev.add("worker stopped") })
+	m.OnClose("mongo", func(ctx context.Context) error { ev.add("mongo closed"); return nil })
+
+	if err := m.Serve(&http.Server{Addr: "127.0.0.1:-1"}); err == nil {
+		t.Fatal("Serve returned nil for an address it cannot listen on")
+	}
+	// A failed server still shuts the rest down
+	if got, want := ev.get(), []string{"worker stopped", "mongo closed"}; !slices.Equal(got, want) {
+		t.Errorf("events %v, want %v", got, want)
+	}
+}
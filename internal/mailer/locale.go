@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"strings"
+)
+
+// countryLocales maps countries, as ISO codes or English names (upper case),
+// to the locale their users get by default
+var countryLocales = map[string]string{
+	"ES": "es", "MX": "es", "AR": "es", "CO": "es", "CL": "es", "PE": "es", "VE": "es", "EC": "es", "UY": "es",
+	"SPAIN": "es", "MEXICO": "es", "ARGENTINA": "es", "COLOMBIA": "es", "CHILE": "es", "PERU": "es",
+	"FR": "fr", "BE": "fr", "LU": "fr", "MC": "fr", "SN": "fr", "CI": "fr",
+	"FRANCE": "fr", "BELGIUM": "fr", "LUXEMBOURG": "fr",
+	"DE": "de", "AT": "de", "CH": "de", "LI": "de",
+	"GERMANY": "de", "AUSTRIA": "de", "SWITZERLAND": "de",
+}
+
+// ResolveLocale picks the email locale from an Accept-Language header, then
+// the user's country, then DefaultLocale. Only locales in supported count.
+func ResolveLocale(acceptLanguage, country string, supported []string) string {
+	has := func(l string) bool {
+		for _, s := range supported {
+			if s == l {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Accept-Language entries are usually already ordered by preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		base := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if has(base) {
+			return base
+		}
+	}
+
+	if l, ok := countryLocales[strings.ToUpper(strings.TrimSpace(country))]; ok && has(l) {
+		return l
+	}
+	return DefaultLocale
+}
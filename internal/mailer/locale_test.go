@@ -0,0 +1,33 @@
+package mailer
+
+import "testing"
+
+func TestResolveLocale(t *testing.T) {
+	supported := []string{"de", "en", "es", "fr"}
+	tests := []struct {
+		name, acceptLanguage, country, want string
+	}{
+		{"nothing to go on", "", "", DefaultLocale},
+		{"header language", "fr", "", "fr"},
+		{"region dropped", "es-MX,es;q=0.9", "", "es"},
+		{"case ignored", "DE-at", "", "de"},
+		{"first supported preference wins", "ja,pt-BR;q=0.9,de;q=0.8,fr;q=0.7", "", "de"},
+		{"header beats country", "fr-CA", "Germany", "fr"},
+		{"unsupported header falls back to country", "ja-JP", "MX", "es"},
+		{"wildcard skipped", "*", "AT", "de"},
+		{"country by ISO code", "", "be", "fr"},
+		{"country by name", "", " switzerland ", "de"},
+		{"unknown country", "", "Japan", DefaultLocale},
+		{"malformed header", ";q=0.5, ,", "", DefaultLocale},
+	}
+	for _, tt := range tests {
+		if got := ResolveLocale(tt.acceptLanguage, tt.country, supported); got != tt.want {
+			t.Errorf("%s: ResolveLocale(%q, %q) = %q, want %q", tt.name, tt.acceptLanguage, tt.country, got, tt.want)
+		}
+	}
+
+	// A locale without a variant of the template is never picked
+	if got := ResolveLocale("de", "Germany", []string{"en"}); got != DefaultLocale {
+		t.Errorf("unsupported locale picked: %q", got)
+	}
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"auth-microservice/internal/config"
+)
+
+// Transports selectable with MAIL_TRANSPORT
+const (
+	TransportSendGrid = "sendgrid"
+	TransportSMTP     = "smtp"
+	TransportOutbox   = "outbox"
+)
+
+// Message is a single email with plain-text and HTML bodies
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+
+	// Delivery metadata, used by the durable queue
+	Template       string `json:"template,omitempty"`
+	IdempotencyKey string `json:"-"` // the same key is only queued once
+	WorkspaceID    string `json:"-"` // lets workspace admins see the email's status
+}
+
+// Mailer delivers email. The sender address is part of the mailer's configuration.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by cfg.MailTransport
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailTransport {
+	case TransportSendGrid:
+		return NewSendGrid(cfg.EmailKey, cfg.Email, cfg.MailFromName), nil
+	case TransportSMTP:
+		return NewSMTP(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.Email, cfg.MailFromName), nil
+	case TransportOutbox:
+		return NewOutbox(cfg.MailOutboxDir)
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.MailTransport)
+	}
+}
+
+// Close releases the transport's resources, for transports that hold any
+func Close(m Mailer) error {
+	if c, ok := m.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outboxLimit caps how many messages the in-memory outbox keeps
+const outboxLimit = 200
+
+// OutboxMessage is a message captured by the outbox
+type OutboxMessage struct {
+	Message
+	SentAt time.Time `json:"sent_at"`
+}
+
+// Outbox captures email instead of sending it, for development and tests.
+// Messages are kept in memory and, when dir is set, also written there as JSON.
+type Outbox struct {
+	mu       sync.Mutex
+	messages []OutboxMessage
+	dir      string
+}
+
+// NewOutbox returns an outbox, creating dir if it is set
+func NewOutbox(dir string) (*Outbox, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create outbox dir: %w", err)
+		}
+	}
+	return &Outbox{dir: dir}, nil
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	m := OutboxMessage{Message: msg, SentAt: time.Now().UTC()}
+
+	o.mu.Lock()
+	o.messages = append(o.messages, m)
+	if len(o.messages) > outboxLimit {
+		o.messages = o.messages[len(o.messages)-outboxLimit:]
+	}
+	o.mu.Unlock()
+
+	slog.InfoContext(ctx, "email captured in outbox", "subject", msg.Subject, "to", msg.To)
+
+	if o.dir == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.json", m.SentAt.UnixNano(), sanitizeFilename(msg.To))
+	return os.WriteFile(filepath.Join(o.dir, name), b, 0o644)
+}
+
+// Messages returns captured messages, newest first, optionally only those to one address
+func (o *Outbox) Messages(to string) []OutboxMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	out := []OutboxMessage{}
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if to == "" || strings.EqualFold(o.messages[i].To, to) {
+			out = append(out, o.messages[i])
+		}
+	}
+	return out
+}
+
+// Clear drops all captured messages from memory
+func (o *Outbox) Clear() {
+	o.mu.Lock()
+	o.messages = nil
+	o.mu.Unlock()
+}
+
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		}
+		return '_'
+	}, s)
+}
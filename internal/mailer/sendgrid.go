@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// SendGrid sends email through the SendGrid API
+type SendGrid struct {
+	apiKey string
+	from   *mail.Email
+}
+
+// NewSendGrid returns a SendGrid mailer. fromEmail must be a verified sender.
+func NewSendGrid(apiKey, fromEmail, fromName string) *SendGrid {
+	return &SendGrid{apiKey: apiKey, from: mail.NewEmail(fromName, fromEmail)}
+}
+
+func (s *SendGrid) Send(ctx context.Context, msg Message) error {
+	message := mail.NewSingleEmail(s.from, msg.Subject, mail.NewEmail("", msg.To), msg.Text, msg.HTML)
+	client := sendgrid.NewSendClient(s.apiKey)
+
+	resp, err := client.SendWithContext(ctx, message)
+	if err != nil {
+		return fmt.Errorf("SendGrid error: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("SendGrid API returned status %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// SMTP sends email through a plain SMTP server
+type SMTP struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	fromName string
+}
+
+// NewSMTP returns an SMTP mailer. Username may be empty for servers without auth.
+func NewSMTP(host string, port int, username, password, fromEmail, fromName string) *SMTP {
+	return &SMTP{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     fromEmail,
+		fromName: fromName,
+	}
+}
+
+// Send delivers msg over one connection that ends with ctx, so nothing is
+// left sending after Send gives up.
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	m := gomail.NewMessage()
+	m.SetAddressHeader("From", s.from, s.fromName)
+	m.SetHeader("To", msg.To)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.Text)
+	if msg.HTML != "" {
+		m.AddAlternative("text/html", msg.HTML)
+	}
+
+	if err := s.send(ctx, msg.To, m); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("SMTP error: %w", err)
+	}
+	return nil
+}
+
+func (s *SMTP) send(ctx context.Context, to string, m *gomail.Message) error {
+	var d net.Dialer
+	raw, err := d.DialContext(ctx, "tcp", net.JoinHostPort(s.host, strconv.Itoa(s.port)))
+	if err != nil {
+		return err
+	}
+	defer raw.Close()
+	// Once ctx ends, a deadline in the past fails whatever read or write is
+	// in progress and every one after it
+	stop := context.AfterFunc(ctx, func() { _ = raw.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	conn := raw
+	tlsConfig := &tls.Config{ServerName: s.host}
+	implicitTLS := s.port == 465
+	if implicitTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && !implicitTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if ok, mechanisms := c.Extension("AUTH"); ok {
+			if err := c.Auth(s.auth(mechanisms)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := m.WriteTo(w); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	// The server has accepted the message; failing now would send it twice
+	_ = c.Quit()
+	return nil
+}
+
+// auth picks a mechanism the server advertises, preferring CRAM-MD5, then
+// PLAIN, then LOGIN
+func (s *SMTP) auth(mechanisms string) smtp.Auth {
+	switch {
+	case strings.Contains(mechanisms, "CRAM-MD5"):
+		return smtp.CRAMMD5Auth(s.username, s.password)
+	case strings.Contains(mechanisms, "LOGIN") && !strings.Contains(mechanisms, "PLAIN"):
+		return &loginAuth{username: s.username, password: s.password, host: s.host}
+	default:
+		return smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp lacks. Like
+// smtp.PlainAuth it refuses to send credentials unencrypted.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && server.Name != "localhost" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch {
+	case bytes.EqualFold(fromServer, []byte("Username:")):
+		return []byte(a.username), nil
+	case bytes.EqualFold(fromServer, []byte("Password:")):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+	}
+}
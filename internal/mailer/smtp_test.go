@@ -0,0 +1,121 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts one connection and answers a plain SMTP exchange.
+// With stallData it never acknowledges the message body. It reports the
+// message it received, and closes done once the client hung up.
+func fakeSMTPServer(t *testing.T, stallData bool) (host string, port int, received <-chan string, done <-chan struct{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	recv, closed := make(chan string, 1), make(chan struct{})
+
+	go func() {
+		defer close(closed)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var body strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return // client hung up
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					recv <- body.String()
+					if !stallData {
+						reply("250 queued")
+					}
+					continue
+				}
+				body.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, recv, closed
+}
+
+func TestSMTPSend(t *testing.T) {
+	host, port, received, _ := fakeSMTPServer(t, false)
+	m := NewSMTP(host, port, "", "", "noreply@example.com", "Example")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, Message{To: "user@example.com", Subject: "Sign in", Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	body := <-received
+	if !strings.Contains(body, "Subject: Sign in") || !strings.Contains(body, "hello") {
+		t.Errorf("unexpected message:\n%s", body)
+	}
+}
+
+// TestSMTPSendAbortsWithContext checks that a send given up on is not still
+// talking to the server, where it could deliver a message the outbox retries
+func TestSMTPSendAbortsWithContext(t *testing.T) {
+	host, port, _, done := fakeSMTPServer(t, true)
+	m := NewSMTP(host, port, "", "", "noreply@example.com", "Example")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := m.Send(ctx, Message{To: "user@example.com", Subject: "Sign in", Text: "hello"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection still open after Send returned")
+	}
+}
+
+func TestSMTPSendRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m := NewSMTP("127.0.0.1", port, "", "", "noreply@example.com", "Example")
+	err = m.Send(context.Background(), Message{To: "user@example.com", Subject: "x", Text: "x"})
+	if err == nil || !strings.HasPrefix(err.Error(), "SMTP error") {
+		t.Fatalf("err = %v, want an SMTP error on port %s", err, strconv.Itoa(port))
+	}
+}
@@ -0,0 +1,150 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template names
+const (
+	TemplateVerifyEmail     = "verify_email"
+	TemplateWorkspaceInvite = "workspace_invite"
+	TemplateChangeEmail     = "change_email"
+)
+
+// DefaultLocale is used when no variant exists for the requested locale
+const DefaultLocale = "en"
+
+//go:embed templates/*.html templates/*.txt
+var templateFS embed.FS
+
+// Brand is the product identity shown in every email
+type Brand struct {
+	Name         string
+	URL          string
+	SupportEmail string
+}
+
+// Templates renders the embedded email templates. Each email is a pair of
+// files, <name>.<locale>.html and <name>.<locale>.txt, wrapped in layout.html
+// and layout.txt. The text file also defines the "subject" block.
+type Templates struct {
+	brand Brand
+	html  map[string]*htmltemplate.Template // key: name.locale
+	text  map[string]*texttemplate.Template
+	names map[string][]string // template name -> locales
+}
+
+// NewTemplates parses every embedded template
+func NewTemplates(brand Brand) (*Templates, error) {
+	t := &Templates{
+		brand: brand,
+		html:  map[string]*htmltemplate.Template{},
+		text:  map[string]*texttemplate.Template{},
+		names: map[string][]string{},
+	}
+
+	files, err := fs.Glob(templateFS, "templates/*.*.txt")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		key := strings.TrimSuffix(strings.TrimPrefix(f, "templates/"), ".txt")
+		name, locale, _ := strings.Cut(key, ".")
+
+		tt, err := texttemplate.ParseFS(templateFS, "templates/layout.txt", f)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", f, err)
+		}
+		ht, err := htmltemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+key+".html")
+		if err != nil {
+			return nil, fmt.Errorf("parse %s.html: %w", key, err)
+		}
+		t.text[key] = tt
+		t.html[key] = ht
+		t.names[name] = append(t.names[name], locale)
+	}
+	for name, locales := range t.names {
+		sort.Strings(locales)
+		if _, ok := t.text[name+"."+DefaultLocale]; !ok {
+			return nil, fmt.Errorf("template %s has no %s variant", name, DefaultLocale)
+		}
+	}
+	return t, nil
+}
+
+// Render builds the message for a template in the closest available locale.
+// data supplies the template's fields; Brand and Locale are added to it.
+func (t *Templates) Render(name, locale, to string, data map[string]any) (Message, error) {
+	key := name + "." + locale
+	if _, ok := t.text[key]; !ok {
+		key = name + "." + DefaultLocale
+		locale = DefaultLocale
+	}
+	tt, ok := t.text[key]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	vars := map[string]any{}
+	for k, v := range data {
+		vars[k] = v
+	}
+	vars["Brand"] = t.brand
+	vars["Locale"] = locale
+
+	var subject, text, html bytes.Buffer
+	if err := tt.ExecuteTemplate(&subject, "subject", vars); err != nil {
+		return Message{}, fmt.Errorf("render %s subject: %w", key, err)
+	}
+	if err := tt.ExecuteTemplate(&text, "layout", vars); err != nil {
+		return Message{}, fmt.Errorf("render %s text: %w", key, err)
+	}
+	if err := t.html[key].ExecuteTemplate(&html, "layout", vars); err != nil {
+		return Message{}, fmt.Errorf("render %s html: %w", key, err)
+	}
+
+	return Message{
+		To:       to,
+		Subject:  strings.TrimSpace(subject.String()),
+		Text:     strings.TrimSpace(text.String()),
+		HTML:     html.String(),
+		Template: name,
+	}, nil
+}
+
+// Names lists the available templates and their locales
+func (t *Templates) Names() map[string][]string {
+	return t.names
+}
+
+// SampleData returns placeholder fields for previewing a template
+func SampleData(name string) map[string]any {
+	switch name {
+	case TemplateVerifyEmail:
+		return map[string]any{
+			"VerifyURL": "https://app.example.com/verify?token=sample",
+			"Code":      "123456",
+		}
+	case TemplateWorkspaceInvite:
+		return map[string]any{
+			"WorkspaceName": "Acme Marketing",
+			"InvitedBy":     "jane@example.com",
+			"Role":          "editor",
+			"AcceptURL":     "https://app.example.com/invite/accept?token=sample",
+		}
+	case TemplateChangeEmail:
+		return map[string]any{
+			"OldEmail":   "jane@example.com",
+			"ConfirmURL": "https://app.example.com/email/confirm?token=sample",
+		}
+	default:
+		return map[string]any{}
+	}
+}
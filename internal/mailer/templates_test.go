@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testTemplates(t *testing.T) *Templates {
+	t.Helper()
+	tpl, err := NewTemplates(Brand{Name: "Acme Rank", URL: "https://acme.example", SupportEmail: "help@acme.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tpl
+}
+
+func TestTemplatesRenderEveryLocale(t *testing.T) {
+	tpl := testTemplates(t)
+	names := tpl.Names()
+	for _, name := range []string{TemplateVerifyEmail, TemplateWorkspaceInvite, TemplateChangeEmail} {
+		if !slices.Equal(names[name], []string{"de", "en", "es", "fr"}) {
+			t.Errorf("%s has locales %v", name, names[name])
+		}
+	}
+
+	for name, locales := range names {
+		data := SampleData(name)
+		for _, locale := range locales {
+			msg, err := tpl.Render(name, locale, "to@example.com", data)
+			if err != nil {
+				t.Fatalf("%s.%s: %v", name, locale, err)
+			}
+			if msg.To != "to@example.com" || msg.Template != name || msg.Subject == "" || strings.Contains(msg.Subject, "\n") {
+				t.Errorf("%s.%s: message %+v", name, locale, msg)
+			}
+			for _, body := range []string{msg.Subject, msg.Text, msg.HTML} {
+				if strings.Contains(body, "<no value>") {
+					t.Errorf("%s.%s: a field is missing from the sample data:\n%s", name, locale, body)
+				}
+			}
+			// Every link in the sample data reaches both bodies
+			for _, v := range data {
+				if s, ok := v.(string); ok && strings.HasPrefix(s, "https://") {
+					if !strings.Contains(msg.Text, s) || !strings.Contains(msg.HTML, s) {
+						t.Errorf("%s.%s: link %s missing from a body", name, locale, s)
+					}
+				}
+			}
+			if !strings.Contains(msg.HTML, `<html lang="`+locale+`">`) || !strings.Contains(msg.Text, "help@acme.example") {
+				t.Errorf("%s.%s: layout not applied:\n%s", name, locale, msg.HTML)
+			}
+		}
+	}
+}
+
+func TestTemplatesRender(t *testing.T) {
+	tpl := testTemplates(t)
+
+	// Locales without a variant get the default one
+	msg, err := tpl.Render(TemplateWorkspaceInvite, "ja", "to@example.com", SampleData(TemplateWorkspaceInvite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "You've been invited to Acme Marketing on Acme Rank" || !strings.Contains(msg.HTML, `lang="en"`) {
+		t.Errorf("fallback rendered %q in %s", msg.Subject, msg.HTML[:60])
+	}
+
+	// Fields come from users, so the HTML body escapes them
+	data := SampleData(TemplateWorkspaceInvite)
+	data["WorkspaceName"] = `<script>alert("x")</script>`
+	msg, err = tpl.Render(TemplateWorkspaceInvite, "en", "to@example.com", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.HTML, "<script>") || !strings.Contains(msg.HTML, "&lt;script&gt;") {
+		t.Errorf("workspace name not escaped in HTML:\n%s", msg.HTML)
+	}
+
+	if _, err := tpl.Render("password_reset", "en", "to@example.com", nil); err == nil {
+		t.Error("unknown template rendered")
+	}
+}
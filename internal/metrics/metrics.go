@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the service's collectors. All methods are safe on a nil
+// *Metrics, so code under test can leave it out.
+type Metrics struct {
+	reg prometheus.Registerer
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	llmCalls    *prometheus.CounterVec
+	llmDuration *prometheus.HistogramVec
+	llmTokens   *prometheus.CounterVec
+
+	promptsAnalysed prometheus.Counter
+	emailsDelivered *prometheus.CounterVec
+	signups         *prometheus.CounterVec
+}
+
+// New creates the collectors and registers them with reg. Pass a fresh
+// prometheus.NewRegistry() in tests.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		reg: reg,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method and route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+
+		llmCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llm_calls_total",
+			Help: "LLM calls by provider, model and outcome (ok or error).",
+		}, []string{"provider", "model", "outcome"}),
+		llmDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "llm_call_duration_seconds",
+			Help:    "LLM call latency by provider and model.",
+			Buckets: []float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+		}, []string{"provider", "model"}),
+		llmTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llm_tokens_total",
+			Help: "LLM tokens used by provider, model and type (prompt or completion).",
+		}, []string{"provider", "model", "type"}),
+
+		promptsAnalysed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "prompts_analysed_total",
+			Help: "Prompt responses analysed and stored.",
+		}),
+		emailsDelivered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "email_deliveries_total",
+			Help: "Email delivery attempts by outcome (sent, retry or dead).",
+		}, []string{"outcome"}),
+		signups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "signups_total",
+			Help: "New accounts by sign-up method.",
+		}, []string{"method"}),
+	}
+	reg.MustRegister(m.httpRequests, m.httpDuration, m.llmCalls, m.llmDuration, m.llmTokens,
+		m.promptsAnalysed, m.emailsDelivered, m.signups)
+	return m
+}
+
+// Handler serves the metrics gathered by g. A non-empty token must be sent as
+// a Bearer token.
+func Handler(g prometheus.Gatherer, token string) http.Handler {
+	h := promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ObserveRequest implements middleware.RequestObserver
+func (m *Metrics) ObserveRequest(method, route string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	if route == "" {
+		route = "unmatched" // keeps scanners' random paths out of the label set
+	}
+	m.httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(method, route).Observe(d.Seconds())
+}
+
+// ObserveLLMCall records one LLM call and the tokens it used
+func (m *Metrics) ObserveLLMCall(provider, model string, d time.Duration, promptTokens, completionTokens int, err error) {
+	if m == nil {
+		return
+	}
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	m.llmCalls.WithLabelValues(provider, model, outcome).Inc()
+	m.llmDuration.WithLabelValues(provider, model).Observe(d.Seconds())
+	m.llmTokens.WithLabelValues(provider, model, "prompt").Add(float64(promptTokens))
+	m.llmTokens.WithLabelValues(provider, model, "completion").Add(float64(completionTokens))
+}
+
+// PromptsAnalysed counts n analysed prompt responses
+func (m *Metrics) PromptsAnalysed(n int) {
+	if m == nil {
+		return
+	}
+	m.promptsAnalysed.Add(float64(n))
+}
+
+// EmailDelivery counts a delivery attempt's outcome: sent, retry or dead
+func (m *Metrics) EmailDelivery(outcome string) {
+	if m == nil {
+		return
+	}
+	m.emailsDelivered.WithLabelValues(outcome).Inc()
+}
+
+// Signup counts a new account created through method
+func (m *Metrics) Signup(method string) {
+	if m == nil {
+		return
+	}
+	m.signups.WithLabelValues(method).Inc()
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHTTPMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+
+	m.ObserveRequest(http.MethodGet, "GET /v1/projects/{id}", http.StatusOK, 120*time.Millisecond)
+	m.ObserveRequest(http.MethodGet, "GET /v1/projects/{id}", http.StatusOK, 80*time.Millisecond)
+	m.ObserveRequest(http.MethodGet, "", http.StatusNotFound, time.Millisecond)
+
+	want := `
+# HELP http_requests_total HTTP requests by method, route pattern and status code.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="GET /v1/projects/{id}",status="200"} 2
+http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "http_requests_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(m.httpDuration); n != 2 {
+		t.Errorf("http_request_duration_seconds has %d series, want 2", n)
+	}
+}
+
+func TestLLMMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+
+	m.ObserveLLMCall("openai", "gpt-4o-mini", 2*time.Second, 100, 40, nil)
+	m.ObserveLLMCall("openai", "gpt-4o-mini", time.Second, 0, 0, errors.New("timeout"))
+
+	want := `
+# HELP llm_calls_total LLM calls by provider, model and outcome (ok or error).
+# TYPE llm_calls_total counter
+llm_calls_total{model="gpt-4o-mini",outcome="error",provider="openai"} 1
+llm_calls_total{model="gpt-4o-mini",outcome="ok",provider="openai"} 1
+# HELP llm_tokens_total LLM tokens used by provider, model and type (prompt or completion).
+# TYPE llm_tokens_total counter
+llm_tokens_total{model="gpt-4o-mini",provider="openai",type="completion"} 40
+llm_tokens_total{model="gpt-4o-mini",provider="openai",type="prompt"} 100
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "llm_calls_total", "llm_tokens_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(m.llmDuration); n != 1 {
+		t.Errorf("llm_call_duration_seconds has %d series, want 1", n)
+	}
+}
+
+func TestQueueCollector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+
+	m.RegisterQueue("email", func(context.Context) (map[string]int64, error) {
+		return map[string]int64{"pending": 3, "dead": 1}, nil
+	})
+	m.RegisterQueue("broken", func(context.Context) (map[string]int64, error) {
+		return nil, errors.New("db down")
+	})
+
+	want := `
+# HELP queue_jobs Jobs in a background queue by state.
+# TYPE queue_jobs gauge
+queue_jobs{queue="email",state="dead"} 1
+queue_jobs{queue="email",state="pending"} 3
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "queue_jobs"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.ObserveRequest(http.MethodGet, "/", http.StatusOK, time.Millisecond)
+	m.ObserveLLMCall("openai", "gpt-4o", time.Second, 1, 1, nil)
+	m.RegisterQueue("email", nil)
+	if m.MongoPoolMonitor() != nil {
+		t.Error("nil metrics returned a pool monitor")
+	}
+}
+
+func TestHandlerToken(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	New(reg).Signup("email")
+
+	tests := []struct {
+		name, token, auth string
+		want              int
+	}{
+		{"no token configured", "", "", http.StatusOK},
+		{"right token", "s3cret", "Bearer s3cret", http.StatusOK},
+		{"wrong token", "s3cret", "Bearer guess", http.StatusUnauthorized},
+		{"missing token", "s3cret", "", http.StatusUnauthorized},
+		{"token without scheme", "s3cret", "s3cret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		Handler(reg, tt.token).ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		exposed := strings.Contains(rec.Body.String(), "signups_total")
+		if exposed != (tt.want == http.StatusOK) {
+			t.Errorf("%s: metrics exposed = %v", tt.name, exposed)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// queueScrapeTimeout bounds the database query behind a queue depth scrape
+const queueScrapeTimeout = 5 * time.Second
+
+// RegisterPgxPool exports the pool's connection stats, read at scrape time
+func (m *Metrics) RegisterPgxPool(pool *pgxpool.Pool) {
+	if m == nil {
+		return
+	}
+	m.reg.MustRegister(&pgxPoolCollector{pool: pool})
+}
+
+var (
+	pgxAcquired      = prometheus.NewDesc("pgxpool_acquired_conns", "Connections currently in use.", nil, nil)
+	pgxIdle          = prometheus.NewDesc("pgxpool_idle_conns", "Idle connections.", nil, nil)
+	pgxTotal         = prometheus.NewDesc("pgxpool_total_conns", "Open connections.", nil, nil)
+	pgxMax           = prometheus.NewDesc("pgxpool_max_conns", "Maximum pool size.", nil, nil)
+	pgxAcquires      = prometheus.NewDesc("pgxpool_acquires_total", "Successful connection acquires.", nil, nil)
+	pgxEmptyAcquires = prometheus.NewDesc("pgxpool_empty_acquires_total", "Acquires that had to wait for a connection.", nil, nil)
+	pgxAcquireWait   = prometheus.NewDesc("pgxpool_acquire_wait_seconds_total", "Time spent acquiring connections.", nil, nil)
+)
+
+type pgxPoolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (c *pgxPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{pgxAcquired, pgxIdle, pgxTotal, pgxMax, pgxAcquires, pgxEmptyAcquires, pgxAcquireWait} {
+		ch <- d
+	}
+}
+
+func (c *pgxPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(pgxAcquired, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(pgxIdle, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(pgxTotal, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(pgxMax, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(pgxAcquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pgxEmptyAcquires, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pgxAcquireWait, prometheus.CounterValue, s.AcquireDuration().Seconds())
+}
+
+// MongoPoolMonitor returns a pool monitor to set on the Mongo client options.
+// It tracks open and checked-out connections, and failed checkouts by reason.
+// A nil *Metrics returns nil, which the driver treats as no monitor.
+func (m *Metrics) MongoPoolMonitor() *event.PoolMonitor {
+	if m == nil {
+		return nil
+	}
+	open := prometheus.NewGauge(prometheus.GaugeOpts{Name: "mongo_pool_open_conns", Help: "Open Mongo connections."})
+	inUse := prometheus.NewGauge(prometheus.GaugeOpts{Name: "mongo_pool_checked_out_conns", Help: "Mongo connections checked out."})
+	failed := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongo_pool_checkout_failures_total",
+		Help: "Failed Mongo connection checkouts by reason.",
+	}, []string{"reason"})
+	m.reg.MustRegister(open, inUse, failed)
+
+	return &event.PoolMonitor{Event: func(e *event.PoolEvent) {
+		switch e.Type {
+		case event.ConnectionCreated:
+			open.Inc()
+		case event.ConnectionClosed:
+			open.Dec()
+		case event.GetSucceeded:
+			inUse.Inc()
+		case event.ConnectionReturned:
+			inUse.Dec()
+		case event.GetFailed:
+			failed.WithLabelValues(e.Reason).Inc()
+		}
+	}}
+}
+
+// QueueDepthFunc returns the number of jobs in each state of a queue
+type QueueDepthFunc func(ctx context.Context) (map[string]int64, error)
+
+// RegisterQueue exports a queue's depth by state, read at scrape time
+func (m *Metrics) RegisterQueue(name string, depth QueueDepthFunc) {
+	if m == nil {
+		return
+	}
+	m.reg.MustRegister(&queueCollector{name: name, depth: depth})
+}
+
+var queueJobs = prometheus.NewDesc("queue_jobs", "Jobs in a background queue by state.", []string{"queue", "state"}, nil)
+
+type queueCollector struct {
+	name  string
+	depth QueueDepthFunc
+}
+
+// Describe sends nothing, leaving the collector unchecked: every queue
+// exports queue_jobs, which a checked collector could only do once
+func (c *queueCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), queueScrapeTimeout)
+	defer cancel()
+	counts, err := c.depth(ctx)
+	if err != nil {
+		slog.Warn("queue depth scrape failed", "queue", c.name, "err", err)
+		return
+	}
+	for state, n := range counts {
+		ch <- prometheus.MustNewConstMetric(queueJobs, prometheus.GaugeValue, float64(n), c.name, state)
+	}
+}
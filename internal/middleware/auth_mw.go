@@ -1,24 +1,64 @@
 package middleware
 
 import (
+	"auth-microservice/internal/apperr"
 	"auth-microservice/internal/auth"
 	"auth-microservice/internal/pkg"
+	"context"
+	"fmt"
 	"net/http"
 	"strings"
 )
 
-// JWTAuth is middleware that validates a JWT token and injects the email into the request context
-func JWTAuth(secret string, next http.Handler) http.Handler {
+var (
+	errMissingAuthHeader = apperr.New(apperr.Unauthorized, "missing_credentials", "missing authorization header")
+	errInvalidAuthHeader = apperr.New(apperr.Unauthorized, "invalid_credentials", "invalid authorization header")
+	errWrongTokenType    = apperr.New(apperr.Unauthorized, "invalid_token", "this token cannot be used here")
+	errSessionNeedsMFA   = apperr.New(apperr.Unauthorized, "mfa_required", "this workspace requires two-factor authentication, sign in again")
+	errAPIKeyNeedsMFA    = apperr.New(apperr.Forbidden, "mfa_required", "this workspace requires two-factor authentication, create a new key from a session that completed it")
+)
+
+// APIKeyAuthenticator resolves an API key to the principal it acts as
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+// SessionValidator checks that a signed token still belongs to a live session.
+// ValidateSession returns auth.ErrSessionRevoked for revoked sessions;
+// CurrentRole returns the user's role in a workspace now, "" for non-members;
+// RequiresMFA reports whether a workspace requires MFA now.
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, claims *auth.JWTClaims) error
+	CurrentRole(ctx context.Context, userID, workspaceID string) (string, error)
+	RequiresMFA(ctx context.Context, workspaceID string) (bool, error)
+}
+
+// JWTAuth is middleware that validates a JWT token and injects the email, user ID
+// and active workspace into the request context. Step-up tokens are refused.
+// The role is the user's current one in the workspace, not the token's claim,
+// so a demotion or removal applies to tokens already issued. Likewise tokens
+// without MFA stop working once their workspace requires it.
+func JWTAuth(secret string, sessions SessionValidator, next http.Handler) http.Handler {
+	return jwtAuth(secret, "", sessions, next)
+}
+
+// MFAEnrollAuth is JWTAuth that also accepts mfa_enroll tokens, for the routes
+// a member must reach to set up MFA before a workspace will let them in
+func MFAEnrollAuth(secret string, sessions SessionValidator, next http.Handler) http.Handler {
+	return jwtAuth(secret, auth.TokenTypeMFAEnroll, sessions, next)
+}
+
+func jwtAuth(secret, allowType string, sessions SessionValidator, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "missing authorization header", http.StatusUnauthorized)
+			WriteError(w, r, errMissingAuthHeader)
 			return
 		}
 
 		parts := strings.Fields(authHeader)
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			http.Error(w, "invalid authorization header", http.StatusUnauthorized)
+			WriteError(w, r, errInvalidAuthHeader)
 			return
 		}
 
@@ -27,15 +67,145 @@ func JWTAuth(secret string, next http.Handler) http.Handler {
 		// verify JWT...
 		claims, err := auth.ParseToken(secret, tokenString)
 		if err != nil {
-			http.Error(w, "invalid token: "+err.Error(), http.StatusUnauthorized)
+			WriteError(w, r, apperr.Wrap(apperr.Unauthorized, "invalid_token", "invalid or expired token", err))
 			return
 		}
-		// Get email & UserID from claims
-		email := claims.Email
-		userID := claims.UserID
-		// Store in context
-		ctx := pkg.WithEmail(r.Context(), email)
-		ctx = pkg.WithUserID(ctx, userID)
+		if claims.TokenType != "" && claims.TokenType != allowType {
+			WriteError(w, r, errWrongTokenType)
+			return
+		}
+		// auth.ErrSessionRevoked is a 401; anything else failed to check
+		if err := sessions.ValidateSession(r.Context(), claims); err != nil {
+			WriteError(w, r, fmt.Errorf("failed to verify session: %w", err))
+			return
+		}
+		if claims.Act != nil {
+			// The operator's own session must still be live too, so disabling
+			// them or revoking their sessions ends the impersonation
+			actor := *claims
+			actor.UserID = claims.Act.UserID
+			if err := sessions.ValidateSession(r.Context(), &actor); err != nil {
+				WriteError(w, r, fmt.Errorf("failed to verify impersonating operator's session: %w", err))
+				return
+			}
+		}
+		workspaceID, role := claims.WorkspaceID, ""
+		if workspaceID != "" {
+			if role, err = sessions.CurrentRole(r.Context(), claims.UserID, workspaceID); err != nil {
+				WriteError(w, r, fmt.Errorf("failed to verify workspace role: %w", err))
+				return
+			}
+			// A removed member keeps their token but loses the workspace; they
+			// can still reach their account and switch to another workspace
+			if role == "" {
+				workspaceID = ""
+			}
+		}
+		// mfa_enroll tokens exist to reach MFA set-up, so they are let through
+		if role != "" && !claims.MFA && claims.TokenType != auth.TokenTypeMFAEnroll {
+			if !checkWorkspaceMFA(w, r, sessions, workspaceID, errSessionNeedsMFA) {
+				return
+			}
+		}
+		// Get email, UserID & active workspace from claims and store in context
+		principal := auth.Principal{
+			Email:       claims.Email,
+			UserID:      claims.UserID,
+			WorkspaceID: workspaceID,
+			Role:        role,
+			MFA:         claims.MFA,
+			SysRole:     claims.SysRole,
+		}
+		if claims.Act != nil {
+			principal.ImpersonatorID, principal.ImpersonatorEmail = claims.Act.UserID, claims.Act.Email
+		}
+		ctx := WithPrincipal(r.Context(), principal)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// checkWorkspaceMFA writes refusal and reports false when the workspace
+// requires MFA
+func checkWorkspaceMFA(w http.ResponseWriter, r *http.Request, sessions SessionValidator, workspaceID string, refusal error) bool {
+	required, err := sessions.RequiresMFA(r.Context(), workspaceID)
+	if err != nil {
+		WriteError(w, r, fmt.Errorf("failed to check workspace MFA requirement: %w", err))
+		return false
+	}
+	if required {
+		WriteError(w, r, refusal)
+		return false
+	}
+	return true
+}
+
+// Authenticate is middleware that accepts either a Bearer JWT or an API key,
+// sent as a Bearer token or in the X-API-Key header, and injects the same
+// context values for both. A key counts as MFA only when the session that
+// created it had completed MFA.
+func Authenticate(secret string, sessions SessionValidator, keys APIKeyAuthenticator, next http.Handler) http.Handler {
+	jwtAuth := JWTAuth(secret, sessions, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			parts := strings.Fields(r.Header.Get("Authorization"))
+			if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" && auth.IsAPIKey(parts[1]) {
+				key = parts[1]
+			}
+		}
+		if key == "" {
+			jwtAuth.ServeHTTP(w, r)
+			return
+		}
+
+		// auth.ErrInvalidAPIKey is a 401; anything else failed to check
+		principal, err := keys.AuthenticateAPIKey(r.Context(), key)
+		if err != nil {
+			WriteError(w, r, fmt.Errorf("failed to verify api key: %w", err))
+			return
+		}
+		if !principal.MFA && !checkWorkspaceMFA(w, r, sessions, principal.WorkspaceID, errAPIKeyNeedsMFA) {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), *principal)))
+	})
+}
+
+// WithPrincipal stores an authenticated identity in the context
+func WithPrincipal(ctx context.Context, p auth.Principal) context.Context {
+	ctx = pkg.WithEmail(ctx, p.Email)
+	ctx = pkg.WithUserID(ctx, p.UserID)
+	ctx = pkg.WithWorkspaceID(ctx, p.WorkspaceID)
+	ctx = pkg.WithRole(ctx, p.Role)
+	ctx = pkg.WithMFA(ctx, p.MFA)
+	ctx = pkg.WithAPIKeyID(ctx, p.APIKeyID)
+	ctx = pkg.WithSysRole(ctx, p.SysRole)
+	ctx = pkg.WithLogger(ctx, pkg.Logger(ctx).With("user_id", p.UserID))
+	setAccessUser(ctx, p.UserID)
+	if p.ImpersonatorID != "" {
+		ctx = pkg.WithImpersonator(ctx, pkg.Impersonator{ID: p.ImpersonatorID, Email: p.ImpersonatorEmail})
+	}
+	return pkg.WithScopes(ctx, p.Scopes)
+}
+
+// PrincipalFromContext rebuilds the identity stored by WithPrincipal
+func PrincipalFromContext(ctx context.Context) auth.Principal {
+	email, _ := pkg.GetEmailFromContext(ctx)
+	userID, _ := pkg.GetUserIDFromContext(ctx)
+	workspaceID, _ := pkg.GetWorkspaceIDFromContext(ctx)
+	role, _ := pkg.GetRoleFromContext(ctx)
+	imp, _ := pkg.GetImpersonatorFromContext(ctx)
+	return auth.Principal{
+		Email:       email,
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+		Role:        role,
+		Scopes:      pkg.GetScopesFromContext(ctx),
+		MFA:         pkg.GetMFAFromContext(ctx),
+		APIKeyID:    pkg.GetAPIKeyIDFromContext(ctx),
+		SysRole:     pkg.GetSysRoleFromContext(ctx),
+
+		ImpersonatorID:    imp.ID,
+		ImpersonatorEmail: imp.Email,
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/pkg"
+)
+
+// TestStepUpTokens checks that mfa_pending tokens open no authenticated route
+// and mfa_enroll tokens only the enrolment routes
+func TestStepUpTokens(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	sessions := fakeSessions{roles: map[string]string{"u1/ws1": "owner"}}
+
+	tests := []struct {
+		name      string
+		tokenType string
+		guard     func(string, SessionValidator, http.Handler) http.Handler
+		want      int
+	}{
+		{"access token on a route", "", JWTAuth, http.StatusOK},
+		{"access token on enrolment", "", MFAEnrollAuth, http.StatusOK},
+		{"mfa_pending on a route", auth.TokenTypeMFAPending, JWTAuth, http.StatusUnauthorized},
+		{"mfa_pending on enrolment", auth.TokenTypeMFAPending, MFAEnrollAuth, http.StatusUnauthorized},
+		{"mfa_enroll on a route", auth.TokenTypeMFAEnroll, JWTAuth, http.StatusUnauthorized},
+		{"mfa_enroll on enrolment", auth.TokenTypeMFAEnroll, MFAEnrollAuth, http.StatusOK},
+	}
+	for _, tt := range tests {
+		token, err := auth.GenerateAccessToken(testSecret, auth.JWTClaims{UserID: "u1", WorkspaceID: "ws1", TokenType: tt.tokenType}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/auth/mfa/setup", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		tt.guard(testSecret, sessions, ok).ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+// fakeKeys resolves every API key to a fixed principal
+type fakeKeys struct{ principal auth.Principal }
+
+func (f fakeKeys) AuthenticateAPIKey(context.Context, string) (*auth.Principal, error) {
+	p := f.principal
+	return &p, nil
+}
+
+func TestWorkspaceMFARequirement(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	sessions := fakeSessions{
+		roles:      map[string]string{"u1/strict": "editor", "u1/open": "editor"},
+		requireMFA: map[string]bool{"strict": true},
+	}
+
+	tokens := []struct {
+		name      string
+		claims    auth.JWTClaims
+		guard     func(string, SessionValidator, http.Handler) http.Handler
+		want      int
+		workspace string
+	}{
+		{"token without MFA", auth.JWTClaims{UserID: "u1", WorkspaceID: "strict"}, JWTAuth, http.StatusUnauthorized, ""},
+		{"token with MFA", auth.JWTClaims{UserID: "u1", WorkspaceID: "strict", MFA: true}, JWTAuth, http.StatusOK, "strict"},
+		{"token without MFA, workspace not requiring it", auth.JWTClaims{UserID: "u1", WorkspaceID: "open"}, JWTAuth, http.StatusOK, "open"},
+		{"mfa_enroll token on enrolment", auth.JWTClaims{UserID: "u1", WorkspaceID: "strict", TokenType: auth.TokenTypeMFAEnroll}, MFAEnrollAuth, http.StatusOK, "strict"},
+		{"removed member", auth.JWTClaims{UserID: "u2", WorkspaceID: "strict"}, JWTAuth, http.StatusOK, ""},
+	}
+	for _, tt := range tokens {
+		token, err := auth.GenerateAccessToken(testSecret, tt.claims, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var workspace string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			workspace, _ = pkg.GetWorkspaceIDFromContext(r.Context())
+			ok.ServeHTTP(w, r)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/v1/projects", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		tt.guard(testSecret, sessions, next).ServeHTTP(w, req)
+
+		if w.Code != tt.want || workspace != tt.workspace {
+			t.Errorf("%s: status %d workspace %q, want %d %q", tt.name, w.Code, workspace, tt.want, tt.workspace)
+		}
+	}
+
+	keys := []struct {
+		name      string
+		principal auth.Principal
+		want      int
+	}{
+		{"key created without MFA", auth.Principal{UserID: "u1", WorkspaceID: "strict", Role: "editor", APIKeyID: "k1"}, http.StatusForbidden},
+		{"key created with MFA", auth.Principal{UserID: "u1", WorkspaceID: "strict", Role: "editor", APIKeyID: "k1", MFA: true}, http.StatusOK},
+		{"key without MFA, workspace not requiring it", auth.Principal{UserID: "u1", WorkspaceID: "open", Role: "editor", APIKeyID: "k1"}, http.StatusOK},
+	}
+	for _, tt := range keys {
+		req := httptest.NewRequest(http.MethodGet, "/v1/projects", nil)
+		req.Header.Set("X-API-Key", "aeo_test_key")
+		w := httptest.NewRecorder()
+		Authenticate(testSecret, sessions, fakeKeys{tt.principal}, ok).ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -1,20 +1,120 @@
 package middleware
 
-import "net/http"
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
 
-func CORS(next http.Handler) http.Handler {
+// CORSPolicy says which browser origins may call a set of routes and how
+type CORSPolicy struct {
+	// AllowedOrigins holds exact origins ("https://app.example.com"),
+	// wildcard-subdomain patterns ("https://*.example.com", which does not
+	// match the bare domain) or "*" for any origin
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration // preflight cache lifetime; 0 leaves it to the browser
+}
+
+// CORSRoute applies its own policy to every path under Prefix
+type CORSRoute struct {
+	Prefix string
+	Policy CORSPolicy
+}
+
+// CORS applies policy to cross-origin requests, or the policy of the longest
+// matching route override. Preflights from allowed origins are answered here
+// with 204; those from other origins get a 403. Other requests always reach
+// next, but only allowed origins get CORS headers, so browsers block the rest.
+func CORS(policy CORSPolicy, routes []CORSRoute, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow all origins for dev — restrict in prod
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		// Handle preflight (OPTIONS) requests quickly
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
+		p := policy
+		longest := -1
+		for _, rt := range routes {
+			if strings.HasPrefix(r.URL.Path, rt.Prefix) && len(rt.Prefix) > longest {
+				p, longest = rt.Policy, len(rt.Prefix)
+			}
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !p.allows(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if p.AllowCredentials || !slices.Contains(p.AllowedOrigins, "*") {
+			h.Set("Access-Control-Allow-Origin", origin)
+		} else {
+			h.Set("Access-Control-Allow-Origin", "*")
+		}
+		if p.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if len(p.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+		if len(p.AllowedHeaders) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+		}
+		if p.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
 	})
 }
+
+func (p CORSPolicy) allows(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	for _, o := range p.AllowedOrigins {
+		if o == "*" || matchOrigin(o, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin compares an origin with an allowed entry: scheme and port must
+// match exactly, and a "*." host matches any subdomain at any depth
+func matchOrigin(allowed string, origin *url.URL) bool {
+	a, err := url.Parse(strings.TrimRight(allowed, "/"))
+	if err != nil || !strings.EqualFold(a.Scheme, origin.Scheme) || a.Port() != origin.Port() {
+		return false
+	}
+	host, want := strings.ToLower(origin.Hostname()), strings.ToLower(a.Hostname())
+	if suffix, ok := strings.CutPrefix(want, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == want
+}
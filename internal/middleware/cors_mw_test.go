@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		allowed, origin string
+		want            bool
+	}{
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com/", "https://app.example.com", true},
+		{"https://app.example.com", "https://APP.example.com", true},
+		{"https://app.example.com", "http://app.example.com", false},
+		{"https://app.example.com", "https://app.example.com:8443", false},
+		{"http://localhost:3000", "http://localhost:3000", true},
+		{"http://localhost:3000", "http://localhost:3001", false},
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://eu.app.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://app.example.com.evil.com", false},
+		{"https://*.example.com", "https://example.com.evil.com", false},
+		{"https://*.example.com", "https://app.example.co", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://app.example.com@evil.com", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := matchOrigin(tt.allowed, u); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.allowed, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	policy := CORSPolicy{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.preview.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	public := CORSPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}}
+	handler := CORS(policy, []CORSRoute{{Prefix: "/v1/public/", Policy: public}}, ok)
+
+	tests := []struct {
+		name, method, path, origin string
+		preflight                  bool
+		wantStatus                 int
+		wantOrigin                 string
+		wantCredentials            bool
+	}{
+		{"same-origin request", http.MethodGet, "/v1/me", "", false, http.StatusOK, "", false},
+		{"allowed origin", http.MethodGet, "/v1/me", "https://app.example.com", false, http.StatusOK, "https://app.example.com", true},
+		{"allowed subdomain", http.MethodGet, "/v1/me", "https://pr-1.preview.example.com", false, http.StatusOK, "https://pr-1.preview.example.com", true},
+		{"bare domain of a pattern", http.MethodGet, "/v1/me", "https://preview.example.com", false, http.StatusOK, "", false},
+		{"lookalike domain", http.MethodGet, "/v1/me", "https://app.example.com.evil.com", false, http.StatusOK, "", false},
+		{"allowed preflight", http.MethodOptions, "/v1/me", "https://app.example.com", true, http.StatusNoContent, "https://app.example.com", true},
+		{"refused preflight", http.MethodOptions, "/v1/me", "https://evil.com", true, http.StatusForbidden, "", false},
+		{"route policy", http.MethodGet, "/v1/public/brands", "https://evil.com", false, http.StatusOK, "*", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.preflight {
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		h := w.Header()
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+		if got := h.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin %q, want %q", tt.name, got, tt.wantOrigin)
+		}
+		if got := h.Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCredentials {
+			t.Errorf("%s: credentials %v, want %v", tt.name, got, tt.wantCredentials)
+		}
+		if tt.preflight && tt.wantStatus == http.StatusNoContent {
+			if h.Get("Access-Control-Allow-Methods") != "GET, POST" || h.Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("%s: preflight headers %v", tt.name, h)
+			}
+		}
+	}
+}
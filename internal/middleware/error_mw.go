@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/pkg"
+)
+
+// ErrorBody is the JSON body of every error response
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code               string            `json:"code"`
+	Message            string            `json:"message"`
+	Fields             map[string]string `json:"fields,omitempty"`
+	RequestID          string            `json:"request_id,omitempty"`
+	RequiredPermission string            `json:"required_permission,omitempty"`
+}
+
+// errorStatus maps an error kind to its HTTP status code
+func errorStatus(kind apperr.Kind) int {
+	switch kind {
+	case apperr.NotFound:
+		return http.StatusNotFound
+	case apperr.Validation:
+		return http.StatusBadRequest
+	case apperr.Conflict:
+		return http.StatusConflict
+	case apperr.Unauthorized:
+		return http.StatusUnauthorized
+	case apperr.Forbidden:
+		return http.StatusForbidden
+	case apperr.RateLimited:
+		return http.StatusTooManyRequests
+	case apperr.Upstream:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// WriteError sends err as the JSON error envelope. An *apperr.Error anywhere
+// in the chain sets the status, code and message; anything else is a 500
+// with a generic message. Internal details are logged, never returned.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	requestID := pkg.GetRequestInfo(r.Context()).ID
+
+	var e *apperr.Error
+	if !errors.As(err, &e) {
+		e = apperr.New(apperr.Internal, "internal", "something went wrong")
+	}
+	status := errorStatus(e.Kind)
+	if status >= http.StatusInternalServerError {
+		pkg.Logger(r.Context()).Error("request failed", "method", r.Method, "path", r.URL.Path, "status", status, "err", err)
+	}
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", retryAfterSeconds(e.RetryAfter))
+	}
+
+	writeErrorBody(w, status, ErrorDetail{Code: e.Code, Message: e.Message, Fields: e.Fields, RequestID: requestID})
+}
+
+// WriteForbidden writes the standard 403 body. perm may be empty when the
+// refusal is not about a single permission.
+func WriteForbidden(w http.ResponseWriter, r *http.Request, message string, perm auth.Permission) {
+	writeErrorBody(w, http.StatusForbidden, ErrorDetail{
+		Code:               "forbidden",
+		Message:            message,
+		RequestID:          pkg.GetRequestInfo(r.Context()).ID,
+		RequiredPermission: string(perm),
+	})
+}
+
+func writeErrorBody(w http.ResponseWriter, status int, detail ErrorDetail) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ErrorBody{Error: detail})
+}
+
+// retryAfterSeconds formats d for the Retry-After header, rounding up so
+// clients never retry early
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/pkg"
+)
+
+// writeTestError sends err through WriteError for a request with ID req-1
+func writeTestError(err error) (*httptest.ResponseRecorder, ErrorBody) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/things", nil)
+	r = r.WithContext(pkg.WithRequestInfo(r.Context(), pkg.RequestInfo{ID: "req-1"}))
+	w := httptest.NewRecorder()
+	WriteError(w, r, err)
+
+	var body ErrorBody
+	_ = json.NewDecoder(w.Body).Decode(&body)
+	return w, body
+}
+
+func TestWriteErrorStatus(t *testing.T) {
+	tests := []struct {
+		kind apperr.Kind
+		want int
+	}{
+		{apperr.NotFound, http.StatusNotFound},
+		{apperr.Validation, http.StatusBadRequest},
+		{apperr.Conflict, http.StatusConflict},
+		{apperr.Unauthorized, http.StatusUnauthorized},
+		{apperr.Forbidden, http.StatusForbidden},
+		{apperr.RateLimited, http.StatusTooManyRequests},
+		{apperr.Upstream, http.StatusBadGateway},
+		{apperr.Internal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		// Errors keep their meaning however deeply they are wrapped
+		err := fmt.Errorf("handler step: %w", fmt.Errorf("service: %w", apperr.New(tt.kind, "some_code", "some message")))
+		w, body := writeTestError(err)
+		if w.Code != tt.want || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: status %d %s, want %d JSON", tt.kind, w.Code, w.Header().Get("Content-Type"), tt.want)
+		}
+		if body.Error.Code != "some_code" || body.Error.Message != "some message" || body.Error.RequestID != "req-1" {
+			t.Errorf("%s: body %+v", tt.kind, body.Error)
+		}
+	}
+}
+
+func TestWriteErrorHidesInternals(t *testing.T) {
+	logs := captureLogs(t)
+	w, body := writeTestError(fmt.Errorf("failed to fetch user: %w", errors.New("mongo: connection to 10.0.0.5 refused")))
+	if w.Code != http.StatusInternalServerError || body.Error.Code != "internal" || body.Error.Message != "something went wrong" {
+		t.Errorf("plain error: %d %+v", w.Code, body.Error)
+	}
+	if raw := w.Body.String(); strings.Contains(raw, "10.0.0.5") {
+		t.Errorf("response leaks the cause: %s", raw)
+	}
+	// The cause goes to the log instead
+	if !strings.Contains(logs.String(), "10.0.0.5") || !strings.Contains(logs.String(), `"status":500`) {
+		t.Errorf("cause not logged: %s", logs)
+	}
+
+	// Wrapped causes of client errors stay private too
+	w, body = writeTestError(apperr.Wrap(apperr.Upstream, "llm_failed", "the language model request failed", errors.New("api key sk-123 rejected")))
+	if w.Code != http.StatusBadGateway || strings.Contains(w.Body.String(), "sk-123") || body.Error.Message != "the language model request failed" {
+		t.Errorf("upstream error: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWriteErrorDetails(t *testing.T) {
+	w, body := writeTestError(apperr.Invalid("invalid request", map[string]string{"email": "failed email"}))
+	if w.Code != http.StatusBadRequest || body.Error.Code != "invalid_request" || body.Error.Fields["email"] != "failed email" {
+		t.Errorf("validation error: %d %+v", w.Code, body.Error)
+	}
+
+	for d, want := range map[time.Duration]string{
+		30 * time.Second:        "30",
+		1500 * time.Millisecond: "2", // rounded up so clients never retry early
+		time.Millisecond:        "1",
+	} {
+		w, body := writeTestError(apperr.Retry("rate_limited", "slow down", d))
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != want || body.Error.Code != "rate_limited" {
+			t.Errorf("retry after %v: %d Retry-After %q, want %q", d, w.Code, w.Header().Get("Retry-After"), want)
+		}
+	}
+	if w, _ := writeTestError(apperr.New(apperr.Conflict, "taken", "taken")); w.Header().Get("Retry-After") != "" {
+		t.Error("Retry-After set on an error without a delay")
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/workspace/members", nil)
+	r = r.WithContext(pkg.WithRequestInfo(r.Context(), pkg.RequestInfo{ID: "req-2"}))
+	fw := httptest.NewRecorder()
+	WriteForbidden(fw, r, "your role does not allow this action", auth.PermAdminMembers)
+	var forbidden ErrorBody
+	_ = json.NewDecoder(fw.Body).Decode(&forbidden)
+	if got := forbidden.Error; fw.Code != http.StatusForbidden || got.Code != "forbidden" || got.Message != "your role does not allow this action" ||
+		got.RequestID != "req-2" || got.RequiredPermission != string(auth.PermAdminMembers) {
+		t.Errorf("forbidden: %d %+v", fw.Code, forbidden.Error)
+	}
+}
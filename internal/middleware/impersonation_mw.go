@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"auth-microservice/internal/pkg"
+)
+
+// ImpersonationRecorder logs requests made with an impersonation token
+type ImpersonationRecorder interface {
+	RecordImpersonatedRequest(ctx context.Context, method, path string, status int)
+}
+
+// ReadOnly refuses mutating requests made with an impersonation token and
+// records every impersonated request, refused or not. Other requests pass
+// straight through. It must run after JWTAuth or Authenticate.
+func ReadOnly(rec ImpersonationRecorder, next http.Handler) http.Handler {
+	return impersonated(rec, next, "impersonation sessions are read-only", func(r *http.Request) bool {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return true
+		}
+		return false
+	})
+}
+
+// NoImpersonation refuses every request made with an impersonation token,
+// reads included, for routes only the user's own session may use, such as
+// exporting their data. Refusals are recorded like ReadOnly's.
+func NoImpersonation(rec ImpersonationRecorder, next http.Handler) http.Handler {
+	return impersonated(rec, next, "impersonation sessions cannot use the user's own account routes", func(*http.Request) bool { return false })
+}
+
+// impersonated serves impersonated requests that allowed accepts, refuses the
+// rest with refusal and records them all
+func impersonated(rec ImpersonationRecorder, next http.Handler, refusal string, allowed func(*http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := pkg.GetImpersonatorFromContext(r.Context()); !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		if allowed(r) {
+			next.ServeHTTP(sw, r)
+		} else {
+			WriteForbidden(sw, r, refusal, "")
+		}
+		rec.RecordImpersonatedRequest(r.Context(), r.Method, r.URL.Path, sw.Status())
+	})
+}
+
+// statusWriter remembers the status code written to a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status is the code sent, 200 if the handler wrote nothing
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
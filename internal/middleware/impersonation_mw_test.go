@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-microservice/internal/pkg"
+)
+
+type recordedRequest struct {
+	method, path string
+	status       int
+}
+
+type fakeRecorder struct{ requests []recordedRequest }
+
+func (f *fakeRecorder) RecordImpersonatedRequest(_ context.Context, method, path string, status int) {
+	f.requests = append(f.requests, recordedRequest{method, path, status})
+}
+
+func TestImpersonationGuards(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	impersonating := pkg.WithImpersonator(context.Background(), pkg.Impersonator{ID: "op1", Email: "op@example.com"})
+
+	tests := []struct {
+		name         string
+		guard        func(ImpersonationRecorder, http.Handler) http.Handler
+		method, path string
+		ctx          context.Context
+		want         int
+		wantRecorded bool
+	}{
+		{"read-only allows reads", ReadOnly, http.MethodGet, "/v1/projects", impersonating, http.StatusOK, true},
+		{"read-only refuses writes", ReadOnly, http.MethodPost, "/v1/projects", impersonating, http.StatusForbidden, true},
+		{"account route refuses reads", NoImpersonation, http.MethodGet, "/v1/me/export", impersonating, http.StatusForbidden, true},
+		{"account route refuses writes", NoImpersonation, http.MethodPost, "/v1/me/email", impersonating, http.StatusForbidden, true},
+		{"own session passes read-only", ReadOnly, http.MethodPost, "/v1/projects", context.Background(), http.StatusOK, false},
+		{"own session passes account route", NoImpersonation, http.MethodGet, "/v1/me/export", context.Background(), http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		rec := &fakeRecorder{}
+		w := httptest.NewRecorder()
+		tt.guard(rec, ok).ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil).WithContext(tt.ctx))
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if recorded := len(rec.requests) == 1; recorded != tt.wantRecorded {
+			t.Errorf("%s: recorded %v, want %v", tt.name, rec.requests, tt.wantRecorded)
+		} else if recorded && rec.requests[0] != (recordedRequest{tt.method, tt.path, tt.want}) {
+			t.Errorf("%s: recorded %+v", tt.name, rec.requests[0])
+		}
+	}
+}
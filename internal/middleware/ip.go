@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the caller's IP. Proxies append the address they received
+// a request from to X-Forwarded-For, so with trustedHops proxies in front of
+// the server the entry that many places from the right is the last one a
+// trusted proxy wrote; anything left of it came from the client. With no
+// trusted proxies, or no header, it is the connection's remote address.
+func ClientIP(r *http.Request, trustedHops int) string {
+	if trustedHops > 0 {
+		var entries []string
+		for _, h := range r.Header.Values("X-Forwarded-For") {
+			entries = append(entries, strings.Split(h, ",")...)
+		}
+		if len(entries) > 0 {
+			// Fewer entries than hops means the request skipped the outer
+			// proxies; the leftmost was still written by a trusted one
+			i := max(len(entries)-trustedHops, 0)
+			if ip := strings.TrimSpace(entries[i]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
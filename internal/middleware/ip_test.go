@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name string
+		xff  []string
+		hops int
+		want string
+	}{
+		{"no proxy ignores the header", []string{"6.6.6.6"}, 0, "10.0.0.1"},
+		{"no header", nil, 1, "10.0.0.1"},
+		{"one proxy", []string{"203.0.113.7"}, 1, "203.0.113.7"},
+		{"one proxy after a spoofed entry", []string{"6.6.6.6, 203.0.113.7"}, 1, "203.0.113.7"},
+		{"one proxy after several spoofed entries", []string{"1.1.1.1, 6.6.6.6,203.0.113.7"}, 1, "203.0.113.7"},
+		{"two proxies", []string{"6.6.6.6, 203.0.113.7, 198.51.100.2"}, 2, "203.0.113.7"},
+		{"two proxies, outer one skipped", []string{"203.0.113.7"}, 2, "203.0.113.7"},
+		{"entries split across headers", []string{"6.6.6.6", "203.0.113.7"}, 1, "203.0.113.7"},
+		{"empty rightmost entry", []string{"6.6.6.6, "}, 1, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:4321"
+		for _, v := range tt.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := ClientIP(r, tt.hops); got != tt.want {
+			t.Errorf("%s: ClientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
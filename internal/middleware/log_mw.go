@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"auth-microservice/internal/pkg"
+)
+
+// accessKey holds the *accessEntry of the request being logged
+type accessKey struct{}
+
+// accessEntry collects details only known deeper in the handler chain
+type accessEntry struct {
+	userID string
+	route  string
+}
+
+// setAccessUser records the authenticated user for the access log
+func setAccessUser(ctx context.Context, userID string) {
+	if e, ok := ctx.Value(accessKey{}).(*accessEntry); ok {
+		e.userID = userID
+	}
+}
+
+// Route records the pattern next matched for AccessLog. next must be the mux
+// itself: the mux sets the pattern on the request it is handed, which
+// middleware such as otelhttp copies, so AccessLog cannot see it directly.
+func Route(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e, ok := r.Context().Value(accessKey{}).(*accessEntry); ok {
+			defer func() { e.route = r.Pattern }()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestObserver receives every completed request, e.g. for metrics
+type RequestObserver interface {
+	ObserveRequest(method, route string, status int, d time.Duration)
+}
+
+// AccessLog logs every request with its method, route pattern, status, latency
+// and user, and reports it to obs. It must run inside RequestContext and wrap
+// the mux directly, so the matched pattern is visible once the request completes.
+func AccessLog(obs RequestObserver, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessEntry{}
+		r = r.WithContext(context.WithValue(r.Context(), accessKey{}, entry))
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+		latency := time.Since(start)
+		obs.ObserveRequest(r.Method, entry.route, sw.Status(), latency)
+
+		level := slog.LevelInfo
+		if sw.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		pkg.Logger(r.Context()).LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("route", entry.route), // empty when nothing matched
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.Status()),
+			slog.Float64("latency_ms", float64(latency.Microseconds())/1000),
+			slog.String("user_id", entry.userID),
+		)
+	})
+}
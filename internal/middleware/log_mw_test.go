@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/pkg"
+)
+
+// observed records the requests reported to a RequestObserver
+type observed struct {
+	method, route string
+	status        int
+}
+
+type fakeObserver struct{ got []observed }
+
+func (f *fakeObserver) ObserveRequest(method, route string, status int, _ time.Duration) {
+	f.got = append(f.got, observed{method, route, status})
+}
+
+// captureLogs sends the default logger to a buffer of JSON lines for the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestAccessLogFields(t *testing.T) {
+	logs := captureLogs(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		setAccessUser(r.Context(), "user-1")
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST /v1/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	obs := &fakeObserver{}
+	h := RequestContext(0, AccessLog(obs, Route(mux)))
+
+	requests := []struct {
+		method, path, requestID string
+	}{
+		{http.MethodGet, "/v1/projects/abc", "req-1"},
+		{http.MethodPost, "/v1/fail", "req-2"},
+		{http.MethodGet, "/nowhere", "has a space"},
+	}
+	for _, rq := range requests {
+		req := httptest.NewRequest(rq.method, rq.path, nil)
+		req.Header.Set("X-Request-ID", rq.requestID)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := []map[string]any{
+		{"level": "INFO", "request_id": "req-1", "method": "GET", "route": "GET /v1/projects/{id}", "path": "/v1/projects/abc", "status": 200.0, "user_id": "user-1"},
+		{"level": "ERROR", "request_id": "req-2", "method": "POST", "route": "POST /v1/fail", "path": "/v1/fail", "status": 502.0, "user_id": ""},
+		{"level": "INFO", "method": "GET", "route": "", "path": "/nowhere", "status": 404.0, "user_id": ""},
+	}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d log lines, want %d:\n%s", len(lines), len(want), logs)
+	}
+	for i, line := range lines {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["msg"] != "request" {
+			t.Errorf("line %d: msg %v", i, entry["msg"])
+		}
+		if _, ok := entry["latency_ms"].(float64); !ok {
+			t.Errorf("line %d: no latency_ms", i)
+		}
+		for k, v := range want[i] {
+			if entry[k] != v {
+				t.Errorf("line %d: %s = %v, want %v", i, k, entry[k], v)
+			}
+		}
+	}
+	// An unusable request ID is replaced rather than logged
+	var last map[string]any
+	_ = json.Unmarshal([]byte(lines[2]), &last)
+	if id, _ := last["request_id"].(string); len(id) != 32 {
+		t.Errorf("request_id %q, want a generated one", id)
+	}
+
+	wantObs := []observed{
+		{"GET", "GET /v1/projects/{id}", 200},
+		{"POST", "POST /v1/fail", 502},
+		{"GET", "", 404},
+	}
+	if len(obs.got) != len(wantObs) {
+		t.Fatalf("observed %v, want %v", obs.got, wantObs)
+	}
+	for i := range wantObs {
+		if obs.got[i] != wantObs[i] {
+			t.Errorf("observed %+v, want %+v", obs.got[i], wantObs[i])
+		}
+	}
+}
+
+func TestRequestContextRequestID(t *testing.T) {
+	tests := []struct {
+		name, incoming string
+		keep           bool
+	}{
+		{"caller's ID kept", "abc-123", true},
+		{"missing", "", false},
+		{"control characters", "abc\x01", false},
+		{"too long", strings.Repeat("a", maxRequestIDLen+1), false},
+	}
+	for _, tt := range tests {
+		logs := captureLogs(t)
+		var infoID string
+		h := RequestContext(0, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			infoID = pkg.GetRequestInfo(r.Context()).ID
+			pkg.Logger(r.Context()).Info("handled")
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.incoming != "" {
+			req.Header.Set("X-Request-ID", tt.incoming)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		got := w.Header().Get("X-Request-ID")
+		if tt.keep && got != tt.incoming {
+			t.Errorf("%s: echoed %q, want %q", tt.name, got, tt.incoming)
+		}
+		if !tt.keep && (got == tt.incoming || !validRequestID(got)) {
+			t.Errorf("%s: echoed %q, want a new ID", tt.name, got)
+		}
+		// Audit records and every log line of the request carry the same ID
+		var entry map[string]any
+		if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if infoID != got || entry["request_id"] != got {
+			t.Errorf("%s: request info ID %q, logged %v, echoed %q", tt.name, infoID, entry["request_id"], got)
+		}
+	}
+}
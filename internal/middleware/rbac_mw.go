@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/pkg"
+	"net/http"
+)
+
+// RequirePermission is middleware that lets the request through only when the
+// role in the active workspace grants perm and, for API keys, the key's scopes
+// allow it. It must run after JWTAuth or Authenticate, which put the caller's
+// current membership role in the context rather than a token's role claim.
+func RequirePermission(perm auth.Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, _ := pkg.GetRoleFromContext(r.Context())
+		if !auth.RoleHasPermission(role, perm) {
+			WriteForbidden(w, r, "your role does not allow this action", perm)
+			return
+		}
+		if !auth.ScopesAllow(pkg.GetScopesFromContext(r.Context()), perm) {
+			WriteForbidden(w, r, "this API key is not scoped for this action", perm)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSystemPermission is middleware for the operator API. It lets the
+// request through only when the session's system role grants perm and the
+// session completed a second factor. It must run after JWTAuth.
+func RequireSystemPermission(perm auth.Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if pkg.GetAPIKeyIDFromContext(ctx) != "" || !auth.SysRoleHasPermission(pkg.GetSysRoleFromContext(ctx), perm) {
+			WriteForbidden(w, r, "operators only", perm)
+			return
+		}
+		if !pkg.GetMFAFromContext(ctx) {
+			WriteForbidden(w, r, "operators must sign in with two-factor authentication", perm)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/pkg"
+)
+
+const testSecret = "test-secret"
+
+// fakeSessions accepts every session and reports roles and MFA requirements
+// from fixed tables
+type fakeSessions struct {
+	roles      map[string]string
+	requireMFA map[string]bool
+}
+
+func (f fakeSessions) ValidateSession(context.Context, *auth.JWTClaims) error { return nil }
+
+func (f fakeSessions) CurrentRole(_ context.Context, userID, workspaceID string) (string, error) {
+	return f.roles[userID+"/"+workspaceID], nil
+}
+
+func (f fakeSessions) RequiresMFA(_ context.Context, workspaceID string) (bool, error) {
+	return f.requireMFA[workspaceID], nil
+}
+
+func TestRequirePermissionUsesCurrentRole(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	sessions := fakeSessions{roles: map[string]string{
+		"admin/ws1":    "admin",
+		"demoted/ws1":  "viewer",
+		"promoted/ws1": "admin",
+	}}
+
+	tests := []struct {
+		name, user, claimRole string
+		want                  int
+	}{
+		{"current admin", "admin", "admin", http.StatusOK},
+		{"demoted since the token was issued", "demoted", "admin", http.StatusForbidden},
+		{"removed since the token was issued", "removed", "owner", http.StatusForbidden},
+		{"promoted since the token was issued", "promoted", "viewer", http.StatusOK},
+	}
+	for _, tt := range tests {
+		token, err := auth.GenerateAccessToken(testSecret, auth.JWTClaims{UserID: tt.user, WorkspaceID: "ws1", Role: tt.claimRole}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/workspace/members", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		JWTAuth(testSecret, sessions, RequirePermission(auth.PermAdminMembers, ok)).ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestJWTAuthDropsWorkspaceOfRemovedMember(t *testing.T) {
+	sessions := fakeSessions{roles: map[string]string{"member/ws1": "editor"}}
+	tests := []struct{ user, wantWorkspace, wantRole string }{
+		{"member", "ws1", "editor"},
+		{"removed", "", ""},
+	}
+	for _, tt := range tests {
+		token, err := auth.GenerateAccessToken(testSecret, auth.JWTClaims{UserID: tt.user, WorkspaceID: "ws1", Role: "editor"}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var workspaceID, role string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			workspaceID, _ = pkg.GetWorkspaceIDFromContext(r.Context())
+			role, _ = pkg.GetRoleFromContext(r.Context())
+		})
+		req := httptest.NewRequest(http.MethodGet, "/v1/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		JWTAuth(testSecret, sessions, next).ServeHTTP(httptest.NewRecorder(), req)
+
+		if workspaceID != tt.wantWorkspace || role != tt.wantRole {
+			t.Errorf("%s: workspace %q role %q, want %q %q", tt.user, workspaceID, role, tt.wantWorkspace, tt.wantRole)
+		}
+	}
+}
+
+func TestRequirePermissionAppliesKeyScopes(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	tests := []struct {
+		name   string
+		role   string
+		scopes []string
+		perm   auth.Permission
+		want   int
+	}{
+		{"unscoped key uses its role", "editor", nil, auth.PermPromptsWrite, http.StatusOK},
+		{"scope allows", "editor", []string{"reports:read"}, auth.PermReportsRead, http.StatusOK},
+		{"scope refuses what the role allows", "editor", []string{"reports:read"}, auth.PermPromptsWrite, http.StatusForbidden},
+		{"wildcard scope", "editor", []string{"*"}, auth.PermPromptsWrite, http.StatusOK},
+		{"scope cannot widen the role", "viewer", []string{"prompts:write"}, auth.PermPromptsWrite, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		principal := auth.Principal{UserID: "u1", WorkspaceID: "ws1", Role: tt.role, Scopes: tt.scopes, APIKeyID: "k1"}
+		req := httptest.NewRequest(http.MethodGet, "/v1/reports", nil)
+		req.Header.Set("Authorization", "Bearer "+auth.APIKeyPrefix+"00000000_secret")
+		w := httptest.NewRecorder()
+		Authenticate(testSecret, fakeSessions{}, fakeKeys{principal}, RequirePermission(tt.perm, ok)).ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"auth-microservice/internal/pkg"
+)
+
+// maxRequestIDLen bounds a caller-supplied X-Request-ID
+const maxRequestIDLen = 128
+
+// RequestContext stores the request ID, client IP and user agent in the
+// context for audit records, along with a logger tagged with the request ID.
+// An incoming X-Request-ID is kept, otherwise one is generated; either way it
+// is echoed in the response.
+func RequestContext(trustedProxyHops int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := pkg.WithRequestInfo(r.Context(), pkg.RequestInfo{
+			ID:        id,
+			IP:        ClientIP(r, trustedProxyHops),
+			UserAgent: r.UserAgent(),
+		})
+		ctx = pkg.WithLogger(ctx, slog.Default().With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
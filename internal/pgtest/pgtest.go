@@ -0,0 +1,34 @@
+// Package pgtest gives tests a migrated Postgres pool
+package pgtest
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/config"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Pool connects to POSTGRES_TEST_URL and applies the migrations. Tests
+// needing Postgres are skipped without it.
+func Pool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connect to postgres: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	if err := config.RunMigrations(ctx, pool); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return pool
+}
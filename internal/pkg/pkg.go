@@ -1,13 +1,25 @@
 package pkg
 
-import "context"
+import (
+	"context"
+	"log/slog"
+)
 
 // contextKey is a private type to avoid collisions in context values
 type contextKey string
 
 const (
-	userEmailKey contextKey = "userEmail"
-	userIDKey    contextKey = "userID"
+	userEmailKey    contextKey = "userEmail"
+	userIDKey       contextKey = "userID"
+	workspaceKey    contextKey = "workspaceID"
+	roleKey         contextKey = "role"
+	scopesKey       contextKey = "scopes"
+	mfaKey          contextKey = "mfa"
+	apiKeyIDKey     contextKey = "apiKeyID"
+	requestKey      contextKey = "request"
+	sysRoleKey      contextKey = "sysRole"
+	impersonatorKey contextKey = "impersonator"
+	loggerKey       contextKey = "logger"
 )
 
 // ------------------- Email -------------------
@@ -31,3 +43,125 @@ func GetUserIDFromContext(ctx context.Context) (string, bool) {
 	userID, ok := ctx.Value(userIDKey).(string)
 	return userID, ok
 }
+
+// ------------------- Workspace -------------------
+
+func WithWorkspaceID(ctx context.Context, workspaceID string) context.Context {
+	return context.WithValue(ctx, workspaceKey, workspaceID)
+}
+
+func GetWorkspaceIDFromContext(ctx context.Context) (string, bool) {
+	workspaceID, ok := ctx.Value(workspaceKey).(string)
+	return workspaceID, ok
+}
+
+// ------------------- Role -------------------
+
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleKey, role)
+}
+
+func GetRoleFromContext(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(roleKey).(string)
+	return role, ok
+}
+
+// ------------------- Scopes -------------------
+
+// WithScopes stores the scopes of an API key; JWT sessions carry none
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey, scopes)
+}
+
+func GetScopesFromContext(ctx context.Context) []string {
+	scopes, _ := ctx.Value(scopesKey).([]string)
+	return scopes
+}
+
+// ------------------- MFA -------------------
+
+// WithMFA records whether the session completed a second factor
+func WithMFA(ctx context.Context, mfa bool) context.Context {
+	return context.WithValue(ctx, mfaKey, mfa)
+}
+
+func GetMFAFromContext(ctx context.Context) bool {
+	mfa, _ := ctx.Value(mfaKey).(bool)
+	return mfa
+}
+
+// ------------------- API key -------------------
+
+// WithAPIKeyID records the API key a request authenticated with
+func WithAPIKeyID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, apiKeyIDKey, id)
+}
+
+func GetAPIKeyIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(apiKeyIDKey).(string)
+	return id
+}
+
+// ------------------- Request -------------------
+
+// RequestInfo identifies the HTTP request behind an action
+type RequestInfo struct {
+	ID        string
+	IP        string
+	UserAgent string
+}
+
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestKey, info)
+}
+
+func GetRequestInfo(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestKey).(RequestInfo)
+	return info
+}
+
+// ------------------- System role -------------------
+
+// WithSysRole stores the platform role of an interactive session
+func WithSysRole(ctx context.Context, sysRole string) context.Context {
+	return context.WithValue(ctx, sysRoleKey, sysRole)
+}
+
+func GetSysRoleFromContext(ctx context.Context) string {
+	sysRole, _ := ctx.Value(sysRoleKey).(string)
+	return sysRole
+}
+
+// ------------------- Impersonation -------------------
+
+// Impersonator is the operator behind an impersonation session
+type Impersonator struct {
+	ID    string
+	Email string
+}
+
+// WithImpersonator marks the session as an operator impersonating the user
+func WithImpersonator(ctx context.Context, imp Impersonator) context.Context {
+	return context.WithValue(ctx, impersonatorKey, imp)
+}
+
+// GetImpersonatorFromContext returns the impersonating operator, if any
+func GetImpersonatorFromContext(ctx context.Context) (Impersonator, bool) {
+	imp, ok := ctx.Value(impersonatorKey).(Impersonator)
+	return imp, ok && imp.ID != ""
+}
+
+// ------------------- Logger -------------------
+
+// WithLogger stores a logger carrying the request's attributes
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// Logger returns the request's logger, or the default logger outside a request
+func Logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
@@ -2,14 +2,20 @@ package pkg
 
 import (
 	"auth-microservice/internal/repository"
+	"context"
 	"regexp"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/cdipaolo/sentiment"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("auth-microservice/internal/pkg")
+
 // PromptResponse holds one prompt and its AI response
 type PromptResponse struct {
 	Prompt   string
@@ -23,6 +29,11 @@ func SetSentimentModel(m *sentiment.Models) {
 	model = m
 }
 
+// SentimentModelLoaded reports whether SetSentimentModel has been called
+func SentimentModelLoaded() bool {
+	return model != nil
+}
+
 // Returns sentiment as a number from 1 to 100
 func AnalyzeSentiment(text string) int {
 	if model == nil {
@@ -179,56 +190,80 @@ func CalculateBrandVisibility(mentions map[string]int, brandAliases []string) fl
 func WordVolume(text string) int {
 	return len(strings.Fields(text))
 }
+
+// AnalyzeResponses scores each response for the brand and its competitors.
+// Each stage runs in its own span, so a slow analysis shows where time went.
 func AnalyzeResponses(
+	ctx context.Context,
 	responses []PromptResponse,
 	country string,
 	brandName string,
 	brandAliases []string,
 	competitorAliases map[string][]string,
 ) []repository.MinimalAnalysis {
+	ctx, span := tracer.Start(ctx, "analysis", trace.WithAttributes(
+		attribute.Int("analysis.responses", len(responses)),
+		attribute.Int("analysis.competitors", len(competitorAliases)),
+	))
+	defer span.End()
+
 	var results []repository.MinimalAnalysis
 
 	for _, r := range responses {
 		// Count mentions
-		mentions := CountBrandMentions(r.Response, brandName, brandAliases, competitorAliases)
+		var mentions map[string]int
+		stage(ctx, "analysis.mentions", func() {
+			mentions = CountBrandMentions(r.Response, brandName, brandAliases, competitorAliases)
+		})
 
-		// Prepare brand analyses
-		var brandAnalyses []repository.BrandAnalysis
-
-		// Main brand
-		mainPosition := BrandPosition(r.Response, brandName, brandAliases, competitorAliases)
-		mainSentiment := AnalyzeSentiment(r.Response)
-		mainVisibility := CalculateBrandVisibility(mentions, append([]string{brandName}, brandAliases...))
-
-		brandAnalyses = append(brandAnalyses, repository.BrandAnalysis{
-			BrandName:  brandName,
-			Sentiment:  mainSentiment,
-			Position:   mainPosition,
-			Visibility: mainVisibility,
+		// The sentiment model scores the whole response, so every brand shares it
+		var sentimentScore int
+		stage(ctx, "analysis.sentiment", func() {
+			sentimentScore = AnalyzeSentiment(r.Response)
 		})
 
-		// Competitors
-		for comp, aliases := range competitorAliases {
-			compPosition := BrandPosition(r.Response, comp, aliases, competitorAliases)
-			compSentiment := AnalyzeSentiment(r.Response)
-			compVisibility := CalculateBrandVisibility(mentions, aliases)
+		// Prepare brand analyses
+		var (
+			brandAnalyses  []repository.BrandAnalysis
+			mainPosition   int
+			mainVisibility float64
+		)
+		stage(ctx, "analysis.brands", func() {
+			// Main brand
+			mainPosition = BrandPosition(r.Response, brandName, brandAliases, competitorAliases)
+			mainVisibility = CalculateBrandVisibility(mentions, append([]string{brandName}, brandAliases...))
 
 			brandAnalyses = append(brandAnalyses, repository.BrandAnalysis{
-				BrandName:  comp,
-				Sentiment:  compSentiment,
-				Position:   compPosition,
-				Visibility: compVisibility,
+				BrandName:  brandName,
+				Sentiment:  sentimentScore,
+				Position:   mainPosition,
+				Visibility: mainVisibility,
 			})
-		}
+
+			// Competitors
+			for comp, aliases := range competitorAliases {
+				brandAnalyses = append(brandAnalyses, repository.BrandAnalysis{
+					BrandName:  comp,
+					Sentiment:  sentimentScore,
+					Position:   BrandPosition(r.Response, comp, aliases, competitorAliases),
+					Visibility: CalculateBrandVisibility(mentions, aliases),
+				})
+			}
+		})
+
+		var domains []repository.DomainAnalysis
+		stage(ctx, "analysis.domains", func() {
+			domains = ExtractDomains(r.Response)
+		})
 
 		analysis := repository.MinimalAnalysis{
 			Prompt:     r.Prompt,
 			Response:   r.Response,
-			Sentiment:  mainSentiment, // top-level sentiment still main brand
-			Position:   mainPosition,  // top-level position still main brand
+			Sentiment:  sentimentScore, // top-level sentiment still main brand
+			Position:   mainPosition,   // top-level position still main brand
 			Mentions:   mentions,
 			Visibility: mainVisibility, // top-level visibility still main brand
-			Domains:    ExtractDomains(r.Response),
+			Domains:    domains,
 			Volume:     WordVolume(r.Response),
 			Location:   country,
 			Brands:     brandAnalyses, // filled with main + competitors
@@ -241,6 +276,13 @@ func AnalyzeResponses(
 	return results
 }
 
+// stage runs fn in a child span of ctx
+func stage(ctx context.Context, name string, fn func()) {
+	_, span := tracer.Start(ctx, name)
+	defer span.End()
+	fn()
+}
+
 // BrandPosition calculates the rank (position) of a main brand in a text
 // among competitors. Returns 0 if the brand is not mentioned.
 func BrandPosition(
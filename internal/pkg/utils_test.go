@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cdipaolo/sentiment"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestAnalyzeResponsesSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	m, err := sentiment.Restore()
+	if err != nil {
+		t.Fatalf("restore sentiment model: %v", err)
+	}
+	SetSentimentModel(&m)
+
+	responses := []PromptResponse{
+		{Prompt: "best crm?", Response: "Acme is great, see https://acme.example.com. Globex is fine too."},
+		{Prompt: "cheapest crm?", Response: "Globex is cheaper than Acme."},
+	}
+	results := AnalyzeResponses(context.Background(), responses, "US", "Acme", nil, map[string][]string{"Globex": {"Globex"}})
+	if len(results) != len(responses) {
+		t.Fatalf("got %d results, want %d", len(results), len(responses))
+	}
+
+	spans := exporter.GetSpans()
+	var root tracetest.SpanStub
+	stages := map[string]int{}
+	for _, s := range spans {
+		if s.Name == "analysis" {
+			root = s
+			continue
+		}
+		stages[s.Name]++
+	}
+	if root.Name == "" {
+		t.Fatal("no analysis span")
+	}
+
+	attrs := map[attribute.Key]int64{}
+	for _, kv := range root.Attributes {
+		attrs[kv.Key] = kv.Value.AsInt64()
+	}
+	if attrs["analysis.responses"] != 2 || attrs["analysis.competitors"] != 1 {
+		t.Errorf("analysis span attributes %v, want 2 responses and 1 competitor", attrs)
+	}
+
+	for _, name := range []string{"analysis.mentions", "analysis.sentiment", "analysis.brands", "analysis.domains"} {
+		if stages[name] != len(responses) {
+			t.Errorf("%s: %d spans, want one per response (%d)", name, stages[name], len(responses))
+		}
+	}
+	for _, s := range spans {
+		if s.Name == "analysis" {
+			continue
+		}
+		if s.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("%s is not a child of the analysis span", s.Name)
+		}
+	}
+}
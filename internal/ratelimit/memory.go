@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// memorySweepEvery is how many operations pass between sweeps of stale entries
+const memorySweepEvery = 1024
+
+// MemoryStore keeps buckets and counters in process memory. Limits are per
+// instance, so it only suits a single replica or development.
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*memoryBucket
+	counters map[string]*memoryCounter
+	ops      int
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket will have refilled
+}
+
+type memoryCounter struct {
+	n       int64
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*memoryBucket{}, counters: map[string]*memoryCounter{}}
+}
+
+func (s *MemoryStore) TakeToken(_ context.Context, key string, burst int, refillPerSec float64, now time.Time) (bool, float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*refillPerSec)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((float64(burst) - b.tokens) / refillPerSec * float64(time.Second)))
+	return allowed, b.tokens, nil
+}
+
+func (s *MemoryStore) AddUsage(_ context.Context, key string, n int64, expiresAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expires) {
+		c = &memoryCounter{expires: expiresAt}
+		s.counters[key] = c
+	}
+	c.n += n
+	return c.n, nil
+}
+
+func (s *MemoryStore) Usage(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.counters[key]; ok && time.Now().Before(c.expires) {
+		return c.n, nil
+	}
+	return 0, nil
+}
+
+// sweep drops full buckets and expired counters now and then; callers hold mu
+func (s *MemoryStore) sweep(now time.Time) {
+	if s.ops++; s.ops%memorySweepEvery != 0 {
+		return
+	}
+	for k, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, k)
+		}
+	}
+	for k, c := range s.counters {
+		if !now.Before(c.expires) {
+			delete(s.counters, k)
+		}
+	}
+}
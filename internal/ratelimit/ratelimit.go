@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a token bucket holding up to Burst tokens, refilled with Rate
+// tokens every Per. A zero Burst turns the limit off.
+type Limit struct {
+	Burst int
+	Rate  int
+	Per   time.Duration
+}
+
+// PerMinute returns a bucket of burst tokens refilled at rate a minute
+func PerMinute(burst, rate int) Limit {
+	return Limit{Burst: burst, Rate: rate, Per: time.Minute}
+}
+
+func (l Limit) refillPerSecond() float64 {
+	return float64(l.Rate) / l.Per.Seconds()
+}
+
+// Store keeps buckets and usage counters. MemoryStore suits a single
+// instance; repository.RateLimitRepo shares them between instances.
+type Store interface {
+	// TakeToken refills the bucket at key for the time since it was last used
+	// and takes one token if a whole one is left. It returns the tokens left.
+	TakeToken(ctx context.Context, key string, burst int, refillPerSec float64, now time.Time) (allowed bool, tokens float64, err error)
+	// AddUsage adds n (which may be negative) to the counter at key and
+	// returns the new total. A new counter expires at expiresAt.
+	AddUsage(ctx context.Context, key string, n int64, expiresAt time.Time) (int64, error)
+	// Usage returns the counter at key, 0 if there is none
+	Usage(ctx context.Context, key string) (int64, error)
+}
+
+// Decision is the outcome of taking a token
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // until a token is available; 0 when allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// Limiter applies token-bucket limits and usage quotas on top of a Store
+type Limiter struct {
+	store Store
+	now   func() time.Time
+}
+
+func New(store Store) *Limiter {
+	return &Limiter{store: store, now: time.Now}
+}
+
+// Allow takes a token from the bucket at key
+func (l *Limiter) Allow(ctx context.Context, key string, lim Limit) (Decision, error) {
+	if lim.Burst <= 0 || lim.Rate <= 0 {
+		return Decision{Allowed: true}, nil
+	}
+	rate := lim.refillPerSecond()
+	allowed, tokens, err := l.store.TakeToken(ctx, key, lim.Burst, rate, l.now())
+	if err != nil {
+		return Decision{}, err
+	}
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     lim.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(lim.Burst) - tokens) / rate),
+	}
+	if !allowed {
+		d.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return d, nil
+}
+
+// Consume adds n to the usage counter at key unless that would take it past
+// max, in which case nothing is counted. The counter expires at resetAt.
+func (l *Limiter) Consume(ctx context.Context, key string, n, max int64, resetAt time.Time) (used int64, ok bool, err error) {
+	used, err = l.store.AddUsage(ctx, key, n, resetAt)
+	if err != nil {
+		return 0, false, err
+	}
+	if used <= max {
+		return used, true, nil
+	}
+	// Concurrent callers may both overshoot; each takes back only its own share
+	used, err = l.store.AddUsage(ctx, key, -n, resetAt)
+	return used, false, err
+}
+
+// Release takes back n counted by an earlier Consume, e.g. when a later
+// quota refused the same request
+func (l *Limiter) Release(ctx context.Context, key string, n int64, resetAt time.Time) error {
+	_, err := l.store.AddUsage(ctx, key, -n, resetAt)
+	return err
+}
+
+// Usage returns the counter at key
+func (l *Limiter) Usage(ctx context.Context, key string) (int64, error) {
+	return l.store.Usage(ctx, key)
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
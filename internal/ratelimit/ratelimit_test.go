@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreRefill(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	const burst, rate = 3, 1.0 // one token a second
+
+	for i := range burst {
+		ok, _, err := s.TakeToken(ctx, "k", burst, rate, start)
+		if err != nil || !ok {
+			t.Fatalf("take %d: ok=%v err=%v, want a token from a full bucket", i, ok, err)
+		}
+	}
+	if ok, tokens, _ := s.TakeToken(ctx, "k", burst, rate, start); ok || tokens != 0 {
+		t.Fatalf("empty bucket gave a token (tokens=%v)", tokens)
+	}
+
+	steps := []struct {
+		after      time.Duration
+		wantOK     bool
+		wantTokens float64
+	}{
+		{500 * time.Millisecond, false, 0.5}, // half a token is not enough
+		{time.Second, true, 0},               // refilled to one, taken
+		{10 * time.Second, true, 2},          // capped at burst, one taken
+		{10 * time.Second, true, 1},          // same instant: no refill
+	}
+	for _, st := range steps {
+		ok, tokens, err := s.TakeToken(ctx, "k", burst, rate, start.Add(st.after))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != st.wantOK || tokens != st.wantTokens {
+			t.Errorf("after %v: ok=%v tokens=%v, want ok=%v tokens=%v", st.after, ok, tokens, st.wantOK, st.wantTokens)
+		}
+	}
+
+	if ok, _, _ := s.TakeToken(ctx, "other", burst, rate, start); !ok {
+		t.Error("buckets are not separate per key")
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := New(NewMemoryStore())
+	l.now = func() time.Time { return now }
+	lim := PerMinute(2, 60)
+
+	for i := range 2 {
+		d, err := l.Allow(ctx, "k", lim)
+		if err != nil || !d.Allowed {
+			t.Fatalf("request %d refused: %+v %v", i, d, err)
+		}
+	}
+	d, err := l.Allow(ctx, "k", lim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allowed || d.Remaining != 0 || d.RetryAfter != time.Second || d.Reset != 2*time.Second {
+		t.Errorf("over the limit: %+v, want refused with a 1s retry and 2s reset", d)
+	}
+
+	now = now.Add(time.Second)
+	if d, _ := l.Allow(ctx, "k", lim); !d.Allowed {
+		t.Error("refused after a token refilled")
+	}
+
+	if d, _ := l.Allow(ctx, "k", Limit{}); !d.Allowed {
+		t.Error("a zero limit refused a request")
+	}
+}
+
+func TestLimiterConsume(t *testing.T) {
+	ctx := context.Background()
+	l := New(NewMemoryStore())
+	reset := time.Now().Add(time.Hour)
+
+	if used, ok, err := l.Consume(ctx, "q", 3, 5, reset); err != nil || !ok || used != 3 {
+		t.Fatalf("consume 3 of 5: used=%d ok=%v err=%v", used, ok, err)
+	}
+	if used, ok, _ := l.Consume(ctx, "q", 3, 5, reset); ok || used != 3 {
+		t.Errorf("consume past max: used=%d ok=%v, want refused and nothing counted", used, ok)
+	}
+	if used, ok, _ := l.Consume(ctx, "q", 2, 5, reset); !ok || used != 5 {
+		t.Errorf("consume up to max: used=%d ok=%v", used, ok)
+	}
+	if err := l.Release(ctx, "q", 2, reset); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := l.Usage(ctx, "q"); used != 3 {
+		t.Errorf("usage after release = %d, want 3", used)
+	}
+
+	expired := time.Now().Add(-time.Second)
+	if _, err := l.store.AddUsage(ctx, "old", 4, expired); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := l.Usage(ctx, "old"); used != 0 {
+		t.Errorf("expired counter reads %d, want 0", used)
+	}
+}
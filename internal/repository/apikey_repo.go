@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// API key ownership
+const (
+	APIKeyScopeUser      = "user"      // acts as its creator, with their current role
+	APIKeyScopeWorkspace = "workspace" // belongs to the workspace, with a fixed role
+)
+
+// APIKey is a long-lived credential for programmatic access. Only the hash of
+// the key is stored; Prefix identifies it in listings.
+type APIKey struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Prefix      string             `bson:"prefix" json:"prefix"`
+	Hash        string             `bson:"hash" json:"-"`
+	ScopeType   string             `bson:"scope_type" json:"scope_type"`
+	WorkspaceID primitive.ObjectID `bson:"workspace_id" json:"workspace_id"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"` // creator
+	Email       string             `bson:"email" json:"email"`     // creator
+	Role        string             `bson:"role,omitempty" json:"role,omitempty"`
+	Scopes      []string           `bson:"scopes,omitempty" json:"scopes,omitempty"`
+	MFA         bool               `bson:"mfa,omitempty" json:"mfa"` // created from a session that completed MFA
+	ExpiresAt   *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type APIKeyRepo struct {
+	col *mongo.Collection
+}
+
+func NewAPIKeyRepo(db *mongo.Database, colName string) *APIKeyRepo {
+	return &APIKeyRepo{col: db.Collection(colName)}
+}
+
+// Create inserts a new key and sets its ID
+func (r *APIKeyRepo) Create(ctx context.Context, k *APIKey) error {
+	k.CreatedAt = time.Now().UTC()
+	res, err := r.col.InsertOne(ctx, k)
+	if err != nil {
+		return err
+	}
+	k.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindByHash returns the key with the given hash, or nil
+func (r *APIKeyRepo) FindByHash(ctx context.Context, hash string) (*APIKey, error) {
+	var k APIKey
+	err := r.col.FindOne(ctx, bson.M{"hash": hash}).Decode(&k)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &k, nil
+}
+
+// FindByID returns a key by its hex ID, or nil
+func (r *APIKeyRepo) FindByID(ctx context.Context, id string) (*APIKey, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	var k APIKey
+	err = r.col.FindOne(ctx, bson.M{"_id": oid}).Decode(&k)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &k, nil
+}
+
+// ListByWorkspace returns the keys of a workspace, newest first
+func (r *APIKeyRepo) ListByWorkspace(ctx context.Context, workspaceID primitive.ObjectID) ([]APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cur, err := r.col.Find(ctx, bson.M{"workspace_id": workspaceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	keys := []APIKey{}
+	if err := cur.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke marks a key as revoked
+func (r *APIKeyRepo) Revoke(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now().UTC()
+	_, err := r.col.UpdateOne(ctx,
+		bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now}},
+	)
+	return err
+}
+
+// TouchLastUsed records a use of the key, at most once per interval to keep
+// authentication from writing on every request
+func (r *APIKeyRepo) TouchLastUsed(ctx context.Context, id primitive.ObjectID, interval time.Duration) error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id": id,
+		"$or": []bson.M{
+			{"last_used_at": bson.M{"$exists": false}},
+			{"last_used_at": bson.M{"$lt": now.Add(-interval)}},
+		},
+	}
+	_, err := r.col.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_used_at": now}})
+	return err
+}
+
+// RevokeUserKeys revokes the user-scoped keys a user created, which act as them
+func (r *APIKeyRepo) RevokeUserKeys(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.col.UpdateMany(ctx,
+		bson.M{"user_id": userID, "scope_type": APIKeyScopeUser, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}},
+	)
+	return err
+}
+
+// DeleteByUser removes a user's user-scoped keys and strips their email from
+// the workspace keys they created, which stay with the workspace
+func (r *APIKeyRepo) DeleteByUser(ctx context.Context, userID primitive.ObjectID, placeholder string) error {
+	if _, err := r.col.DeleteMany(ctx, bson.M{"user_id": userID, "scope_type": APIKeyScopeUser}); err != nil {
+		return err
+	}
+	_, err := r.col.UpdateMany(ctx, bson.M{"user_id": userID}, bson.M{"$set": bson.M{"email": placeholder}})
+	return err
+}
+
+// DeleteByWorkspace removes every key of a workspace
+func (r *APIKeyRepo) DeleteByWorkspace(ctx context.Context, workspaceID primitive.ObjectID) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"workspace_id": workspaceID})
+	return err
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditEvent is one security-relevant action. Events are only ever inserted;
+// the repo has no update or delete.
+type AuditEvent struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	WorkspaceID *primitive.ObjectID `bson:"workspace_id,omitempty" json:"workspace_id,omitempty"`
+	// Who acted: a user, optionally through an API key
+	ActorID    string `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	ActorEmail string `bson:"actor_email,omitempty" json:"actor_email,omitempty"`
+	APIKeyID   string `bson:"api_key_id,omitempty" json:"api_key_id,omitempty"`
+	// Operator using an impersonation session of the actor
+	ImpersonatorID    string `bson:"impersonator_id,omitempty" json:"impersonator_id,omitempty"`
+	ImpersonatorEmail string `bson:"impersonator_email,omitempty" json:"impersonator_email,omitempty"`
+	Action            string `bson:"action" json:"action"`
+	// What was acted on, e.g. type "project" and the project's hex ID
+	TargetType string `bson:"target_type,omitempty" json:"target_type,omitempty"`
+	TargetID   string `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	// Request the action came from
+	IP        string `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	RequestID string `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	// Changed fields of a mutation, before and after
+	Before   map[string]any `bson:"before,omitempty" json:"before,omitempty"`
+	After    map[string]any `bson:"after,omitempty" json:"after,omitempty"`
+	Metadata map[string]any `bson:"metadata,omitempty" json:"metadata,omitempty"`
+	At       time.Time      `bson:"at" json:"at"`
+}
+
+// AuditFilter narrows an audit query; zero fields match everything
+type AuditFilter struct {
+	WorkspaceID *primitive.ObjectID
+	Actions     []string
+	From        time.Time
+	To          time.Time
+}
+
+func (f AuditFilter) query() bson.M {
+	q := bson.M{}
+	if f.WorkspaceID != nil {
+		q["workspace_id"] = *f.WorkspaceID
+	}
+	if len(f.Actions) > 0 {
+		q["action"] = bson.M{"$in": f.Actions}
+	}
+	at := bson.M{}
+	if !f.From.IsZero() {
+		at["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		at["$lt"] = f.To
+	}
+	if len(at) > 0 {
+		q["at"] = at
+	}
+	return q
+}
+
+type AuditRepo struct {
+	col *mongo.Collection
+}
+
+func NewAuditRepo(db *mongo.Database, colName string) *AuditRepo {
+	return &AuditRepo{col: db.Collection(colName)}
+}
+
+// Insert appends an event
+func (r *AuditRepo) Insert(ctx context.Context, e *AuditEvent) error {
+	res, err := r.col.InsertOne(ctx, e)
+	if err != nil {
+		return err
+	}
+	e.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// List returns the newest events matching f, up to limit
+func (r *AuditRepo) List(ctx context.Context, f AuditFilter, limit int64) ([]AuditEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit)
+	cur, err := r.col.Find(ctx, f.query(), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	events := []AuditEvent{}
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Each calls fn for every event matching f, oldest first
+func (r *AuditRepo) Each(ctx context.Context, f AuditFilter, fn func(AuditEvent) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}})
+	cur, err := r.col.Find(ctx, f.query(), opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var e AuditEvent
+		if err := cur.Decode(&e); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
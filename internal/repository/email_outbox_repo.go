@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Outbox email states
+const (
+	EmailQueued  = "queued"  // waiting for its next attempt
+	EmailSending = "sending" // claimed by a sender until locked_until
+	EmailSent    = "sent"
+	EmailDead    = "dead" // gave up after the maximum number of attempts
+)
+
+// OutboxEmail is an email waiting for, or done with, delivery. Bodies can hold
+// sign-in links, so they are dropped once the email is sent or dead-lettered.
+type OutboxEmail struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	IdempotencyKey string              `bson:"idempotency_key" json:"idempotency_key"`
+	WorkspaceID    *primitive.ObjectID `bson:"workspace_id,omitempty" json:"workspace_id,omitempty"`
+	Template       string              `bson:"template,omitempty" json:"template,omitempty"`
+	To             string              `bson:"to" json:"to"`
+	Subject        string              `bson:"subject" json:"subject"`
+	Text           string              `bson:"text,omitempty" json:"-"`
+	HTML           string              `bson:"html,omitempty" json:"-"`
+	Status         string              `bson:"status" json:"status"`
+	Attempts       int                 `bson:"attempts" json:"attempts"`
+	LastError      string              `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt  time.Time           `bson:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil    *time.Time          `bson:"locked_until,omitempty" json:"-"`
+	SentAt         *time.Time          `bson:"sent_at,omitempty" json:"sent_at,omitempty"` // TTL index removes old sent mail
+	CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// OutboxFilter narrows an outbox listing; zero fields match everything
+type OutboxFilter struct {
+	WorkspaceID *primitive.ObjectID
+	NoWorkspace bool // only mail sent for no workspace, e.g. sign-in links
+	Status      string
+	To          string
+}
+
+func (f OutboxFilter) query() bson.M {
+	filter := bson.M{}
+	if f.WorkspaceID != nil {
+		filter["workspace_id"] = *f.WorkspaceID
+	} else if f.NoWorkspace {
+		filter["workspace_id"] = nil
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	if f.To != "" {
+		filter["to"] = f.To
+	}
+	return filter
+}
+
+type EmailOutboxRepo struct {
+	col *mongo.Collection
+}
+
+func NewEmailOutboxRepo(db *mongo.Database, colName string) *EmailOutboxRepo {
+	return &EmailOutboxRepo{col: db.Collection(colName)}
+}
+
+// Enqueue stores a new email for delivery. If an email with the same
+// idempotency key exists it is left alone and returned with created false.
+func (r *EmailOutboxRepo) Enqueue(ctx context.Context, e *OutboxEmail) (bool, error) {
+	now := time.Now().UTC()
+	e.Status = EmailQueued
+	e.NextAttemptAt = now
+	e.CreatedAt = now
+	e.UpdatedAt = now
+
+	res, err := r.col.InsertOne(ctx, e)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			existing, findErr := r.findByKey(ctx, e.IdempotencyKey)
+			if findErr != nil {
+				return false, findErr
+			}
+			if existing != nil {
+				*e = *existing
+			}
+			return false, nil
+		}
+		return false, err
+	}
+	e.ID = res.InsertedID.(primitive.ObjectID)
+	return true, nil
+}
+
+func (r *EmailOutboxRepo) findByKey(ctx context.Context, key string) (*OutboxEmail, error) {
+	var e OutboxEmail
+	err := r.col.FindOne(ctx, bson.M{"idempotency_key": key}).Decode(&e)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ClaimDue locks the next email that is due, or whose sender died mid-send,
+// for lease and counts the attempt. It returns nil when nothing is due.
+func (r *EmailOutboxRepo) ClaimDue(ctx context.Context, lease time.Duration) (*OutboxEmail, error) {
+	now := time.Now().UTC()
+	filter := bson.M{"$or": []bson.M{
+		{"status": EmailQueued, "next_attempt_at": bson.M{"$lte": now}},
+		{"status": EmailSending, "locked_until": bson.M{"$lt": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{"status": EmailSending, "locked_until": now.Add(lease), "updated_at": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var e OutboxEmail
+	err := r.col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&e)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+// MarkSent records delivery and drops the bodies
+func (r *EmailOutboxRepo) MarkSent(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now().UTC()
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":   bson.M{"status": EmailSent, "sent_at": now, "updated_at": now},
+		"$unset": bson.M{"text": "", "html": "", "locked_until": "", "last_error": ""},
+	})
+	return err
+}
+
+// MarkRetry puts a failed email back in the queue until next
+func (r *EmailOutboxRepo) MarkRetry(ctx context.Context, id primitive.ObjectID, next time.Time, lastErr string) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":   bson.M{"status": EmailQueued, "next_attempt_at": next, "last_error": lastErr, "updated_at": time.Now().UTC()},
+		"$unset": bson.M{"locked_until": ""},
+	})
+	return err
+}
+
+// MarkDead dead-letters an email that will not be retried and drops the bodies
+func (r *EmailOutboxRepo) MarkDead(ctx context.Context, id primitive.ObjectID, lastErr string) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":   bson.M{"status": EmailDead, "last_error": lastErr, "updated_at": time.Now().UTC()},
+		"$unset": bson.M{"text": "", "html": "", "locked_until": ""},
+	})
+	return err
+}
+
+// List returns the newest emails matching f, up to limit
+func (r *EmailOutboxRepo) List(ctx context.Context, f OutboxFilter, limit int64) ([]OutboxEmail, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cur, err := r.col.Find(ctx, f.query(), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	emails := []OutboxEmail{}
+	if err := cur.All(ctx, &emails); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// CountByStatus returns how many emails matching f are in each state
+func (r *EmailOutboxRepo) CountByStatus(ctx context.Context, f OutboxFilter) (map[string]int64, error) {
+	cur, err := r.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: f.query()}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var rows []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{EmailQueued: 0, EmailSending: 0, EmailSent: 0, EmailDead: 0}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// DeleteByRecipient removes all email addressed to a recipient
+func (r *EmailOutboxRepo) DeleteByRecipient(ctx context.Context, to string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"to": to})
+	return err
+}
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testOutbox returns an outbox repo over a scratch database with the
+// production indexes
+func testOutbox(t *testing.T) *EmailOutboxRepo {
+	t.Helper()
+	db := testMongo(t)
+	cfg := &config.Config{UserCol: "users", TokenCol: "tokens", MemberCol: "members", ProjectCol: "projects",
+		APIKeyCol: "api_keys", EmailOutboxCol: "email_outbox", AuditCol: "audit", RateLimitCol: "rate_limits"}
+	if err := config.EnsureIndexes(context.Background(), db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return NewEmailOutboxRepo(db, cfg.EmailOutboxCol)
+}
+
+func TestOutboxIdempotencyKey(t *testing.T) {
+	r := testOutbox(t)
+	ctx := context.Background()
+
+	first := &OutboxEmail{IdempotencyKey: "verify_email:abc", To: "a@example.com", Subject: "Sign in", Text: "link"}
+	if created, err := r.Enqueue(ctx, first); err != nil || !created {
+		t.Fatalf("first enqueue: created %v, %v", created, err)
+	}
+	again := &OutboxEmail{IdempotencyKey: "verify_email:abc", To: "a@example.com", Subject: "Sign in again", Text: "link"}
+	if created, err := r.Enqueue(ctx, again); err != nil || created {
+		t.Fatalf("repeat enqueue: created %v, %v", created, err)
+	}
+	if again.ID != first.ID || again.Subject != "Sign in" {
+		t.Errorf("repeat enqueue returned %+v, want the queued email %s", again, first.ID.Hex())
+	}
+	emails, err := r.List(ctx, OutboxFilter{To: "a@example.com"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 1 {
+		t.Errorf("queued %d emails for one key", len(emails))
+	}
+}
+
+func TestOutboxClaimAndLease(t *testing.T) {
+	r := testOutbox(t)
+	ctx := context.Background()
+	for _, key := range []string{"first", "second"} {
+		if _, err := r.Enqueue(ctx, &OutboxEmail{IdempotencyKey: key, To: key + "@example.com", Subject: key, Text: "body", HTML: "<p>body</p>"}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond) // distinct next_attempt_at, oldest first
+	}
+
+	claim := func() *OutboxEmail {
+		t.Helper()
+		e, err := r.ClaimDue(ctx, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	e := claim()
+	if e == nil || e.IdempotencyKey != "first" || e.Status != EmailSending || e.Attempts != 1 || e.LockedUntil == nil {
+		t.Fatalf("first claim %+v, want the oldest email leased with one attempt", e)
+	}
+	if e2 := claim(); e2 == nil || e2.IdempotencyKey != "second" {
+		t.Fatalf("second claim %+v, want the other email", e2)
+	}
+	if e3 := claim(); e3 != nil {
+		t.Fatalf("claimed %s while both emails are leased", e3.IdempotencyKey)
+	}
+
+	// A sender that died leaves its lease to run out; the email is then claimed again
+	if _, err := r.col.UpdateByID(ctx, e.ID, bson.M{"$set": bson.M{"locked_until": time.Now().UTC().Add(-time.Second)}}); err != nil {
+		t.Fatal(err)
+	}
+	if again := claim(); again == nil || again.ID != e.ID || again.Attempts != 2 {
+		t.Fatalf("claim after the lease ran out %+v, want %s with two attempts", again, e.ID.Hex())
+	}
+
+	// A retry waits until its next attempt
+	if err := r.MarkRetry(ctx, e.ID, time.Now().UTC().Add(time.Hour), "timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if e3 := claim(); e3 != nil {
+		t.Fatalf("claimed %s before its retry was due", e3.IdempotencyKey)
+	}
+	if err := r.MarkRetry(ctx, e.ID, time.Now().UTC().Add(-time.Second), "timeout"); err != nil {
+		t.Fatal(err)
+	}
+	retried := claim()
+	if retried == nil || retried.ID != e.ID || retried.Attempts != 3 || retried.LastError != "timeout" {
+		t.Fatalf("due retry %+v, want %s on its third attempt", retried, e.ID.Hex())
+	}
+
+	// Sent and dead-lettered email keeps no bodies, which can hold sign-in links
+	if err := r.MarkSent(ctx, retried.ID); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := r.findByKey(ctx, "second")
+	if err := r.MarkDead(ctx, second.ID, "mailbox unavailable"); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"first": EmailSent, "second": EmailDead} {
+		got, err := r.findByKey(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != want || got.Text != "" || got.HTML != "" || got.LockedUntil != nil {
+			t.Errorf("%s: %+v, want %s without bodies or lease", key, got, want)
+		}
+	}
+	counts, err := r.CountByStatus(ctx, OutboxFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[EmailSent] != 1 || counts[EmailDead] != 1 || counts[EmailQueued] != 0 || counts[EmailSending] != 0 {
+		t.Errorf("counts %v", counts)
+	}
+}
+
+func TestOutboxConcurrentClaims(t *testing.T) {
+	r := testOutbox(t)
+	ctx := context.Background()
+	const emails = 20
+	for i := 0; i < emails; i++ {
+		if _, err := r.Enqueue(ctx, &OutboxEmail{IdempotencyKey: fmt.Sprintf("key-%d", i), To: "x@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	claimed := map[string]int{}
+	var wg sync.WaitGroup
+	for w := 0; w < 5; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				e, err := r.ClaimDue(ctx, time.Minute)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if e == nil {
+					return
+				}
+				mu.Lock()
+				claimed[e.ID.Hex()]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != emails {
+		t.Errorf("claimed %d emails, want %d", len(claimed), emails)
+	}
+	for id, n := range claimed {
+		if n != 1 {
+			t.Errorf("email %s claimed %d times", id, n)
+		}
+	}
+}
+
+func TestOutboxFilterScope(t *testing.T) {
+	r := testOutbox(t)
+	ctx := context.Background()
+	ws, other := primitive.NewObjectID(), primitive.NewObjectID()
+	for _, e := range []*OutboxEmail{
+		{IdempotencyKey: "login", To: "a@example.com"},
+		{IdempotencyKey: "invite", To: "a@example.com", WorkspaceID: &ws},
+		{IdempotencyKey: "other", To: "b@example.com", WorkspaceID: &other},
+	} {
+		if _, err := r.Enqueue(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter OutboxFilter
+		want   int
+	}{
+		{"everything", OutboxFilter{}, 3},
+		{"no workspace", OutboxFilter{NoWorkspace: true}, 1},
+		{"one workspace", OutboxFilter{WorkspaceID: &ws}, 1},
+		{"one recipient", OutboxFilter{To: "a@example.com"}, 2},
+		{"one recipient, no workspace", OutboxFilter{NoWorkspace: true, To: "a@example.com"}, 1},
+	}
+	for _, tt := range tests {
+		emails, err := r.List(ctx, tt.filter, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts, err := r.CountByStatus(ctx, tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(emails) != tt.want || counts[EmailQueued] != int64(tt.want) {
+			t.Errorf("%s: listed %d, counted %v, want %d", tt.name, len(emails), counts, tt.want)
+		}
+		if tt.filter.NoWorkspace && len(emails) == 1 && emails[0].IdempotencyKey != "login" {
+			t.Errorf("%s: listed %s", tt.name, emails[0].IdempotencyKey)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LLMCall is one call to a language model and what it cost
+type LLMCall struct {
+	WorkspaceID      string
+	UserID           string
+	Purpose          string // e.g. "prompt_generation", "analysis"
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+	Failed           bool
+	Latency          time.Duration
+	At               time.Time
+}
+
+// LLMUsageRow is LLM usage summed over one UTC day, purpose and model
+type LLMUsageRow struct {
+	Day              string  `json:"day"` // YYYY-MM-DD
+	Purpose          string  `json:"purpose"`
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model"`
+	Calls            int64   `json:"calls"`
+	FailedCalls      int64   `json:"failed_calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// LLMSpendTotal is the LLM usage of one workspace or user over a period
+type LLMSpendTotal struct {
+	ID               string  `json:"id"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+type LLMUsageRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewLLMUsageRepo(db *pgxpool.Pool) *LLMUsageRepo {
+	return &LLMUsageRepo{db: db}
+}
+
+// Record stores a call and adds it to its day's rollup in one transaction
+func (r *LLMUsageRepo) Record(ctx context.Context, c *LLMCall) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin record llm call: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO llm_call (workspace_id, user_id, purpose, provider, model, prompt_tokens, completion_tokens, cost_usd, failed, latency_ms, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, c.WorkspaceID, c.UserID, c.Purpose, c.Provider, c.Model, c.PromptTokens, c.CompletionTokens, c.CostUSD, c.Failed, c.Latency.Milliseconds(), c.At); err != nil {
+		return fmt.Errorf("insert llm call: %w", err)
+	}
+
+	failed := 0
+	if c.Failed {
+		failed = 1
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO llm_usage_daily AS d (day, workspace_id, user_id, purpose, provider, model, calls, failed_calls, prompt_tokens, completion_tokens, cost_usd)
+		VALUES ($1::date, $2, $3, $4, $5, $6, 1, $7, $8, $9, $10)
+		ON CONFLICT (day, workspace_id, user_id, purpose, provider, model) DO UPDATE SET
+			calls             = d.calls + 1,
+			failed_calls      = d.failed_calls + EXCLUDED.failed_calls,
+			prompt_tokens     = d.prompt_tokens + EXCLUDED.prompt_tokens,
+			completion_tokens = d.completion_tokens + EXCLUDED.completion_tokens,
+			cost_usd          = d.cost_usd + EXCLUDED.cost_usd
+	`, c.At.UTC(), c.WorkspaceID, c.UserID, c.Purpose, c.Provider, c.Model, failed, c.PromptTokens, c.CompletionTokens, c.CostUSD); err != nil {
+		return fmt.Errorf("update llm usage rollup: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Spend returns what a workspace's calls cost from the UTC day of since onwards;
+// an empty workspaceID sums every workspace
+func (r *LLMUsageRepo) Spend(ctx context.Context, workspaceID string, since time.Time) (float64, error) {
+	var spend float64
+	err := r.db.QueryRow(ctx, `
+		SELECT COALESCE(SUM(cost_usd), 0)::float8
+		FROM llm_usage_daily
+		WHERE day >= $2::date AND ($1 = '' OR workspace_id = $1)
+	`, workspaceID, since.UTC()).Scan(&spend)
+	if err != nil {
+		return 0, fmt.Errorf("query llm spend: %w", err)
+	}
+	return spend, nil
+}
+
+// Daily returns usage per UTC day, purpose and model in [from, to), oldest
+// first; an empty workspaceID covers every workspace
+func (r *LLMUsageRepo) Daily(ctx context.Context, workspaceID string, from, to time.Time) ([]LLMUsageRow, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT to_char(day, 'YYYY-MM-DD'), purpose, provider, model,
+			SUM(calls)::bigint, SUM(failed_calls)::bigint, SUM(prompt_tokens)::bigint, SUM(completion_tokens)::bigint, SUM(cost_usd)::float8
+		FROM llm_usage_daily
+		WHERE day >= $2::date AND day < $3::date AND ($1 = '' OR workspace_id = $1)
+		GROUP BY day, purpose, provider, model
+		ORDER BY day, purpose, provider, model
+	`, workspaceID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("query llm usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []LLMUsageRow{}
+	for rows.Next() {
+		var u LLMUsageRow
+		if err := rows.Scan(&u.Day, &u.Purpose, &u.Provider, &u.Model,
+			&u.Calls, &u.FailedCalls, &u.PromptTokens, &u.CompletionTokens, &u.CostUSD); err != nil {
+			return nil, fmt.Errorf("scan llm usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// TopUsers returns a workspace's users by spend in [from, to), highest first
+func (r *LLMUsageRepo) TopUsers(ctx context.Context, workspaceID string, from, to time.Time, limit int) ([]LLMSpendTotal, error) {
+	return r.totals(ctx, "user_id", workspaceID, from, to, limit)
+}
+
+// TopWorkspaces returns workspaces by spend in [from, to), highest first
+func (r *LLMUsageRepo) TopWorkspaces(ctx context.Context, from, to time.Time, limit int) ([]LLMSpendTotal, error) {
+	return r.totals(ctx, "workspace_id", "", from, to, limit)
+}
+
+// totals sums usage per value of column within a workspace, or all of them
+func (r *LLMUsageRepo) totals(ctx context.Context, column, workspaceID string, from, to time.Time, limit int) ([]LLMSpendTotal, error) {
+	rows, err := r.db.Query(ctx, fmt.Sprintf(`
+		SELECT %[1]s, SUM(calls)::bigint, SUM(prompt_tokens)::bigint, SUM(completion_tokens)::bigint, SUM(cost_usd)::float8 AS cost
+		FROM llm_usage_daily
+		WHERE day >= $2::date AND day < $3::date AND ($1 = '' OR workspace_id = $1)
+		GROUP BY %[1]s
+		ORDER BY cost DESC, %[1]s
+		LIMIT $4
+	`, column), workspaceID, from.UTC(), to.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("query llm spend totals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := []LLMSpendTotal{}
+	for rows.Next() {
+		var t LLMSpendTotal
+		if err := rows.Scan(&t.ID, &t.Calls, &t.PromptTokens, &t.CompletionTokens, &t.CostUSD); err != nil {
+			return nil, fmt.Errorf("scan llm spend totals: %w", err)
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
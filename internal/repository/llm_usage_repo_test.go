@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/pgtest"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testPostgres returns a migrated pool, skipping the test without one
+func testPostgres(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	return pgtest.Pool(t)
+}
+
+func TestLLMUsageRepoDailyRollup(t *testing.T) {
+	db := testPostgres(t)
+	r := NewLLMUsageRepo(db)
+	ctx := context.Background()
+	ws := primitive.NewObjectID().Hex() // keeps this run's rows apart
+	t.Cleanup(func() {
+		_, _ = db.Exec(context.Background(), `DELETE FROM llm_call WHERE workspace_id = $1`, ws)
+		_, _ = db.Exec(context.Background(), `DELETE FROM llm_usage_daily WHERE workspace_id = $1`, ws)
+	})
+
+	day1 := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	calls := []LLMCall{
+		{WorkspaceID: ws, UserID: "u1", Purpose: "analysis", Provider: "openai", Model: "gpt-4o-mini", PromptTokens: 100, CompletionTokens: 50, CostUSD: 0.25, At: day1},
+		{WorkspaceID: ws, UserID: "u1", Purpose: "analysis", Provider: "openai", Model: "gpt-4o-mini", PromptTokens: 10, CompletionTokens: 5, CostUSD: 0.5, Failed: true, At: day1.Add(14 * time.Hour)},
+		{WorkspaceID: ws, UserID: "u2", Purpose: "competitor_generation", Provider: "openai", Model: "gpt-4o", PromptTokens: 1, CompletionTokens: 1, CostUSD: 1, At: day2},
+	}
+	for i := range calls {
+		if err := r.Record(ctx, &calls[i]); err != nil {
+			t.Fatalf("record call %d: %v", i, err)
+		}
+	}
+
+	rows, err := r.Daily(ctx, ws, day1, day2.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LLMUsageRow{
+		{Day: "2026-05-01", Purpose: "analysis", Provider: "openai", Model: "gpt-4o-mini", Calls: 2, FailedCalls: 1, PromptTokens: 110, CompletionTokens: 55, CostUSD: 0.75},
+		{Day: "2026-05-02", Purpose: "competitor_generation", Provider: "openai", Model: "gpt-4o", Calls: 1, PromptTokens: 1, CompletionTokens: 1, CostUSD: 1},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rollup rows, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+
+	for _, tt := range []struct {
+		since time.Time
+		want  float64
+	}{
+		{day1, 1.75},
+		{day2, 1},
+		{day2.AddDate(0, 0, 1), 0},
+	} {
+		spend, err := r.Spend(ctx, ws, tt.since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(spend-tt.want) > 1e-9 {
+			t.Errorf("spend since %s = %v, want %v", tt.since.Format(time.DateOnly), spend, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Workspace roles, from most to least privileged
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// ValidRole reports whether role is one of the known workspace roles
+func ValidRole(role string) bool {
+	switch role {
+	case RoleOwner, RoleAdmin, RoleEditor, RoleViewer:
+		return true
+	}
+	return false
+}
+
+// RoleRank orders roles by privilege; unknown roles rank lowest
+func RoleRank(role string) int {
+	switch role {
+	case RoleOwner:
+		return 4
+	case RoleAdmin:
+		return 3
+	case RoleEditor:
+		return 2
+	case RoleViewer:
+		return 1
+	}
+	return 0
+}
+
+// Membership links a user to a workspace with a role
+type Membership struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	WorkspaceID primitive.ObjectID `bson:"workspace_id" json:"workspace_id"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Email       string             `bson:"email" json:"email"`
+	Role        string             `bson:"role" json:"role"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type MemberRepo struct {
+	col *mongo.Collection
+}
+
+func NewMemberRepo(db *mongo.Database, colName string) *MemberRepo {
+	return &MemberRepo{col: db.Collection(colName)}
+}
+
+// Add inserts a membership; the unique (workspace_id, user_id) index rejects duplicates
+func (r *MemberRepo) Add(ctx context.Context, m *Membership) error {
+	now := time.Now().UTC()
+	m.CreatedAt = now
+	m.UpdatedAt = now
+
+	res, err := r.col.InsertOne(ctx, m)
+	if err != nil {
+		return err
+	}
+	m.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// Find returns the membership of a user in a workspace, or nil
+func (r *MemberRepo) Find(ctx context.Context, workspaceID, userID primitive.ObjectID) (*Membership, error) {
+	var m Membership
+	err := r.col.FindOne(ctx, bson.M{"workspace_id": workspaceID, "user_id": userID}).Decode(&m)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListByUser returns every membership of a user, oldest first
+func (r *MemberRepo) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]Membership, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cur, err := r.col.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	members := []Membership{}
+	if err := cur.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// ListByWorkspace returns every member of a workspace, oldest first
+func (r *MemberRepo) ListByWorkspace(ctx context.Context, workspaceID primitive.ObjectID) ([]Membership, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cur, err := r.col.Find(ctx, bson.M{"workspace_id": workspaceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	members := []Membership{}
+	if err := cur.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// CountByRole counts members of a workspace holding a role
+func (r *MemberRepo) CountByRole(ctx context.Context, workspaceID primitive.ObjectID, role string) (int64, error) {
+	return r.col.CountDocuments(ctx, bson.M{"workspace_id": workspaceID, "role": role})
+}
+
+// UpdateRole changes a member's role
+func (r *MemberRepo) UpdateRole(ctx context.Context, workspaceID, userID primitive.ObjectID, role string) error {
+	filter := bson.M{"workspace_id": workspaceID, "user_id": userID}
+	update := bson.M{"$set": bson.M{"role": role, "updated_at": time.Now().UTC()}}
+	_, err := r.col.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// Remove deletes a membership
+func (r *MemberRepo) Remove(ctx context.Context, workspaceID, userID primitive.ObjectID) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"workspace_id": workspaceID, "user_id": userID})
+	return err
+}
+
+// DeleteByWorkspace removes every membership of a workspace
+func (r *MemberRepo) DeleteByWorkspace(ctx context.Context, workspaceID primitive.ObjectID) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"workspace_id": workspaceID})
+	return err
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Project is one tracked brand in one market. A workspace owns many projects;
+// prompts and analyses in Postgres are tagged with the project's hex ID.
+type Project struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	WorkspaceID primitive.ObjectID `bson:"workspace_id" json:"workspace_id"`
+	Name        string             `bson:"name" json:"name"`
+	BrandName   string             `bson:"brand_name,omitempty" json:"brand_name,omitempty"`
+	Domain      string             `bson:"domain,omitempty" json:"domain,omitempty"`
+	Country     string             `bson:"country,omitempty" json:"country,omitempty"`
+	Competitor  []Competitor       `bson:"competitor,omitempty" json:"competitor,omitempty"`
+	// Default marks the project requests without a project ID go to; a unique
+	// index keeps it to one per workspace
+	Default   bool      `bson:"default,omitempty" json:"default"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type ProjectRepo struct {
+	col *mongo.Collection
+}
+
+func NewProjectRepo(db *mongo.Database, colName string) *ProjectRepo {
+	return &ProjectRepo{col: db.Collection(colName)}
+}
+
+// Create inserts a new project and sets its ID
+func (r *ProjectRepo) Create(ctx context.Context, p *Project) error {
+	now := time.Now().UTC()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+
+	res, err := r.col.InsertOne(ctx, p)
+	if err != nil {
+		return err
+	}
+	p.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindByID returns a project by its hex ID, or nil if it does not exist
+func (r *ProjectRepo) FindByID(ctx context.Context, id string) (*Project, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	var p Project
+	err = r.col.FindOne(ctx, bson.M{"_id": oid}).Decode(&p)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// FindDefault returns a workspace's default project, or nil if it has none
+func (r *ProjectRepo) FindDefault(ctx context.Context, workspaceID primitive.ObjectID) (*Project, error) {
+	var p Project
+	err := r.col.FindOne(ctx, bson.M{"workspace_id": workspaceID, "default": true}).Decode(&p)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreateDefault inserts p as its workspace's default project. If the
+// workspace already has one, that one is returned instead.
+func (r *ProjectRepo) CreateDefault(ctx context.Context, p *Project) (*Project, error) {
+	p.Default = true
+	if err := r.Create(ctx, p); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return r.FindDefault(ctx, p.WorkspaceID)
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// MarkDefault makes an existing project its workspace's default. If the
+// workspace already has one, that one is returned instead.
+func (r *ProjectRepo) MarkDefault(ctx context.Context, p *Project) (*Project, error) {
+	_, err := r.col.UpdateByID(ctx, p.ID, bson.M{"$set": bson.M{"default": true, "updated_at": time.Now().UTC()}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return r.FindDefault(ctx, p.WorkspaceID)
+		}
+		return nil, err
+	}
+	p.Default = true
+	return p, nil
+}
+
+// WorkspacesWithDefault returns the IDs of workspaces that have a default project
+func (r *ProjectRepo) WorkspacesWithDefault(ctx context.Context) ([]primitive.ObjectID, error) {
+	vals, err := r.col.Distinct(ctx, "workspace_id", bson.M{"default": true})
+	if err != nil {
+		return nil, err
+	}
+	return objectIDs(vals), nil
+}
+
+// ListByWorkspace returns every project of a workspace, oldest first
+func (r *ProjectRepo) ListByWorkspace(ctx context.Context, workspaceID primitive.ObjectID) ([]Project, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cur, err := r.col.Find(ctx, bson.M{"workspace_id": workspaceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	projects := []Project{}
+	if err := cur.All(ctx, &projects); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+// UpdateProfile sets the brand profile of a project
+func (r *ProjectRepo) UpdateProfile(ctx context.Context, id primitive.ObjectID, brandName, domain, country string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"brand_name": brandName,
+			"domain":     domain,
+			"country":    country,
+			"updated_at": time.Now().UTC(),
+		},
+	}
+	_, err := r.col.UpdateByID(ctx, id, update)
+	return err
+}
+
+// AddCompetitor adds competitors to a project
+func (r *ProjectRepo) AddCompetitor(ctx context.Context, id primitive.ObjectID, competitor []Competitor) error {
+	update := bson.M{
+		"$addToSet": bson.M{"competitor": bson.M{"$each": competitor}}, // ✅ avoids duplicates
+		"$set":      bson.M{"updated_at": time.Now().UTC()},
+	}
+	_, err := r.col.UpdateByID(ctx, id, update)
+	return err
+}
+
+// RemoveCompetitor removes the competitor with the given domain from a
+// project, reporting whether there was one
+func (r *ProjectRepo) RemoveCompetitor(ctx context.Context, id primitive.ObjectID, domain string) (bool, error) {
+	update := bson.M{
+		"$pull": bson.M{"competitor": bson.M{"domain": domain}},
+		"$set":  bson.M{"updated_at": time.Now().UTC()},
+	}
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": id, "competitor.domain": domain}, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// GetCompetitor returns a paginated list of competitors for a project
+func (r *ProjectRepo) GetCompetitor(ctx context.Context, id primitive.ObjectID, page, limit int) ([]Competitor, int, error) {
+	var p Project
+	err := r.col.FindOne(ctx, bson.M{"_id": id}).Decode(&p)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return []Competitor{}, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	total := len(p.Competitor)
+	start := (page - 1) * limit
+	if start >= total {
+		return []Competitor{}, total, nil
+	}
+
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	return p.Competitor[start:end], total, nil
+}
+
+// DeleteByWorkspace removes every project of a workspace
+func (r *ProjectRepo) DeleteByWorkspace(ctx context.Context, workspaceID primitive.ObjectID) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"workspace_id": workspaceID})
+	return err
+}
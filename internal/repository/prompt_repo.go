@@ -7,9 +7,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// execer is satisfied by both the pool and a transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
 type MinimalAnalysis struct {
 	Prompt     string           `json:"prompt"`
 	Response   string           `json:"response"`
@@ -33,12 +39,14 @@ func NewPromptRepo(db *pgxpool.Pool) *PromptRepo {
 }
 
 type PromptResponseEntry struct {
-	ID        int       `json:"id"`
-	UserEmail string    `json:"user_email"`
-	Prompt    string    `json:"prompt"`
-	Response  string    `json:"response"`
-	Country   string    `json:"country"`
-	Added     time.Time `json:"added"`
+	ID          int       `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	ProjectID   string    `json:"project_id"`
+	UserID      string    `json:"user_id"`
+	Prompt      string    `json:"prompt"`
+	Response    string    `json:"response"`
+	Country     string    `json:"country"`
+	Added       time.Time `json:"added"`
 }
 
 // AddPromptResponse inserts a single record
@@ -48,18 +56,18 @@ func (r *PromptRepo) StorePromptResponses(ctx context.Context, entries []PromptR
 	}
 
 	query := `
-		INSERT INTO prompt_response_entry (user_email, prompt, response, country, added)
+		INSERT INTO prompt_response_entry (workspace_id, project_id, user_id, prompt, response, country, added)
 		VALUES %s
 		RETURNING id
 	`
 
 	valueStrings := make([]string, 0, len(entries))
-	valueArgs := make([]interface{}, 0, len(entries)*5)
+	valueArgs := make([]interface{}, 0, len(entries)*7)
 
 	for i, e := range entries {
-		idx := i*5 + 1
-		valueStrings = append(valueStrings, fmt.Sprintf("($%d,$%d,$%d,$%d,$%d)", idx, idx+1, idx+2, idx+3, idx+4))
-		valueArgs = append(valueArgs, e.UserEmail, e.Prompt, e.Response, e.Country, e.Added)
+		idx := i*7 + 1
+		valueStrings = append(valueStrings, fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d)", idx, idx+1, idx+2, idx+3, idx+4, idx+5, idx+6))
+		valueArgs = append(valueArgs, e.WorkspaceID, e.ProjectID, e.UserID, e.Prompt, e.Response, e.Country, e.Added)
 	}
 
 	finalQuery := fmt.Sprintf(query, strings.Join(valueStrings, ","))
@@ -86,16 +94,16 @@ func (r *PromptRepo) StorePromptResponses(ctx context.Context, entries []PromptR
 	return ids, nil
 }
 
-// GetPromptResponsesByEmail retrieves paginated records
-func (r *PromptRepo) GetPromptResponsesByEmail(ctx context.Context, email string, limit, offset int) ([]PromptResponseEntry, error) {
+// GetPromptResponsesByProject retrieves paginated records
+func (r *PromptRepo) GetPromptResponsesByProject(ctx context.Context, projectID string, limit, offset int) ([]PromptResponseEntry, error) {
 	query := `
-		SELECT id, user_email, prompt, response, country, added
-		FROM prompt_response_entry	
-		WHERE user_email = $1
+		SELECT id, workspace_id, project_id, COALESCE(user_id, ''), prompt, response, country, added
+		FROM prompt_response_entry
+		WHERE project_id = $1
 		ORDER BY added DESC
 		LIMIT $2 OFFSET $3
 	`
-	rows, err := r.db.Query(ctx, query, email, limit, offset)
+	rows, err := r.db.Query(ctx, query, projectID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -104,7 +112,7 @@ func (r *PromptRepo) GetPromptResponsesByEmail(ctx context.Context, email string
 	var results []PromptResponseEntry
 	for rows.Next() {
 		var e PromptResponseEntry
-		if err := rows.Scan(&e.ID, &e.UserEmail, &e.Prompt, &e.Response, &e.Country, &e.Added); err != nil {
+		if err := rows.Scan(&e.ID, &e.WorkspaceID, &e.ProjectID, &e.UserID, &e.Prompt, &e.Response, &e.Country, &e.Added); err != nil {
 			return nil, err
 		}
 		results = append(results, e)
@@ -117,28 +125,32 @@ func (r *PromptRepo) GetPromptResponsesByEmail(ctx context.Context, email string
 // 🧩 2️⃣ PromptMeta
 // High-level prompt info (acts as root for analyses)
 type PromptMeta struct {
-	ID        int            `json:"id"`
-	PromptID  int            `json:"prompt_id"`
-	UserEmail string         `json:"user_email"`
-	Prompt    string         `json:"prompt"`
-	Mentions  map[string]int `json:"mentions"`
-	Volume    int            `json:"volume"`
-	Tags      []string       `json:"tags"`
-	Location  string         `json:"location"`
-	Added     time.Time      `json:"added"`
+	ID          int            `json:"id"`
+	PromptID    int            `json:"prompt_id"`
+	WorkspaceID string         `json:"workspace_id"`
+	ProjectID   string         `json:"project_id"`
+	UserID      string         `json:"user_id"`
+	Prompt      string         `json:"prompt"`
+	Mentions    map[string]int `json:"mentions"`
+	Volume      int            `json:"volume"`
+	Tags        []string       `json:"tags"`
+	Location    string         `json:"location"`
+	Added       time.Time      `json:"added"`
 }
 
 // 🧩 3️⃣ BrandAnalysis
 // Per-brand analysis results
 type BrandAnalysis struct {
-	ID         int       `json:"id"`
-	PromptID   int       `json:"prompt_id"`
-	UserEmail  string    `json:"user_email"`
-	BrandName  string    `json:"brand_name"`
-	Visibility float64   `json:"visibility"`
-	Sentiment  int       `json:"sentiment"`
-	Position   int       `json:"position"`
-	Added      time.Time `json:"added"`
+	ID          int       `json:"id"`
+	PromptID    int       `json:"prompt_id"`
+	WorkspaceID string    `json:"workspace_id"`
+	ProjectID   string    `json:"project_id"`
+	UserID      string    `json:"user_id"`
+	BrandName   string    `json:"brand_name"`
+	Visibility  float64   `json:"visibility"`
+	Sentiment   int       `json:"sentiment"`
+	Position    int       `json:"position"`
+	Added       time.Time `json:"added"`
 }
 
 // 🧩 4️⃣ DomainAnalysis
@@ -155,65 +167,77 @@ type DomainAnalysis struct {
 
 // 🧩 Store Prompt Meta
 func (r *PromptRepo) StorePromptMeta(ctx context.Context, entries []PromptMeta) error {
+	return storePromptMeta(ctx, r.db, entries)
+}
+
+func storePromptMeta(ctx context.Context, db execer, entries []PromptMeta) error {
 	if len(entries) == 0 {
 		return nil
 	}
 
 	query := `
-		INSERT INTO prompt_meta (prompt_id, user_email, prompt, mentions, volume, tags, location, added)
+		INSERT INTO prompt_meta (prompt_id, workspace_id, project_id, user_id, prompt, mentions, volume, tags, location, added)
 		VALUES %s
 	`
 
 	valueStrings := make([]string, 0, len(entries))
-	valueArgs := make([]interface{}, 0, len(entries)*8) // 8 columns now, including prompt_id
+	valueArgs := make([]interface{}, 0, len(entries)*10) // 10 columns now, including prompt_id, workspace_id and project_id
 
 	for i, e := range entries {
-		idx := i*8 + 1
+		idx := i*10 + 1
 		valueStrings = append(valueStrings,
-			fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)",
-				idx, idx+1, idx+2, idx+3, idx+4, idx+5, idx+6, idx+7,
+			fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)",
+				idx, idx+1, idx+2, idx+3, idx+4, idx+5, idx+6, idx+7, idx+8, idx+9,
 			))
-		valueArgs = append(valueArgs, e.PromptID, e.UserEmail, e.Prompt, e.Mentions, e.Volume, e.Tags, e.Location, e.Added)
+		valueArgs = append(valueArgs, e.PromptID, e.WorkspaceID, e.ProjectID, e.UserID, e.Prompt, e.Mentions, e.Volume, e.Tags, e.Location, e.Added)
 	}
 
 	finalQuery := fmt.Sprintf(query, strings.Join(valueStrings, ","))
 
-	_, err := r.db.Exec(ctx, finalQuery, valueArgs...)
+	_, err := db.Exec(ctx, finalQuery, valueArgs...)
 	return err
 }
 
 func (r *PromptRepo) StoreBrandAnalyses(ctx context.Context, entries []BrandAnalysis) error {
+	return storeBrandAnalyses(ctx, r.db, entries)
+}
+
+func storeBrandAnalyses(ctx context.Context, db execer, entries []BrandAnalysis) error {
 	if len(entries) == 0 {
 		return nil
 	}
 
 	query := `
-		INSERT INTO brand_analysis (prompt_id, user_email, brand_name, visibility, sentiment, position, added)
+		INSERT INTO brand_analysis (prompt_id, workspace_id, project_id, user_id, brand_name, visibility, sentiment, position, added)
 		VALUES %s
 	`
 
 	valueStrings := make([]string, 0, len(entries))
-	valueArgs := make([]interface{}, 0, len(entries)*7)
+	valueArgs := make([]interface{}, 0, len(entries)*9)
 
 	for i, e := range entries {
-		idx := i*7 + 1
+		idx := i*9 + 1
 		valueStrings = append(valueStrings,
-			fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d)",
-				idx, idx+1, idx+2, idx+3, idx+4, idx+5, idx+6,
+			fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)",
+				idx, idx+1, idx+2, idx+3, idx+4, idx+5, idx+6, idx+7, idx+8,
 			))
 		valueArgs = append(valueArgs,
-			e.PromptID, e.UserEmail, e.BrandName, e.Visibility, e.Sentiment, e.Position, e.Added,
+			e.PromptID, e.WorkspaceID, e.ProjectID, e.UserID, e.BrandName, e.Visibility, e.Sentiment, e.Position, e.Added,
 		)
 	}
 
 	finalQuery := fmt.Sprintf(query, strings.Join(valueStrings, ","))
 
-	_, err := r.db.Exec(ctx, finalQuery, valueArgs...)
+	_, err := db.Exec(ctx, finalQuery, valueArgs...)
 	return err
 }
 
 // 🧩 Store Domain Analyses
 func (r *PromptRepo) StoreDomainAnalyses(ctx context.Context, entries []DomainAnalysis) error {
+	return storeDomainAnalyses(ctx, r.db, entries)
+}
+
+func storeDomainAnalyses(ctx context.Context, db execer, entries []DomainAnalysis) error {
 	if len(entries) == 0 {
 		return nil
 	}
@@ -237,21 +261,21 @@ func (r *PromptRepo) StoreDomainAnalyses(ctx context.Context, entries []DomainAn
 
 	finalQuery := fmt.Sprintf(query, strings.Join(valueStrings, ","))
 
-	_, err := r.db.Exec(ctx, finalQuery, valueArgs...)
+	_, err := db.Exec(ctx, finalQuery, valueArgs...)
 	return err
 }
 
-// GetBrandAnalysesByEmail retrieves paginated brand analyses by user email
-func (r *PromptRepo) GetBrandAnalysesByEmail(ctx context.Context, email string, limit, offset int) ([]BrandAnalysis, error) {
+// GetBrandAnalysesByProject retrieves paginated brand analyses for a project
+func (r *PromptRepo) GetBrandAnalysesByProject(ctx context.Context, projectID string, limit, offset int) ([]BrandAnalysis, error) {
 	query := `
-		SELECT id, prompt_id, user_email, brand_name, visibility, sentiment, position, added
+		SELECT id, prompt_id, workspace_id, project_id, COALESCE(user_id, ''), brand_name, visibility, sentiment, position, added
 		FROM brand_analysis
-		WHERE user_email = $1
+		WHERE project_id = $1
 		ORDER BY added DESC
 		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := r.db.Query(ctx, query, email, limit, offset)
+	rows, err := r.db.Query(ctx, query, projectID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("query brand analyses: %w", err)
 	}
@@ -263,7 +287,9 @@ func (r *PromptRepo) GetBrandAnalysesByEmail(ctx context.Context, email string,
 		if err := rows.Scan(
 			&a.ID,
 			&a.PromptID,
-			&a.UserEmail,
+			&a.WorkspaceID,
+			&a.ProjectID,
+			&a.UserID,
 			&a.BrandName,
 			&a.Visibility,
 			&a.Sentiment,
@@ -282,18 +308,18 @@ func (r *PromptRepo) GetBrandAnalysesByEmail(ctx context.Context, email string,
 	return analyses, nil
 }
 
-// GetDomainAnalysesByEmail retrieves paginated domain analyses for a user
-func (r *PromptRepo) GetDomainAnalysesByEmail(ctx context.Context, email string, limit, offset int) ([]DomainAnalysis, error) {
+// GetDomainAnalysesByProject retrieves paginated domain analyses for a project
+func (r *PromptRepo) GetDomainAnalysesByProject(ctx context.Context, projectID string, limit, offset int) ([]DomainAnalysis, error) {
 	query := `
 	SELECT da.id, da.prompt_id, da.domain, da.used, da.avg_citations, da.type, da.added
 	FROM domain_analysis AS da
 	JOIN prompt_response_entry AS pr ON da.prompt_id = pr.id
-	WHERE pr.user_email = $1
+	WHERE pr.project_id = $1
 	ORDER BY da.added DESC
 	LIMIT $2 OFFSET $3
 `
 
-	rows, err := r.db.Query(ctx, query, email, limit, offset)
+	rows, err := r.db.Query(ctx, query, projectID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("query domain analyses: %w", err)
 	}
@@ -330,7 +356,7 @@ type BrandOverview struct {
 	AvgSentiment  float64 `json:"avg_sentiment"`
 }
 
-func (r *PromptRepo) GetBrandOverviewByEmail(ctx context.Context, email string) ([]BrandOverview, error) {
+func (r *PromptRepo) GetBrandOverviewByProject(ctx context.Context, projectID string) ([]BrandOverview, error) {
 	query := `
 		SELECT 
 			ba.brand_name,
@@ -339,12 +365,12 @@ func (r *PromptRepo) GetBrandOverviewByEmail(ctx context.Context, email string)
 			AVG(ba.sentiment) AS avg_sentiment
 		FROM brand_analysis AS ba
 		JOIN prompt_response_entry AS pr ON ba.prompt_id = pr.id
-		WHERE pr.user_email = $1
+		WHERE pr.project_id = $1
 		GROUP BY ba.brand_name
 		ORDER BY avg_visibility DESC
 		`
 
-	rows, err := r.db.Query(ctx, query, email)
+	rows, err := r.db.Query(ctx, query, projectID)
 	if err != nil {
 		return nil, fmt.Errorf("query brand overview: %w", err)
 	}
@@ -370,16 +396,16 @@ func (r *PromptRepo) GetBrandOverviewByEmail(ctx context.Context, email string)
 
 	return overviews, nil
 }
-func (r *PromptRepo) GetPromptMetaByEmail(ctx context.Context, email string, limit, offset int) ([]PromptMeta, error) {
+func (r *PromptRepo) GetPromptMetaByProject(ctx context.Context, projectID string, limit, offset int) ([]PromptMeta, error) {
 	query := `
-		SELECT id, prompt_id, user_email, prompt, mentions, volume, tags, location, added
+		SELECT id, prompt_id, workspace_id, project_id, COALESCE(user_id, ''), prompt, mentions, volume, tags, location, added
 		FROM prompt_meta
-		WHERE user_email = $1
+		WHERE project_id = $1
 		ORDER BY added DESC
 		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := r.db.Query(ctx, query, email, limit, offset)
+	rows, err := r.db.Query(ctx, query, projectID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("query prompt meta: %w", err)
 	}
@@ -393,7 +419,9 @@ func (r *PromptRepo) GetPromptMetaByEmail(ctx context.Context, email string, lim
 		if err := rows.Scan(
 			&m.ID,
 			&m.PromptID,
-			&m.UserEmail,
+			&m.WorkspaceID,
+			&m.ProjectID,
+			&m.UserID,
 			&m.Prompt,
 			&mentionsJSON,
 			&m.Volume,
@@ -417,7 +445,7 @@ func (r *PromptRepo) GetPromptMetaByEmail(ctx context.Context, email string, lim
 
 	return metas, nil
 }
-func (r *PromptRepo) GetBrandOverviewByPrompt(ctx context.Context, email string, promptID int) ([]BrandOverview, error) {
+func (r *PromptRepo) GetBrandOverviewByPrompt(ctx context.Context, projectID string, promptID int) ([]BrandOverview, error) {
 	query := `
 		SELECT 
 			ba.brand_name,
@@ -426,11 +454,11 @@ func (r *PromptRepo) GetBrandOverviewByPrompt(ctx context.Context, email string,
 			ba.sentiment AS avg_sentiment
 		FROM brand_analysis AS ba
 		JOIN prompt_response_entry AS pr ON ba.prompt_id = pr.id
-		WHERE pr.user_email = $1 AND pr.id = $2
+		WHERE pr.project_id = $1 AND pr.id = $2
 		ORDER BY ba.visibility DESC
 	`
 
-	rows, err := r.db.Query(ctx, query, email, promptID)
+	rows, err := r.db.Query(ctx, query, projectID, promptID)
 	if err != nil {
 		return nil, fmt.Errorf("query brand overview by prompt: %w", err)
 	}
@@ -456,7 +484,7 @@ func (r *PromptRepo) GetBrandOverviewByPrompt(ctx context.Context, email string,
 
 	return overviews, nil
 }
-func (r *PromptRepo) GetDomainOverviewByPrompt(ctx context.Context, email string, promptID int) ([]DomainAnalysis, error) {
+func (r *PromptRepo) GetDomainOverviewByPrompt(ctx context.Context, projectID string, promptID int) ([]DomainAnalysis, error) {
 	query := `
 		SELECT 
 			da.domain,
@@ -466,11 +494,11 @@ func (r *PromptRepo) GetDomainOverviewByPrompt(ctx context.Context, email string
 			da.added
 		FROM domain_analysis AS da
 		JOIN prompt_response_entry AS pr ON da.prompt_id = pr.id
-		WHERE pr.user_email = $1 AND da.prompt_id = $2
+		WHERE pr.project_id = $1 AND da.prompt_id = $2
 		ORDER BY da.avg_citations DESC
 	`
 
-	rows, err := r.db.Query(ctx, query, email, promptID)
+	rows, err := r.db.Query(ctx, query, projectID, promptID)
 	if err != nil {
 		return nil, fmt.Errorf("query domain overview by prompt: %w", err)
 	}
@@ -497,3 +525,342 @@ func (r *PromptRepo) GetDomainOverviewByPrompt(ctx context.Context, email string
 
 	return domainOverview, nil
 }
+
+// AssignWorkspace attaches a user's unscoped analysis rows (written before
+// workspaces existed) to the given workspace.
+func (r *PromptRepo) AssignWorkspace(ctx context.Context, userID, workspaceID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin assign workspace: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range []string{"prompt_response_entry", "prompt_meta", "brand_analysis"} {
+		query := fmt.Sprintf(`UPDATE %s SET workspace_id = $1 WHERE user_id = $2 AND workspace_id IS NULL`, table)
+		if _, err := tx.Exec(ctx, query, workspaceID, userID); err != nil {
+			return fmt.Errorf("assign workspace on %s: %w", table, err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// AssignProject attaches a workspace's analysis rows that predate projects to
+// the given project.
+func (r *PromptRepo) AssignProject(ctx context.Context, workspaceID, projectID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin assign project: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range []string{"prompt_response_entry", "prompt_meta", "brand_analysis"} {
+		query := fmt.Sprintf(`UPDATE %s SET project_id = $1 WHERE workspace_id = $2 AND project_id IS NULL`, table)
+		if _, err := tx.Exec(ctx, query, projectID, workspaceID); err != nil {
+			return fmt.Errorf("assign project on %s: %w", table, err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteWorkspaceData removes every analysis row of a workspace. Meta, brand
+// and domain rows of its prompts go with them through ON DELETE CASCADE.
+func (r *PromptRepo) DeleteWorkspaceData(ctx context.Context, workspaceID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin delete workspace data: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range []string{"prompt_meta", "brand_analysis", "prompt_response_entry"} {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE workspace_id = $1`, table)
+		if _, err := tx.Exec(ctx, query, workspaceID); err != nil {
+			return fmt.Errorf("delete workspace data from %s: %w", table, err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// AnonymiseUser replaces a user's ID on rows that stay with a shared
+// workspace, dropping the email legacy rows still carry, and deletes their
+// rows that never belonged to a workspace.
+func (r *PromptRepo) AnonymiseUser(ctx context.Context, userID, placeholder string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin anonymise user: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM prompt_response_entry WHERE user_id = $1 AND workspace_id IS NULL`, userID); err != nil {
+		return fmt.Errorf("delete unscoped prompts: %w", err)
+	}
+	for _, table := range []string{"prompt_response_entry", "prompt_meta", "brand_analysis"} {
+		query := fmt.Sprintf(`UPDATE %s SET user_id = $1, user_email = NULL WHERE user_id = $2`, table)
+		if _, err := tx.Exec(ctx, query, placeholder, userID); err != nil {
+			return fmt.Errorf("anonymise %s: %w", table, err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// LegacyUserEmails returns the emails on rows written before rows carried a
+// user_id, for BackfillUserID
+func (r *PromptRepo) LegacyUserEmails(ctx context.Context) ([]string, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT user_email FROM prompt_response_entry WHERE user_id IS NULL AND user_email IS NOT NULL
+		UNION
+		SELECT user_email FROM prompt_meta WHERE user_id IS NULL AND user_email IS NOT NULL
+		UNION
+		SELECT user_email FROM brand_analysis WHERE user_id IS NULL AND user_email IS NOT NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query legacy emails: %w", err)
+	}
+	defer rows.Close()
+
+	emails := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, fmt.Errorf("scan legacy email: %w", err)
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+// BackfillUserID sets the user ID on rows that only carry the user's email
+func (r *PromptRepo) BackfillUserID(ctx context.Context, email, userID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin backfill user id: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range []string{"prompt_response_entry", "prompt_meta", "brand_analysis"} {
+		query := fmt.Sprintf(`UPDATE %s SET user_id = $1 WHERE user_email = $2 AND user_id IS NULL`, table)
+		if _, err := tx.Exec(ctx, query, userID, email); err != nil {
+			return fmt.Errorf("backfill user id on %s: %w", table, err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// EachPromptResponseByUser calls fn for every prompt a user ran, oldest first
+func (r *PromptRepo) EachPromptResponseByUser(ctx context.Context, userID string, fn func(PromptResponseEntry) error) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, COALESCE(workspace_id, ''), COALESCE(project_id, ''), COALESCE(user_id, ''), prompt, response, country, added
+		FROM prompt_response_entry
+		WHERE user_id = $1
+		ORDER BY added
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("query prompt responses: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e PromptResponseEntry
+		if err := rows.Scan(&e.ID, &e.WorkspaceID, &e.ProjectID, &e.UserID, &e.Prompt, &e.Response, &e.Country, &e.Added); err != nil {
+			return fmt.Errorf("scan prompt response: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachPromptMetaByUser calls fn for every prompt meta row of a user, oldest first
+func (r *PromptRepo) EachPromptMetaByUser(ctx context.Context, userID string, fn func(PromptMeta) error) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, prompt_id, COALESCE(workspace_id, ''), COALESCE(project_id, ''), COALESCE(user_id, ''), prompt, mentions, volume, tags, location, added
+		FROM prompt_meta
+		WHERE user_id = $1
+		ORDER BY added
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("query prompt meta: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m PromptMeta
+		var mentionsJSON []byte
+		if err := rows.Scan(&m.ID, &m.PromptID, &m.WorkspaceID, &m.ProjectID, &m.UserID, &m.Prompt, &mentionsJSON, &m.Volume, &m.Tags, &m.Location, &m.Added); err != nil {
+			return fmt.Errorf("scan prompt meta: %w", err)
+		}
+		if err := json.Unmarshal(mentionsJSON, &m.Mentions); err != nil {
+			m.Mentions = map[string]int{}
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachBrandAnalysisByUser calls fn for every brand analysis row of a user, oldest first
+func (r *PromptRepo) EachBrandAnalysisByUser(ctx context.Context, userID string, fn func(BrandAnalysis) error) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, prompt_id, COALESCE(workspace_id, ''), COALESCE(project_id, ''), COALESCE(user_id, ''), brand_name, visibility, sentiment, position, added
+		FROM brand_analysis
+		WHERE user_id = $1
+		ORDER BY added
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("query brand analyses: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a BrandAnalysis
+		if err := rows.Scan(&a.ID, &a.PromptID, &a.WorkspaceID, &a.ProjectID, &a.UserID, &a.BrandName, &a.Visibility, &a.Sentiment, &a.Position, &a.Added); err != nil {
+			return fmt.Errorf("scan brand analysis: %w", err)
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachDomainAnalysisByUser calls fn for every domain analysis row of the
+// prompts a user ran, oldest first
+func (r *PromptRepo) EachDomainAnalysisByUser(ctx context.Context, userID string, fn func(DomainAnalysis) error) error {
+	rows, err := r.db.Query(ctx, `
+		SELECT da.id, da.prompt_id, da.domain, da.used, da.avg_citations, da.type, da.added
+		FROM domain_analysis AS da
+		JOIN prompt_response_entry AS pr ON da.prompt_id = pr.id
+		WHERE pr.user_id = $1
+		ORDER BY da.added
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("query domain analyses: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a DomainAnalysis
+		if err := rows.Scan(&a.ID, &a.PromptID, &a.Domain, &a.Used, &a.AvgCitations, &a.Type, &a.Added); err != nil {
+			return fmt.Errorf("scan domain analysis: %w", err)
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetPromptResponsesByUser retrieves a user's prompts across workspaces, newest first
+func (r *PromptRepo) GetPromptResponsesByUser(ctx context.Context, userID string, limit, offset int) ([]PromptResponseEntry, error) {
+	query := `
+		SELECT id, COALESCE(workspace_id, ''), COALESCE(project_id, ''), COALESCE(user_id, ''), prompt, response, country, added
+		FROM prompt_response_entry
+		WHERE user_id = $1
+		ORDER BY added DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.db.Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("query prompt responses: %w", err)
+	}
+	defer rows.Close()
+
+	results := []PromptResponseEntry{}
+	for rows.Next() {
+		var e PromptResponseEntry
+		if err := rows.Scan(&e.ID, &e.WorkspaceID, &e.ProjectID, &e.UserID, &e.Prompt, &e.Response, &e.Country, &e.Added); err != nil {
+			return nil, fmt.Errorf("scan prompt response: %w", err)
+		}
+		results = append(results, e)
+	}
+	return results, rows.Err()
+}
+
+// DailyCount is a number of rows on one UTC day
+type DailyCount struct {
+	Day   string `json:"day"` // YYYY-MM-DD
+	Count int64  `json:"count"`
+}
+
+// PromptsPerDay counts prompts run per UTC day since a time, oldest first
+func (r *PromptRepo) PromptsPerDay(ctx context.Context, since time.Time) ([]DailyCount, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT to_char(date_trunc('day', added AT TIME ZONE 'UTC'), 'YYYY-MM-DD') AS day, count(*)
+		FROM prompt_response_entry
+		WHERE added >= $1
+		GROUP BY day
+		ORDER BY day
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("query prompts per day: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []DailyCount{}
+	for rows.Next() {
+		var c DailyCount
+		if err := rows.Scan(&c.Day, &c.Count); err != nil {
+			return nil, fmt.Errorf("scan prompts per day: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// ReplaceAnalyses swaps the meta, brand and domain rows of the given prompts
+// for new ones in one transaction. Tags on the old meta rows are carried over.
+func (r *PromptRepo) ReplaceAnalyses(ctx context.Context, promptIDs []int, meta []PromptMeta, brands []BrandAnalysis, domains []DomainAnalysis) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin replace analyses: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT prompt_id, tags FROM prompt_meta WHERE prompt_id = ANY($1) AND tags IS NOT NULL`, promptIDs)
+	if err != nil {
+		return fmt.Errorf("query prompt tags: %w", err)
+	}
+	tags := map[int][]string{}
+	for rows.Next() {
+		var id int
+		var t []string
+		if err := rows.Scan(&id, &t); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan prompt tags: %w", err)
+		}
+		tags[id] = t
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate prompt tags: %w", err)
+	}
+	for i := range meta {
+		if t, ok := tags[meta[i].PromptID]; ok {
+			meta[i].Tags = t
+		}
+	}
+
+	for _, table := range []string{"prompt_meta", "brand_analysis", "domain_analysis"} {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE prompt_id = ANY($1)`, table)
+		if _, err := tx.Exec(ctx, query, promptIDs); err != nil {
+			return fmt.Errorf("delete old analyses from %s: %w", table, err)
+		}
+	}
+	if err := storePromptMeta(ctx, tx, meta); err != nil {
+		return fmt.Errorf("store prompt meta: %w", err)
+	}
+	if err := storeBrandAnalyses(ctx, tx, brands); err != nil {
+		return fmt.Errorf("store brand analyses: %w", err)
+	}
+	if err := storeDomainAnalyses(ctx, tx, domains); err != nil {
+		return fmt.Errorf("store domain analyses: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
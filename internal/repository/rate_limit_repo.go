@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimitRepo keeps token buckets and usage counters in Mongo so every
+// instance shares them. It implements ratelimit.Store.
+type RateLimitRepo struct {
+	col *mongo.Collection
+}
+
+func NewRateLimitRepo(db *mongo.Database, colName string) *RateLimitRepo {
+	return &RateLimitRepo{col: db.Collection(colName)}
+}
+
+// TakeToken refills and takes from the bucket in one atomic update, so
+// concurrent requests on different instances cannot both spend the last token
+func (r *RateLimitRepo) TakeToken(ctx context.Context, key string, burst int, refillPerSec float64, now time.Time) (bool, float64, error) {
+	now = now.UTC()
+	// Once full the bucket is the same as a missing one, so Mongo may drop it
+	expires := now.Add(time.Duration(float64(burst) / refillPerSec * float64(time.Second)))
+	elapsed := bson.M{"$max": bson.A{0, bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}}, 1000,
+	}}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$tokens", burst}},
+				bson.M{"$multiply": bson.A{elapsed, refillPerSec}},
+			}}}},
+			"updated_at": now,
+		}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":     bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"expires_at": expires,
+		}}},
+	}
+
+	var doc struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := r.col.FindOneAndUpdate(ctx, bson.M{"_id": "bucket:" + key}, pipeline, opts).Decode(&doc); err != nil {
+		return false, 0, err
+	}
+	return doc.Allowed, doc.Tokens, nil
+}
+
+// AddUsage increments the counter at key, creating it with expiresAt
+func (r *RateLimitRepo) AddUsage(ctx context.Context, key string, n int64, expiresAt time.Time) (int64, error) {
+	var doc struct {
+		N int64 `bson:"n"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := r.col.FindOneAndUpdate(ctx, bson.M{"_id": "usage:" + key}, bson.M{
+		"$inc":         bson.M{"n": n},
+		"$setOnInsert": bson.M{"expires_at": expiresAt.UTC()},
+	}, opts).Decode(&doc)
+	if err != nil {
+		return 0, err
+	}
+	return doc.N, nil
+}
+
+// Usage returns the counter at key, 0 if it does not exist
+func (r *RateLimitRepo) Usage(ctx context.Context, key string) (int64, error) {
+	var doc struct {
+		N int64 `bson:"n"`
+	}
+	err := r.col.FindOne(ctx, bson.M{"_id": "usage:" + key}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return doc.N, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/mongotest"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// testMongo returns a scratch database, skipping the test without one
+func testMongo(t *testing.T) *mongo.Database {
+	t.Helper()
+	return mongotest.Database(t)
+}
+
+func TestRateLimitRepoTakeToken(t *testing.T) {
+	r := NewRateLimitRepo(testMongo(t), "rate_limits")
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	const burst, rate = 2, 1.0
+
+	steps := []struct {
+		after      time.Duration
+		wantOK     bool
+		wantTokens float64
+	}{
+		{0, true, 1},
+		{0, true, 0},
+		{0, false, 0},
+		{500 * time.Millisecond, false, 0.5},
+		{time.Second, true, 0},
+		{time.Minute, true, 1}, // capped at burst
+	}
+	for _, st := range steps {
+		ok, tokens, err := r.TakeToken(ctx, "k", burst, rate, start.Add(st.after))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != st.wantOK || tokens != st.wantTokens {
+			t.Errorf("after %v: ok=%v tokens=%v, want ok=%v tokens=%v", st.after, ok, tokens, st.wantOK, st.wantTokens)
+		}
+	}
+}
+
+func TestRateLimitRepoUsage(t *testing.T) {
+	r := NewRateLimitRepo(testMongo(t), "rate_limits")
+	ctx := context.Background()
+	reset := time.Now().Add(time.Hour)
+
+	if n, err := r.Usage(ctx, "q"); err != nil || n != 0 {
+		t.Fatalf("missing counter: n=%d err=%v", n, err)
+	}
+	for _, tt := range []struct{ add, want int64 }{{3, 3}, {2, 5}, {-1, 4}} {
+		n, err := r.AddUsage(ctx, "q", tt.add, reset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tt.want {
+			t.Errorf("add %d: total %d, want %d", tt.add, n, tt.want)
+		}
+	}
+	if n, _ := r.Usage(ctx, "q"); n != 4 {
+		t.Errorf("usage = %d, want 4", n)
+	}
+}
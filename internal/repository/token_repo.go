@@ -2,20 +2,38 @@ package repository
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// TokenRecord is an emailed single-use token. Only the SHA-256 of the token is
+// stored; the token itself exists only in the link sent to the user.
 type TokenRecord struct {
-	Token     string    `bson:"token"`
-	Email     string    `bson:"email"`
-	Purpose   string    `bson:"purpose"` // e.g. "verify_email"
-	ExpiresAt time.Time `bson:"expires_at"`
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	TokenHash string             `bson:"token_hash"`
+	Email     string             `bson:"email"`
+	Purpose   string             `bson:"purpose"` // e.g. "verify_email", "workspace_invite", "change_email"
+	RequestIP string             `bson:"request_ip,omitempty"`
+	// Optional one-time code sent with a magic link
+	CodeHash string `bson:"code_hash,omitempty"`
+	// Workspace invitations only
+	WorkspaceID string `bson:"workspace_id,omitempty"`
+	Role        string `bson:"role,omitempty"`
+	InvitedBy   string `bson:"invited_by,omitempty"`
+	// Email changes only: the user whose address changes to Email
+	UserID    string    `bson:"user_id,omitempty"`
+	ExpiresAt time.Time `bson:"expires_at"` // TTL index removes the record after this
 	CreatedAt time.Time `bson:"created_at"`
 }
 
+// caseInsensitive compares emails regardless of case
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
 type TokenRepo struct {
 	col *mongo.Collection
 }
@@ -26,20 +44,131 @@ func NewTokenRepo(db *mongo.Database, colName string) *TokenRepo {
 
 func (r *TokenRepo) Create(ctx context.Context, t *TokenRecord) error {
 	t.CreatedAt = time.Now().UTC()
-	_, err := r.col.InsertOne(ctx, t)
-	return err
+	res, err := r.col.InsertOne(ctx, t)
+	if err != nil {
+		return err
+	}
+	t.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindValid returns the unexpired record for a token hash, or mongo.ErrNoDocuments
+func (r *TokenRepo) FindValid(ctx context.Context, hash, purpose string) (*TokenRecord, error) {
+	var rec TokenRecord
+	err := r.col.FindOne(ctx, bson.M{"token_hash": hash, "purpose": purpose, "expires_at": bson.M{"$gt": time.Now().UTC()}}).Decode(&rec)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
 }
 
-func (r *TokenRepo) FindValid(ctx context.Context, token, purpose string) (*TokenRecord, error) {
+// Consume atomically deletes and returns the unexpired record for a token
+// hash, so a link works once even under concurrent clicks
+func (r *TokenRepo) Consume(ctx context.Context, hash, purpose string) (*TokenRecord, error) {
 	var rec TokenRecord
-	err := r.col.FindOne(ctx, bson.M{"token": token, "purpose": purpose, "expires_at": bson.M{"$gt": time.Now().UTC()}}).Decode(&rec)
+	err := r.col.FindOneAndDelete(ctx, bson.M{"token_hash": hash, "purpose": purpose, "expires_at": bson.M{"$gt": time.Now().UTC()}}).Decode(&rec)
 	if err != nil {
 		return nil, err
 	}
 	return &rec, nil
 }
 
-func (r *TokenRepo) Delete(ctx context.Context, token string) error {
-	_, err := r.col.DeleteOne(ctx, bson.M{"token": token})
+// ConsumeByCode atomically deletes and returns the unexpired token of an
+// email (any case) whose code hash matches
+func (r *TokenRepo) ConsumeByCode(ctx context.Context, email, codeHash, purpose string) (*TokenRecord, error) {
+	var rec TokenRecord
+	err := r.col.FindOneAndDelete(ctx,
+		bson.M{"email": email, "purpose": purpose, "code_hash": codeHash, "expires_at": bson.M{"$gt": time.Now().UTC()}},
+		options.FindOneAndDelete().SetCollation(caseInsensitive),
+	).Decode(&rec)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// codeAttemptsID keys the count of codes tried for an email, so concurrent
+// first attempts upsert the same record
+func codeAttemptsID(email, purpose string) string {
+	return "code_attempts:" + purpose + ":" + strings.ToLower(email)
+}
+
+// CountCodeAttempt counts an attempt at one of an email's codes and returns
+// the attempts counted so far, this one included. Callers count before
+// checking the code, so concurrent guesses cannot get ahead of the count. The
+// count is kept apart from the codes, which it outlives: it expires at
+// keepUntil, pushed back on every attempt.
+func (r *TokenRepo) CountCodeAttempt(ctx context.Context, email, purpose string, keepUntil time.Time) (int, error) {
+	pipeline := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"email":      email,
+		"purpose":    "code_attempts:" + purpose,
+		"attempts":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$attempts", 0}}, 1}},
+		"expires_at": keepUntil.UTC(),
+	}}}}
+	var doc struct {
+		Attempts int `bson:"attempts"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := r.col.FindOneAndUpdate(ctx, bson.M{"_id": codeAttemptsID(email, purpose)}, pipeline, opts).Decode(&doc); err != nil {
+		return 0, err
+	}
+	return doc.Attempts, nil
+}
+
+// ResetCodeAttempts forgets the codes tried for an email, e.g. once one worked
+func (r *TokenRepo) ResetCodeAttempts(ctx context.Context, email, purpose string) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": codeAttemptsID(email, purpose)})
+	return err
+}
+
+func (r *TokenRepo) Delete(ctx context.Context, hash string) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"token_hash": hash})
+	return err
+}
+
+// CountByEmailSince counts tokens issued to an email (any case) since a time
+func (r *TokenRepo) CountByEmailSince(ctx context.Context, email, purpose string, since time.Time) (int64, error) {
+	return r.col.CountDocuments(ctx,
+		bson.M{"email": email, "purpose": purpose, "created_at": bson.M{"$gte": since}},
+		options.Count().SetCollation(caseInsensitive),
+	)
+}
+
+// TrimOutstanding deletes all but the newest keep unexpired tokens of an email
+func (r *TokenRepo) TrimOutstanding(ctx context.Context, email, purpose string, keep int) error {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(keep)).
+		SetProjection(bson.M{"_id": 1}).
+		SetCollation(caseInsensitive)
+	cur, err := r.col.Find(ctx, bson.M{"email": email, "purpose": purpose, "expires_at": bson.M{"$gt": time.Now().UTC()}}, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	var stale []TokenRecord
+	if err := cur.All(ctx, &stale); err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	ids := make([]primitive.ObjectID, len(stale))
+	for i, t := range stale {
+		ids[i] = t.ID
+	}
+	_, err = r.col.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// DeleteByEmail removes every token sent to or issued by an email (any case)
+func (r *TokenRepo) DeleteByEmail(ctx context.Context, email string) error {
+	opts := options.Delete().SetCollation(caseInsensitive)
+	if _, err := r.col.DeleteMany(ctx, bson.M{"email": email}, opts); err != nil {
+		return err
+	}
+	_, err := r.col.DeleteMany(ctx, bson.M{"invited_by": email}, opts)
 	return err
 }
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenRepoCodeAttempts(t *testing.T) {
+	r := NewTokenRepo(testMongo(t), "tokens")
+	ctx := context.Background()
+	keep := time.Now().Add(time.Hour)
+
+	for want := 1; want <= 3; want++ {
+		// Any case of the address counts against the same record
+		email := "code@example.com"
+		if want == 2 {
+			email = "Code@Example.com"
+		}
+		n, err := r.CountCodeAttempt(ctx, email, "verify_email", keep)
+		if err != nil || n != want {
+			t.Fatalf("attempt %d: CountCodeAttempt = %d, %v", want, n, err)
+		}
+	}
+	if n, err := r.CountCodeAttempt(ctx, "other@example.com", "verify_email", keep); err != nil || n != 1 {
+		t.Fatalf("another email: CountCodeAttempt = %d, %v, want 1", n, err)
+	}
+
+	if err := r.ResetCodeAttempts(ctx, "code@example.com", "verify_email"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.CountCodeAttempt(ctx, "code@example.com", "verify_email", keep); err != nil || n != 1 {
+		t.Fatalf("after reset: CountCodeAttempt = %d, %v, want 1", n, err)
+	}
+
+	// The count is not a token: sign-in links of the email ignore it
+	if n, err := r.CountByEmailSince(ctx, "code@example.com", "verify_email", time.Time{}); err != nil || n != 0 {
+		t.Fatalf("CountByEmailSince = %d, %v, want 0", n, err)
+	}
+	if err := r.TrimOutstanding(ctx, "code@example.com", "verify_email", 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.CountCodeAttempt(ctx, "code@example.com", "verify_email", keep); err != nil || n != 2 {
+		t.Fatalf("after trimming links: CountCodeAttempt = %d, %v, want 2", n, err)
+	}
+}
+
+func TestTokenRepoConcurrentCodeAttempts(t *testing.T) {
+	r := NewTokenRepo(testMongo(t), "tokens")
+	ctx := context.Background()
+	const attempts = 40
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = map[int]bool{}
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := r.CountCodeAttempt(ctx, "race@example.com", "verify_email", time.Now().Add(time.Hour))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[n] {
+				t.Errorf("two attempts were both counted as attempt %d", n)
+			}
+			seen[n] = true
+		}()
+	}
+	wg.Wait()
+	if len(seen) != attempts {
+		t.Errorf("%d distinct counts for %d attempts", len(seen), attempts)
+	}
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"regexp"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,10 +17,12 @@ type User struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Email      string             `bson:"email" json:"email"`
 	IsVerified bool               `bson:"is_verified" json:"-"`
-	BrandName  string             `bson:"brand_name,omitempty" json:"brand_name,omitempty"`
-	Domain     string             `bson:"domain,omitempty" json:"domain,omitempty"`
-	Country    string             `bson:"country,omitempty" json:"country,omitempty"`
-	Competitor []Competitor       `bson:"competitor,omitempty" json:"competitor,omitempty"`
+	// Brand profile from before workspaces existed; copied into the default
+	// project of the user's personal workspace the first time they sign in.
+	BrandName  string       `bson:"brand_name,omitempty" json:"brand_name,omitempty"`
+	Domain     string       `bson:"domain,omitempty" json:"domain,omitempty"`
+	Country    string       `bson:"country,omitempty" json:"country,omitempty"`
+	Competitor []Competitor `bson:"competitor,omitempty" json:"competitor,omitempty"`
 
 	// OAuth fields
 	Provider    string    `bson:"provider,omitempty" json:"provider,omitempty"`       // "google", "github", etc.
@@ -27,6 +30,38 @@ type User struct {
 	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
 	LastLoginAt time.Time `bson:"last_login_at,omitempty" json:"last_login_at,omitempty"`
+
+	// Two-factor authentication
+	MFAEnabled bool     `bson:"mfa_enabled" json:"mfa_enabled"`
+	MFA        *UserMFA `bson:"mfa,omitempty" json:"-"`
+
+	// Set while the account is scheduled for deletion
+	Deletion *UserDeletion `bson:"deletion,omitempty" json:"deletion,omitempty"`
+
+	// Platform administration
+	SysRole            string     `bson:"sys_role,omitempty" json:"sys_role,omitempty"` // e.g. "operator"; granted by hand
+	DisabledAt         *time.Time `bson:"disabled_at,omitempty" json:"disabled_at,omitempty"`
+	DisabledReason     string     `bson:"disabled_reason,omitempty" json:"disabled_reason,omitempty"`
+	SessionsValidAfter *time.Time `bson:"sessions_valid_after,omitempty" json:"-"` // time of the last revocation
+	SessionGen         int64      `bson:"session_gen,omitempty" json:"-"`          // bumped by each revocation; tokens of older generations are refused
+}
+
+// UserDeletion records a pending account deletion. Until PurgeAfter the user
+// can cancel it; afterwards the account and its personal data are purged.
+type UserDeletion struct {
+	RequestedAt time.Time `bson:"requested_at" json:"requested_at"`
+	PurgeAfter  time.Time `bson:"purge_after" json:"purge_after"`
+}
+
+// UserMFA holds a user's TOTP enrolment. Recovery codes are SHA-256 hashes.
+type UserMFA struct {
+	Secret         string     `bson:"secret,omitempty"`
+	PendingSecret  string     `bson:"pending_secret,omitempty"` // generated, awaiting confirmation
+	RecoveryCodes  []string   `bson:"recovery_codes,omitempty"`
+	LastStep       int64      `bson:"last_step"` // last accepted TOTP time step, blocks replays
+	FailedAttempts int        `bson:"failed_attempts"`
+	LockedUntil    *time.Time `bson:"locked_until,omitempty"`
+	EnabledAt      *time.Time `bson:"enabled_at,omitempty"`
 }
 
 type Competitor struct {
@@ -73,59 +108,6 @@ func (r *UserRepo) CreateUser(ctx context.Context, email string) (*User, error)
 	return user, nil
 }
 
-// AddCompetitor adds a competitor to a user's document
-func (r *UserRepo) AddCompetitor(ctx context.Context, email string, competitor []Competitor) error {
-	filter := bson.M{"email": email}
-	update := bson.M{
-		"$addToSet": bson.M{"competitor": bson.M{"$each": competitor}}, // ✅ avoids duplicates
-		"$set":      bson.M{"updated_at": time.Now().UTC()},
-	}
-
-	_, err := r.col.UpdateOne(ctx, filter, update)
-	return err
-}
-
-// GetCompetitor returns a paginated list of competitors for a user
-func (r *UserRepo) GetCompetitor(ctx context.Context, email string, page, limit int) ([]Competitor, int, error) {
-	filter := bson.M{"email": email}
-	var user User
-
-	err := r.col.FindOne(ctx, filter).Decode(&user)
-	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return []Competitor{}, 0, nil
-		}
-		return nil, 0, err
-	}
-
-	total := len(user.Competitor)
-	start := (page - 1) * limit
-	if start >= total {
-		return []Competitor{}, total, nil
-	}
-
-	end := start + limit
-	if end > total {
-		end = total
-	}
-
-	return user.Competitor[start:end], total, nil
-}
-
-func (r *UserRepo) UpdateProfile(ctx context.Context, email string, profile *User) error {
-
-	filter := bson.M{"email": email}
-	update := bson.M{
-		"$set": bson.M{
-			"brand_name": profile.BrandName,
-			"domain":     profile.Domain,
-			"country":    profile.Country,
-			"updatedAt":  time.Now(),
-		},
-	}
-	_, err := r.col.UpdateOne(ctx, filter, update)
-	return err
-}
 func (r *UserRepo) UpsertOAuthUser(ctx context.Context, email, provider, providerID string) (*User, error) {
 	now := time.Now().UTC()
 
@@ -160,3 +142,266 @@ func (r *UserRepo) UpsertOAuthUser(ctx context.Context, email, provider, provide
 
 	return &user, nil
 }
+
+// SetPendingMFASecret stores a TOTP secret that becomes active once confirmed
+func (r *UserRepo) SetPendingMFASecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"mfa.pending_secret": secret, "updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// EnableMFA promotes the pending secret and stores the hashed recovery codes
+func (r *UserRepo) EnableMFA(ctx context.Context, id primitive.ObjectID, secret string, step int64, recoveryHashes []string) error {
+	now := time.Now().UTC()
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"mfa_enabled": true,
+			"mfa": UserMFA{
+				Secret:        secret,
+				RecoveryCodes: recoveryHashes,
+				LastStep:      step,
+				EnabledAt:     &now,
+			},
+			"updated_at": now,
+		},
+	})
+	return err
+}
+
+// DisableMFA removes the user's TOTP enrolment
+func (r *UserRepo) DisableMFA(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":   bson.M{"mfa_enabled": false, "updated_at": time.Now().UTC()},
+		"$unset": bson.M{"mfa": ""},
+	})
+	return err
+}
+
+// ReplaceRecoveryCodes swaps the stored recovery code hashes
+func (r *UserRepo) ReplaceRecoveryCodes(ctx context.Context, id primitive.ObjectID, recoveryHashes []string) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"mfa.recovery_codes": recoveryHashes, "updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// mfaUnlocked is an $or filter matching users whose MFA is not locked out at now
+func mfaUnlocked(now time.Time) bson.A {
+	return bson.A{
+		bson.M{"mfa.locked_until": bson.M{"$exists": false}},
+		bson.M{"mfa.locked_until": bson.M{"$lte": now}},
+	}
+}
+
+// AcceptMFAStep records step as used. It reports false when the same or a
+// later step was already accepted, i.e. the code is a replay, or when MFA is
+// locked out at now.
+func (r *UserRepo) AcceptMFAStep(ctx context.Context, id primitive.ObjectID, step int64, now time.Time) (bool, error) {
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"_id": id, "mfa.last_step": bson.M{"$lt": step}, "$or": mfaUnlocked(now)},
+		bson.M{"$set": bson.M{"mfa.last_step": step, "mfa.failed_attempts": 0}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// ConsumeRecoveryCode removes a recovery code hash, reporting whether it was
+// present and MFA is not locked out at now
+func (r *UserRepo) ConsumeRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string, now time.Time) (bool, error) {
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"_id": id, "mfa.recovery_codes": hash, "$or": mfaUnlocked(now)},
+		bson.M{
+			"$pull": bson.M{"mfa.recovery_codes": hash},
+			"$set":  bson.M{"mfa.failed_attempts": 0},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// RecordMFAFailure counts a failed code and, in the same update, locks MFA
+// until lockUntil once maxAttempts is reached, starting a new count
+func (r *UserRepo) RecordMFAFailure(ctx context.Context, id primitive.ObjectID, maxAttempts int, lockUntil time.Time) error {
+	failed := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$mfa.failed_attempts", 0}}, 1}}
+	reached := bson.M{"$gte": bson.A{failed, maxAttempts}}
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, []bson.M{{"$set": bson.M{
+		"mfa.failed_attempts": bson.M{"$cond": bson.A{reached, 0, failed}},
+		// a missing locked_until stays missing until the lock is reached
+		"mfa.locked_until": bson.M{"$cond": bson.A{reached, lockUntil, "$mfa.locked_until"}},
+	}}})
+	return err
+}
+
+// FindByID returns a user by hex ID, or nil if it does not exist
+func (r *UserRepo) FindByID(ctx context.Context, id string) (*User, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	var u User
+	err = r.col.FindOne(ctx, bson.M{"_id": oid}).Decode(&u)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ScheduleDeletion marks the user for deletion. An existing schedule is kept.
+func (r *UserRepo) ScheduleDeletion(ctx context.Context, id primitive.ObjectID, d UserDeletion) (*UserDeletion, error) {
+	var u User
+	err := r.col.FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		[]bson.M{{"$set": bson.M{"deletion": bson.M{"$ifNull": bson.A{"$deletion", d}}}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&u)
+	if err != nil {
+		return nil, err
+	}
+	return u.Deletion, nil
+}
+
+// CancelDeletion clears a pending deletion, reporting whether one was pending
+func (r *UserRepo) CancelDeletion(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"_id": id, "deletion": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"deletion": ""}, "$set": bson.M{"updated_at": time.Now().UTC()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// ListDueForPurge returns users whose deletion grace period ended before now
+func (r *UserRepo) ListDueForPurge(ctx context.Context, now time.Time, limit int64) ([]User, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "deletion.purge_after", Value: 1}}).SetLimit(limit)
+	cur, err := r.col.Find(ctx, bson.M{"deletion.purge_after": bson.M{"$lte": now}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	users := []User{}
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Delete removes the user document
+func (r *UserRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// Search returns users whose email contains q (any case), newest first, and
+// the total number of matches
+func (r *UserRepo) Search(ctx context.Context, q string, limit, offset int64) ([]User, int64, error) {
+	filter := bson.M{}
+	if q != "" {
+		filter["email"] = primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+	}
+
+	total, err := r.col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetSkip(offset).SetLimit(limit)
+	cur, err := r.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+
+	users := []User{}
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// UpdateEmail changes the user's email. The unique index on email makes it
+// fail with a duplicate key error if the address is taken.
+func (r *UserRepo) UpdateEmail(ctx context.Context, id primitive.ObjectID, email string) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"email": email, "is_verified": true, "updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// SetVerified marks the user's email as verified
+func (r *UserRepo) SetVerified(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"is_verified": true, "updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// SetDisabled disables the account with a reason, or re-enables it when at is nil
+func (r *UserRepo) SetDisabled(ctx context.Context, id primitive.ObjectID, at *time.Time, reason string) error {
+	update := bson.M{
+		"$set": bson.M{"disabled_at": at, "disabled_reason": reason, "updated_at": time.Now().UTC()},
+	}
+	if at == nil {
+		update = bson.M{
+			"$set":   bson.M{"updated_at": time.Now().UTC()},
+			"$unset": bson.M{"disabled_at": "", "disabled_reason": ""},
+		}
+	}
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// RevokeSessions makes every token issued to the user so far invalid by
+// moving them to a new session generation. at records when.
+func (r *UserRepo) RevokeSessions(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"sessions_valid_after": at, "updated_at": time.Now().UTC()},
+		"$inc": bson.M{"session_gen": 1},
+	})
+	return err
+}
+
+// UserStats counts users by state
+type UserStats struct {
+	Total           int64 `json:"total"`
+	Verified        int64 `json:"verified"`
+	MFAEnabled      int64 `json:"mfa_enabled"`
+	Disabled        int64 `json:"disabled"`
+	PendingDeletion int64 `json:"pending_deletion"`
+	NewSince        int64 `json:"new_since"` // created at or after the given time
+}
+
+// Stats counts users, with NewSince counting those created since since
+func (r *UserRepo) Stats(ctx context.Context, since time.Time) (*UserStats, error) {
+	var s UserStats
+	counts := []struct {
+		dst    *int64
+		filter bson.M
+	}{
+		{&s.Total, bson.M{}},
+		{&s.Verified, bson.M{"is_verified": true}},
+		{&s.MFAEnabled, bson.M{"mfa_enabled": true}},
+		{&s.Disabled, bson.M{"disabled_at": bson.M{"$exists": true}}},
+		{&s.PendingDeletion, bson.M{"deletion": bson.M{"$exists": true}}},
+		{&s.NewSince, bson.M{"created_at": bson.M{"$gte": since}}},
+	}
+	for _, c := range counts {
+		n, err := r.col.CountDocuments(ctx, c.filter)
+		if err != nil {
+			return nil, err
+		}
+		*c.dst = n
+	}
+	return &s, nil
+}
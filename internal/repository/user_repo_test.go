@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUserRepoMFALockout(t *testing.T) {
+	r := NewUserRepo(testMongo(t), "users")
+	ctx := context.Background()
+	user, err := r.CreateUser(ctx, "mfa@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.EnableMFA(ctx, user.ID, "secret", 10, []string{"hash"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	lockUntil := now.Add(15 * time.Minute)
+	const maxAttempts = 3
+
+	for i := 0; i < maxAttempts-1; i++ {
+		if err := r.RecordMFAFailure(ctx, user.ID, maxAttempts, lockUntil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := r.FindByID(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MFA.FailedAttempts != maxAttempts-1 || got.MFA.LockedUntil != nil {
+		t.Fatalf("after %d failures: attempts %d, locked until %v", maxAttempts-1, got.MFA.FailedAttempts, got.MFA.LockedUntil)
+	}
+
+	if err := r.RecordMFAFailure(ctx, user.ID, maxAttempts, lockUntil); err != nil {
+		t.Fatal(err)
+	}
+	got, err = r.FindByID(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MFA.FailedAttempts != 0 || got.MFA.LockedUntil == nil || !got.MFA.LockedUntil.Equal(lockUntil.Truncate(time.Millisecond)) {
+		t.Fatalf("after %d failures: attempts %d, locked until %v", maxAttempts, got.MFA.FailedAttempts, got.MFA.LockedUntil)
+	}
+
+	// A valid code or recovery code is refused while locked, even though the
+	// caller checked the lock against an older copy of the user
+	if ok, err := r.AcceptMFAStep(ctx, user.ID, 11, now); err != nil || ok {
+		t.Fatalf("AcceptMFAStep while locked = %v, %v", ok, err)
+	}
+	if ok, err := r.ConsumeRecoveryCode(ctx, user.ID, "hash", now); err != nil || ok {
+		t.Fatalf("ConsumeRecoveryCode while locked = %v, %v", ok, err)
+	}
+
+	later := lockUntil.Add(time.Second)
+	if ok, err := r.AcceptMFAStep(ctx, user.ID, 11, later); err != nil || !ok {
+		t.Fatalf("AcceptMFAStep after the lock = %v, %v", ok, err)
+	}
+	// A used step, or an earlier one, is a replay
+	for _, step := range []int64{11, 10} {
+		if ok, err := r.AcceptMFAStep(ctx, user.ID, step, later); err != nil || ok {
+			t.Fatalf("AcceptMFAStep replaying step %d = %v, %v", step, ok, err)
+		}
+	}
+	if ok, err := r.ConsumeRecoveryCode(ctx, user.ID, "hash", later); err != nil || !ok {
+		t.Fatalf("ConsumeRecoveryCode after the lock = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Workspace is the organisation that owns projects. Users reach it through a Membership.
+type Workspace struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name    string             `bson:"name" json:"name"`
+	OwnerID primitive.ObjectID `bson:"owner_id" json:"owner_id"`
+	// Brand profile from before projects existed; seeds the workspace's
+	// default project and is not updated afterwards.
+	BrandName  string       `bson:"brand_name,omitempty" json:"-"`
+	Domain     string       `bson:"domain,omitempty" json:"-"`
+	Country    string       `bson:"country,omitempty" json:"-"`
+	Competitor []Competitor `bson:"competitor,omitempty" json:"-"`
+	// RequireMFA makes every member complete TOTP before getting an access token
+	RequireMFA bool `bson:"require_mfa" json:"require_mfa"`
+	// Plan sets the workspace's quotas (see config.Plan*); empty is the free plan
+	Plan string `bson:"plan,omitempty" json:"plan,omitempty"`
+	// LLMBudgetUSD overrides the default monthly LLM budget; 0 means none
+	LLMBudgetUSD *float64  `bson:"llm_budget_usd,omitempty" json:"llm_budget_usd,omitempty"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type WorkspaceRepo struct {
+	col *mongo.Collection
+}
+
+func NewWorkspaceRepo(db *mongo.Database, colName string) *WorkspaceRepo {
+	return &WorkspaceRepo{col: db.Collection(colName)}
+}
+
+// Create inserts a new workspace and sets its ID
+func (r *WorkspaceRepo) Create(ctx context.Context, ws *Workspace) error {
+	now := time.Now().UTC()
+	ws.CreatedAt = now
+	ws.UpdatedAt = now
+
+	res, err := r.col.InsertOne(ctx, ws)
+	if err != nil {
+		return err
+	}
+	ws.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindByID returns a workspace by its hex ID, or nil if it does not exist
+func (r *WorkspaceRepo) FindByID(ctx context.Context, id string) (*Workspace, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	var ws Workspace
+	err = r.col.FindOne(ctx, bson.M{"_id": oid}).Decode(&ws)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ws, nil
+}
+
+// FindByIDs returns all workspaces whose IDs are in the given list
+func (r *WorkspaceRepo) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Workspace, error) {
+	if len(ids) == 0 {
+		return []Workspace{}, nil
+	}
+
+	cur, err := r.col.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	workspaces := []Workspace{}
+	if err := cur.All(ctx, &workspaces); err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// IDs returns the ID of every workspace
+func (r *WorkspaceRepo) IDs(ctx context.Context) ([]primitive.ObjectID, error) {
+	vals, err := r.col.Distinct(ctx, "_id", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	return objectIDs(vals), nil
+}
+
+// objectIDs keeps the ObjectIDs among values returned by Distinct
+func objectIDs(vals []any) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(vals))
+	for _, v := range vals {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// SetRequireMFA turns the workspace's MFA requirement on or off
+func (r *WorkspaceRepo) SetRequireMFA(ctx context.Context, id primitive.ObjectID, require bool) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"require_mfa": require, "updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// SetPlan moves the workspace to another plan
+func (r *WorkspaceRepo) SetPlan(ctx context.Context, id primitive.ObjectID, plan string) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"plan": plan, "updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// SetLLMBudget sets the workspace's monthly LLM budget, or clears it back to
+// the default when budget is nil
+func (r *WorkspaceRepo) SetLLMBudget(ctx context.Context, id primitive.ObjectID, budget *float64) error {
+	update := bson.M{"$set": bson.M{"llm_budget_usd": budget, "updated_at": time.Now().UTC()}}
+	if budget == nil {
+		update = bson.M{"$unset": bson.M{"llm_budget_usd": ""}, "$set": bson.M{"updated_at": time.Now().UTC()}}
+	}
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// SetOwner records a new owning user, e.g. when the previous owner is deleted
+func (r *WorkspaceRepo) SetOwner(ctx context.Context, id, ownerID primitive.ObjectID) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"owner_id": ownerID, "updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// Count returns the number of workspaces, and how many were created since since
+func (r *WorkspaceRepo) Count(ctx context.Context, since time.Time) (total, created int64, err error) {
+	if total, err = r.col.CountDocuments(ctx, bson.M{}); err != nil {
+		return 0, 0, err
+	}
+	created, err = r.col.CountDocuments(ctx, bson.M{"created_at": bson.M{"$gte": since}})
+	return total, created, err
+}
+
+// Delete removes a workspace document
+func (r *WorkspaceRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
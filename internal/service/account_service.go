@@ -0,0 +1,592 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/mailer"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrUserNotFound      = apperr.New(apperr.NotFound, "user_not_found", "user not found")
+	ErrNoDeletionPending = apperr.New(apperr.Conflict, "no_deletion_pending", "account is not scheduled for deletion")
+	ErrEmailTaken        = apperr.New(apperr.Conflict, "email_taken", "that email address belongs to another account")
+	ErrEmailUnchanged    = apperr.New(apperr.Conflict, "email_unchanged", "that is already your email address")
+)
+
+// deletedUserEmail replaces a purged user's email on data that stays with a
+// shared workspace
+const deletedUserEmail = "deleted-user"
+
+const (
+	purgeInterval  = time.Hour
+	purgeBatchSize = 50
+	emailChangeTTL = 24 * time.Hour
+)
+
+// AccountService handles a user's own account: email changes, data export and
+// the two-phase deletion. DELETE /v1/me schedules the deletion and revokes the
+// user's API keys; once the grace period ends, Run purges the account from
+// Mongo and Postgres.
+type AccountService struct {
+	users      *repository.UserRepo
+	workspaces *repository.WorkspaceRepo
+	members    *repository.MemberRepo
+	projects   *repository.ProjectRepo
+	keys       *repository.APIKeyRepo
+	tokens     *repository.TokenRepo
+	outbox     *repository.EmailOutboxRepo
+	prompts    *repository.PromptRepo
+	mail       mailer.Mailer
+	tpl        *mailer.Templates
+	sessions   *SessionService
+	audit      *AuditService
+	cfg        *config.Config
+}
+
+func NewAccountService(
+	u *repository.UserRepo,
+	w *repository.WorkspaceRepo,
+	m *repository.MemberRepo,
+	proj *repository.ProjectRepo,
+	k *repository.APIKeyRepo,
+	t *repository.TokenRepo,
+	o *repository.EmailOutboxRepo,
+	p *repository.PromptRepo,
+	mail mailer.Mailer,
+	tpl *mailer.Templates,
+	sessions *SessionService,
+	audit *AuditService,
+	cfg *config.Config,
+) *AccountService {
+	return &AccountService{users: u, workspaces: w, members: m, projects: proj, keys: k, tokens: t, outbox: o, prompts: p,
+		mail: mail, tpl: tpl, sessions: sessions, audit: audit, cfg: cfg}
+}
+
+func (s *AccountService) user(ctx context.Context, userID string) (*repository.User, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// RequestDeletion schedules the user's account for purging after the grace
+// period. It refuses while the user is the only owner of a workspace that has
+// other members, so shared workspaces are never left without an owner.
+func (s *AccountService) RequestDeletion(ctx context.Context, userID string) (*repository.UserDeletion, error) {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.members.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	for _, m := range memberships {
+		if m.Role != repository.RoleOwner {
+			continue
+		}
+		members, err := s.members.ListByWorkspace(ctx, m.WorkspaceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list members: %w", err)
+		}
+		if len(members) > 1 && countRole(members, repository.RoleOwner) == 1 {
+			return nil, fmt.Errorf("%w: transfer ownership of workspace %s first", ErrLastOwner, m.WorkspaceID.Hex())
+		}
+	}
+
+	now := time.Now().UTC()
+	deletion, err := s.users.ScheduleDeletion(ctx, user.ID, repository.UserDeletion{
+		RequestedAt: now,
+		PurgeAfter:  now.Add(time.Duration(s.cfg.AccountDeletionGraceDays) * 24 * time.Hour),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to schedule deletion: %w", err)
+	}
+
+	// Keys acting as the user stop working now; restoring does not bring them back
+	if err := s.keys.RevokeUserKeys(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("failed to revoke api keys: %w", err)
+	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		Action:     AuditDeletionRequested,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Before:     map[string]any{"deletion": user.Deletion},
+		After:      map[string]any{"deletion": deletion},
+	})
+	return deletion, nil
+}
+
+// CancelDeletion restores an account during its grace period
+func (s *AccountService) CancelDeletion(ctx context.Context, userID string) error {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return err
+	}
+	cancelled, err := s.users.CancelDeletion(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel deletion: %w", err)
+	}
+	if !cancelled {
+		return ErrNoDeletionPending
+	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		Action:     AuditDeletionCancelled,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Before:     map[string]any{"deletion": user.Deletion},
+	})
+	return nil
+}
+
+// RequestEmailChange emails a confirmation link to the new address. Nothing
+// changes until the link is used, so a typo cannot lock the user out.
+func (s *AccountService) RequestEmailChange(ctx context.Context, userID, newEmail, acceptLanguage string) error {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return err
+	}
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrEmailUnchanged
+	}
+	if other, err := s.users.FindByEmail(ctx, newEmail); err != nil {
+		return fmt.Errorf("failed to check email: %w", err)
+	} else if other != nil {
+		return ErrEmailTaken
+	}
+
+	sent, err := s.tokens.CountByEmailSince(ctx, newEmail, "change_email", time.Now().UTC().Add(-time.Hour))
+	if err != nil {
+		return fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if sent >= int64(s.cfg.MagicLinkPerEmailHour) {
+		return ErrTooManyRequests
+	}
+
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		return err
+	}
+	if err := s.tokens.Create(ctx, &repository.TokenRecord{
+		TokenHash: hash,
+		Email:     newEmail,
+		UserID:    user.ID.Hex(),
+		Purpose:   "change_email",
+		ExpiresAt: time.Now().UTC().Add(emailChangeTTL),
+	}); err != nil {
+		return fmt.Errorf("failed to save email change: %w", err)
+	}
+
+	locale := mailer.ResolveLocale(acceptLanguage, user.Country, s.tpl.Names()[mailer.TemplateChangeEmail])
+	msg, err := s.tpl.Render(mailer.TemplateChangeEmail, locale, newEmail, map[string]any{
+		"OldEmail":   user.Email,
+		"ConfirmURL": fmt.Sprintf("%s/email/confirm?token=%s", s.cfg.FrontendURL, token),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render email change email: %w", err)
+	}
+	msg.IdempotencyKey = "change_email:" + hash
+	if err := s.mail.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send email change email: %w", err)
+	}
+
+	s.audit.Record(ctx, repository.AuditEvent{
+		Action:     AuditEmailChangeRequest,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Metadata:   map[string]any{"new_email": newEmail},
+	})
+	return nil
+}
+
+// ConfirmEmailChange consumes an email change token and moves the user to the
+// new address. Only the user document changes: analysis rows are keyed by
+// user ID. Existing sessions are revoked since their tokens carry the old email.
+func (s *AccountService) ConfirmEmailChange(ctx context.Context, token string) error {
+	rec, err := s.tokens.Consume(ctx, auth.HashToken(token), "change_email")
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrInvalidOrExpiredLink
+		}
+		return err
+	}
+	user, err := s.user(ctx, rec.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.users.UpdateEmail(ctx, user.ID, rec.Email); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	if err := s.users.RevokeSessions(ctx, user.ID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	s.sessions.Forget(user.ID.Hex())
+
+	s.audit.Record(ctx, repository.AuditEvent{
+		ActorID:    user.ID.Hex(),
+		ActorEmail: rec.Email,
+		Action:     AuditEmailChanged,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Before:     map[string]any{"email": user.Email},
+		After:      map[string]any{"email": rec.Email},
+	})
+	return nil
+}
+
+// BackfillUserIDs sets the user ID on analysis rows written when rows were
+// keyed by email. Emails without a user are left alone and reported.
+func (s *AccountService) BackfillUserIDs(ctx context.Context) error {
+	emails, err := s.prompts.LegacyUserEmails(ctx)
+	if err != nil {
+		return err
+	}
+	orphaned := 0
+	for _, email := range emails {
+		user, err := s.users.FindByEmail(ctx, email)
+		if err != nil {
+			return fmt.Errorf("failed to fetch user: %w", err)
+		}
+		if user == nil {
+			orphaned++
+			continue
+		}
+		if err := s.prompts.BackfillUserID(ctx, email, user.ID.Hex()); err != nil {
+			return err
+		}
+	}
+	if len(emails) > 0 {
+		pkg.Logger(ctx).Info("backfilled prompt user IDs", "emails", len(emails)-orphaned, "orphaned", orphaned)
+	}
+	return nil
+}
+
+// Run purges accounts whose grace period has ended until ctx is cancelled
+func (s *AccountService) Run(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		s.purgeDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *AccountService) purgeDue(ctx context.Context) {
+	users, err := s.users.ListDueForPurge(ctx, time.Now().UTC(), purgeBatchSize)
+	if err != nil {
+		pkg.Logger(ctx).Error("account purge listing failed", "err", err)
+		return
+	}
+	for i := range users {
+		if ctx.Err() != nil {
+			return // shutting down; the rest wait for the next run
+		}
+		if err := s.purge(ctx, &users[i]); err != nil {
+			// the user document is deleted last, so the next run retries
+			pkg.Logger(ctx).Error("account purge failed", "user_id", users[i].ID.Hex(), "err", err)
+			continue
+		}
+		pkg.Logger(ctx).Info("account purged", "user_id", users[i].ID.Hex())
+	}
+}
+
+// purge deletes the user's personal data. Workspaces the user was alone in
+// are deleted with all their data; in shared workspaces the user's rows stay
+// with the team under deletedUserEmail.
+func (s *AccountService) purge(ctx context.Context, user *repository.User) error {
+	memberships, err := s.members.ListByUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("list memberships: %w", err)
+	}
+
+	for _, m := range memberships {
+		members, err := s.members.ListByWorkspace(ctx, m.WorkspaceID)
+		if err != nil {
+			return fmt.Errorf("list members: %w", err)
+		}
+		if len(members) <= 1 {
+			if err := s.deleteWorkspace(ctx, m.WorkspaceID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.handOver(ctx, user, m, members); err != nil {
+			return err
+		}
+		if err := s.members.Remove(ctx, m.WorkspaceID, user.ID); err != nil {
+			return fmt.Errorf("remove membership: %w", err)
+		}
+	}
+
+	if err := s.prompts.AnonymiseUser(ctx, user.ID.Hex(), deletedUserEmail); err != nil {
+		return err
+	}
+	if err := s.keys.DeleteByUser(ctx, user.ID, deletedUserEmail); err != nil {
+		return fmt.Errorf("delete api keys: %w", err)
+	}
+	if err := s.tokens.DeleteByEmail(ctx, user.Email); err != nil {
+		return fmt.Errorf("delete tokens: %w", err)
+	}
+	if err := s.outbox.DeleteByRecipient(ctx, user.Email); err != nil {
+		return fmt.Errorf("delete queued email: %w", err)
+	}
+	if err := s.users.Delete(ctx, user.ID); err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	return nil
+}
+
+// handOver keeps a shared workspace owned when its last owner is purged,
+// promoting the longest-standing admin, or failing that the oldest member.
+// Deletion requests check for this, but roles may change during the grace period.
+func (s *AccountService) handOver(ctx context.Context, user *repository.User, m repository.Membership, members []repository.Membership) error {
+	if m.Role != repository.RoleOwner || countRole(members, repository.RoleOwner) > 1 {
+		return nil
+	}
+
+	var heir *repository.Membership
+	for i := range members {
+		if members[i].UserID == user.ID {
+			continue
+		}
+		if heir == nil || repository.RoleRank(members[i].Role) > repository.RoleRank(heir.Role) {
+			heir = &members[i]
+		}
+	}
+	if err := s.members.UpdateRole(ctx, m.WorkspaceID, heir.UserID, repository.RoleOwner); err != nil {
+		return fmt.Errorf("promote new owner: %w", err)
+	}
+	if err := s.workspaces.SetOwner(ctx, m.WorkspaceID, heir.UserID); err != nil {
+		return fmt.Errorf("set workspace owner: %w", err)
+	}
+	pkg.Logger(ctx).Info("workspace ownership transferred", "workspace_id", m.WorkspaceID.Hex(), "owner_id", heir.UserID.Hex())
+	return nil
+}
+
+func (s *AccountService) deleteWorkspace(ctx context.Context, id primitive.ObjectID) error {
+	if err := s.prompts.DeleteWorkspaceData(ctx, id.Hex()); err != nil {
+		return err
+	}
+	if err := s.projects.DeleteByWorkspace(ctx, id); err != nil {
+		return fmt.Errorf("delete projects: %w", err)
+	}
+	if err := s.keys.DeleteByWorkspace(ctx, id); err != nil {
+		return fmt.Errorf("delete workspace api keys: %w", err)
+	}
+	if err := s.members.DeleteByWorkspace(ctx, id); err != nil {
+		return fmt.Errorf("delete memberships: %w", err)
+	}
+	if err := s.workspaces.Delete(ctx, id); err != nil {
+		return fmt.Errorf("delete workspace: %w", err)
+	}
+	return nil
+}
+
+func countRole(members []repository.Membership, role string) int {
+	n := 0
+	for _, m := range members {
+		if m.Role == role {
+			n++
+		}
+	}
+	return n
+}
+
+// exportWorkspace is a workspace in a data export, with its projects and the
+// user's role in it
+type exportWorkspace struct {
+	repository.Workspace
+	Role     string               `json:"role"`
+	Projects []repository.Project `json:"projects"`
+}
+
+// Export writes a ZIP of the user's data: profile and workspaces as JSON,
+// competitors, prompts, responses and analyses as CSV. Analysis rows are the
+// ones the user ran.
+func (s *AccountService) Export(ctx context.Context, userID string, w io.Writer) error {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	memberships, err := s.members.ListByUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list memberships: %w", err)
+	}
+	workspaces := make([]exportWorkspace, 0, len(memberships))
+	for _, m := range memberships {
+		ws, err := s.workspaces.FindByID(ctx, m.WorkspaceID.Hex())
+		if err != nil {
+			return fmt.Errorf("failed to fetch workspace: %w", err)
+		}
+		if ws == nil {
+			continue
+		}
+		projects, err := s.projects.ListByWorkspace(ctx, ws.ID)
+		if err != nil {
+			return fmt.Errorf("failed to list projects: %w", err)
+		}
+		workspaces = append(workspaces, exportWorkspace{Workspace: *ws, Role: m.Role, Projects: projects})
+	}
+
+	zw := zip.NewWriter(w)
+
+	if err := writeZipJSON(zw, "profile.json", user); err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "workspaces.json", workspaces); err != nil {
+		return err
+	}
+
+	competitors, err := newZipCSV(zw, "competitors.csv", "workspace_id", "project_id", "display_name", "tracked_name", "domain", "country")
+	if err != nil {
+		return err
+	}
+	for _, ws := range workspaces {
+		for _, p := range ws.Projects {
+			for _, c := range p.Competitor {
+				competitors.Write([]string{ws.ID.Hex(), p.ID.Hex(), c.DisplayName, c.TrackedName, c.Domain, c.Country})
+			}
+		}
+	}
+	if err := competitors.done(); err != nil {
+		return err
+	}
+
+	prompts, err := newZipCSV(zw, "prompts.csv", "id", "workspace_id", "project_id", "prompt", "response", "country", "added")
+	if err != nil {
+		return err
+	}
+	err = s.prompts.EachPromptResponseByUser(ctx, user.ID.Hex(), func(e repository.PromptResponseEntry) error {
+		return prompts.Write([]string{strconv.Itoa(e.ID), e.WorkspaceID, e.ProjectID, e.Prompt, e.Response, e.Country, formatExportTime(e.Added)})
+	})
+	if err != nil {
+		return err
+	}
+	if err := prompts.done(); err != nil {
+		return err
+	}
+
+	meta, err := newZipCSV(zw, "prompt_meta.csv", "id", "prompt_id", "workspace_id", "project_id", "prompt", "mentions", "volume", "tags", "location", "added")
+	if err != nil {
+		return err
+	}
+	err = s.prompts.EachPromptMetaByUser(ctx, user.ID.Hex(), func(m repository.PromptMeta) error {
+		mentions, _ := json.Marshal(m.Mentions)
+		return meta.Write([]string{strconv.Itoa(m.ID), strconv.Itoa(m.PromptID), m.WorkspaceID, m.ProjectID, m.Prompt,
+			string(mentions), strconv.Itoa(m.Volume), strings.Join(m.Tags, ";"), m.Location, formatExportTime(m.Added)})
+	})
+	if err != nil {
+		return err
+	}
+	if err := meta.done(); err != nil {
+		return err
+	}
+
+	brands, err := newZipCSV(zw, "brand_analysis.csv", "id", "prompt_id", "workspace_id", "project_id", "brand_name", "visibility", "sentiment", "position", "added")
+	if err != nil {
+		return err
+	}
+	err = s.prompts.EachBrandAnalysisByUser(ctx, user.ID.Hex(), func(a repository.BrandAnalysis) error {
+		return brands.Write([]string{strconv.Itoa(a.ID), strconv.Itoa(a.PromptID), a.WorkspaceID, a.ProjectID, a.BrandName,
+			strconv.FormatFloat(a.Visibility, 'f', -1, 64), strconv.Itoa(a.Sentiment), strconv.Itoa(a.Position), formatExportTime(a.Added)})
+	})
+	if err != nil {
+		return err
+	}
+	if err := brands.done(); err != nil {
+		return err
+	}
+
+	domains, err := newZipCSV(zw, "domain_analysis.csv", "id", "prompt_id", "domain", "used", "avg_citations", "type", "added")
+	if err != nil {
+		return err
+	}
+	err = s.prompts.EachDomainAnalysisByUser(ctx, user.ID.Hex(), func(a repository.DomainAnalysis) error {
+		return domains.Write([]string{strconv.Itoa(a.ID), strconv.Itoa(a.PromptID), a.Domain, strconv.Itoa(a.Used),
+			strconv.FormatFloat(a.AvgCitations, 'f', -1, 64), a.Type, formatExportTime(a.Added)})
+	})
+	if err != nil {
+		return err
+	}
+	if err := domains.done(); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func writeZipJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// zipCSV is a CSV file inside an export ZIP
+type zipCSV struct {
+	*csv.Writer
+	name string
+}
+
+func newZipCSV(zw *zip.Writer, name string, header ...string) (*zipCSV, error) {
+	f, err := zw.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	c := &zipCSV{Writer: csv.NewWriter(f), name: name}
+	if err := c.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return c, nil
+}
+
+func (c *zipCSV) done() error {
+	c.Flush()
+	if err := c.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", c.name, err)
+	}
+	return nil
+}
+
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
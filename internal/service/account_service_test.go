@@ -0,0 +1,476 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/mailer"
+	"auth-microservice/internal/mongotest"
+	"auth-microservice/internal/pgtest"
+	"auth-microservice/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// accountFixture is an account service over a scratch database. Prompt data
+// lives in Postgres and is only wired up for the tests that need it.
+type accountFixture struct {
+	svc        *AccountService
+	users      *repository.UserRepo
+	workspaces *repository.WorkspaceRepo
+	members    *repository.MemberRepo
+	projects   *repository.ProjectRepo
+	keys       *repository.APIKeyRepo
+	prompts    *repository.PromptRepo
+	mail       *sentMail
+}
+
+func newAccountFixture(t *testing.T, pg *pgxpool.Pool) *accountFixture {
+	t.Helper()
+	db := mongotest.Database(t)
+	cfg := &config.Config{UserCol: "users", TokenCol: "tokens", MemberCol: "members", ProjectCol: "projects",
+		APIKeyCol: "api_keys", EmailOutboxCol: "email_outbox", AuditCol: "audit", RateLimitCol: "rate_limits",
+		AccountDeletionGraceDays: 30, MagicLinkPerEmailHour: 2, FrontendURL: "https://app.example.com"}
+	if err := config.EnsureIndexes(context.Background(), db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := mailer.NewTemplates(mailer.Brand{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &accountFixture{
+		users:      repository.NewUserRepo(db, "users"),
+		workspaces: repository.NewWorkspaceRepo(db, "workspaces"),
+		members:    repository.NewMemberRepo(db, "members"),
+		projects:   repository.NewProjectRepo(db, "projects"),
+		keys:       repository.NewAPIKeyRepo(db, "api_keys"),
+		prompts:    repository.NewPromptRepo(pg),
+		mail:       &sentMail{},
+	}
+	f.svc = NewAccountService(f.users, f.workspaces, f.members, f.projects, f.keys,
+		repository.NewTokenRepo(db, "tokens"), repository.NewEmailOutboxRepo(db, "email_outbox"), f.prompts,
+		f.mail, tpl, NewSessionService(f.users, f.members, f.workspaces),
+		NewAuditService(repository.NewAuditRepo(db, "audit")), cfg)
+	return f
+}
+
+func (f *accountFixture) user(t *testing.T, email string) *repository.User {
+	t.Helper()
+	u, err := f.users.CreateUser(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// workspace creates a workspace with the given members, the first as its owner
+func (f *accountFixture) workspace(t *testing.T, name string, members map[*repository.User]string) *repository.Workspace {
+	t.Helper()
+	ctx := context.Background()
+	ws := &repository.Workspace{Name: name}
+	for u, role := range members {
+		if role == repository.RoleOwner {
+			ws.OwnerID = u.ID
+		}
+	}
+	if err := f.workspaces.Create(ctx, ws); err != nil {
+		t.Fatal(err)
+	}
+	for u, role := range members {
+		if err := f.members.Add(ctx, &repository.Membership{WorkspaceID: ws.ID, UserID: u.ID, Email: u.Email, Role: role}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ws
+}
+
+func TestAccountDeletionGracePeriod(t *testing.T) {
+	f := newAccountFixture(t, nil)
+	ctx := context.Background()
+	user := f.user(t, "leaving@example.com")
+	ws := f.workspace(t, "solo", map[*repository.User]string{user: repository.RoleOwner})
+	keys := NewAPIKeyService(f.keys, f.members, f.svc.audit)
+	actor := auth.Principal{UserID: user.ID.Hex(), Email: user.Email, WorkspaceID: ws.ID.Hex(), Role: repository.RoleOwner}
+	key, _, err := keys.Create(ctx, actor, CreateAPIKeyInput{Name: "ci", ScopeType: repository.APIKeyScopeUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().UTC()
+	deletion, err := f.svc.RequestDeletion(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	grace := 30 * 24 * time.Hour
+	if d := deletion.PurgeAfter.Sub(deletion.RequestedAt); d != grace || deletion.RequestedAt.Before(before.Truncate(time.Millisecond)) {
+		t.Fatalf("deletion %+v, want purge %v after the request", deletion, grace)
+	}
+
+	// Asking again keeps the first schedule rather than extending it
+	again, err := f.svc.RequestDeletion(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.PurgeAfter.Equal(deletion.PurgeAfter) {
+		t.Errorf("second request moved purge from %v to %v", deletion.PurgeAfter, again.PurgeAfter)
+	}
+
+	due := func(at time.Time) bool {
+		users, err := f.users.ListDueForPurge(ctx, at, purgeBatchSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, u := range users {
+			if u.ID == user.ID {
+				return true
+			}
+		}
+		return false
+	}
+	if due(time.Now().UTC()) {
+		t.Error("account due for purge during its grace period")
+	}
+	if !due(deletion.PurgeAfter.Add(time.Second)) {
+		t.Error("account not due for purge after its grace period")
+	}
+	// Keys acting as the user stop working at once, not at the purge
+	if _, err := keys.AuthenticateAPIKey(ctx, key); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("user key after the deletion request: err %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestAccountDeletionCancel(t *testing.T) {
+	f := newAccountFixture(t, nil)
+	ctx := context.Background()
+	user := f.user(t, "staying@example.com")
+
+	if err := f.svc.CancelDeletion(ctx, user.ID.Hex()); !errors.Is(err, ErrNoDeletionPending) {
+		t.Fatalf("cancel with nothing pending: err %v, want ErrNoDeletionPending", err)
+	}
+	deletion, err := f.svc.RequestDeletion(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.svc.CancelDeletion(ctx, user.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := f.users.FindByID(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Deletion != nil {
+		t.Fatalf("deletion %+v still pending after cancel", got.Deletion)
+	}
+	users, err := f.users.ListDueForPurge(ctx, deletion.PurgeAfter.Add(time.Second), purgeBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Errorf("cancelled account still due for purge: %v", users)
+	}
+	if err := f.svc.CancelDeletion(ctx, user.ID.Hex()); !errors.Is(err, ErrNoDeletionPending) {
+		t.Errorf("second cancel: err %v, want ErrNoDeletionPending", err)
+	}
+}
+
+func TestAccountDeletionSoleOwner(t *testing.T) {
+	f := newAccountFixture(t, nil)
+	ctx := context.Background()
+	owner := f.user(t, "owner@example.com")
+	coOwner := f.user(t, "co-owner@example.com")
+	member := f.user(t, "member@example.com")
+
+	// Alone in a workspace, the owner may leave; it is purged with them
+	f.workspace(t, "solo", map[*repository.User]string{owner: repository.RoleOwner})
+	shared := f.workspace(t, "shared", map[*repository.User]string{owner: repository.RoleOwner, member: repository.RoleAdmin})
+
+	if _, err := f.svc.RequestDeletion(ctx, owner.ID.Hex()); !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("sole owner of a shared workspace: err %v, want ErrLastOwner", err)
+	}
+	if got, err := f.users.FindByID(ctx, owner.ID.Hex()); err != nil || got.Deletion != nil {
+		t.Fatalf("refused request still scheduled %+v, %v", got.Deletion, err)
+	}
+
+	// A non-owner member is never held back, and a second owner frees the first
+	if _, err := f.svc.RequestDeletion(ctx, member.ID.Hex()); err != nil {
+		t.Fatalf("member: %v", err)
+	}
+	if err := f.members.Add(ctx, &repository.Membership{WorkspaceID: shared.ID, UserID: coOwner.ID, Email: coOwner.Email, Role: repository.RoleOwner}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.RequestDeletion(ctx, owner.ID.Hex()); err != nil {
+		t.Fatalf("owner with a co-owner: %v", err)
+	}
+}
+
+func TestAccountExport(t *testing.T) {
+	pg := pgtest.Pool(t)
+	f := newAccountFixture(t, pg)
+	ctx := context.Background()
+	user := f.user(t, "export@example.com")
+	other := f.user(t, "teammate@example.com")
+	if err := f.users.EnableMFA(ctx, user.ID, "totp-secret", 1, []string{"recovery-hash"}); err != nil {
+		t.Fatal(err)
+	}
+	ws := f.workspace(t, "acme", map[*repository.User]string{user: repository.RoleEditor, other: repository.RoleOwner})
+	project := &repository.Project{WorkspaceID: ws.ID, Name: "Acme UK", BrandName: "Acme",
+		Competitor: []repository.Competitor{{DisplayName: "Rival", TrackedName: "rival", Domain: "rival.example", Country: "GB"}}}
+	if err := f.projects.Create(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = pg.Exec(context.Background(), `DELETE FROM prompt_response_entry WHERE workspace_id = $1`, ws.ID.Hex())
+	})
+	added := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	if _, err := f.prompts.StorePromptResponses(ctx, []repository.PromptResponseEntry{
+		{WorkspaceID: ws.ID.Hex(), ProjectID: project.ID.Hex(), UserID: user.ID.Hex(), Prompt: "best anvils", Response: "Acme", Country: "GB", Added: added},
+		{WorkspaceID: ws.ID.Hex(), ProjectID: project.ID.Hex(), UserID: other.ID.Hex(), Prompt: "teammate prompt", Response: "-", Country: "GB", Added: added},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := f.svc.Export(ctx, user.ID.Hex(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, zf := range zr.File {
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[zf.Name] = string(b)
+	}
+	for _, name := range []string{"profile.json", "workspaces.json", "competitors.csv", "prompts.csv", "prompt_meta.csv", "brand_analysis.csv", "domain_analysis.csv"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("export has no %s", name)
+		}
+	}
+
+	var profile map[string]any
+	if err := json.Unmarshal([]byte(files["profile.json"]), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile["email"] != user.Email {
+		t.Errorf("profile email %v, want %s", profile["email"], user.Email)
+	}
+	if strings.Contains(files["profile.json"], "totp-secret") || strings.Contains(files["profile.json"], "recovery-hash") {
+		t.Error("profile exports MFA secrets")
+	}
+
+	var workspaces []struct {
+		Name     string `json:"name"`
+		Role     string `json:"role"`
+		Projects []struct {
+			Name string `json:"name"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal([]byte(files["workspaces.json"]), &workspaces); err != nil {
+		t.Fatal(err)
+	}
+	if len(workspaces) != 1 || workspaces[0].Name != "acme" || workspaces[0].Role != repository.RoleEditor ||
+		len(workspaces[0].Projects) != 1 || workspaces[0].Projects[0].Name != "Acme UK" {
+		t.Errorf("workspaces.json = %+v", workspaces)
+	}
+
+	wantCSV := map[string][][]string{
+		"competitors.csv": {
+			{"workspace_id", "project_id", "display_name", "tracked_name", "domain", "country"},
+			{ws.ID.Hex(), project.ID.Hex(), "Rival", "rival", "rival.example", "GB"},
+		},
+		// Only the user's own prompts, not their teammate's
+		"prompts.csv": {
+			{"id", "workspace_id", "project_id", "prompt", "response", "country", "added"},
+			{"*", ws.ID.Hex(), project.ID.Hex(), "best anvils", "Acme", "GB", "2026-05-01T09:00:00Z"},
+		},
+	}
+	for name, want := range wantCSV {
+		rows, err := csv.NewReader(strings.NewReader(files[name])).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(rows) != len(want) {
+			t.Errorf("%s has rows %v, want %v", name, rows, want)
+			continue
+		}
+		for i := range want {
+			for j := range want[i] {
+				if want[i][j] != "*" && (j >= len(rows[i]) || rows[i][j] != want[i][j]) {
+					t.Errorf("%s row %d = %v, want %v", name, i, rows[i], want[i])
+					break
+				}
+			}
+		}
+	}
+}
+
+// confirmToken returns the token of the last email change link sent to an address
+func (f *accountFixture) confirmToken(t *testing.T, to string) string {
+	t.Helper()
+	f.mail.mu.Lock()
+	defer f.mail.mu.Unlock()
+	for i := len(f.mail.msgs) - 1; i >= 0; i-- {
+		if msg := f.mail.msgs[i]; msg.To == to {
+			if m := confirmLink.FindStringSubmatch(msg.Text); m != nil {
+				return m[1]
+			}
+		}
+	}
+	t.Fatalf("no email change link sent to %s", to)
+	return ""
+}
+
+var confirmLink = regexp.MustCompile(`https://app\.example\.com/email/confirm\?token=([0-9a-f]+)`)
+
+func TestAccountEmailChange(t *testing.T) {
+	f := newAccountFixture(t, nil)
+	ctx := context.Background()
+	user := f.user(t, "old@example.com")
+	f.user(t, "taken@example.com")
+
+	refused := []struct {
+		email string
+		want  error
+	}{
+		{" Old@Example.com ", ErrEmailUnchanged},
+		{"taken@example.com", ErrEmailTaken},
+	}
+	for _, tt := range refused {
+		if err := f.svc.RequestEmailChange(ctx, user.ID.Hex(), tt.email, ""); !errors.Is(err, tt.want) {
+			t.Errorf("change to %q: err %v, want %v", tt.email, err, tt.want)
+		}
+	}
+	if len(f.mail.msgs) != 0 {
+		t.Fatalf("refused changes sent %d emails", len(f.mail.msgs))
+	}
+
+	if err := f.svc.RequestEmailChange(ctx, user.ID.Hex(), " New@Example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	token := f.confirmToken(t, "new@example.com")
+	// Nothing changes until the new address is confirmed
+	if got, err := f.users.FindByID(ctx, user.ID.Hex()); err != nil || got.Email != "old@example.com" {
+		t.Fatalf("email before confirmation %q, %v", got.Email, err)
+	}
+
+	if err := f.svc.ConfirmEmailChange(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.users.FindByID(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != "new@example.com" || got.ID != user.ID {
+		t.Errorf("user after confirmation %s %q, want %s new@example.com", got.ID.Hex(), got.Email, user.ID.Hex())
+	}
+	// Tokens issued to the old address stop working
+	if got.SessionGen <= user.SessionGen || got.SessionsValidAfter == nil {
+		t.Errorf("sessions not revoked: generation %d, valid after %v", got.SessionGen, got.SessionsValidAfter)
+	}
+	if err := f.svc.ConfirmEmailChange(ctx, token); !errors.Is(err, ErrInvalidOrExpiredLink) {
+		t.Errorf("reused link: err %v, want ErrInvalidOrExpiredLink", err)
+	}
+}
+
+func TestAccountEmailChangeTakenMeanwhile(t *testing.T) {
+	f := newAccountFixture(t, nil)
+	ctx := context.Background()
+	user := f.user(t, "old@example.com")
+
+	if err := f.svc.RequestEmailChange(ctx, user.ID.Hex(), "new@example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	// Someone signs up with the address before the link is used
+	f.user(t, "new@example.com")
+
+	if err := f.svc.ConfirmEmailChange(ctx, f.confirmToken(t, "new@example.com")); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("confirm a taken address: err %v, want ErrEmailTaken", err)
+	}
+	if got, err := f.users.FindByID(ctx, user.ID.Hex()); err != nil || got.Email != "old@example.com" || got.SessionGen != user.SessionGen {
+		t.Errorf("refused change left %q at generation %d, %v", got.Email, got.SessionGen, err)
+	}
+}
+
+func TestAccountEmailChangeRateLimit(t *testing.T) {
+	f := newAccountFixture(t, nil)
+	ctx := context.Background()
+	user := f.user(t, "old@example.com")
+
+	// The fixture allows two links per address per hour
+	for i := 0; i < 2; i++ {
+		if err := f.svc.RequestEmailChange(ctx, user.ID.Hex(), "new@example.com", ""); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if err := f.svc.RequestEmailChange(ctx, user.ID.Hex(), "NEW@example.com", ""); !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("third request: err %v, want ErrTooManyRequests", err)
+	}
+	if err := f.svc.RequestEmailChange(ctx, user.ID.Hex(), "other@example.com", ""); err != nil {
+		t.Errorf("another address: %v", err)
+	}
+}
+
+func TestAccountBackfillUserIDs(t *testing.T) {
+	pg := pgtest.Pool(t)
+	f := newAccountFixture(t, pg)
+	ctx := context.Background()
+	// Emails are unique to this run: the Postgres tables are shared
+	suffix := primitive.NewObjectID().Hex()
+	user := f.user(t, "known-"+suffix+"@example.com")
+	orphan := "gone-" + suffix + "@example.com"
+
+	insert := func(email, userID string) int {
+		t.Helper()
+		var id int
+		if err := pg.QueryRow(ctx, `INSERT INTO prompt_response_entry (user_email, user_id, prompt, response, country, added)
+			VALUES ($1, NULLIF($2, ''), 'prompt', 'response', 'US', now()) RETURNING id`, email, userID).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	known := insert(user.Email, "")
+	orphaned := insert(orphan, "")
+	keyed := insert(user.Email, "already-keyed")
+	t.Cleanup(func() {
+		_, _ = pg.Exec(context.Background(), `DELETE FROM prompt_response_entry WHERE id = ANY($1)`, []int{known, orphaned, keyed})
+	})
+
+	for run := 0; run < 2; run++ {
+		if err := f.svc.BackfillUserIDs(ctx); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+
+	want := map[int]string{known: user.ID.Hex(), orphaned: "", keyed: "already-keyed"}
+	for id, userID := range want {
+		var got string
+		if err := pg.QueryRow(ctx, `SELECT COALESCE(user_id, '') FROM prompt_response_entry WHERE id = $1`, id).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != userID {
+			t.Errorf("row %d has user_id %q, want %q", id, got, userID)
+		}
+	}
+}
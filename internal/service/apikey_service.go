@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrAPIKeyNotFound     = apperr.New(apperr.NotFound, "api_key_not_found", "api key not found")
+	ErrInvalidAPIKeyInput = apperr.New(apperr.Validation, "invalid_api_key_request", "invalid api key request")
+)
+
+// apiKeyTouchInterval bounds how often last_used_at is written for a busy key
+const apiKeyTouchInterval = time.Minute
+
+type APIKeyService struct {
+	keys    *repository.APIKeyRepo
+	members *repository.MemberRepo
+	audit   *AuditService
+}
+
+func NewAPIKeyService(k *repository.APIKeyRepo, m *repository.MemberRepo, audit *AuditService) *APIKeyService {
+	return &APIKeyService{keys: k, members: m, audit: audit}
+}
+
+// CreateAPIKeyInput describes a key to mint
+type CreateAPIKeyInput struct {
+	Name      string
+	ScopeType string        // repository.APIKeyScopeUser or APIKeyScopeWorkspace
+	Role      string        // workspace keys only
+	Scopes    []string      // optional restriction, e.g. ["reports:read"]
+	ExpiresIn time.Duration // zero means no expiry
+}
+
+// Create mints a key in the actor's active workspace. The plaintext key is
+// returned only here; the record keeps its hash.
+func (s *APIKeyService) Create(ctx context.Context, actor auth.Principal, in CreateAPIKeyInput) (string, *repository.APIKey, error) {
+	for _, scope := range in.Scopes {
+		if !auth.ValidScope(scope) {
+			return "", nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKeyInput, scope)
+		}
+	}
+
+	workspaceID, err := primitive.ObjectIDFromHex(actor.WorkspaceID)
+	if err != nil {
+		return "", nil, ErrNotMember
+	}
+	userID, err := primitive.ObjectIDFromHex(actor.UserID)
+	if err != nil {
+		return "", nil, ErrNotMember
+	}
+
+	rec := &repository.APIKey{
+		Name:        in.Name,
+		ScopeType:   in.ScopeType,
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Email:       actor.Email,
+		Scopes:      in.Scopes,
+		MFA:         actor.MFA,
+	}
+
+	switch in.ScopeType {
+	case repository.APIKeyScopeUser:
+		// role is looked up on every use
+	case repository.APIKeyScopeWorkspace:
+		if !auth.RoleHasPermission(actor.Role, auth.PermAdminAPIKeys) {
+			return "", nil, ErrInsufficientRole
+		}
+		if !repository.ValidRole(in.Role) {
+			return "", nil, ErrInvalidRole
+		}
+		if repository.RoleRank(in.Role) > repository.RoleRank(actor.Role) {
+			return "", nil, ErrInsufficientRole
+		}
+		rec.Role = in.Role
+	default:
+		return "", nil, fmt.Errorf("%w: scope_type must be %q or %q", ErrInvalidAPIKeyInput, repository.APIKeyScopeUser, repository.APIKeyScopeWorkspace)
+	}
+
+	if in.ExpiresIn > 0 {
+		expires := time.Now().UTC().Add(in.ExpiresIn)
+		rec.ExpiresAt = &expires
+	}
+
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	rec.Prefix = prefix
+	rec.Hash = hash
+
+	if err := s.keys.Create(ctx, rec); err != nil {
+		return "", nil, fmt.Errorf("failed to save api key: %w", err)
+	}
+	after := map[string]any{"name": rec.Name, "prefix": rec.Prefix, "scope_type": rec.ScopeType, "role": rec.Role, "scopes": rec.Scopes}
+	if rec.ExpiresAt != nil {
+		after["expires_at"] = *rec.ExpiresAt
+	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &workspaceID,
+		Action:      AuditAPIKeyCreated,
+		TargetType:  "api_key",
+		TargetID:    rec.ID.Hex(),
+		After:       after,
+	})
+	return key, rec, nil
+}
+
+// List returns the keys of the actor's workspace they may manage: all of them
+// for key administrators, otherwise only their own user keys
+func (s *APIKeyService) List(ctx context.Context, actor auth.Principal) ([]repository.APIKey, error) {
+	workspaceID, err := primitive.ObjectIDFromHex(actor.WorkspaceID)
+	if err != nil {
+		return nil, ErrNotMember
+	}
+
+	keys, err := s.keys.ListByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	if auth.RoleHasPermission(actor.Role, auth.PermAdminAPIKeys) {
+		return keys, nil
+	}
+
+	own := []repository.APIKey{}
+	for _, k := range keys {
+		if k.ScopeType == repository.APIKeyScopeUser && k.UserID.Hex() == actor.UserID {
+			own = append(own, k)
+		}
+	}
+	return own, nil
+}
+
+// Revoke disables a key. Users may revoke their own keys; key administrators
+// may revoke any key in the workspace.
+func (s *APIKeyService) Revoke(ctx context.Context, actor auth.Principal, id string) error {
+	k, err := s.keys.FindByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to fetch api key: %w", err)
+	}
+	if k == nil || k.WorkspaceID.Hex() != actor.WorkspaceID {
+		return ErrAPIKeyNotFound
+	}
+
+	isOwn := k.ScopeType == repository.APIKeyScopeUser && k.UserID.Hex() == actor.UserID
+	if !isOwn && !auth.RoleHasPermission(actor.Role, auth.PermAdminAPIKeys) {
+		return ErrInsufficientRole
+	}
+	if err := s.keys.Revoke(ctx, k.ID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &k.WorkspaceID,
+		Action:      AuditAPIKeyRevoked,
+		TargetType:  "api_key",
+		TargetID:    k.ID.Hex(),
+		Before:      map[string]any{"name": k.Name, "prefix": k.Prefix, "revoked": false},
+		After:       map[string]any{"revoked": true},
+	})
+	return nil
+}
+
+// AuthenticateAPIKey resolves a presented key to the principal it acts as.
+// User keys take their creator's current role and stop working when the
+// creator leaves the workspace. A key carries the MFA of the session that
+// created it.
+func (s *APIKeyService) AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error) {
+	if !auth.IsAPIKey(key) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	k, err := s.keys.FindByHash(ctx, auth.HashAPIKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch api key: %w", err)
+	}
+	if k == nil || k.RevokedAt != nil || (k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	role := k.Role
+	if k.ScopeType == repository.APIKeyScopeUser {
+		member, err := s.members.Find(ctx, k.WorkspaceID, k.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch membership: %w", err)
+		}
+		if member == nil {
+			return nil, auth.ErrInvalidAPIKey
+		}
+		role = member.Role
+	}
+
+	if err := s.keys.TouchLastUsed(ctx, k.ID, apiKeyTouchInterval); err != nil {
+		pkg.Logger(ctx).Warn("api key last-used update failed", "api_key_id", k.ID.Hex(), "err", err)
+	}
+
+	return &auth.Principal{
+		Email:       k.Email,
+		UserID:      k.UserID.Hex(),
+		WorkspaceID: k.WorkspaceID.Hex(),
+		Role:        role,
+		Scopes:      k.Scopes,
+		MFA:         k.MFA,
+		APIKeyID:    k.ID.Hex(),
+	}, nil
+}
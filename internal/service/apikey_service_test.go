@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/mongotest"
+	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// apiKeyFixture is an API key service over a scratch database with one
+// workspace and an admin and an editor in it
+type apiKeyFixture struct {
+	svc           *APIKeyService
+	keys          *repository.APIKeyRepo
+	members       *repository.MemberRepo
+	col           *mongo.Collection
+	admin, editor auth.Principal
+}
+
+func newAPIKeyFixture(t *testing.T) *apiKeyFixture {
+	t.Helper()
+	db := mongotest.Database(t)
+	f := &apiKeyFixture{
+		keys:    repository.NewAPIKeyRepo(db, "api_keys"),
+		members: repository.NewMemberRepo(db, "members"),
+		col:     db.Collection("api_keys"),
+	}
+	f.svc = NewAPIKeyService(f.keys, f.members, NewAuditService(repository.NewAuditRepo(db, "audit")))
+
+	ws := primitive.NewObjectID()
+	for _, p := range []*auth.Principal{&f.admin, &f.editor} {
+		*p = auth.Principal{UserID: primitive.NewObjectID().Hex(), WorkspaceID: ws.Hex(), MFA: true}
+	}
+	f.admin.Email, f.admin.Role = "admin@example.com", repository.RoleAdmin
+	f.editor.Email, f.editor.Role = "editor@example.com", repository.RoleEditor
+	for _, p := range []auth.Principal{f.admin, f.editor} {
+		userID, _ := primitive.ObjectIDFromHex(p.UserID)
+		if err := f.members.Add(context.Background(), &repository.Membership{WorkspaceID: ws, UserID: userID, Email: p.Email, Role: p.Role}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+func (f *apiKeyFixture) create(t *testing.T, actor auth.Principal, in CreateAPIKeyInput) (string, *repository.APIKey) {
+	t.Helper()
+	key, rec, err := f.svc.Create(context.Background(), actor, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, rec
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	f := newAPIKeyFixture(t)
+	ctx := context.Background()
+	key, rec := f.create(t, f.editor, CreateAPIKeyInput{Name: "ci", ScopeType: repository.APIKeyScopeUser, Scopes: []string{"reports:read"}})
+
+	// Only the hash is stored; the prefix identifies the key
+	stored, err := f.keys.FindByID(ctx, rec.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Hash != auth.HashAPIKey(key) || strings.Contains(stored.Hash, key) || !strings.HasPrefix(key, stored.Prefix+"_") {
+		t.Fatalf("stored key %+v does not match the issued key by hash and prefix", stored)
+	}
+
+	p, err := f.svc.AuthenticateAPIKey(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := auth.Principal{Email: f.editor.Email, UserID: f.editor.UserID, WorkspaceID: f.editor.WorkspaceID,
+		Role: repository.RoleEditor, Scopes: []string{"reports:read"}, MFA: true, APIKeyID: rec.ID.Hex()}
+	if p.Email != want.Email || p.UserID != want.UserID || p.WorkspaceID != want.WorkspaceID || p.Role != want.Role ||
+		len(p.Scopes) != 1 || p.Scopes[0] != want.Scopes[0] || p.MFA != want.MFA || p.APIKeyID != want.APIKeyID {
+		t.Fatalf("principal %+v, want %+v", p, want)
+	}
+
+	for name, bad := range map[string]string{
+		"wrong secret": stored.Prefix + "_" + strings.Repeat("0", 48),
+		"not a key":    "eyJhbGciOiJIUzI1NiJ9.e30.x",
+		"empty":        "",
+	} {
+		if _, err := f.svc.AuthenticateAPIKey(ctx, bad); !errors.Is(err, auth.ErrInvalidAPIKey) {
+			t.Errorf("%s: err %v, want ErrInvalidAPIKey", name, err)
+		}
+	}
+}
+
+func TestAPIKeyExpiryAndRevocation(t *testing.T) {
+	f := newAPIKeyFixture(t)
+	ctx := context.Background()
+
+	expiring, rec := f.create(t, f.editor, CreateAPIKeyInput{Name: "short", ScopeType: repository.APIKeyScopeUser, ExpiresIn: time.Hour})
+	if _, err := f.svc.AuthenticateAPIKey(ctx, expiring); err != nil {
+		t.Fatalf("before expiry: %v", err)
+	}
+	if _, err := f.col.UpdateByID(ctx, rec.ID, bson.M{"$set": bson.M{"expires_at": time.Now().UTC().Add(-time.Second)}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.AuthenticateAPIKey(ctx, expiring); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("after expiry: err %v, want ErrInvalidAPIKey", err)
+	}
+
+	revoked, rec := f.create(t, f.editor, CreateAPIKeyInput{Name: "old", ScopeType: repository.APIKeyScopeUser})
+	// Another editor's key is not theirs to revoke; an admin may revoke any
+	other := f.editor
+	other.UserID = primitive.NewObjectID().Hex()
+	if err := f.svc.Revoke(ctx, other, rec.ID.Hex()); !errors.Is(err, ErrInsufficientRole) {
+		t.Fatalf("revoke by another editor: err %v, want ErrInsufficientRole", err)
+	}
+	if err := f.svc.Revoke(ctx, f.admin, rec.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.AuthenticateAPIKey(ctx, revoked); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("after revocation: err %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestAPIKeyLastUsed(t *testing.T) {
+	f := newAPIKeyFixture(t)
+	ctx := context.Background()
+	key, rec := f.create(t, f.editor, CreateAPIKeyInput{Name: "ci", ScopeType: repository.APIKeyScopeUser})
+	if rec.LastUsedAt != nil {
+		t.Fatalf("new key has last used %v", rec.LastUsedAt)
+	}
+
+	lastUsed := func() *time.Time {
+		k, err := f.keys.FindByID(ctx, rec.ID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k.LastUsedAt
+	}
+	if _, err := f.svc.AuthenticateAPIKey(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	first := lastUsed()
+	if first == nil {
+		t.Fatal("last used not recorded")
+	}
+	// Within the interval a use is not written again
+	if _, err := f.svc.AuthenticateAPIKey(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if again := lastUsed(); again == nil || !again.Equal(*first) {
+		t.Errorf("last used moved from %v to %v within %v", first, again, apiKeyTouchInterval)
+	}
+	// Once it has passed, it is
+	stale := time.Now().UTC().Add(-2 * apiKeyTouchInterval)
+	if _, err := f.col.UpdateByID(ctx, rec.ID, bson.M{"$set": bson.M{"last_used_at": stale}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.AuthenticateAPIKey(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if later := lastUsed(); later == nil || !later.After(stale) {
+		t.Errorf("last used %v not moved past %v", later, stale)
+	}
+}
+
+func TestAPIKeyRoles(t *testing.T) {
+	f := newAPIKeyFixture(t)
+	ctx := context.Background()
+
+	// User keys follow their creator's membership
+	userKey, _ := f.create(t, f.editor, CreateAPIKeyInput{Name: "mine", ScopeType: repository.APIKeyScopeUser})
+	ws, _ := primitive.ObjectIDFromHex(f.editor.WorkspaceID)
+	editorID, _ := primitive.ObjectIDFromHex(f.editor.UserID)
+	if err := f.members.UpdateRole(ctx, ws, editorID, repository.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := f.svc.AuthenticateAPIKey(ctx, userKey); err != nil || p.Role != repository.RoleViewer {
+		t.Fatalf("after demotion: %+v, %v, want role viewer", p, err)
+	}
+	if err := f.members.Remove(ctx, ws, editorID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.AuthenticateAPIKey(ctx, userKey); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Fatalf("after removal: err %v, want ErrInvalidAPIKey", err)
+	}
+
+	// Workspace keys have a fixed role, no higher than their creator's, and
+	// only key administrators may create them
+	if _, _, err := f.svc.Create(ctx, f.editor, CreateAPIKeyInput{Name: "ws", ScopeType: repository.APIKeyScopeWorkspace, Role: repository.RoleViewer}); !errors.Is(err, ErrInsufficientRole) {
+		t.Errorf("workspace key by an editor: err %v, want ErrInsufficientRole", err)
+	}
+	if _, _, err := f.svc.Create(ctx, f.admin, CreateAPIKeyInput{Name: "ws", ScopeType: repository.APIKeyScopeWorkspace, Role: repository.RoleOwner}); !errors.Is(err, ErrInsufficientRole) {
+		t.Errorf("owner key by an admin: err %v, want ErrInsufficientRole", err)
+	}
+	wsKey, _ := f.create(t, f.admin, CreateAPIKeyInput{Name: "ws", ScopeType: repository.APIKeyScopeWorkspace, Role: repository.RoleEditor})
+	if p, err := f.svc.AuthenticateAPIKey(ctx, wsKey); err != nil || p.Role != repository.RoleEditor {
+		t.Fatalf("workspace key: %+v, %v, want role editor", p, err)
+	}
+
+	if _, _, err := f.svc.Create(ctx, f.admin, CreateAPIKeyInput{Name: "bad", ScopeType: repository.APIKeyScopeUser, Scopes: []string{"reports"}}); !errors.Is(err, ErrInvalidAPIKeyInput) {
+		t.Errorf("malformed scope: err %v, want ErrInvalidAPIKeyInput", err)
+	}
+}
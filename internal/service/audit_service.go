@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit actions
+const (
+	AuditMagicLinkRequested   = "auth.magic_link_requested"
+	AuditLogin                = "auth.login" // first factor verified
+	AuditLoginFailed          = "auth.login_failed"
+	AuditSignup               = "auth.signup"
+	AuditOAuthSignup          = "auth.oauth_signup"
+	AuditTokenIssued          = "auth.token_issued"
+	AuditMFAEnabled           = "auth.mfa_enabled"
+	AuditMFADisabled          = "auth.mfa_disabled"
+	AuditMFAFailed            = "auth.mfa_failed"
+	AuditRecoveryCodesReset   = "auth.recovery_codes_regenerated"
+	AuditProjectCreated       = "project.created"
+	AuditProfileUpdated       = "project.profile_updated"
+	AuditCompetitorsAdded     = "project.competitors_added"
+	AuditCompetitorRemoved    = "project.competitor_removed"
+	AuditPromptsAdded         = "prompts.added"
+	AuditEmailChangeRequest   = "account.email_change_requested"
+	AuditEmailChanged         = "account.email_changed"
+	AuditDeletionRequested    = "account.deletion_requested"
+	AuditDeletionCancelled    = "account.deletion_cancelled"
+	AuditMemberInvited        = "member.invited"
+	AuditMemberJoined         = "member.joined"
+	AuditMemberRoleChanged    = "member.role_changed"
+	AuditMemberRemoved        = "member.removed"
+	AuditRequireMFAChanged    = "workspace.require_mfa_changed"
+	AuditAPIKeyCreated        = "api_key.created"
+	AuditAPIKeyRevoked        = "api_key.revoked"
+	AuditCompetitorsSuggested = "project.competitors_suggested"
+
+	// Operator actions are platform-wide and never take a workspace from ctx
+	AuditSysUsersSearched    = "system.users_searched"
+	AuditSysUserViewed       = "system.user_viewed"
+	AuditSysUserPromptsRead  = "system.user_prompts_viewed"
+	AuditSysUserVerified     = "system.user_verified"
+	AuditSysUserDisabled     = "system.user_disabled"
+	AuditSysUserEnabled      = "system.user_enabled"
+	AuditSysSessionsRevoked  = "system.sessions_revoked"
+	AuditSysAnalysesRerun    = "system.analyses_rerun"
+	AuditSysStatsViewed      = "system.stats_viewed"
+	AuditSysImpersonation    = "system.impersonation_started"
+	AuditSysWorkspacePlan    = "system.workspace_plan_changed"
+	AuditSysWorkspaceBudget  = "system.workspace_llm_budget_changed"
+	AuditSysLLMUsageViewed   = "system.llm_usage_viewed"
+	AuditImpersonatedRequest = "impersonation.request"
+	auditSystemActionPrefix  = "system."
+)
+
+// auditAccountActionPrefixes start the actions about a user's own account.
+// They belong to no workspace, or admins of whichever workspace the user had
+// open could read them.
+var auditAccountActionPrefixes = []string{"account.", "auth.mfa_", "auth.recovery_codes_"}
+
+var ErrInvalidAuditFilter = apperr.New(apperr.Validation, "invalid_audit_filter", "invalid audit filter")
+
+const (
+	auditListLimit    = 100
+	auditMaxListLimit = 1000
+)
+
+// Audit export formats
+const (
+	AuditFormatCSV    = "csv"
+	AuditFormatNDJSON = "ndjson"
+)
+
+// AuditService records security-relevant actions to the append-only audit log
+type AuditService struct {
+	events *repository.AuditRepo
+}
+
+func NewAuditService(events *repository.AuditRepo) *AuditService {
+	return &AuditService{events: events}
+}
+
+// Record stores an event. Actor, workspace and request details missing from e
+// are taken from ctx; account events never get a workspace. Failures are
+// logged rather than failing the action.
+func (s *AuditService) Record(ctx context.Context, e repository.AuditEvent) {
+	if e.ActorID == "" && e.ActorEmail == "" {
+		e.ActorID, _ = pkg.GetUserIDFromContext(ctx)
+		e.ActorEmail, _ = pkg.GetEmailFromContext(ctx)
+		e.APIKeyID = pkg.GetAPIKeyIDFromContext(ctx)
+	}
+	if imp, ok := pkg.GetImpersonatorFromContext(ctx); ok {
+		e.ImpersonatorID, e.ImpersonatorEmail = imp.ID, imp.Email
+	}
+	if isAccountAction(e.Action) {
+		e.WorkspaceID = nil
+	} else if e.WorkspaceID == nil && !strings.HasPrefix(e.Action, auditSystemActionPrefix) {
+		if wsID, ok := pkg.GetWorkspaceIDFromContext(ctx); ok {
+			if oid, err := primitive.ObjectIDFromHex(wsID); err == nil {
+				e.WorkspaceID = &oid
+			}
+		}
+	}
+	req := pkg.GetRequestInfo(ctx)
+	e.IP, e.UserAgent, e.RequestID = req.IP, req.UserAgent, req.ID
+	e.At = time.Now().UTC()
+
+	// The action already happened, so record it even if the request is gone
+	if err := s.events.Insert(context.WithoutCancel(ctx), &e); err != nil {
+		pkg.Logger(ctx).Error("audit event not recorded", "action", e.Action, "err", err)
+	}
+}
+
+func isAccountAction(action string) bool {
+	for _, prefix := range auditAccountActionPrefixes {
+		if strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordImpersonatedRequest implements middleware.ImpersonationRecorder. The
+// event lands in the impersonated workspace's log, so customers can see it.
+func (s *AuditService) RecordImpersonatedRequest(ctx context.Context, method, path string, status int) {
+	userID, _ := pkg.GetUserIDFromContext(ctx)
+	s.Record(ctx, repository.AuditEvent{
+		Action:     AuditImpersonatedRequest,
+		TargetType: "user",
+		TargetID:   userID,
+		Metadata:   map[string]any{"method": method, "path": path, "status": status},
+	})
+}
+
+// auditChanges keeps only the fields whose values differ between before and after
+func auditChanges(before, after map[string]any) (map[string]any, map[string]any) {
+	b, a := map[string]any{}, map[string]any{}
+	for k, v := range after {
+		if !reflect.DeepEqual(before[k], v) {
+			b[k], a[k] = before[k], v
+		}
+	}
+	return b, a
+}
+
+// AuditQuery selects a workspace's events. From and To are RFC 3339 times;
+// Actions is a comma-separated list.
+type AuditQuery struct {
+	From    string
+	To      string
+	Actions string
+	Limit   int
+}
+
+func (q AuditQuery) filter(workspaceID string) (repository.AuditFilter, error) {
+	oid, err := primitive.ObjectIDFromHex(workspaceID)
+	if err != nil {
+		return repository.AuditFilter{}, ErrNotMember
+	}
+	f := repository.AuditFilter{WorkspaceID: &oid}
+	if q.From != "" {
+		if f.From, err = time.Parse(time.RFC3339, q.From); err != nil {
+			return f, fmt.Errorf("%w: from must be an RFC 3339 time", ErrInvalidAuditFilter)
+		}
+	}
+	if q.To != "" {
+		if f.To, err = time.Parse(time.RFC3339, q.To); err != nil {
+			return f, fmt.Errorf("%w: to must be an RFC 3339 time", ErrInvalidAuditFilter)
+		}
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return f, fmt.Errorf("%w: from must be before to", ErrInvalidAuditFilter)
+	}
+	for _, a := range strings.Split(q.Actions, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			f.Actions = append(f.Actions, a)
+		}
+	}
+	return f, nil
+}
+
+// List returns a workspace's newest events matching q
+func (s *AuditService) List(ctx context.Context, workspaceID string, q AuditQuery) ([]repository.AuditEvent, error) {
+	f, err := q.filter(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = auditListLimit
+	}
+	if limit > auditMaxListLimit {
+		limit = auditMaxListLimit
+	}
+	events, err := s.events.List(ctx, f, int64(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return events, nil
+}
+
+// Export writes every event of a workspace matching q, oldest first, as CSV or
+// newline-delimited JSON. q.Limit is ignored.
+func (s *AuditService) Export(ctx context.Context, workspaceID string, q AuditQuery, format string, w io.Writer) error {
+	f, err := q.filter(workspaceID)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case AuditFormatNDJSON:
+		enc := json.NewEncoder(w)
+		return s.events.Each(ctx, f, func(e repository.AuditEvent) error { return enc.Encode(e) })
+
+	case AuditFormatCSV:
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"at", "action", "actor_id", "actor_email", "api_key_id", "impersonator_id", "impersonator_email",
+			"target_type", "target_id", "ip", "user_agent", "request_id", "before", "after", "metadata"})
+		err := s.events.Each(ctx, f, func(e repository.AuditEvent) error {
+			return cw.Write([]string{e.At.UTC().Format(time.RFC3339Nano), e.Action, e.ActorID, e.ActorEmail, e.APIKeyID,
+				e.ImpersonatorID, e.ImpersonatorEmail, e.TargetType, e.TargetID, e.IP, e.UserAgent, e.RequestID, auditJSON(e.Before), auditJSON(e.After), auditJSON(e.Metadata)})
+		})
+		cw.Flush()
+		if err != nil {
+			return err
+		}
+		return cw.Error()
+
+	default:
+		return fmt.Errorf("%w: format must be %s or %s", ErrInvalidAuditFilter, AuditFormatCSV, AuditFormatNDJSON)
+	}
+}
+
+func auditJSON(m map[string]any) string {
+	if len(m) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
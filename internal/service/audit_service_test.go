@@ -0,0 +1,26 @@
+package service
+
+import "testing"
+
+func TestIsAccountAction(t *testing.T) {
+	tests := map[string]bool{
+		AuditEmailChangeRequest: true,
+		AuditEmailChanged:       true,
+		AuditDeletionRequested:  true,
+		AuditDeletionCancelled:  true,
+		AuditMFAEnabled:         true,
+		AuditMFADisabled:        true,
+		AuditMFAFailed:          true,
+		AuditRecoveryCodesReset: true,
+		AuditLogin:              false,
+		AuditTokenIssued:        false,
+		AuditMemberRemoved:      false,
+		AuditAPIKeyCreated:      false,
+		AuditSysUserDisabled:    false,
+	}
+	for action, want := range tests {
+		if got := isAccountAction(action); got != want {
+			t.Errorf("isAccountAction(%q) = %v, want %v", action, got, want)
+		}
+	}
+}
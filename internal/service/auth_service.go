@@ -2,111 +2,400 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"auth-microservice/internal/apperr"
 	"auth-microservice/internal/auth"
 	"auth-microservice/internal/config"
+	"auth-microservice/internal/mailer"
+	"auth-microservice/internal/metrics"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/ratelimit"
 	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AuthService struct {
-	users  *repository.UserRepo
-	tokens *repository.TokenRepo
-	cfg    *config.Config
+	users   *repository.UserRepo
+	tokens  *repository.TokenRepo
+	mail    mailer.Mailer
+	tpl     *mailer.Templates
+	audit   *AuditService
+	metrics *metrics.Metrics
+	limiter *ratelimit.Limiter
+	cfg     *config.Config
 }
 
-func NewAuthService(u *repository.UserRepo, t *repository.TokenRepo, cfg *config.Config) *AuthService {
-	return &AuthService{users: u, tokens: t, cfg: cfg}
+func NewAuthService(u *repository.UserRepo, t *repository.TokenRepo, m mailer.Mailer, tpl *mailer.Templates, audit *AuditService, mx *metrics.Metrics, l *ratelimit.Limiter, cfg *config.Config) *AuthService {
+	return &AuthService{users: u, tokens: t, mail: m, tpl: tpl, audit: audit, metrics: mx, limiter: l, cfg: cfg}
 }
 
-// SendEmailVerification generates a magic link and sends email
-func (s *AuthService) SendEmailVerification(ctx context.Context, email, baseURL string) (string, error) {
-	// generate random token
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
+var (
+	ErrTooManyRequests      = apperr.New(apperr.RateLimited, "too_many_requests", "too many sign-in links requested, try again later")
+	ErrBaseURLNotAllowed    = apperr.New(apperr.Validation, "base_url_not_allowed", "base URL is not permitted for sign-in links")
+	ErrInvalidOrExpiredLink = apperr.New(apperr.Validation, "invalid_or_expired_link", "invalid or expired token")
+	ErrInvalidLoginCode     = apperr.New(apperr.Validation, "invalid_login_code", "invalid or expired code")
+	ErrLoginCodeLocked      = apperr.New(apperr.RateLimited, "login_code_locked", "too many wrong codes, sign in with the link in the email instead")
+	ErrAccountDisabled      = apperr.New(apperr.Forbidden, "account_disabled", "this account has been disabled, contact support")
+)
+
+const (
+	magicLinkWindow     = time.Hour      // period the magic link rate limits apply to
+	magicLinkTTL        = 24 * time.Hour // lifetime of a magic link and its code
+	loginCodeMaxAttempt = 5              // codes tried, without one working, before an email's codes stop working
+)
+
+// SendEmailVerification generates a magic link and sends email, with a 6-digit
+// code as well when withCode is set. Requests are limited per address and per
+// client IP, and the link may only point at an allowed base URL (the first one
+// when baseURL is empty). The email's language follows acceptLanguage, then
+// the user's country.
+func (s *AuthService) SendEmailVerification(ctx context.Context, email, baseURL, ip, acceptLanguage string, withCode bool) error {
+	base, err := s.magicLinkBase(baseURL)
+	if err != nil {
+		return err
+	}
+
+	if err := s.countMagicLink(ctx, email, ip); err != nil {
+		return err
+	}
+
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		return err
 	}
-	token := hex.EncodeToString(b)
 
 	// save token record in DB
 	rec := &repository.TokenRecord{
-		Token:     token,
+		TokenHash: hash,
 		Email:     email,
 		Purpose:   "verify_email",
-		ExpiresAt: time.Now().UTC().Add(24 * time.Hour),
+		RequestIP: ip,
+		ExpiresAt: time.Now().UTC().Add(magicLinkTTL),
+	}
+	var code string
+	if withCode {
+		if code, err = auth.GenerateLoginCode(); err != nil {
+			return err
+		}
+		rec.CodeHash = auth.HashLoginCode(s.cfg.EmailSecret, code)
 	}
 	if err := s.tokens.Create(ctx, rec); err != nil {
-		return "", err
+		return err
+	}
+	if err := s.tokens.TrimOutstanding(ctx, email, "verify_email", s.cfg.MagicLinkMaxOutstanding); err != nil {
+		pkg.Logger(ctx).Warn("magic link trim failed", "err", err)
 	}
 
 	// construct magic link
-	verifyURL := fmt.Sprintf("%s/verify?token=%s", baseURL, token)
-
-	// send email if configured
-	if s.cfg.Email != "" && s.cfg.EmailKey != "" {
-		err := auth.SendVerificationEmail(s.cfg.Email, s.cfg.EmailKey, email, verifyURL)
-		if err != nil {
-			// log the error and return it
-			fmt.Println("SendGrid email error:", err)
-			return "", fmt.Errorf("failed to send verification email: %w", err)
+	verifyURL := fmt.Sprintf("%s/verify?token=%s", base, token)
+
+	var country string
+	if user, err := s.users.FindByEmail(ctx, email); err == nil && user != nil {
+		country = user.Country
+	}
+	locale := mailer.ResolveLocale(acceptLanguage, country, s.tpl.Names()[mailer.TemplateVerifyEmail])
+	msg, err := s.tpl.Render(mailer.TemplateVerifyEmail, locale, email, map[string]any{
+		"VerifyURL": verifyURL,
+		"Code":      code,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render verification email: %w", err)
+	}
+	msg.IdempotencyKey = "verify_email:" + hash
+
+	if err := s.mail.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	s.audit.Record(ctx, repository.AuditEvent{
+		ActorEmail: email,
+		Action:     AuditMagicLinkRequested,
+		TargetType: "email",
+		TargetID:   email,
+		Metadata:   map[string]any{"with_code": withCode},
+	})
+	return nil
+}
+
+// countMagicLink counts a sign-in link request against the hourly limits of
+// its address and client IP. Requests are counted apart from the tokens, which
+// are trimmed and consumed, so the count holds however many are still live.
+func (s *AuthService) countMagicLink(ctx context.Context, email, ip string) error {
+	window := time.Now().UTC().Truncate(magicLinkWindow)
+	resetAt := window.Add(magicLinkWindow)
+	hour := window.Format("2006-01-02T15")
+
+	emailKey := "magic_link:email:" + strings.ToLower(email) + ":" + hour
+	_, ok, err := s.limiter.Consume(ctx, emailKey, 1, int64(s.cfg.MagicLinkPerEmailHour), resetAt)
+	if err != nil {
+		return fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if !ok {
+		return ErrTooManyRequests
+	}
+	if ip == "" {
+		return nil
+	}
+	_, ok, err = s.limiter.Consume(ctx, "magic_link:ip:"+ip+":"+hour, 1, int64(s.cfg.MagicLinkPerIPHour), resetAt)
+	if err == nil && ok {
+		return nil
+	}
+	if rerr := s.limiter.Release(ctx, emailKey, 1, resetAt); rerr != nil {
+		pkg.Logger(ctx).Warn("magic link count release failed", "err", rerr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	return ErrTooManyRequests
+}
+
+// recordLogin audits a first-factor attempt for an email
+func (s *AuthService) recordLogin(ctx context.Context, email, method string, err error) {
+	e := repository.AuditEvent{
+		ActorEmail: email,
+		Action:     AuditLogin,
+		TargetType: "email",
+		TargetID:   email,
+		Metadata:   map[string]any{"method": method},
+	}
+	if err != nil {
+		e.Action = AuditLoginFailed
+		e.Metadata["reason"] = err.Error()
+	}
+	s.audit.Record(ctx, e)
+}
+
+// magicLinkBase returns baseURL if it is on the allowlist, or the first
+// allowed base when baseURL is empty
+func (s *AuthService) magicLinkBase(baseURL string) (string, error) {
+	allowed := s.cfg.MagicLinkBaseURLs
+	if len(allowed) == 0 {
+		return "", ErrBaseURLNotAllowed
+	}
+	if baseURL == "" {
+		return allowed[0], nil
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+	for _, a := range allowed {
+		if strings.EqualFold(a, baseURL) {
+			return a, nil
 		}
 	}
+	return "", ErrBaseURLNotAllowed
+}
 
-	return verifyURL, nil
+// CheckEmailToken reports the email of a magic link token without using it up,
+// so link scanners that fetch the URL do not consume it
+func (s *AuthService) CheckEmailToken(ctx context.Context, token string) (*repository.TokenRecord, error) {
+	rec, err := s.tokens.FindValid(ctx, auth.HashToken(token), "verify_email")
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidOrExpiredLink
+		}
+		return nil, err
+	}
+	return rec, nil
 }
 
-// checks token
-func (s *AuthService) VerifyEmailToken(ctx context.Context, token string) (*repository.TokenRecord, error) {
-	rec, err := s.tokens.FindValid(ctx, token, "verify_email")
+// VerifyLoginCode consumes the magic link whose code matches. Guesses are
+// rate limited per email, and after loginCodeMaxAttempt of them the email's
+// codes stop working until the links they came with have expired.
+func (s *AuthService) VerifyLoginCode(ctx context.Context, email, code string) (*repository.TokenRecord, error) {
+	lim := ratelimit.PerMinute(s.cfg.LoginCodePerEmailMinute, s.cfg.LoginCodePerEmailMinute)
+	d, err := s.limiter.Allow(ctx, "login_code:email:"+strings.ToLower(email), lim)
 	if err != nil {
+		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if !d.Allowed {
+		return nil, apperr.Retry("rate_limited", "too many codes entered, slow down", d.RetryAfter)
+	}
+
+	// Count the attempt before checking it, so concurrent guesses cannot all
+	// be checked before any is counted
+	attempts, err := s.tokens.CountCodeAttempt(ctx, email, "verify_email", time.Now().UTC().Add(magicLinkTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record attempt: %w", err)
+	}
+	if attempts > loginCodeMaxAttempt {
+		s.recordLogin(ctx, email, "code", ErrLoginCodeLocked)
+		return nil, ErrLoginCodeLocked
+	}
+
+	rec, err := s.tokens.ConsumeByCode(ctx, email, auth.HashLoginCode(s.cfg.EmailSecret, code), "verify_email")
+	if err == nil {
+		if err := s.tokens.ResetCodeAttempts(ctx, email, "verify_email"); err != nil {
+			pkg.Logger(ctx).Warn("code attempt reset failed", "err", err)
+		}
+		s.recordLogin(ctx, rec.Email, "code", nil)
+		return rec, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
 		return nil, err
 	}
-	if rec == nil {
-		return nil, errors.New("invalid or expired token")
+	if attempts == loginCodeMaxAttempt {
+		s.recordLogin(ctx, email, "code", ErrLoginCodeLocked)
+		return nil, ErrLoginCodeLocked
 	}
-	_ = s.DeleteToken(ctx, token)
-	return rec, nil
+	s.recordLogin(ctx, email, "code", ErrInvalidLoginCode)
+	return nil, ErrInvalidLoginCode
+}
 
+// VerifyEmailToken consumes a magic link token
+func (s *AuthService) VerifyEmailToken(ctx context.Context, token string) (*repository.TokenRecord, error) {
+	rec, err := s.tokens.Consume(ctx, auth.HashToken(token), "verify_email")
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			s.recordLogin(ctx, "", "magic_link", ErrInvalidOrExpiredLink)
+			return nil, ErrInvalidOrExpiredLink
+		}
+		return nil, err
+	}
+	s.recordLogin(ctx, rec.Email, "magic_link", nil)
+	return rec, nil
 }
 
 func (s *AuthService) GetUserByEmail(ctx context.Context, email string) (*repository.User, error) {
 	return s.users.FindByEmail(ctx, email)
 }
+
+// GetUserByID returns a user by hex ID, or nil if there is none
+func (s *AuthService) GetUserByID(ctx context.Context, id string) (*repository.User, error) {
+	return s.users.FindByID(ctx, id)
+}
 func (s *AuthService) SignupUser(ctx context.Context, email string) (*repository.User, error) {
 	// Create a new verified user
 	user, err := s.users.CreateUser(ctx, email)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		ActorID:    user.ID.Hex(),
+		ActorEmail: user.Email,
+		Action:     AuditSignup,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+	})
+	s.metrics.Signup("magic_link")
 
 	return user, nil
 }
 
-// GenerateAccessToken creates JWT for the given email
-func (s *AuthService) GenerateAccessToken(email, userID string) (string, error) {
-	return auth.GenerateAccessToken(s.cfg.AccessSecret, email, userID, 24*time.Hour)
+// Lifetimes of the step-up tokens issued between the first and second factor
+const (
+	mfaPendingTTL = 5 * time.Minute
+	mfaEnrollTTL  = 15 * time.Minute
+)
+
+// Sign-in steps returned by SignIn when an access token cannot be issued yet
+const (
+	SignInMFARequired = "mfa_required" // submit a TOTP or recovery code to /auth/mfa/verify
+	SignInMFAEnroll   = "mfa_enroll"   // workspace requires MFA; enrol before continuing
+)
+
+var ErrInvalidStepToken = apperr.New(apperr.Unauthorized, "invalid_mfa_token", "invalid or expired mfa token")
+
+// GenerateAccessToken creates a JWT for the user, scoped to the workspace of the
+// given membership. mfa records whether the session completed a second factor.
+func (s *AuthService) GenerateAccessToken(ctx context.Context, user *repository.User, member *repository.Membership, mfa bool) (string, error) {
+	if user.DisabledAt != nil {
+		return "", ErrAccountDisabled
+	}
+	token, err := auth.GenerateAccessToken(s.cfg.AccessSecret, auth.JWTClaims{
+		Email:       user.Email,
+		UserID:      user.ID.Hex(),
+		WorkspaceID: member.WorkspaceID.Hex(),
+		Role:        member.Role,
+		MFA:         mfa,
+		SysRole:     user.SysRole,
+		SessionGen:  user.SessionGen,
+	}, 24*time.Hour)
+	if err == nil {
+		s.recordTokenIssued(ctx, user, member, "access", mfa)
+	}
+	return token, err
 }
-func (s *AuthService) DeleteToken(ctx context.Context, token string) error {
-	// Optional: add any business logic here, e.g., logging
-	if token == "" {
-		return errors.New("token cannot be empty")
+
+// recordTokenIssued audits a JWT issued to a user for a workspace
+func (s *AuthService) recordTokenIssued(ctx context.Context, user *repository.User, member *repository.Membership, tokenType string, mfa bool) {
+	wsID := member.WorkspaceID
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &wsID,
+		ActorID:     user.ID.Hex(),
+		ActorEmail:  user.Email,
+		Action:      AuditTokenIssued,
+		TargetType:  "user",
+		TargetID:    user.ID.Hex(),
+		Metadata:    map[string]any{"type": tokenType, "role": member.Role, "mfa": mfa},
+	})
+}
+
+// SignIn issues the token that follows a successful first factor. Users with
+// MFA get an mfa_pending token; members of a workspace that requires MFA who
+// have not enrolled get an mfa_enroll token. step is empty for an access token.
+func (s *AuthService) SignIn(ctx context.Context, user *repository.User, ws *repository.Workspace, member *repository.Membership) (token, step string, err error) {
+	switch {
+	case user.DisabledAt != nil:
+		return "", "", ErrAccountDisabled
+	case user.MFAEnabled:
+		token, err = s.generateStepToken(ctx, user, member, auth.TokenTypeMFAPending, mfaPendingTTL)
+		return token, SignInMFARequired, err
+	case ws.RequireMFA:
+		token, err = s.generateStepToken(ctx, user, member, auth.TokenTypeMFAEnroll, mfaEnrollTTL)
+		return token, SignInMFAEnroll, err
+	default:
+		token, err = s.GenerateAccessToken(ctx, user, member, false)
+		return token, "", err
+	}
+}
+
+func (s *AuthService) generateStepToken(ctx context.Context, user *repository.User, member *repository.Membership, tokenType string, ttl time.Duration) (string, error) {
+	token, err := auth.GenerateAccessToken(s.cfg.AccessSecret, auth.JWTClaims{
+		Email:       user.Email,
+		UserID:      user.ID.Hex(),
+		WorkspaceID: member.WorkspaceID.Hex(),
+		Role:        member.Role,
+		TokenType:   tokenType,
+		SessionGen:  user.SessionGen,
+	}, ttl)
+	if err == nil {
+		s.recordTokenIssued(ctx, user, member, tokenType, false)
 	}
+	return token, err
+}
 
-	if err := s.tokens.Delete(ctx, token); err != nil {
-		return fmt.Errorf("failed to delete token: %w", err)
+// ParseMFAPendingToken validates an mfa_pending token
+func (s *AuthService) ParseMFAPendingToken(token string) (*auth.JWTClaims, error) {
+	claims, err := auth.ParseToken(s.cfg.AccessSecret, token)
+	if err != nil || claims.TokenType != auth.TokenTypeMFAPending {
+		return nil, ErrInvalidStepToken
 	}
+	return claims, nil
+}
 
-	return nil
+// RecordOAuthLogin audits a sign-in verified by an OAuth provider
+func (s *AuthService) RecordOAuthLogin(ctx context.Context, email, provider string) {
+	s.recordLogin(ctx, email, provider, nil)
 }
+
 func (s *AuthService) SignupOAuthUser(ctx context.Context, email, provider, providerID string) (*repository.User, error) {
 	user, err := s.users.UpsertOAuthUser(ctx, email, provider, providerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to signup OAuth user: %w", err)
 	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		ActorID:    user.ID.Hex(),
+		ActorEmail: user.Email,
+		Action:     AuditOAuthSignup,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Metadata:   map[string]any{"provider": provider},
+	})
+	s.metrics.Signup(provider)
 
 	return user, nil
 }
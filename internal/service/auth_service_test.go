@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/mongotest"
+	"auth-microservice/internal/ratelimit"
+	"auth-microservice/internal/repository"
+)
+
+func TestParseMFAPendingToken(t *testing.T) {
+	const secret = "test-secret"
+	s := NewAuthService(nil, nil, nil, nil, nil, nil, nil, &config.Config{AccessSecret: secret})
+	sign := func(key, tokenType string, ttl time.Duration) string {
+		token, err := auth.GenerateAccessToken(key, auth.JWTClaims{UserID: "u1", WorkspaceID: "ws1", TokenType: tokenType}, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"mfa_pending", sign(secret, auth.TokenTypeMFAPending, mfaPendingTTL), true},
+		{"access token", sign(secret, "", time.Hour), false},
+		{"mfa_enroll", sign(secret, auth.TokenTypeMFAEnroll, mfaEnrollTTL), false},
+		{"expired", sign(secret, auth.TokenTypeMFAPending, -time.Minute), false},
+		{"other key", sign("other-secret", auth.TokenTypeMFAPending, mfaPendingTTL), false},
+		{"garbage", "not-a-token", false},
+	}
+	for _, tt := range tests {
+		claims, err := s.ParseMFAPendingToken(tt.token)
+		if tt.ok {
+			if err != nil || claims.UserID != "u1" || claims.WorkspaceID != "ws1" {
+				t.Errorf("%s: claims %+v, err %v", tt.name, claims, err)
+			}
+		} else if !errors.Is(err, ErrInvalidStepToken) {
+			t.Errorf("%s: err %v, want ErrInvalidStepToken", tt.name, err)
+		}
+	}
+}
+
+// newCodeAuthService returns an AuthService over a scratch database, with a
+// helper that stores a sign-in link with the given code
+func newCodeAuthService(t *testing.T, perMinute int) (*AuthService, func(email, code string)) {
+	t.Helper()
+	db := mongotest.Database(t)
+	tokens := repository.NewTokenRepo(db, "tokens")
+	cfg := &config.Config{EmailSecret: "test-secret", LoginCodePerEmailMinute: perMinute}
+	s := NewAuthService(nil, tokens, nil, nil, NewAuditService(repository.NewAuditRepo(db, "audit")), nil,
+		ratelimit.New(ratelimit.NewMemoryStore()), cfg)
+	send := func(email, code string) {
+		_, hash, err := auth.GenerateToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tokens.Create(context.Background(), &repository.TokenRecord{
+			TokenHash: hash,
+			Email:     email,
+			Purpose:   "verify_email",
+			CodeHash:  auth.HashLoginCode(cfg.EmailSecret, code),
+			ExpiresAt: time.Now().UTC().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, send
+}
+
+func TestVerifyLoginCode(t *testing.T) {
+	s, send := newCodeAuthService(t, 100)
+	ctx := context.Background()
+
+	send("code@example.com", "111111")
+	if _, err := s.VerifyLoginCode(ctx, "code@example.com", "000000"); !errors.Is(err, ErrInvalidLoginCode) {
+		t.Fatalf("wrong code: err %v, want ErrInvalidLoginCode", err)
+	}
+	if rec, err := s.VerifyLoginCode(ctx, "Code@Example.com", "111111"); err != nil || rec.Email != "code@example.com" {
+		t.Fatalf("right code: %+v, %v", rec, err)
+	}
+	if _, err := s.VerifyLoginCode(ctx, "code@example.com", "111111"); !errors.Is(err, ErrInvalidLoginCode) {
+		t.Fatalf("used code: err %v, want ErrInvalidLoginCode", err)
+	}
+
+	// A code that worked clears the count, so the next sign-in gets every attempt
+	send("code@example.com", "222222")
+	for i := 0; i < loginCodeMaxAttempt-1; i++ {
+		if _, err := s.VerifyLoginCode(ctx, "code@example.com", "000000"); !errors.Is(err, ErrInvalidLoginCode) {
+			t.Fatalf("wrong code %d: err %v, want ErrInvalidLoginCode", i+1, err)
+		}
+	}
+	if _, err := s.VerifyLoginCode(ctx, "code@example.com", "222222"); err != nil {
+		t.Fatalf("right code on the last attempt: %v", err)
+	}
+}
+
+func TestVerifyLoginCodeConcurrentGuesses(t *testing.T) {
+	s, send := newCodeAuthService(t, 1000)
+	ctx := context.Background()
+	const guesses = 50
+	send("race@example.com", "123456")
+	send("race@example.com", "654321")
+
+	var (
+		wg             sync.WaitGroup
+		mu             sync.Mutex
+		invalid, other int
+	)
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.VerifyLoginCode(ctx, "race@example.com", fmt.Sprintf("%06d", 200000+i))
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ErrInvalidLoginCode):
+				invalid++
+			case !errors.Is(err, ErrLoginCodeLocked):
+				other++
+				t.Errorf("guess %d: err %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Only loginCodeMaxAttempt guesses were checked; the last of them reports the lock
+	if invalid != loginCodeMaxAttempt-1 {
+		t.Errorf("%d guesses were checked and wrong, want %d", invalid, loginCodeMaxAttempt-1)
+	}
+	for _, code := range []string{"123456", "654321"} {
+		if _, err := s.VerifyLoginCode(ctx, "race@example.com", code); !errors.Is(err, ErrLoginCodeLocked) {
+			t.Errorf("right code %s after the guesses: err %v, want ErrLoginCodeLocked", code, err)
+		}
+	}
+	// A new code does not reset the count
+	send("race@example.com", "111111")
+	if _, err := s.VerifyLoginCode(ctx, "race@example.com", "111111"); !errors.Is(err, ErrLoginCodeLocked) {
+		t.Errorf("new code after the lock: err %v, want ErrLoginCodeLocked", err)
+	}
+}
+
+func TestVerifyLoginCodeRateLimit(t *testing.T) {
+	s, send := newCodeAuthService(t, 2)
+	ctx := context.Background()
+	send("slow@example.com", "111111")
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.VerifyLoginCode(ctx, "slow@example.com", "000000"); !errors.Is(err, ErrInvalidLoginCode) {
+			t.Fatalf("guess %d: err %v, want ErrInvalidLoginCode", i+1, err)
+		}
+	}
+	_, err := s.VerifyLoginCode(ctx, "SLOW@example.com", "111111")
+	var ae *apperr.Error
+	if !errors.As(err, &ae) || ae.Code != "rate_limited" || ae.RetryAfter <= 0 {
+		t.Fatalf("third guess within the minute: err %v, want rate_limited", err)
+	}
+	// Other addresses have their own allowance
+	send("other@example.com", "333333")
+	if _, err := s.VerifyLoginCode(ctx, "other@example.com", "333333"); err != nil {
+		t.Fatalf("another address: %v", err)
+	}
+}
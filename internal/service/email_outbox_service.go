@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/mailer"
+	"auth-microservice/internal/metrics"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidEmailFilter = apperr.New(apperr.Validation, "invalid_email_filter", "invalid email filter")
+
+const (
+	outboxPollInterval = 5 * time.Second
+	outboxSendLease    = time.Minute // a claimed email is retried if its sender dies
+	outboxBaseBackoff  = 30 * time.Second
+	outboxMaxBackoff   = 2 * time.Hour
+	outboxListLimit    = 100
+)
+
+// EmailOutboxService queues email durably and delivers it in the background.
+// Send makes it a mailer.Mailer, so callers return as soon as the email is stored.
+type EmailOutboxService struct {
+	outbox      *repository.EmailOutboxRepo
+	transport   mailer.Mailer
+	maxAttempts int
+	metrics     *metrics.Metrics
+	wake        chan struct{}
+}
+
+func NewEmailOutboxService(o *repository.EmailOutboxRepo, transport mailer.Mailer, maxAttempts int, m *metrics.Metrics) *EmailOutboxService {
+	return &EmailOutboxService{outbox: o, transport: transport, maxAttempts: maxAttempts, metrics: m, wake: make(chan struct{}, 1)}
+}
+
+// Send queues msg. A message whose idempotency key was already queued is not queued again.
+func (s *EmailOutboxService) Send(ctx context.Context, msg mailer.Message) error {
+	key := msg.IdempotencyKey
+	if key == "" {
+		_, hash, err := auth.GenerateToken()
+		if err != nil {
+			return err
+		}
+		key = "auto:" + hash
+	}
+
+	e := &repository.OutboxEmail{
+		IdempotencyKey: key,
+		Template:       msg.Template,
+		To:             msg.To,
+		Subject:        msg.Subject,
+		Text:           msg.Text,
+		HTML:           msg.HTML,
+	}
+	if oid, err := primitive.ObjectIDFromHex(msg.WorkspaceID); err == nil {
+		e.WorkspaceID = &oid
+	}
+
+	created, err := s.outbox.Enqueue(ctx, e)
+	if err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+	if created {
+		// wake the sender so the email goes out now rather than at the next poll
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Run delivers queued email until ctx is cancelled
+func (s *EmailOutboxService) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// deliverDue sends every email that is due
+func (s *EmailOutboxService) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		e, err := s.outbox.ClaimDue(ctx, outboxSendLease)
+		if err != nil {
+			pkg.Logger(ctx).Error("email outbox claim failed", "err", err)
+			return
+		}
+		if e == nil {
+			return
+		}
+		s.deliver(ctx, e)
+	}
+}
+
+func (s *EmailOutboxService) deliver(ctx context.Context, e *repository.OutboxEmail) {
+	// a claimed email is finished even during shutdown, so it is not sent twice
+	ctx = context.WithoutCancel(ctx)
+	sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	err := s.transport.Send(sendCtx, mailer.Message{
+		To:       e.To,
+		Subject:  e.Subject,
+		Text:     e.Text,
+		HTML:     e.HTML,
+		Template: e.Template,
+	})
+	cancel()
+
+	log := pkg.Logger(ctx).With("email_id", e.ID.Hex(), "to", e.To)
+	switch {
+	case err == nil:
+		s.metrics.EmailDelivery("sent")
+		err = s.outbox.MarkSent(ctx, e.ID)
+	case e.Attempts >= s.maxAttempts:
+		s.metrics.EmailDelivery("dead")
+		log.Error("email dead-lettered", "attempts", e.Attempts, "err", err)
+		err = s.outbox.MarkDead(ctx, e.ID, err.Error())
+	default:
+		s.metrics.EmailDelivery("retry")
+		log.Warn("email delivery failed", "attempt", e.Attempts, "err", err)
+		err = s.outbox.MarkRetry(ctx, e.ID, time.Now().UTC().Add(outboxBackoff(e.Attempts)), err.Error())
+	}
+	if err != nil {
+		log.Error("email outbox update failed", "err", err)
+	}
+}
+
+// outboxBackoff returns the delay before retry number attempt+1: exponential
+// from outboxBaseBackoff, capped at outboxMaxBackoff, with up to 20% jitter
+func outboxBackoff(attempt int) time.Duration {
+	d := outboxBaseBackoff
+	for i := 1; i < attempt && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > outboxMaxBackoff {
+		d = outboxMaxBackoff
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+// OutboxStatus is the delivery state of a workspace's email
+type OutboxStatus struct {
+	Counts map[string]int64         `json:"counts"`
+	Emails []repository.OutboxEmail `json:"emails"`
+}
+
+// NoWorkspace selects, in SystemStatus, the email sent for no workspace:
+// sign-in codes, magic links and account notices
+const NoWorkspace = "none"
+
+// WorkspaceStatus lists a workspace's recent email, optionally filtered by
+// status or recipient, with counts per status
+func (s *EmailOutboxService) WorkspaceStatus(ctx context.Context, workspaceID, status, to string) (*OutboxStatus, error) {
+	oid, err := primitive.ObjectIDFromHex(workspaceID)
+	if err != nil {
+		return nil, ErrNotMember
+	}
+	return s.status(ctx, repository.OutboxFilter{WorkspaceID: &oid}, status, to)
+}
+
+// SystemStatus lists recent email across the platform for operators, with
+// counts per status. workspace narrows it to one workspace's email, or to
+// email sent for no workspace when it is NoWorkspace.
+func (s *EmailOutboxService) SystemStatus(ctx context.Context, workspace, status, to string) (*OutboxStatus, error) {
+	var scope repository.OutboxFilter
+	switch workspace {
+	case "":
+	case NoWorkspace:
+		scope.NoWorkspace = true
+	default:
+		oid, err := primitive.ObjectIDFromHex(workspace)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid workspace %q", ErrInvalidEmailFilter, workspace)
+		}
+		scope.WorkspaceID = &oid
+	}
+	return s.status(ctx, scope, status, to)
+}
+
+// status lists the email in scope matching status and to, and counts the
+// email in scope by status
+func (s *EmailOutboxService) status(ctx context.Context, scope repository.OutboxFilter, status, to string) (*OutboxStatus, error) {
+	switch status {
+	case "", repository.EmailQueued, repository.EmailSending, repository.EmailSent, repository.EmailDead:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidEmailFilter, status)
+	}
+
+	filter := scope
+	filter.Status, filter.To = status, to
+	emails, err := s.outbox.List(ctx, filter, outboxListLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list emails: %w", err)
+	}
+	counts, err := s.outbox.CountByStatus(ctx, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count emails: %w", err)
+	}
+	return &OutboxStatus{Counts: counts, Emails: emails}, nil
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/mailer"
+	"auth-microservice/internal/metrics"
+	"auth-microservice/internal/mongotest"
+	"auth-microservice/internal/repository"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{9, 2 * time.Hour}, // 30s doubled eight times is past the cap
+		{50, 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		seen := map[time.Duration]bool{}
+		for i := 0; i < 50; i++ {
+			d := outboxBackoff(tt.attempt)
+			if d < tt.base || d > tt.base+tt.base/5 {
+				t.Fatalf("attempt %d: backoff %v outside %v plus 20%%", tt.attempt, d, tt.base)
+			}
+			seen[d] = true
+		}
+		// Jitter spreads senders that failed together
+		if len(seen) < 2 {
+			t.Errorf("attempt %d: 50 backoffs were all %v", tt.attempt, outboxBackoff(tt.attempt))
+		}
+	}
+}
+
+// flakyTransport fails the first fails sends and records the rest
+type flakyTransport struct {
+	mu    sync.Mutex
+	fails int
+	sent  []mailer.Message
+}
+
+func (f *flakyTransport) Send(_ context.Context, msg mailer.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fails > 0 {
+		f.fails--
+		return errors.New("connection refused")
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+// outboxFixture is an outbox service over a scratch database
+type outboxFixture struct {
+	svc       *EmailOutboxService
+	col       *mongo.Collection
+	transport *flakyTransport
+	reg       *prometheus.Registry
+}
+
+func newOutboxFixture(t *testing.T, maxAttempts int) *outboxFixture {
+	t.Helper()
+	db := mongotest.Database(t)
+	f := &outboxFixture{col: db.Collection("email_outbox"), transport: &flakyTransport{}, reg: prometheus.NewRegistry()}
+	_, err := f.col.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.M{"idempotency_key": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.svc = NewEmailOutboxService(repository.NewEmailOutboxRepo(db, "email_outbox"), f.transport, maxAttempts, metrics.New(f.reg))
+	return f
+}
+
+// email returns the one queued email addressed to to
+func (f *outboxFixture) email(t *testing.T, to string) repository.OutboxEmail {
+	t.Helper()
+	var e repository.OutboxEmail
+	if err := f.col.FindOne(context.Background(), bson.M{"to": to}).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// makeDue brings an email's next attempt forward to now
+func (f *outboxFixture) makeDue(t *testing.T, id primitive.ObjectID) {
+	t.Helper()
+	if _, err := f.col.UpdateByID(context.Background(), id, bson.M{"$set": bson.M{"next_attempt_at": time.Now().UTC()}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutboxSendIdempotency(t *testing.T) {
+	f := newOutboxFixture(t, 3)
+	ctx := context.Background()
+
+	msg := mailer.Message{To: "a@example.com", Subject: "Join acme", Text: "link", IdempotencyKey: "workspace_invite:abc"}
+	for i := 0; i < 2; i++ {
+		if err := f.svc.Send(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Messages without a key are never merged
+	for i := 0; i < 2; i++ {
+		if err := f.svc.Send(ctx, mailer.Message{To: "b@example.com", Subject: "Sign in"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for to, want := range map[string]int64{"a@example.com": 1, "b@example.com": 2} {
+		n, err := f.col.CountDocuments(ctx, bson.M{"to": to})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("%s: %d emails queued, want %d", to, n, want)
+		}
+	}
+
+	f.svc.deliverDue(ctx)
+	if len(f.transport.sent) != 3 {
+		t.Errorf("delivered %d emails, want 3", len(f.transport.sent))
+	}
+}
+
+func TestOutboxRetryAndDeadLetter(t *testing.T) {
+	f := newOutboxFixture(t, 3)
+	ctx := context.Background()
+	f.transport.fails = 3
+
+	ws := primitive.NewObjectID()
+	if err := f.svc.Send(ctx, mailer.Message{To: "a@example.com", Subject: "Join acme", Text: "link", HTML: "<a>link</a>", WorkspaceID: ws.Hex()}); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt < 3; attempt++ {
+		before := time.Now().UTC()
+		f.svc.deliverDue(ctx)
+		e := f.email(t, "a@example.com")
+		base := outboxBaseBackoff << (attempt - 1)
+		earliest, latest := before.Add(base).Truncate(time.Millisecond), time.Now().UTC().Add(base+base/5)
+		if e.Status != repository.EmailQueued || e.Attempts != attempt || e.LastError != "connection refused" ||
+			e.NextAttemptAt.Before(earliest) || e.NextAttemptAt.After(latest) {
+			t.Fatalf("after failed attempt %d: %+v", attempt, e)
+		}
+		// Nothing is due until the backoff passes
+		f.svc.deliverDue(ctx)
+		if e := f.email(t, "a@example.com"); e.Attempts != attempt {
+			t.Fatalf("retried during the backoff: %d attempts", e.Attempts)
+		}
+		f.makeDue(t, e.ID)
+	}
+
+	f.svc.deliverDue(ctx)
+	e := f.email(t, "a@example.com")
+	if e.Status != repository.EmailDead || e.Attempts != 3 || e.Text != "" || e.HTML != "" || e.WorkspaceID == nil || *e.WorkspaceID != ws {
+		t.Fatalf("after the last attempt: %+v, want dead-lettered without bodies", e)
+	}
+	f.makeDue(t, e.ID)
+	f.svc.deliverDue(ctx)
+	if len(f.transport.sent) != 0 || f.email(t, "a@example.com").Attempts != 3 {
+		t.Fatal("a dead-lettered email was tried again")
+	}
+
+	// The next email goes through and is counted as sent
+	if err := f.svc.Send(ctx, mailer.Message{To: "b@example.com", Subject: "Sign in", Text: "code"}); err != nil {
+		t.Fatal(err)
+	}
+	f.svc.deliverDue(ctx)
+	if got := f.email(t, "b@example.com"); got.Status != repository.EmailSent || got.SentAt == nil || got.Text != "" {
+		t.Errorf("delivered email %+v, want sent without bodies", got)
+	}
+	if len(f.transport.sent) != 1 || f.transport.sent[0].Subject != "Sign in" || f.transport.sent[0].Text != "code" {
+		t.Errorf("transport got %+v", f.transport.sent)
+	}
+
+	want := `
+# HELP email_deliveries_total Email delivery attempts by outcome (sent, retry or dead).
+# TYPE email_deliveries_total counter
+email_deliveries_total{outcome="dead"} 1
+email_deliveries_total{outcome="retry"} 2
+email_deliveries_total{outcome="sent"} 1
+`
+	if err := testutil.GatherAndCompare(f.reg, strings.NewReader(want), "email_deliveries_total"); err != nil {
+		t.Error(err)
+	}
+
+	status, err := f.svc.WorkspaceStatus(ctx, ws.Hex(), repository.EmailDead, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Emails) != 1 || status.Emails[0].LastError != "connection refused" || status.Counts[repository.EmailDead] != 1 || status.Counts[repository.EmailSent] != 0 {
+		t.Errorf("workspace status %+v", status)
+	}
+	if _, err := f.svc.WorkspaceStatus(ctx, ws.Hex(), "bounced", ""); !errors.Is(err, ErrInvalidEmailFilter) {
+		t.Errorf("unknown status filter: err %v, want ErrInvalidEmailFilter", err)
+	}
+}
+
+func TestOutboxSystemStatus(t *testing.T) {
+	f := newOutboxFixture(t, 1)
+	ctx := context.Background()
+	f.transport.fails = 2
+
+	// A sign-in code and a workspace invitation both dead-letter on their only attempt
+	ws := primitive.NewObjectID()
+	for _, msg := range []mailer.Message{
+		{To: "login@example.com", Subject: "Your code", Text: "123456", IdempotencyKey: "login_code:1"},
+		{To: "invitee@example.com", Subject: "Join acme", Text: "link", WorkspaceID: ws.Hex(), IdempotencyKey: "workspace_invite:1"},
+	} {
+		if err := f.svc.Send(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.svc.deliverDue(ctx)
+	if err := f.svc.Send(ctx, mailer.Message{To: "login@example.com", Subject: "Your code", Text: "654321", IdempotencyKey: "login_code:2"}); err != nil {
+		t.Fatal(err)
+	}
+	f.svc.deliverDue(ctx)
+
+	recipients := func(s *OutboxStatus) []string {
+		var to []string
+		for _, e := range s.Emails {
+			to = append(to, e.To)
+		}
+		slices.Sort(to)
+		return to
+	}
+	tests := []struct {
+		name, workspace, status, to string
+		want                        []string
+		dead, sent                  int64
+	}{
+		{"all dead letters", "", repository.EmailDead, "", []string{"invitee@example.com", "login@example.com"}, 2, 1},
+		{"mail of no workspace", NoWorkspace, "", "", []string{"login@example.com", "login@example.com"}, 1, 1},
+		{"dead mail of no workspace", NoWorkspace, repository.EmailDead, "", []string{"login@example.com"}, 1, 1},
+		{"one workspace", ws.Hex(), "", "", []string{"invitee@example.com"}, 1, 0},
+		{"one recipient", "", "", "invitee@example.com", []string{"invitee@example.com"}, 2, 1},
+	}
+	for _, tt := range tests {
+		status, err := f.svc.SystemStatus(ctx, tt.workspace, tt.status, tt.to)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := recipients(status); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: emails to %v, want %v", tt.name, got, tt.want)
+		}
+		// Counts cover the whole scope, whatever the status and recipient filters
+		if status.Counts[repository.EmailDead] != tt.dead || status.Counts[repository.EmailSent] != tt.sent {
+			t.Errorf("%s: counts %v, want %d dead and %d sent", tt.name, status.Counts, tt.dead, tt.sent)
+		}
+	}
+
+	// Workspace admins never see mail of no workspace
+	if status, err := f.svc.WorkspaceStatus(ctx, ws.Hex(), "", "login@example.com"); err != nil || len(status.Emails) != 0 {
+		t.Errorf("workspace status shows sign-in mail: %+v, %v", status, err)
+	}
+	for _, tt := range []struct{ workspace, status string }{{"acme", ""}, {"", "bounced"}} {
+		if _, err := f.svc.SystemStatus(ctx, tt.workspace, tt.status, ""); !errors.Is(err, ErrInvalidEmailFilter) {
+			t.Errorf("workspace %q status %q: err %v, want ErrInvalidEmailFilter", tt.workspace, tt.status, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/metrics"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errLLM reports a failed or unusable LLM response as an upstream error.
+// Errors that already carry a client-facing meaning, such as a spent budget,
+// pass through.
+func errLLM(err error) error {
+	var e *apperr.Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return apperr.Wrap(apperr.Upstream, "llm_failed", "the language model request failed", err)
+}
+
+// llmProvider labels metrics for calls made through the OpenAI client
+const llmProvider = "openai"
+
+var tracer = otel.Tracer("auth-microservice/internal/service")
+
+// chatCompletion sends req in a span named after purpose, logs the call's
+// model, latency and token usage, and records it in m and usage. Once the
+// workspace in ctx has spent its budget the call is not made.
+func chatCompletion(ctx context.Context, client *openai.Client, m *metrics.Metrics, usage *LLMUsageService, purpose string, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	workspaceID, _ := pkg.GetWorkspaceIDFromContext(ctx)
+	if err := usage.CheckBudget(ctx, workspaceID); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	ctx, span := tracer.Start(ctx, "llm "+purpose, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.GenAISystemOpenAI,
+		semconv.GenAIOperationNameChat,
+		semconv.GenAIRequestModel(req.Model),
+	))
+	defer span.End()
+
+	start := time.Now()
+	resp, err := client.CreateChatCompletion(ctx, req)
+	latency := time.Since(start)
+	m.ObserveLLMCall(llmProvider, req.Model, latency, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, err)
+	usage.Record(ctx, repository.LLMCall{
+		Purpose:          purpose,
+		Provider:         llmProvider,
+		Model:            req.Model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		Failed:           err != nil,
+		Latency:          latency,
+	})
+
+	log := pkg.Logger(ctx).With(
+		"purpose", purpose,
+		"provider", llmProvider,
+		"model", req.Model,
+		"latency_ms", float64(latency.Microseconds())/1000,
+	)
+	if err != nil {
+		log.Warn("llm call failed", "err", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+	span.SetAttributes(
+		semconv.GenAIUsageInputTokens(resp.Usage.PromptTokens),
+		semconv.GenAIUsageOutputTokens(resp.Usage.CompletionTokens),
+	)
+	log.Info("llm call",
+		"prompt_tokens", resp.Usage.PromptTokens,
+		"completion_tokens", resp.Usage.CompletionTokens,
+		"total_tokens", resp.Usage.TotalTokens,
+	)
+	return resp, nil
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"auth-microservice/internal/metrics"
+	"auth-microservice/internal/pkg"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	spansOnce sync.Once
+	spans     = tracetest.NewInMemoryExporter()
+)
+
+// recordSpans installs a global tracer provider exporting to an in-memory
+// exporter, emptied for each test. The package tracer only delegates to the
+// first provider installed, so it is installed once.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	spansOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+	})
+	spans.Reset()
+	return spans
+}
+
+// fakeOpenAI serves one canned chat completion response
+func fakeOpenAI(t *testing.T, status int, body string) *openai.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := openai.DefaultConfig("test-key")
+	cfg.BaseURL = srv.URL + "/v1"
+	return openai.NewClientWithConfig(cfg)
+}
+
+func spanAttrs(s tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestChatCompletionSpan(t *testing.T) {
+	exporter := recordSpans(t)
+	client := fakeOpenAI(t, http.StatusOK, `{
+		"id": "chatcmpl-1", "object": "chat.completion", "model": "gpt-4o-mini",
+		"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 12, "completion_tokens": 34, "total_tokens": 46}
+	}`)
+
+	_, err := chatCompletion(context.Background(), client, nil, nil, LLMPurposeAnalysis, openai.ChatCompletionRequest{
+		Model:    "gpt-4o-mini",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+	})
+	if err != nil {
+		t.Fatalf("chatCompletion: %v", err)
+	}
+
+	got := exporter.GetSpans()
+	if len(got) != 1 {
+		t.Fatalf("got %d spans, want 1", len(got))
+	}
+	span := got[0]
+	if span.Name != "llm analysis" {
+		t.Errorf("span name %q, want %q", span.Name, "llm analysis")
+	}
+	if span.SpanKind != trace.SpanKindClient {
+		t.Errorf("span kind %v, want client", span.SpanKind)
+	}
+	if span.Status.Code == codes.Error {
+		t.Errorf("span status error: %s", span.Status.Description)
+	}
+
+	attrs := spanAttrs(span)
+	want := map[attribute.Key]attribute.Value{
+		"gen_ai.system":              attribute.StringValue("openai"),
+		"gen_ai.operation.name":      attribute.StringValue("chat"),
+		"gen_ai.request.model":       attribute.StringValue("gpt-4o-mini"),
+		"gen_ai.usage.input_tokens":  attribute.IntValue(12),
+		"gen_ai.usage.output_tokens": attribute.IntValue(34),
+	}
+	for k, v := range want {
+		if attrs[k] != v {
+			t.Errorf("attribute %s = %v, want %v", k, attrs[k].Emit(), v.Emit())
+		}
+	}
+}
+
+func TestChatCompletionSpanRecordsFailure(t *testing.T) {
+	exporter := recordSpans(t)
+	client := fakeOpenAI(t, http.StatusInternalServerError, `{"error": {"message": "boom", "type": "server_error"}}`)
+
+	_, err := chatCompletion(context.Background(), client, nil, nil, LLMPurposeCompetitorGeneration, openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+	})
+	if err == nil {
+		t.Fatal("chatCompletion succeeded, want an error")
+	}
+
+	got := exporter.GetSpans()
+	if len(got) != 1 {
+		t.Fatalf("got %d spans, want 1", len(got))
+	}
+	span := got[0]
+	if span.Name != "llm competitor_generation" {
+		t.Errorf("span name %q, want %q", span.Name, "llm competitor_generation")
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("span status %v, want error", span.Status.Code)
+	}
+	if _, ok := spanAttrs(span)["gen_ai.usage.input_tokens"]; ok {
+		t.Error("failed call has token usage attributes")
+	}
+	if len(span.Events) == 0 || span.Events[0].Name != "exception" {
+		t.Error("failed call has no exception event")
+	}
+}
+
+func TestChatCompletionLogsAndMetrics(t *testing.T) {
+	recordSpans(t)
+	ok := fakeOpenAI(t, http.StatusOK, `{
+		"id": "chatcmpl-1", "object": "chat.completion", "model": "gpt-4o-mini",
+		"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 12, "completion_tokens": 34, "total_tokens": 46}
+	}`)
+	failing := fakeOpenAI(t, http.StatusInternalServerError, `{"error": {"message": "boom", "type": "server_error"}}`)
+
+	var logs bytes.Buffer
+	ctx := pkg.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(&logs, nil)).With("request_id", "req-1"))
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+	req := openai.ChatCompletionRequest{
+		Model:    "gpt-4o-mini",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+	}
+	if _, err := chatCompletion(ctx, ok, m, nil, LLMPurposeAnalysis, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chatCompletion(ctx, failing, m, nil, LLMPurposeAnalysis, req); err == nil {
+		t.Fatal("chatCompletion succeeded, want an error")
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(lines), logs.String())
+	}
+	want := []map[string]any{
+		{"level": "INFO", "msg": "llm call", "prompt_tokens": 12.0, "completion_tokens": 34.0, "total_tokens": 46.0},
+		{"level": "WARN", "msg": "llm call failed"},
+	}
+	for i, line := range lines {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range map[string]any{"request_id": "req-1", "purpose": "analysis", "provider": "openai", "model": "gpt-4o-mini"} {
+			want[i][k] = v
+		}
+		for k, v := range want[i] {
+			if entry[k] != v {
+				t.Errorf("line %d: %s = %v, want %v", i, k, entry[k], v)
+			}
+		}
+		if _, ok := entry["latency_ms"].(float64); !ok {
+			t.Errorf("line %d: no latency_ms", i)
+		}
+	}
+	var failed map[string]any
+	_ = json.Unmarshal([]byte(lines[1]), &failed)
+	if failed["err"] == nil || failed["prompt_tokens"] != nil {
+		t.Errorf("failed call logged %v, want the error and no token counts", failed)
+	}
+
+	wantMetrics := `
+# HELP llm_calls_total LLM calls by provider, model and outcome (ok or error).
+# TYPE llm_calls_total counter
+llm_calls_total{model="gpt-4o-mini",outcome="error",provider="openai"} 1
+llm_calls_total{model="gpt-4o-mini",outcome="ok",provider="openai"} 1
+# HELP llm_tokens_total LLM tokens used by provider, model and type (prompt or completion).
+# TYPE llm_tokens_total counter
+llm_tokens_total{model="gpt-4o-mini",provider="openai",type="completion"} 34
+llm_tokens_total{model="gpt-4o-mini",provider="openai",type="prompt"} 12
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(wantMetrics), "llm_calls_total", "llm_tokens_total"); err != nil {
+		t.Error(err)
+	}
+}
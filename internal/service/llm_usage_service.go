@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+)
+
+// LLM call purposes, recorded with every call
+const (
+	LLMPurposePromptGeneration     = "prompt_generation"
+	LLMPurposeCompetitorGeneration = "competitor_generation"
+	LLMPurposeAnalysis             = "analysis" // answering a tracked prompt so the answer can be analysed
+)
+
+const (
+	llmTopSpenders     = 50
+	llmRecordTimeout   = 5 * time.Second
+	llmBudgetErrorCode = "llm_budget_exceeded"
+)
+
+// llmUsageStore keeps LLM calls and their daily rollups;
+// *repository.LLMUsageRepo is one
+type llmUsageStore interface {
+	Record(ctx context.Context, c *repository.LLMCall) error
+	Spend(ctx context.Context, workspaceID string, since time.Time) (float64, error)
+	Daily(ctx context.Context, workspaceID string, from, to time.Time) ([]repository.LLMUsageRow, error)
+	TopUsers(ctx context.Context, workspaceID string, from, to time.Time, limit int) ([]repository.LLMSpendTotal, error)
+	TopWorkspaces(ctx context.Context, from, to time.Time, limit int) ([]repository.LLMSpendTotal, error)
+}
+
+// LLMUsageService records the tokens and cost of every LLM call, reports
+// spend, and stops calls once a budget is spent. A nil service records
+// nothing and enforces no budget.
+type LLMUsageService struct {
+	repo       llmUsageStore
+	workspaces workspaceFinder
+	cfg        *config.Config
+	now        func() time.Time
+}
+
+func NewLLMUsageService(repo *repository.LLMUsageRepo, w *repository.WorkspaceRepo, cfg *config.Config) *LLMUsageService {
+	return &LLMUsageService{repo: repo, workspaces: w, cfg: cfg, now: time.Now}
+}
+
+// Cost prices a call from the configured price table; unpriced models cost 0
+func (s *LLMUsageService) Cost(model string, promptTokens, completionTokens int) float64 {
+	price := s.cfg.LLMPrices[model]
+	return (float64(promptTokens)*price.InputPerMTok + float64(completionTokens)*price.OutputPerMTok) / 1e6
+}
+
+// Record stores a call, attributed to the user and workspace in ctx. It runs
+// even if the request was cancelled, and a failure is logged rather than
+// returned: the call has already been paid for.
+func (s *LLMUsageService) Record(ctx context.Context, c repository.LLMCall) {
+	if s == nil {
+		return
+	}
+	c.UserID, _ = pkg.GetUserIDFromContext(ctx)
+	c.WorkspaceID, _ = pkg.GetWorkspaceIDFromContext(ctx)
+	c.CostUSD = s.Cost(c.Model, c.PromptTokens, c.CompletionTokens)
+	c.At = s.now().UTC()
+	if _, ok := s.cfg.LLMPrices[c.Model]; !ok && c.PromptTokens+c.CompletionTokens > 0 {
+		pkg.Logger(ctx).Warn("no price for llm model; call recorded at no cost", "model", c.Model)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), llmRecordTimeout)
+	defer cancel()
+	if err := s.repo.Record(ctx, &c); err != nil {
+		pkg.Logger(ctx).Error("llm call not recorded", "purpose", c.Purpose, "model", c.Model, "err", err)
+	}
+}
+
+// CheckBudget refuses further calls once the platform's daily budget or the
+// workspace's monthly budget is spent. The error tells clients when the
+// budget period ends. If spend cannot be read the call is allowed.
+func (s *LLMUsageService) CheckBudget(ctx context.Context, workspaceID string) error {
+	if s == nil {
+		return nil
+	}
+	now := s.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if budget := s.cfg.LLMPlatformDailyBudgetUSD; budget > 0 {
+		spent, err := s.repo.Spend(ctx, "", day)
+		if err != nil {
+			pkg.Logger(ctx).Warn("llm budget check failed", "err", err)
+		} else if spent >= budget {
+			return apperr.Retry(llmBudgetErrorCode, "the service has reached its daily language model budget", day.AddDate(0, 0, 1).Sub(now))
+		}
+	}
+
+	if workspaceID == "" {
+		return nil
+	}
+	budget, err := s.budget(ctx, workspaceID)
+	if err != nil {
+		pkg.Logger(ctx).Warn("llm budget check failed", "workspace_id", workspaceID, "err", err)
+		return nil
+	}
+	if budget <= 0 {
+		return nil
+	}
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	spent, err := s.repo.Spend(ctx, workspaceID, month)
+	if err != nil {
+		pkg.Logger(ctx).Warn("llm budget check failed", "workspace_id", workspaceID, "err", err)
+		return nil
+	}
+	if spent >= budget {
+		return apperr.Retry(llmBudgetErrorCode,
+			fmt.Sprintf("this workspace has spent its monthly language model budget of $%.2f", budget),
+			month.AddDate(0, 1, 0).Sub(now))
+	}
+	return nil
+}
+
+// budget returns the workspace's monthly budget: its own, else the default
+func (s *LLMUsageService) budget(ctx context.Context, workspaceID string) (float64, error) {
+	ws, err := s.workspaces.FindByID(ctx, workspaceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch workspace: %w", err)
+	}
+	if ws == nil {
+		return 0, ErrWorkspaceNotFound
+	}
+	if ws.LLMBudgetUSD != nil {
+		return *ws.LLMBudgetUSD, nil
+	}
+	return s.cfg.LLMMonthlyBudgetUSD, nil
+}
+
+// Spend returns what a workspace's calls cost from the UTC day of since
+// onwards; an empty workspaceID sums every workspace
+func (s *LLMUsageService) Spend(ctx context.Context, workspaceID string, since time.Time) (float64, error) {
+	spend, err := s.repo.Spend(ctx, workspaceID, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read llm spend: %w", err)
+	}
+	return spend, nil
+}
+
+// LLMTotals sums LLM usage over a period
+type LLMTotals struct {
+	Calls            int64   `json:"calls"`
+	FailedCalls      int64   `json:"failed_calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func sumLLMUsage(rows []repository.LLMUsageRow) LLMTotals {
+	var t LLMTotals
+	for _, r := range rows {
+		t.Calls += r.Calls
+		t.FailedCalls += r.FailedCalls
+		t.PromptTokens += r.PromptTokens
+		t.CompletionTokens += r.CompletionTokens
+		t.CostUSD += r.CostUSD
+	}
+	return t
+}
+
+// LLMSpend is a workspace's LLM usage over the last days and its budget
+type LLMSpend struct {
+	Since  time.Time `json:"since"`
+	Totals LLMTotals `json:"totals"`
+	// BudgetUSD is the monthly budget, omitted when there is none
+	BudgetUSD      *float64                   `json:"budget_usd,omitempty"`
+	MonthToDateUSD float64                    `json:"month_to_date_usd"`
+	Daily          []repository.LLMUsageRow   `json:"daily"`
+	Users          []repository.LLMSpendTotal `json:"users"` // highest spend first
+}
+
+// WorkspaceSpend reports a workspace's LLM usage over the last days, per
+// day, purpose and model and per user
+func (s *LLMUsageService) WorkspaceSpend(ctx context.Context, workspaceID string, days int) (*LLMSpend, error) {
+	budget, err := s.budget(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(days - 1))
+	until := today.AddDate(0, 0, 1)
+
+	daily, err := s.repo.Daily(ctx, workspaceID, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read llm usage: %w", err)
+	}
+	users, err := s.repo.TopUsers(ctx, workspaceID, since, until, llmTopSpenders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read llm usage by user: %w", err)
+	}
+	monthToDate, err := s.repo.Spend(ctx, workspaceID, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read llm spend: %w", err)
+	}
+
+	spend := &LLMSpend{Since: since, Totals: sumLLMUsage(daily), MonthToDateUSD: monthToDate, Daily: daily, Users: users}
+	if budget > 0 {
+		spend.BudgetUSD = &budget
+	}
+	return spend, nil
+}
+
+// LLMOverview is platform-wide LLM usage for operators
+type LLMOverview struct {
+	Since  time.Time `json:"since"`
+	Totals LLMTotals `json:"totals"`
+	// DailyBudgetUSD is the platform's daily budget, omitted when there is none
+	DailyBudgetUSD *float64                   `json:"daily_budget_usd,omitempty"`
+	TodayUSD       float64                    `json:"today_usd"`
+	Daily          []repository.LLMUsageRow   `json:"daily"`
+	Workspaces     []repository.LLMSpendTotal `json:"workspaces"` // highest spend first
+}
+
+// Overview reports LLM usage across every workspace over the last days
+func (s *LLMUsageService) Overview(ctx context.Context, days int) (*LLMOverview, error) {
+	now := s.now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(days - 1))
+	until := today.AddDate(0, 0, 1)
+
+	daily, err := s.repo.Daily(ctx, "", since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read llm usage: %w", err)
+	}
+	workspaces, err := s.repo.TopWorkspaces(ctx, since, until, llmTopSpenders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read llm usage by workspace: %w", err)
+	}
+	todayUSD, err := s.repo.Spend(ctx, "", today)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read llm spend: %w", err)
+	}
+
+	overview := &LLMOverview{Since: since, Totals: sumLLMUsage(daily), TodayUSD: todayUSD, Daily: daily, Workspaces: workspaces}
+	if budget := s.cfg.LLMPlatformDailyBudgetUSD; budget > 0 {
+		overview.DailyBudgetUSD = &budget
+	}
+	return overview, nil
+}
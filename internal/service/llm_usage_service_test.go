@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/repository"
+)
+
+// fakeLLMUsage reports fixed spend per workspace ("" for the platform) and
+// remembers the period each Spend call asked for
+type fakeLLMUsage struct {
+	spend map[string]float64
+	since map[string]time.Time
+	err   error
+}
+
+func (f *fakeLLMUsage) Record(context.Context, *repository.LLMCall) error { return nil }
+
+func (f *fakeLLMUsage) Spend(_ context.Context, workspaceID string, since time.Time) (float64, error) {
+	if f.since == nil {
+		f.since = map[string]time.Time{}
+	}
+	f.since[workspaceID] = since
+	return f.spend[workspaceID], f.err
+}
+
+func (f *fakeLLMUsage) Daily(context.Context, string, time.Time, time.Time) ([]repository.LLMUsageRow, error) {
+	return nil, nil
+}
+
+func (f *fakeLLMUsage) TopUsers(context.Context, string, time.Time, time.Time, int) ([]repository.LLMSpendTotal, error) {
+	return nil, nil
+}
+
+func (f *fakeLLMUsage) TopWorkspaces(context.Context, time.Time, time.Time, int) ([]repository.LLMSpendTotal, error) {
+	return nil, nil
+}
+
+func TestLLMCost(t *testing.T) {
+	s := &LLMUsageService{cfg: &config.Config{LLMPrices: map[string]config.LLMPrice{
+		"gpt-4o-mini": {InputPerMTok: 0.15, OutputPerMTok: 0.60},
+		"gpt-4o":      {InputPerMTok: 2.50, OutputPerMTok: 10.00},
+	}}}
+
+	tests := []struct {
+		model              string
+		prompt, completion int
+		want               float64
+	}{
+		{"gpt-4o-mini", 1_000_000, 0, 0.15},
+		{"gpt-4o-mini", 0, 1_000_000, 0.60},
+		{"gpt-4o-mini", 2000, 500, 0.0006},
+		{"gpt-4o", 1000, 1000, 0.0125},
+		{"gpt-4o", 0, 0, 0},
+		{"unpriced-model", 1000, 1000, 0},
+	}
+	for _, tt := range tests {
+		if got := s.Cost(tt.model, tt.prompt, tt.completion); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("Cost(%s, %d, %d) = %v, want %v", tt.model, tt.prompt, tt.completion, got, tt.want)
+		}
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	now := time.Date(2026, 4, 20, 18, 0, 0, 0, time.UTC)
+	month := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	today := time.Date(2026, 4, 20, 0, 0, 0, 0, time.UTC)
+	own := 5.0
+	ws, custom := newTestWorkspace(""), newTestWorkspace("")
+	custom.LLMBudgetUSD = &own
+
+	tests := []struct {
+		name           string
+		workspace      *repository.Workspace
+		defaultBudget  float64
+		platformBudget float64
+		spend          map[string]float64
+		storeErr       error
+		wantErr        bool
+		wantRetry      time.Duration
+	}{
+		{name: "no budgets", workspace: ws, spend: map[string]float64{"": 1e6}},
+		{name: "under the default budget", workspace: ws, defaultBudget: 10, spend: map[string]float64{ws.ID.Hex(): 9.99}},
+		{name: "at the default budget", workspace: ws, defaultBudget: 10, spend: map[string]float64{ws.ID.Hex(): 10}, wantErr: true, wantRetry: 10*24*time.Hour + 6*time.Hour},
+		{name: "over the default budget", workspace: ws, defaultBudget: 10, spend: map[string]float64{ws.ID.Hex(): 12}, wantErr: true, wantRetry: 10*24*time.Hour + 6*time.Hour},
+		{name: "under its own budget", workspace: custom, defaultBudget: 1, spend: map[string]float64{custom.ID.Hex(): 4}},
+		{name: "at its own budget", workspace: custom, defaultBudget: 100, spend: map[string]float64{custom.ID.Hex(): 5}, wantErr: true, wantRetry: 10*24*time.Hour + 6*time.Hour},
+		{name: "under the platform budget", workspace: ws, platformBudget: 50, spend: map[string]float64{"": 49}},
+		{name: "at the platform budget", workspace: ws, platformBudget: 50, spend: map[string]float64{"": 50}, wantErr: true, wantRetry: 6 * time.Hour},
+		{name: "over the platform budget", workspace: ws, platformBudget: 50, spend: map[string]float64{"": 75}, wantErr: true, wantRetry: 6 * time.Hour},
+		{name: "spend unreadable", workspace: ws, defaultBudget: 10, platformBudget: 50, storeErr: errors.New("down"), spend: map[string]float64{"": 75, ws.ID.Hex(): 12}},
+	}
+	for _, tt := range tests {
+		store := &fakeLLMUsage{spend: tt.spend, err: tt.storeErr}
+		s := &LLMUsageService{
+			repo:       store,
+			workspaces: fakeWorkspaces{tt.workspace.ID.Hex(): tt.workspace},
+			cfg:        &config.Config{LLMMonthlyBudgetUSD: tt.defaultBudget, LLMPlatformDailyBudgetUSD: tt.platformBudget},
+			now:        func() time.Time { return now },
+		}
+
+		err := s.CheckBudget(context.Background(), tt.workspace.ID.Hex())
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			var e *apperr.Error
+			if !errors.As(err, &e) || e.Code != llmBudgetErrorCode || e.Kind != apperr.RateLimited {
+				t.Errorf("%s: err = %v, want %s", tt.name, err, llmBudgetErrorCode)
+			} else if e.RetryAfter != tt.wantRetry {
+				t.Errorf("%s: retry after %v, want %v", tt.name, e.RetryAfter, tt.wantRetry)
+			}
+		}
+
+		if since, ok := store.since[""]; ok && !since.Equal(today) {
+			t.Errorf("%s: platform spend read since %v, want the start of the day", tt.name, since)
+		}
+		if since, ok := store.since[tt.workspace.ID.Hex()]; ok && !since.Equal(month) {
+			t.Errorf("%s: workspace spend read since %v, want the start of the month", tt.name, since)
+		}
+	}
+}
+
+func TestCheckBudgetNilService(t *testing.T) {
+	var s *LLMUsageService
+	if err := s.CheckBudget(context.Background(), "any"); err != nil {
+		t.Errorf("nil service enforced a budget: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+)
+
+var (
+	ErrMFANotEnabled     = apperr.New(apperr.Conflict, "mfa_not_enabled", "two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled = apperr.New(apperr.Conflict, "mfa_already_enabled", "two-factor authentication is already enabled")
+	ErrMFANoPendingSetup = apperr.New(apperr.Conflict, "mfa_setup_not_started", "start two-factor setup first")
+	ErrInvalidMFACode    = apperr.New(apperr.Unauthorized, "invalid_mfa_code", "invalid two-factor code")
+	ErrMFALocked         = apperr.New(apperr.RateLimited, "mfa_locked", "too many failed two-factor attempts, try again later")
+)
+
+const (
+	recoveryCodeCount  = 10
+	mfaMaxAttempts     = 5
+	mfaLockoutDuration = 15 * time.Minute
+)
+
+type MFAService struct {
+	users *repository.UserRepo
+	audit *AuditService
+	cfg   *config.Config
+}
+
+func NewMFAService(u *repository.UserRepo, audit *AuditService, cfg *config.Config) *MFAService {
+	return &MFAService{users: u, audit: audit, cfg: cfg}
+}
+
+// record audits an MFA change or failure for the user
+func (s *MFAService) record(ctx context.Context, user *repository.User, action string, metadata map[string]any) {
+	s.audit.Record(ctx, repository.AuditEvent{
+		ActorID:    user.ID.Hex(),
+		ActorEmail: user.Email,
+		Action:     action,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Metadata:   metadata,
+	})
+}
+
+// Setup generates a new TOTP secret for the user and returns it with its
+// otpauth URI. It is not active until confirmed with Enable.
+func (s *MFAService) Setup(ctx context.Context, user *repository.User) (secret, uri string, err error) {
+	if user.MFAEnabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+	secret, err = auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.users.SetPendingMFASecret(ctx, user.ID, secret); err != nil {
+		return "", "", fmt.Errorf("failed to save mfa secret: %w", err)
+	}
+	return secret, auth.TOTPURI(s.cfg.MFAIssuer, user.Email, secret), nil
+}
+
+// Enable confirms the pending secret with a current code and returns the
+// recovery codes. They are shown once; only their hashes are stored.
+func (s *MFAService) Enable(ctx context.Context, user *repository.User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFA == nil || user.MFA.PendingSecret == "" {
+		return nil, ErrMFANoPendingSetup
+	}
+	step, ok := auth.ValidateTOTP(user.MFA.PendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.users.EnableMFA(ctx, user.ID, user.MFA.PendingSecret, step, hashes); err != nil {
+		return nil, fmt.Errorf("failed to enable mfa: %w", err)
+	}
+	s.record(ctx, user, AuditMFAEnabled, nil)
+	return codes, nil
+}
+
+// Verify checks a TOTP code, or a recovery code when code is empty. A
+// recovery code works once; repeated failures lock MFA for a while.
+func (s *MFAService) Verify(ctx context.Context, user *repository.User, code, recoveryCode string) error {
+	if !user.MFAEnabled || user.MFA == nil {
+		return ErrMFANotEnabled
+	}
+	now := time.Now().UTC()
+	if user.MFA.LockedUntil != nil && now.Before(*user.MFA.LockedUntil) {
+		return ErrMFALocked
+	}
+
+	// user was loaded before this request; the lock is checked again in the
+	// update that accepts the code, so parallel guesses cannot slip past it
+	var ok bool
+	var err error
+	if code != "" {
+		if step, valid := auth.ValidateTOTP(user.MFA.Secret, code, now); valid {
+			ok, err = s.users.AcceptMFAStep(ctx, user.ID, step, now)
+		}
+	} else if recoveryCode != "" {
+		ok, err = s.users.ConsumeRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(recoveryCode), now)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to verify mfa code: %w", err)
+	}
+	if !ok {
+		if err := s.users.RecordMFAFailure(ctx, user.ID, mfaMaxAttempts, now.Add(mfaLockoutDuration)); err != nil {
+			pkg.Logger(ctx).Warn("mfa failure count update failed", "err", err)
+		}
+		s.record(ctx, user, AuditMFAFailed, map[string]any{"recovery_code": code == ""})
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after a fresh TOTP check
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, user *repository.User, code string) ([]string, error) {
+	if err := s.Verify(ctx, user, code, ""); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.users.ReplaceRecoveryCodes(ctx, user.ID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	s.record(ctx, user, AuditRecoveryCodesReset, nil)
+	return codes, nil
+}
+
+// Disable removes MFA after a fresh TOTP or recovery code check
+func (s *MFAService) Disable(ctx context.Context, user *repository.User, code, recoveryCode string) error {
+	if err := s.Verify(ctx, user, code, recoveryCode); err != nil {
+		return err
+	}
+	if err := s.users.DisableMFA(ctx, user.ID); err != nil {
+		return err
+	}
+	s.record(ctx, user, AuditMFADisabled, nil)
+	return nil
+}
+
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	codes, err = auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes = make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = auth.HashRecoveryCode(c)
+	}
+	return codes, hashes, nil
+}
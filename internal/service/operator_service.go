@@ -0,0 +1,529 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	operatorListLimit    = 50
+	operatorMaxListLimit = 500
+	reanalyseBatchSize   = 500
+
+	// impersonationTTL keeps support sessions short; mint a new one if needed
+	impersonationTTL = 15 * time.Minute
+)
+
+var (
+	ErrCannotImpersonate = apperr.New(apperr.Forbidden, "cannot_impersonate", "this user cannot be impersonated")
+	ErrNoMembership      = apperr.New(apperr.NotFound, "membership_not_found", "user is not a member of that workspace")
+	ErrUnknownPlan       = apperr.New(apperr.Validation, "unknown_plan", "unknown plan")
+)
+
+// OperatorService backs the platform admin API used by support staff. Every
+// action, reads included, is written to the audit log.
+type OperatorService struct {
+	users      *repository.UserRepo
+	workspaces *repository.WorkspaceRepo
+	members    *repository.MemberRepo
+	projects   *repository.ProjectRepo
+	keys       *repository.APIKeyRepo
+	prompts    *repository.PromptRepo
+	sessions   *SessionService
+	llmUsage   *LLMUsageService
+	audit      *AuditService
+	cfg        *config.Config
+}
+
+func NewOperatorService(
+	u *repository.UserRepo,
+	w *repository.WorkspaceRepo,
+	m *repository.MemberRepo,
+	proj *repository.ProjectRepo,
+	k *repository.APIKeyRepo,
+	p *repository.PromptRepo,
+	sessions *SessionService,
+	llmUsage *LLMUsageService,
+	audit *AuditService,
+	cfg *config.Config,
+) *OperatorService {
+	return &OperatorService{users: u, workspaces: w, members: m, projects: proj, keys: k, prompts: p, sessions: sessions, llmUsage: llmUsage, audit: audit, cfg: cfg}
+}
+
+func clampLimit(limit int) int {
+	if limit <= 0 {
+		return operatorListLimit
+	}
+	if limit > operatorMaxListLimit {
+		return operatorMaxListLimit
+	}
+	return limit
+}
+
+func (s *OperatorService) user(ctx context.Context, userID string) (*repository.User, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *OperatorService) record(ctx context.Context, action string, user *repository.User, metadata map[string]any) {
+	s.audit.Record(ctx, repository.AuditEvent{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Metadata:   metadata,
+	})
+}
+
+// SearchUsers lists users whose email contains q, newest first
+func (s *OperatorService) SearchUsers(ctx context.Context, q string, limit, offset int) ([]repository.User, int64, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	users, total, err := s.users.Search(ctx, strings.TrimSpace(q), int64(clampLimit(limit)), int64(offset))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		Action:   AuditSysUsersSearched,
+		Metadata: map[string]any{"q": q, "offset": offset, "results": len(users)},
+	})
+	return users, total, nil
+}
+
+// OperatorWorkspace is one of a user's workspaces as shown to operators
+type OperatorWorkspace struct {
+	Workspace repository.Workspace `json:"workspace"`
+	Role      string               `json:"role"`
+	Projects  []repository.Project `json:"projects"`
+}
+
+// UserProfile is everything support needs to look at an account
+type UserProfile struct {
+	User       *repository.User    `json:"user"`
+	Verified   bool                `json:"verified"`
+	Workspaces []OperatorWorkspace `json:"workspaces"`
+}
+
+// UserProfile returns a user with their workspaces, projects and competitors
+func (s *OperatorService) UserProfile(ctx context.Context, userID string) (*UserProfile, error) {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.members.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	ids := make([]primitive.ObjectID, 0, len(memberships))
+	roles := map[primitive.ObjectID]string{}
+	for _, m := range memberships {
+		ids = append(ids, m.WorkspaceID)
+		roles[m.WorkspaceID] = m.Role
+	}
+	workspaces, err := s.workspaces.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch workspaces: %w", err)
+	}
+
+	profile := &UserProfile{User: user, Verified: user.IsVerified, Workspaces: []OperatorWorkspace{}}
+	for _, ws := range workspaces {
+		projects, err := s.projects.ListByWorkspace(ctx, ws.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list projects: %w", err)
+		}
+		profile.Workspaces = append(profile.Workspaces, OperatorWorkspace{Workspace: ws, Role: roles[ws.ID], Projects: projects})
+	}
+
+	s.record(ctx, AuditSysUserViewed, user, nil)
+	return profile, nil
+}
+
+// UserPrompts returns a user's prompt history across workspaces, newest first
+func (s *OperatorService) UserPrompts(ctx context.Context, userID string, limit, offset int) ([]repository.PromptResponseEntry, error) {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	entries, err := s.prompts.GetPromptResponsesByUser(ctx, user.ID.Hex(), clampLimit(limit), offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch prompts: %w", err)
+	}
+	s.record(ctx, AuditSysUserPromptsRead, user, map[string]any{"offset": offset, "results": len(entries)})
+	return entries, nil
+}
+
+// ForceVerify marks the user's email as verified
+func (s *OperatorService) ForceVerify(ctx context.Context, userID string) error {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.users.SetVerified(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to verify user: %w", err)
+	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		Action:     AuditSysUserVerified,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Before:     map[string]any{"verified": user.IsVerified},
+		After:      map[string]any{"verified": true},
+	})
+	return nil
+}
+
+// SetDisabled disables or re-enables an account. Disabling refuses the user's
+// tokens straight away and revokes the API keys they created.
+func (s *OperatorService) SetDisabled(ctx context.Context, userID string, disabled bool, reason string) error {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	action := AuditSysUserEnabled
+	var at *time.Time
+	if disabled {
+		action = AuditSysUserDisabled
+		now := time.Now().UTC()
+		at = &now
+	}
+	if err := s.users.SetDisabled(ctx, user.ID, at, reason); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if disabled {
+		if err := s.keys.RevokeUserKeys(ctx, user.ID); err != nil {
+			return fmt.Errorf("failed to revoke api keys: %w", err)
+		}
+	}
+	s.sessions.Forget(user.ID.Hex())
+
+	s.audit.Record(ctx, repository.AuditEvent{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Before:     map[string]any{"disabled": user.DisabledAt != nil},
+		After:      map[string]any{"disabled": disabled},
+		Metadata:   map[string]any{"reason": reason},
+	})
+	return nil
+}
+
+// RevokeSessions invalidates every access token issued to the user so far
+func (s *OperatorService) RevokeSessions(ctx context.Context, userID string) error {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.users.RevokeSessions(ctx, user.ID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	s.sessions.Forget(user.ID.Hex())
+	s.record(ctx, AuditSysSessionsRevoked, user, nil)
+	return nil
+}
+
+// SetWorkspacePlan moves a workspace to another plan, which changes its quotas
+// from the next LLM call
+func (s *OperatorService) SetWorkspacePlan(ctx context.Context, workspaceID, plan string) error {
+	if _, ok := s.cfg.Plans[plan]; !ok {
+		return ErrUnknownPlan
+	}
+	ws, err := s.workspaces.FindByID(ctx, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch workspace: %w", err)
+	}
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	if err := s.workspaces.SetPlan(ctx, ws.ID, plan); err != nil {
+		return fmt.Errorf("failed to set plan: %w", err)
+	}
+
+	before := ws.Plan
+	if before == "" {
+		before = config.PlanFree
+	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		Action:     AuditSysWorkspacePlan,
+		TargetType: "workspace",
+		TargetID:   ws.ID.Hex(),
+		Before:     map[string]any{"plan": before},
+		After:      map[string]any{"plan": plan},
+	})
+	return nil
+}
+
+// SetWorkspaceBudget sets a workspace's monthly LLM budget in USD, 0 for
+// none, or returns it to the default when budget is nil
+func (s *OperatorService) SetWorkspaceBudget(ctx context.Context, workspaceID string, budget *float64) error {
+	ws, err := s.workspaces.FindByID(ctx, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch workspace: %w", err)
+	}
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	if err := s.workspaces.SetLLMBudget(ctx, ws.ID, budget); err != nil {
+		return fmt.Errorf("failed to set budget: %w", err)
+	}
+
+	s.audit.Record(ctx, repository.AuditEvent{
+		Action:     AuditSysWorkspaceBudget,
+		TargetType: "workspace",
+		TargetID:   ws.ID.Hex(),
+		Before:     map[string]any{"llm_budget_usd": ws.LLMBudgetUSD},
+		After:      map[string]any{"llm_budget_usd": budget},
+	})
+	return nil
+}
+
+// LLMUsage reports LLM usage and spend across the platform over the last days
+func (s *OperatorService) LLMUsage(ctx context.Context, days int) (*LLMOverview, error) {
+	overview, err := s.llmUsage.Overview(ctx, days)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, repository.AuditEvent{Action: AuditSysLLMUsageViewed, Metadata: map[string]any{"days": days}})
+	return overview, nil
+}
+
+// Impersonation is a read-only access token acting as a user in one workspace
+type Impersonation struct {
+	Token       string    `json:"access_token"`
+	WorkspaceID string    `json:"workspace_id"`
+	Role        string    `json:"role"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Impersonate mints a short-lived token that sees what the user sees in a
+// workspace, their first one when workspaceID is empty. The token carries the
+// operator in its act claim; middleware refuses its mutating requests and
+// records the rest.
+func (s *OperatorService) Impersonate(ctx context.Context, userID, workspaceID, reason string) (*Impersonation, error) {
+	operatorID, _ := pkg.GetUserIDFromContext(ctx)
+	operatorEmail, _ := pkg.GetEmailFromContext(ctx)
+	if _, ok := pkg.GetImpersonatorFromContext(ctx); ok {
+		return nil, ErrCannotImpersonate
+	}
+
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Operators are not impersonated, so one cannot act with another's access
+	if user.ID.Hex() == operatorID || user.SysRole != "" || user.DisabledAt != nil {
+		return nil, ErrCannotImpersonate
+	}
+
+	memberships, err := s.members.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	var member *repository.Membership
+	for i := range memberships {
+		if workspaceID == "" || memberships[i].WorkspaceID.Hex() == workspaceID {
+			member = &memberships[i]
+			break
+		}
+	}
+	if member == nil {
+		return nil, ErrNoMembership
+	}
+
+	token, err := auth.GenerateAccessToken(s.cfg.AccessSecret, auth.JWTClaims{
+		Email:       user.Email,
+		UserID:      user.ID.Hex(),
+		WorkspaceID: member.WorkspaceID.Hex(),
+		Role:        member.Role,
+		MFA:         true, // the operator's session completed MFA
+		Act:         &auth.JWTActor{UserID: operatorID, Email: operatorEmail},
+		SessionGen:  user.SessionGen,
+	}, impersonationTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+	expiresAt := time.Now().UTC().Add(impersonationTTL)
+
+	wsID := member.WorkspaceID
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &wsID,
+		Action:      AuditSysImpersonation,
+		TargetType:  "user",
+		TargetID:    user.ID.Hex(),
+		Metadata:    map[string]any{"reason": reason, "role": member.Role, "expires_at": expiresAt},
+	})
+	return &Impersonation{Token: token, WorkspaceID: wsID.Hex(), Role: member.Role, ExpiresAt: expiresAt}, nil
+}
+
+// Reanalyse recomputes the brand and domain analyses of a user's stored
+// responses against each project's current brand and competitors. No LLM
+// calls are made. With projectID set only that project is re-run. It
+// returns the number of prompts re-analysed.
+func (s *OperatorService) Reanalyse(ctx context.Context, userID, projectID string) (int, error) {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if projectID != "" {
+		p, err := s.projects.FindByID(ctx, projectID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch project: %w", err)
+		}
+		if p == nil {
+			return 0, ErrProjectNotFound
+		}
+	}
+
+	byProject := map[string][]repository.PromptResponseEntry{}
+	err = s.prompts.EachPromptResponseByUser(ctx, user.ID.Hex(), func(e repository.PromptResponseEntry) error {
+		if e.ProjectID != "" && (projectID == "" || e.ProjectID == projectID) {
+			byProject[e.ProjectID] = append(byProject[e.ProjectID], e)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read prompts: %w", err)
+	}
+
+	count := 0
+	for pid, entries := range byProject {
+		project, err := s.projects.FindByID(ctx, pid)
+		if err != nil {
+			return count, fmt.Errorf("failed to fetch project: %w", err)
+		}
+		if project == nil {
+			// Prompts of deleted projects have nothing to compare against
+			continue
+		}
+		for start := 0; start < len(entries); start += reanalyseBatchSize {
+			end := min(start+reanalyseBatchSize, len(entries))
+			if err := s.reanalyseBatch(ctx, project, entries[start:end]); err != nil {
+				return count, err
+			}
+			count += end - start
+		}
+	}
+
+	s.record(ctx, AuditSysAnalysesRerun, user, map[string]any{"project_id": projectID, "prompts": count})
+	return count, nil
+}
+
+func (s *OperatorService) reanalyseBatch(ctx context.Context, project *repository.Project, entries []repository.PromptResponseEntry) error {
+	brandAliases := pkg.GenerateAliases(project.BrandName)
+	competitorMap := make(map[string][]string)
+	for _, c := range project.Competitor {
+		competitorMap[c.TrackedName] = pkg.GenerateAliases(c.TrackedName)
+	}
+
+	var (
+		promptIDs     []int
+		promptEntries []repository.PromptMeta
+		brandEntries  []repository.BrandAnalysis
+		domainEntries []repository.DomainAnalysis
+	)
+	for _, e := range entries {
+		// Each prompt keeps its own country and original timestamp
+		a := pkg.AnalyzeResponses(ctx, []pkg.PromptResponse{{Prompt: e.Prompt, Response: e.Response}},
+			e.Country, project.BrandName, brandAliases, competitorMap)[0]
+
+		promptIDs = append(promptIDs, e.ID)
+		promptEntries = append(promptEntries, repository.PromptMeta{
+			PromptID:    e.ID,
+			WorkspaceID: e.WorkspaceID,
+			ProjectID:   e.ProjectID,
+			UserID:      e.UserID,
+			Prompt:      a.Prompt,
+			Mentions:    a.Mentions,
+			Volume:      a.Volume,
+			Location:    a.Location,
+			Added:       e.Added,
+		})
+		for _, b := range a.Brands {
+			brandEntries = append(brandEntries, repository.BrandAnalysis{
+				PromptID:    e.ID,
+				WorkspaceID: e.WorkspaceID,
+				ProjectID:   e.ProjectID,
+				UserID:      e.UserID,
+				BrandName:   b.BrandName,
+				Visibility:  b.Visibility,
+				Sentiment:   b.Sentiment,
+				Position:    b.Position,
+				Added:       e.Added,
+			})
+		}
+		for _, d := range a.Domains {
+			domainEntries = append(domainEntries, repository.DomainAnalysis{
+				PromptID:     e.ID,
+				Domain:       d.Domain,
+				Used:         d.Used,
+				AvgCitations: d.AvgCitations,
+				Type:         d.Type,
+				Added:        e.Added,
+			})
+		}
+	}
+
+	if err := s.prompts.ReplaceAnalyses(ctx, promptIDs, promptEntries, brandEntries, domainEntries); err != nil {
+		return fmt.Errorf("failed to replace analyses: %w", err)
+	}
+	return nil
+}
+
+// SystemStats is a platform-wide overview for operators
+type SystemStats struct {
+	Since         time.Time               `json:"since"`
+	Users         *repository.UserStats   `json:"users"`
+	Workspaces    int64                   `json:"workspaces"`
+	NewWorkspaces int64                   `json:"new_workspaces"`
+	PromptsPerDay []repository.DailyCount `json:"prompts_per_day"`
+	Prompts       int64                   `json:"prompts"`
+	LLMSpendUSD   float64                 `json:"llm_spend_usd"` // recorded cost of every LLM call
+}
+
+// Stats summarises users, workspaces, prompts and LLM spend over the last days
+func (s *OperatorService) Stats(ctx context.Context, days int) (*SystemStats, error) {
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -(days - 1))
+
+	users, err := s.users.Stats(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	total, created, err := s.workspaces.Count(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count workspaces: %w", err)
+	}
+	perDay, err := s.prompts.PromptsPerDay(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count prompts: %w", err)
+	}
+
+	stats := &SystemStats{Since: since, Users: users, Workspaces: total, NewWorkspaces: created, PromptsPerDay: perDay}
+	for _, d := range perDay {
+		stats.Prompts += d.Count
+	}
+	if stats.LLMSpendUSD, err = s.llmUsage.Spend(ctx, "", since); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, repository.AuditEvent{Action: AuditSysStatsViewed, Metadata: map[string]any{"days": days}})
+	return stats, nil
+}
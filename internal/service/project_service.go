@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrProjectNotFound    = apperr.New(apperr.NotFound, "project_not_found", "project not found")
+	ErrCompetitorNotFound = apperr.New(apperr.NotFound, "competitor_not_found", "competitor not found")
+)
+
+type ProjectService struct {
+	projects   *repository.ProjectRepo
+	workspaces *repository.WorkspaceRepo
+	prompts    *repository.PromptRepo
+	audit      *AuditService
+}
+
+func NewProjectService(p *repository.ProjectRepo, w *repository.WorkspaceRepo, pr *repository.PromptRepo, audit *AuditService) *ProjectService {
+	return &ProjectService{projects: p, workspaces: w, prompts: pr, audit: audit}
+}
+
+// Resolve returns the project a request targets: projectID when it belongs to
+// the workspace, or the workspace's default project when projectID is empty.
+func (s *ProjectService) Resolve(ctx context.Context, workspaceID, projectID string) (*repository.Project, error) {
+	if projectID == "" {
+		ws, err := s.workspaces.FindByID(ctx, workspaceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch workspace: %w", err)
+		}
+		if ws == nil {
+			return nil, ErrWorkspaceNotFound
+		}
+		return s.Default(ctx, ws)
+	}
+
+	p, err := s.projects.FindByID(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch project: %w", err)
+	}
+	// Projects of other workspaces are reported as missing rather than forbidden
+	if p == nil || p.WorkspaceID.Hex() != workspaceID {
+		return nil, ErrProjectNotFound
+	}
+	return p, nil
+}
+
+// Default returns a workspace's default project. It only reads: the project
+// is made with the workspace, or by BackfillDefaults for older workspaces.
+func (s *ProjectService) Default(ctx context.Context, ws *repository.Workspace) (*repository.Project, error) {
+	p, err := s.projects.FindDefault(ctx, ws.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch default project: %w", err)
+	}
+	if p == nil {
+		return nil, ErrProjectNotFound
+	}
+	return p, nil
+}
+
+// CreateDefault gives a workspace its default project unless it has one: its
+// oldest project if there is any, else one seeded from the workspace's legacy
+// brand profile. Analysis rows without a project are moved into it. Running
+// it twice, even concurrently, leaves one default.
+func (s *ProjectService) CreateDefault(ctx context.Context, ws *repository.Workspace) (*repository.Project, error) {
+	if p, err := s.projects.FindDefault(ctx, ws.ID); err != nil {
+		return nil, fmt.Errorf("failed to fetch default project: %w", err)
+	} else if p != nil {
+		return p, nil
+	}
+
+	projects, err := s.projects.ListByWorkspace(ctx, ws.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	var p *repository.Project
+	if len(projects) > 0 {
+		p, err = s.projects.MarkDefault(ctx, &projects[0])
+	} else {
+		name := ws.BrandName
+		if name == "" {
+			name = ws.Name
+		}
+		p, err = s.projects.CreateDefault(ctx, &repository.Project{
+			WorkspaceID: ws.ID,
+			Name:        name,
+			BrandName:   ws.BrandName,
+			Domain:      ws.Domain,
+			Country:     ws.Country,
+			Competitor:  ws.Competitor,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create default project: %w", err)
+	}
+
+	if err := s.prompts.AssignProject(ctx, ws.ID.Hex(), p.ID.Hex()); err != nil {
+		return nil, fmt.Errorf("failed to move analyses into project: %w", err)
+	}
+	return p, nil
+}
+
+// BackfillDefaults gives every workspace made before default projects were
+// created with the workspace its default project
+func (s *ProjectService) BackfillDefaults(ctx context.Context) error {
+	all, err := s.workspaces.IDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	done, err := s.projects.WorkspacesWithDefault(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list default projects: %w", err)
+	}
+	have := make(map[primitive.ObjectID]bool, len(done))
+	for _, id := range done {
+		have[id] = true
+	}
+
+	created := 0
+	for _, id := range all {
+		if have[id] {
+			continue
+		}
+		ws, err := s.workspaces.FindByID(ctx, id.Hex())
+		if err != nil {
+			return fmt.Errorf("failed to fetch workspace: %w", err)
+		}
+		if ws == nil {
+			continue
+		}
+		if _, err := s.CreateDefault(ctx, ws); err != nil {
+			return err
+		}
+		created++
+	}
+	if created > 0 {
+		pkg.Logger(ctx).Info("backfilled default projects", "workspaces", created)
+	}
+	return nil
+}
+
+// List returns the projects of a workspace, oldest first
+func (s *ProjectService) List(ctx context.Context, workspaceID string) ([]repository.Project, error) {
+	ws, err := s.workspaces.FindByID(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch workspace: %w", err)
+	}
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	return s.projects.ListByWorkspace(ctx, ws.ID)
+}
+
+// Create adds a project to a workspace
+func (s *ProjectService) Create(ctx context.Context, workspaceID, name, brandName, domain, country string) (*repository.Project, error) {
+	ws, err := s.workspaces.FindByID(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch workspace: %w", err)
+	}
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+
+	p := &repository.Project{
+		WorkspaceID: ws.ID,
+		Name:        name,
+		BrandName:   brandName,
+		Domain:      domain,
+		Country:     country,
+	}
+	if err := s.projects.Create(ctx, p); err != nil {
+		return nil, fmt.Errorf("failed to create project: %w", err)
+	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &ws.ID,
+		Action:      AuditProjectCreated,
+		TargetType:  "project",
+		TargetID:    p.ID.Hex(),
+		After:       map[string]any{"name": name, "brand_name": brandName, "domain": domain, "country": country},
+	})
+	return p, nil
+}
+
+// UpdateBrandProfile sets the brand name, domain and country of a project
+func (s *ProjectService) UpdateBrandProfile(ctx context.Context, p *repository.Project, brandName, domain, country string) error {
+	if err := s.projects.UpdateProfile(ctx, p.ID, brandName, domain, country); err != nil {
+		return err
+	}
+	before, after := auditChanges(
+		map[string]any{"brand_name": p.BrandName, "domain": p.Domain, "country": p.Country},
+		map[string]any{"brand_name": brandName, "domain": domain, "country": country},
+	)
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &p.WorkspaceID,
+		Action:      AuditProfileUpdated,
+		TargetType:  "project",
+		TargetID:    p.ID.Hex(),
+		Before:      before,
+		After:       after,
+	})
+	return nil
+}
+
+// AddCompetitor adds competitors to a project
+func (s *ProjectService) AddCompetitor(ctx context.Context, p *repository.Project, competitor []repository.Competitor) error {
+	if err := s.projects.AddCompetitor(ctx, p.ID, competitor); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &p.WorkspaceID,
+		Action:      AuditCompetitorsAdded,
+		TargetType:  "project",
+		TargetID:    p.ID.Hex(),
+		Before:      map[string]any{"competitor": p.Competitor},
+		After:       map[string]any{"competitor": append(append([]repository.Competitor{}, p.Competitor...), competitor...)},
+	})
+	return nil
+}
+
+// RemoveCompetitor removes a competitor, identified by its domain, from a project
+func (s *ProjectService) RemoveCompetitor(ctx context.Context, p *repository.Project, domain string) error {
+	removed, err := s.projects.RemoveCompetitor(ctx, p.ID, domain)
+	if err != nil {
+		return fmt.Errorf("failed to remove competitor: %w", err)
+	}
+	if !removed {
+		return ErrCompetitorNotFound
+	}
+	after := []repository.Competitor{}
+	for _, c := range p.Competitor {
+		if c.Domain != domain {
+			after = append(after, c)
+		}
+	}
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &p.WorkspaceID,
+		Action:      AuditCompetitorRemoved,
+		TargetType:  "project",
+		TargetID:    p.ID.Hex(),
+		Before:      map[string]any{"competitor": p.Competitor},
+		After:       map[string]any{"competitor": after},
+	})
+	return nil
+}
+
+// GetCompetitor returns a paginated list of competitors for a project
+func (s *ProjectService) GetCompetitor(ctx context.Context, p *repository.Project, page, limit int) ([]repository.Competitor, int, error) {
+	return s.projects.GetCompetitor(ctx, p.ID, page, limit)
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/mongotest"
+	"auth-microservice/internal/pgtest"
+	"auth-microservice/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// projectFixture is a project service over a scratch database with the
+// production indexes, so a workspace can only hold one default project
+type projectFixture struct {
+	svc        *ProjectService
+	projects   *repository.ProjectRepo
+	workspaces *repository.WorkspaceRepo
+}
+
+func newProjectFixture(t *testing.T, pg *pgxpool.Pool) *projectFixture {
+	t.Helper()
+	db := mongotest.Database(t)
+	cfg := &config.Config{UserCol: "users", TokenCol: "tokens", MemberCol: "members", ProjectCol: "projects",
+		APIKeyCol: "api_keys", EmailOutboxCol: "email_outbox", AuditCol: "audit", RateLimitCol: "rate_limits"}
+	if err := config.EnsureIndexes(context.Background(), db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	f := &projectFixture{
+		projects:   repository.NewProjectRepo(db, cfg.ProjectCol),
+		workspaces: repository.NewWorkspaceRepo(db, "workspaces"),
+	}
+	f.svc = NewProjectService(f.projects, f.workspaces, repository.NewPromptRepo(pg),
+		NewAuditService(repository.NewAuditRepo(db, cfg.AuditCol)))
+	return f
+}
+
+func (f *projectFixture) workspace(t *testing.T, ws *repository.Workspace) *repository.Workspace {
+	t.Helper()
+	if err := f.workspaces.Create(context.Background(), ws); err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func (f *projectFixture) defaults(t *testing.T, workspaceID primitive.ObjectID) []repository.Project {
+	t.Helper()
+	all, err := f.projects.ListByWorkspace(context.Background(), workspaceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var defaults []repository.Project
+	for _, p := range all {
+		if p.Default {
+			defaults = append(defaults, p)
+		}
+	}
+	return defaults
+}
+
+func TestProjectResolve(t *testing.T) {
+	f := newProjectFixture(t, nil)
+	ctx := context.Background()
+	acme := f.workspace(t, &repository.Workspace{Name: "acme"})
+	other := f.workspace(t, &repository.Workspace{Name: "other"})
+
+	def, err := f.projects.CreateDefault(ctx, &repository.Project{WorkspaceID: acme.ID, Name: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := f.svc.Create(ctx, acme.ID.Hex(), "acme.de", "Acme", "acme.de", "DE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := f.svc.Create(ctx, other.ID.Hex(), "other", "Other", "other.com", "US")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := []struct {
+		name, projectID string
+		want            primitive.ObjectID
+	}{
+		{"no project ID", "", def.ID},
+		{"own project", second.ID.Hex(), second.ID},
+	}
+	for _, tt := range found {
+		p, err := f.svc.Resolve(ctx, acme.ID.Hex(), tt.projectID)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if p.ID != tt.want {
+			t.Errorf("%s: resolved %s, want %s", tt.name, p.ID.Hex(), tt.want.Hex())
+		}
+	}
+
+	refused := []struct {
+		name, workspaceID, projectID string
+		want                         error
+	}{
+		{"another workspace's project", acme.ID.Hex(), foreign.ID.Hex(), ErrProjectNotFound},
+		{"malformed project ID", acme.ID.Hex(), "not-an-id", ErrProjectNotFound},
+		{"no default project", other.ID.Hex(), "", ErrProjectNotFound},
+		{"unknown workspace", primitive.NewObjectID().Hex(), "", ErrWorkspaceNotFound},
+	}
+	for _, tt := range refused {
+		if _, err := f.svc.Resolve(ctx, tt.workspaceID, tt.projectID); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestProjectCreateDefault(t *testing.T) {
+	pg := pgtest.Pool(t)
+	f := newProjectFixture(t, pg)
+	ctx := context.Background()
+	ws := f.workspace(t, &repository.Workspace{Name: "acme", BrandName: "Acme", Domain: "acme.com", Country: "US",
+		Competitor: []repository.Competitor{{DisplayName: "Globex", Domain: "globex.com"}}})
+
+	// A row written before projects existed, and one already in a project
+	var legacy, scoped int
+	if err := pg.QueryRow(ctx, `INSERT INTO prompt_response_entry (workspace_id, prompt, response, country, added)
+		VALUES ($1, 'legacy', 'r', 'US', now()) RETURNING id`, ws.ID.Hex()).Scan(&legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.QueryRow(ctx, `INSERT INTO prompt_response_entry (workspace_id, project_id, prompt, response, country, added)
+		VALUES ($1, 'elsewhere', 'scoped', 'r', 'US', now()) RETURNING id`, ws.ID.Hex()).Scan(&scoped); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pg.Exec(context.Background(), `DELETE FROM prompt_response_entry WHERE id = ANY($1)`, []int{legacy, scoped})
+	})
+
+	// Concurrent callers, e.g. two replicas backfilling at start-up, agree on one default
+	const callers = 4
+	got := make([]*repository.Project, callers)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p, err := f.svc.CreateDefault(ctx, ws)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			got[i] = p
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+	for _, p := range got[1:] {
+		if p.ID != got[0].ID {
+			t.Fatalf("callers got defaults %s and %s", got[0].ID.Hex(), p.ID.Hex())
+		}
+	}
+	if defaults := f.defaults(t, ws.ID); len(defaults) != 1 {
+		t.Fatalf("workspace has %d default projects, want 1", len(defaults))
+	}
+
+	p := got[0]
+	if p.Name != "Acme" || p.BrandName != "Acme" || p.Domain != "acme.com" || p.Country != "US" || len(p.Competitor) != 1 {
+		t.Errorf("default project %+v is not seeded from the brand profile", p)
+	}
+	rows := map[int]string{}
+	r, err := pg.Query(ctx, `SELECT id, COALESCE(project_id, '') FROM prompt_response_entry WHERE id = ANY($1)`, []int{legacy, scoped})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for r.Next() {
+		var id int
+		var projectID string
+		if err := r.Scan(&id, &projectID); err != nil {
+			t.Fatal(err)
+		}
+		rows[id] = projectID
+	}
+	if rows[legacy] != p.ID.Hex() || rows[scoped] != "elsewhere" {
+		t.Errorf("rows moved to %v, want only the legacy row in %s", rows, p.ID.Hex())
+	}
+}
+
+func TestProjectBackfillDefaults(t *testing.T) {
+	pg := pgtest.Pool(t)
+	f := newProjectFixture(t, pg)
+	ctx := context.Background()
+
+	fresh := f.workspace(t, &repository.Workspace{Name: "fresh"})
+	withProjects := f.workspace(t, &repository.Workspace{Name: "with projects", BrandName: "Ignored"})
+	var oldest primitive.ObjectID
+	for _, name := range []string{"oldest", "newer"} {
+		p := &repository.Project{WorkspaceID: withProjects.ID, Name: name}
+		if err := f.projects.Create(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		if oldest.IsZero() {
+			oldest = p.ID
+		}
+		time.Sleep(2 * time.Millisecond) // distinct created_at, oldest first
+	}
+
+	for run := 0; run < 2; run++ {
+		if err := f.svc.BackfillDefaults(ctx); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+
+	if defaults := f.defaults(t, fresh.ID); len(defaults) != 1 || defaults[0].Name != "fresh" {
+		t.Errorf("fresh workspace defaults %+v, want one named after the workspace", defaults)
+	}
+	defaults := f.defaults(t, withProjects.ID)
+	if len(defaults) != 1 || defaults[0].ID != oldest {
+		t.Errorf("defaults %+v, want the oldest existing project %s", defaults, oldest.Hex())
+	}
+	if all, _ := f.projects.ListByWorkspace(ctx, withProjects.ID); len(all) != 2 {
+		t.Errorf("backfill left %d projects, want the existing 2", len(all))
+	}
+}
+
+func TestProjectCompetitors(t *testing.T) {
+	f := newProjectFixture(t, nil)
+	ctx := context.Background()
+	ws := f.workspace(t, &repository.Workspace{Name: "acme"})
+	p, err := f.svc.Create(ctx, ws.ID.Hex(), "acme", "Acme", "acme.com", "US")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added := []repository.Competitor{{DisplayName: "Globex", Domain: "globex.com"}, {DisplayName: "Initech", Domain: "initech.com"}}
+	if err := f.svc.AddCompetitor(ctx, p, added); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.svc.RemoveCompetitor(ctx, p, "globex.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.svc.RemoveCompetitor(ctx, p, "globex.com"); !errors.Is(err, ErrCompetitorNotFound) {
+		t.Errorf("removing twice: err %v, want ErrCompetitorNotFound", err)
+	}
+
+	got, total, err := f.svc.GetCompetitor(ctx, p, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(got) != 1 || got[0].Domain != "initech.com" {
+		t.Errorf("competitors %+v (total %d), want only initech.com", got, total)
+	}
+	// Competitors belong to the project, not to the workspace's other projects
+	other, err := f.svc.Create(ctx, ws.ID.Hex(), "acme.de", "Acme", "acme.de", "DE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, total, err := f.svc.GetCompetitor(ctx, other, 1, 10); err != nil || total != 0 || len(got) != 0 {
+		t.Errorf("other project competitors %+v (total %d), %v", got, total, err)
+	}
+}
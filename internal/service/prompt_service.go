@@ -1,9 +1,11 @@
 package service
 
 import (
+	"auth-microservice/internal/metrics"
 	"auth-microservice/internal/repository"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -12,14 +14,20 @@ import (
 )
 
 type PromptService struct {
-	repo   *repository.PromptRepo
-	client *openai.Client
+	repo    *repository.PromptRepo
+	client  *openai.Client
+	audit   *AuditService
+	metrics *metrics.Metrics
+	usage   *LLMUsageService
 }
 
-func NewPromptService(p *repository.PromptRepo, apiKey string) *PromptService {
+func NewPromptService(p *repository.PromptRepo, apiKey string, audit *AuditService, m *metrics.Metrics, usage *LLMUsageService) *PromptService {
 	return &PromptService{
-		repo:   p,
-		client: openai.NewClient(apiKey),
+		repo:    p,
+		client:  openai.NewClient(apiKey),
+		audit:   audit,
+		metrics: m,
+		usage:   usage,
 	}
 }
 
@@ -56,7 +64,7 @@ Always return exactly 5 prompts — no more, no less.
 
 	userPrompt := "Domain: " + domain + "\nCountry: " + country
 
-	resp, err := s.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	resp, err := chatCompletion(ctx, s.client, s.metrics, s.usage, LLMPurposePromptGeneration, openai.ChatCompletionRequest{
 		Model: "gpt-4o-mini",
 		Messages: []openai.ChatCompletionMessage{
 			{Role: "system", Content: systemPrompt},
@@ -65,19 +73,19 @@ Always return exactly 5 prompts — no more, no less.
 		MaxTokens: 200,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("openai error: %w", err)
+		return nil, errLLM(fmt.Errorf("openai error: %w", err))
 	}
 
 	content := resp.Choices[0].Message.Content
 	var prompts []string
 	if err := json.Unmarshal([]byte(content), &prompts); err != nil {
-		return nil, fmt.Errorf("invalid json from model: %w", err)
+		return nil, errLLM(fmt.Errorf("invalid json from model: %w", err))
 	}
 
 	return prompts, nil
 }
 
-func (p *PromptService) SendToOpenAI(ctx context.Context, userEmail, prompt, country string) (string, error) {
+func (p *PromptService) SendToOpenAI(ctx context.Context, userID, prompt, country string) (string, error) {
 	// System message to guide the AI
 	systemPrompt := `
 You are an AI content assistant and subject-matter expert across domains such as finance, health, technology, education, travel, and consumer products.
@@ -138,7 +146,7 @@ Example structure:
 	userPrompt := fmt.Sprintf("Country: %s\nPrompt: %s", country, prompt)
 
 	// Call OpenAI API
-	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	resp, err := chatCompletion(ctx, p.client, p.metrics, p.usage, LLMPurposeAnalysis, openai.ChatCompletionRequest{
 		Model: "gpt-4o-mini", // or gpt-4o-mini if available
 		Messages: []openai.ChatCompletionMessage{
 			{Role: "system", Content: systemPrompt},
@@ -147,12 +155,12 @@ Example structure:
 		MaxTokens: 1200,
 	})
 	if err != nil {
-		return "", fmt.Errorf("OpenAI API error: %w", err)
+		return "", errLLM(fmt.Errorf("OpenAI API error: %w", err))
 	}
 
 	// Validate response
 	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
-		return "", fmt.Errorf("OpenAI returned empty response")
+		return "", errLLM(errors.New("OpenAI returned empty response"))
 	}
 
 	// Trim whitespace and return
@@ -170,11 +178,24 @@ func (s *PromptService) StorePromptResponses(ctx context.Context, entries []repo
 		return nil, err
 	}
 
+	prompts := make([]string, len(entries))
+	for i, e := range entries {
+		prompts[i] = e.Prompt
+	}
+	if len(entries) > 0 {
+		s.audit.Record(ctx, repository.AuditEvent{
+			Action:     AuditPromptsAdded,
+			TargetType: "project",
+			TargetID:   entries[0].ProjectID,
+			After:      map[string]any{"prompt_ids": ids, "prompts": prompts},
+		})
+	}
+
 	return ids, nil
 }
 
 // GetPromptResponses fetches paginated prompt responses
-func (s *PromptService) GetPromptResponses(ctx context.Context, email string, page, limit int) ([]repository.PromptResponseEntry, error) {
+func (s *PromptService) GetPromptResponses(ctx context.Context, projectID string, page, limit int) ([]repository.PromptResponseEntry, error) {
 	if page <= 0 {
 		page = 1
 	}
@@ -182,7 +203,7 @@ func (s *PromptService) GetPromptResponses(ctx context.Context, email string, pa
 		limit = 10
 	}
 	offset := (page - 1) * limit
-	return s.repo.GetPromptResponsesByEmail(ctx, email, limit, offset)
+	return s.repo.GetPromptResponsesByProject(ctx, projectID, limit, offset)
 }
 
 // Store prompt meta in bulk
@@ -191,7 +212,11 @@ func (s *PromptService) StorePromptMeta(ctx context.Context, entries []repositor
 	for i := range entries {
 		entries[i].Added = now
 	}
-	return s.repo.StorePromptMeta(ctx, entries)
+	if err := s.repo.StorePromptMeta(ctx, entries); err != nil {
+		return err
+	}
+	s.metrics.PromptsAnalysed(len(entries))
+	return nil
 }
 
 // Store brand analyses in bulk
@@ -212,32 +237,32 @@ func (s *PromptService) StoreDomainAnalyses(ctx context.Context, entries []repos
 	return s.repo.StoreDomainAnalyses(ctx, entries)
 }
 
-// GetBrandAnalyses returns paginated brand analyses for a user
-func (s *PromptService) GetBrandAnalyses(ctx context.Context, email string, page, limit int) ([]repository.BrandAnalysis, error) {
+// GetBrandAnalyses returns paginated brand analyses for a project
+func (s *PromptService) GetBrandAnalyses(ctx context.Context, projectID string, page, limit int) ([]repository.BrandAnalysis, error) {
 	if page <= 0 {
 		page = 1
 	}
 	offset := (page - 1) * limit
-	return s.repo.GetBrandAnalysesByEmail(ctx, email, limit, offset)
+	return s.repo.GetBrandAnalysesByProject(ctx, projectID, limit, offset)
 }
 
-// GetDomainAnalyses returns paginated domain analyses for a user
-func (s *PromptService) GetDomainAnalyses(ctx context.Context, email string, page, limit int) ([]repository.DomainAnalysis, error) {
+// GetDomainAnalyses returns paginated domain analyses for a project
+func (s *PromptService) GetDomainAnalyses(ctx context.Context, projectID string, page, limit int) ([]repository.DomainAnalysis, error) {
 	if page <= 0 {
 		page = 1
 	}
 	offset := (page - 1) * limit
-	return s.repo.GetDomainAnalysesByEmail(ctx, email, limit, offset)
+	return s.repo.GetDomainAnalysesByProject(ctx, projectID, limit, offset)
 }
-func (s *PromptService) GetBrandOverview(ctx context.Context, email string) ([]repository.BrandOverview, error) {
-	return s.repo.GetBrandOverviewByEmail(ctx, email)
+func (s *PromptService) GetBrandOverview(ctx context.Context, projectID string) ([]repository.BrandOverview, error) {
+	return s.repo.GetBrandOverviewByProject(ctx, projectID)
 }
-func (s *PromptService) GetPromptMetaByEmail(ctx context.Context, email string, limit, offset int) ([]repository.PromptMeta, error) {
-	return s.repo.GetPromptMetaByEmail(ctx, email, limit, offset)
+func (s *PromptService) GetPromptMeta(ctx context.Context, projectID string, limit, offset int) ([]repository.PromptMeta, error) {
+	return s.repo.GetPromptMetaByProject(ctx, projectID, limit, offset)
 }
-func (s *PromptService) GetBrandOverviewByPrompt(ctx context.Context, email string, promptID int) ([]repository.BrandOverview, error) {
-	return s.repo.GetBrandOverviewByPrompt(ctx, email, promptID)
+func (s *PromptService) GetBrandOverviewByPrompt(ctx context.Context, projectID string, promptID int) ([]repository.BrandOverview, error) {
+	return s.repo.GetBrandOverviewByPrompt(ctx, projectID, promptID)
 }
-func (s *PromptService) GetDomainOverviewByPrompt(ctx context.Context, email string, promptID int) ([]repository.DomainAnalysis, error) {
-	return s.repo.GetDomainOverviewByPrompt(ctx, email, promptID)
+func (s *PromptService) GetDomainOverviewByPrompt(ctx context.Context, projectID string, promptID int) ([]repository.DomainAnalysis, error) {
+	return s.repo.GetDomainOverviewByPrompt(ctx, projectID, promptID)
 }
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/pkg"
+	"auth-microservice/internal/ratelimit"
+	"auth-microservice/internal/repository"
+)
+
+// QuotaService counts LLM-backed operations per workspace against the daily
+// and monthly quotas of the workspace's plan
+type QuotaService struct {
+	limiter    *ratelimit.Limiter
+	workspaces workspaceFinder
+	plans      map[string]config.PlanQuota
+	now        func() time.Time
+}
+
+func NewQuotaService(l *ratelimit.Limiter, w *repository.WorkspaceRepo, cfg *config.Config) *QuotaService {
+	return &QuotaService{limiter: l, workspaces: w, plans: cfg.Plans, now: time.Now}
+}
+
+// workspaceFinder looks workspaces up by ID; *repository.WorkspaceRepo is one
+type workspaceFinder interface {
+	FindByID(ctx context.Context, id string) (*repository.Workspace, error)
+}
+
+// QuotaUsage is a workspace's LLM usage in the current day and month
+type QuotaUsage struct {
+	Plan    string      `json:"plan"`
+	Daily   QuotaPeriod `json:"daily"`
+	Monthly QuotaPeriod `json:"monthly"`
+}
+
+// QuotaPeriod is usage within one quota period. Limit and Remaining are
+// null when the plan has no limit for the period.
+type QuotaPeriod struct {
+	Limit     *int64    `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining *int64    `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// quotaPeriod is one counter a call is checked against
+type quotaPeriod struct {
+	name    string // "daily" or "monthly"
+	key     string
+	max     int64 // 0 means unlimited
+	resetAt time.Time
+}
+
+// quotaPeriods returns the workspace's daily and monthly counters at now (UTC)
+func quotaPeriods(workspaceID string, q config.PlanQuota, now time.Time) []quotaPeriod {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return []quotaPeriod{
+		{name: "daily", key: "llm:" + workspaceID + ":day:" + day.Format("2006-01-02"), max: int64(q.DailyLLMCalls), resetAt: day.AddDate(0, 0, 1)},
+		{name: "monthly", key: "llm:" + workspaceID + ":month:" + month.Format("2006-01"), max: int64(q.MonthlyLLMCalls), resetAt: month.AddDate(0, 1, 0)},
+	}
+}
+
+// QuotaCharge is the counters ConsumeLLMCalls charged. Refunds go back to
+// these, even when the day or month has turned since.
+type QuotaCharge struct {
+	periods []quotaPeriod
+}
+
+// plan returns the name and quota of the workspace's plan
+func (s *QuotaService) plan(ctx context.Context, workspaceID string) (string, config.PlanQuota, error) {
+	ws, err := s.workspaces.FindByID(ctx, workspaceID)
+	if err != nil {
+		return "", config.PlanQuota{}, fmt.Errorf("failed to fetch workspace: %w", err)
+	}
+	if ws == nil {
+		return "", config.PlanQuota{}, ErrWorkspaceNotFound
+	}
+	name := ws.Plan
+	if name == "" {
+		name = config.PlanFree
+	}
+	return name, s.plans[name], nil
+}
+
+// ConsumeLLMCalls counts n LLM calls against the workspace's quotas before
+// they are made. When either quota would be exceeded nothing is counted and
+// the error says when the quota resets. Calls that then fail or are never
+// made are handed back by passing the returned charge to RefundLLMCalls. If
+// the counters cannot be reached the calls are allowed, as with rate limits.
+func (s *QuotaService) ConsumeLLMCalls(ctx context.Context, workspaceID string, n int) (*QuotaCharge, error) {
+	name, quota, err := s.plan(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	var taken []quotaPeriod
+	for _, p := range quotaPeriods(workspaceID, quota, now) {
+		limit := p.max
+		if limit == 0 {
+			limit = math.MaxInt64 // still counted, for the usage endpoint
+		}
+		_, ok, err := s.limiter.Consume(ctx, p.key, int64(n), limit, p.resetAt)
+		if err != nil {
+			pkg.Logger(ctx).Warn("quota check failed", "workspace_id", workspaceID, "period", p.name, "err", err)
+			continue
+		}
+		if !ok {
+			s.release(ctx, taken, n)
+			return nil, apperr.Retry("quota_exceeded",
+				fmt.Sprintf("%s quota of %d LLM calls on the %s plan reached", p.name, p.max, name),
+				p.resetAt.Sub(now))
+		}
+		taken = append(taken, p)
+	}
+	return &QuotaCharge{periods: taken}, nil
+}
+
+// RefundLLMCalls takes back n calls of a charge that failed or were not made
+func (s *QuotaService) RefundLLMCalls(ctx context.Context, charge *QuotaCharge, n int) {
+	if charge == nil || n <= 0 {
+		return
+	}
+	s.release(ctx, charge.periods, n)
+}
+
+// release takes back n from counters already charged for a refused request
+func (s *QuotaService) release(ctx context.Context, periods []quotaPeriod, n int) {
+	for _, p := range periods {
+		if err := s.limiter.Release(ctx, p.key, int64(n), p.resetAt); err != nil {
+			pkg.Logger(ctx).Warn("quota release failed", "key", p.key, "err", err)
+		}
+	}
+}
+
+// Usage reports the workspace's plan and its use of each quota
+func (s *QuotaService) Usage(ctx context.Context, workspaceID string) (*QuotaUsage, error) {
+	name, quota, err := s.plan(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &QuotaUsage{Plan: name}
+	for _, p := range quotaPeriods(workspaceID, quota, s.now()) {
+		used, err := s.limiter.Usage(ctx, p.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s usage: %w", p.name, err)
+		}
+		period := QuotaPeriod{Used: used, ResetsAt: p.resetAt}
+		if p.max > 0 {
+			limit, remaining := p.max, max(p.max-used, 0)
+			period.Limit, period.Remaining = &limit, &remaining
+		}
+		if p.name == "daily" {
+			usage.Daily = period
+		} else {
+			usage.Monthly = period
+		}
+	}
+	return usage, nil
+}
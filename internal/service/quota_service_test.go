@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/ratelimit"
+	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeWorkspaces serves workspaces from memory by hex ID
+type fakeWorkspaces map[string]*repository.Workspace
+
+func (f fakeWorkspaces) FindByID(_ context.Context, id string) (*repository.Workspace, error) {
+	return f[id], nil
+}
+
+func newTestWorkspace(plan string) *repository.Workspace {
+	return &repository.Workspace{ID: primitive.NewObjectID(), Plan: plan}
+}
+
+func TestQuotaExhaustion(t *testing.T) {
+	ctx := context.Background()
+	// Counters expire by the wall clock, so the fake clock runs ahead of it:
+	// noon on the 1st of next month
+	wall := time.Now().UTC()
+	now := time.Date(wall.Year(), wall.Month()+1, 1, 12, 0, 0, 0, time.UTC)
+	free, pro, unlimited := newTestWorkspace(""), newTestWorkspace(config.PlanPro), newTestWorkspace(config.PlanEnterprise)
+	s := &QuotaService{
+		limiter:    ratelimit.New(ratelimit.NewMemoryStore()),
+		workspaces: fakeWorkspaces{free.ID.Hex(): free, pro.ID.Hex(): pro, unlimited.ID.Hex(): unlimited},
+		plans: map[string]config.PlanQuota{
+			config.PlanFree:       {DailyLLMCalls: 3, MonthlyLLMCalls: 5},
+			config.PlanPro:        {DailyLLMCalls: 10, MonthlyLLMCalls: 100},
+			config.PlanEnterprise: {},
+		},
+		now: func() time.Time { return now },
+	}
+
+	tests := []struct {
+		name    string
+		ws      *repository.Workspace
+		calls   int
+		wantErr bool
+	}{
+		{"free within daily quota", free, 2, false},
+		{"free batch past daily quota", free, 2, true},
+		{"free up to daily quota", free, 1, false},
+		{"free daily quota spent", free, 1, true},
+		{"pro has its own counters", pro, 10, false},
+		{"pro daily quota spent", pro, 1, true},
+		{"enterprise is unlimited", unlimited, 1000, false},
+	}
+	for _, tt := range tests {
+		_, err := s.ConsumeLLMCalls(ctx, tt.ws.ID.Hex(), tt.calls)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil {
+			continue
+		}
+		var e *apperr.Error
+		if !errors.As(err, &e) || e.Kind != apperr.RateLimited || e.Code != "quota_exceeded" {
+			t.Errorf("%s: err = %v, want a quota_exceeded rate limit error", tt.name, err)
+		} else if e.RetryAfter != 12*time.Hour {
+			t.Errorf("%s: retry after %v, want 12h until midnight UTC", tt.name, e.RetryAfter)
+		}
+	}
+
+	usage, err := s.Usage(ctx, free.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Plan != config.PlanFree || usage.Daily.Used != 3 || *usage.Daily.Remaining != 0 || usage.Monthly.Used != 3 || *usage.Monthly.Remaining != 2 {
+		t.Errorf("free usage after refusals: %+v daily=%+v monthly=%+v", usage, usage.Daily, usage.Monthly)
+	}
+
+	// The next day the daily quota is fresh but the monthly one runs out
+	now = now.AddDate(0, 0, 1)
+	if _, err := s.ConsumeLLMCalls(ctx, free.ID.Hex(), 3); err == nil {
+		t.Fatal("batch past the monthly quota was allowed")
+	}
+	charge, err := s.ConsumeLLMCalls(ctx, free.ID.Hex(), 2)
+	if err != nil {
+		t.Fatalf("calls within both quotas refused: %v", err)
+	}
+	usage, _ = s.Usage(ctx, free.ID.Hex())
+	if usage.Daily.Used != 2 || usage.Monthly.Used != 5 {
+		t.Errorf("a refused batch was counted: daily=%d monthly=%d, want 2 and 5", usage.Daily.Used, usage.Monthly.Used)
+	}
+
+	// Calls refunded after failing go back to both periods
+	s.RefundLLMCalls(ctx, charge, 2)
+	usage, _ = s.Usage(ctx, free.ID.Hex())
+	if usage.Daily.Used != 0 || usage.Monthly.Used != 3 {
+		t.Errorf("after refund: daily=%d monthly=%d, want 0 and 3", usage.Daily.Used, usage.Monthly.Used)
+	}
+}
+
+func TestQuotaRefundAfterMidnight(t *testing.T) {
+	ctx := context.Background()
+	wall := time.Now().UTC()
+	now := time.Date(wall.Year(), wall.Month()+1, 1, 23, 59, 0, 0, time.UTC)
+	ws := newTestWorkspace("")
+	s := &QuotaService{
+		limiter:    ratelimit.New(ratelimit.NewMemoryStore()),
+		workspaces: fakeWorkspaces{ws.ID.Hex(): ws},
+		plans:      map[string]config.PlanQuota{config.PlanFree: {DailyLLMCalls: 3, MonthlyLLMCalls: 10}},
+		now:        func() time.Time { return now },
+	}
+
+	charge, err := s.ConsumeLLMCalls(ctx, ws.ID.Hex(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The calls fail after midnight; the new day's calls are already counted
+	now = now.Add(2 * time.Minute)
+	if _, err := s.ConsumeLLMCalls(ctx, ws.ID.Hex(), 1); err != nil {
+		t.Fatal(err)
+	}
+	s.RefundLLMCalls(ctx, charge, 3)
+
+	usage, _ := s.Usage(ctx, ws.ID.Hex())
+	if usage.Daily.Used != 1 || usage.Monthly.Used != 1 {
+		t.Errorf("new day after refund: daily=%d monthly=%d, want 1 and 1", usage.Daily.Used, usage.Monthly.Used)
+	}
+	now = now.Add(-2 * time.Minute)
+	usage, _ = s.Usage(ctx, ws.ID.Hex())
+	if usage.Daily.Used != 0 {
+		t.Errorf("charged day after refund: daily=%d, want 0", usage.Daily.Used)
+	}
+
+	// A refused charge has nothing to refund
+	s.RefundLLMCalls(ctx, nil, 1)
+}
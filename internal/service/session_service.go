@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// sessionCacheTTL bounds how long a disabled account or revoked session
+	// keeps working on instances other than the one that changed it
+	sessionCacheTTL     = 30 * time.Second
+	sessionCachePruneAt = 10000
+)
+
+// sessionState is the part of a user that decides whether their tokens are valid
+type sessionState struct {
+	exists     bool
+	disabled   bool
+	gen        int64
+	validAfter *time.Time
+	expires    time.Time
+}
+
+// memberKey identifies a user's membership of a workspace
+type memberKey struct{ userID, workspaceID string }
+
+// memberState is a user's current role in a workspace, empty once they left
+type memberState struct {
+	role    string
+	expires time.Time
+}
+
+// workspaceState is the part of a workspace that decides who may use it
+type workspaceState struct {
+	requireMFA bool
+	expires    time.Time
+}
+
+// SessionService checks signed tokens against the user's current state, so
+// disabling an account or revoking its sessions takes effect before the
+// tokens expire, and role changes or a new MFA requirement apply to tokens
+// already issued. Lookups are cached briefly to keep a read off every request.
+type SessionService struct {
+	users      *repository.UserRepo
+	members    *repository.MemberRepo
+	workspaces *repository.WorkspaceRepo
+
+	mu     sync.Mutex
+	cache  map[string]sessionState
+	roles  map[memberKey]memberState
+	spaces map[string]workspaceState
+}
+
+func NewSessionService(u *repository.UserRepo, m *repository.MemberRepo, w *repository.WorkspaceRepo) *SessionService {
+	return &SessionService{users: u, members: m, workspaces: w,
+		cache: map[string]sessionState{}, roles: map[memberKey]memberState{}, spaces: map[string]workspaceState{}}
+}
+
+// ValidateSession implements middleware.SessionValidator
+func (s *SessionService) ValidateSession(ctx context.Context, claims *auth.JWTClaims) error {
+	state, err := s.state(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if !state.exists || state.disabled {
+		return auth.ErrSessionRevoked
+	}
+	if claims.SessionGen < state.gen {
+		return auth.ErrSessionRevoked
+	}
+	// Revocations from before session generations carry only a time. iat has
+	// whole-second precision, so a token from that second is refused too.
+	if state.gen == 0 && state.validAfter != nil && (claims.IssuedAt == nil || claims.IssuedAt.Unix() <= state.validAfter.Unix()) {
+		return auth.ErrSessionRevoked
+	}
+	return nil
+}
+
+// CurrentRole implements middleware.SessionValidator. It returns the user's
+// role in the workspace now, or "" when they are no longer a member.
+func (s *SessionService) CurrentRole(ctx context.Context, userID, workspaceID string) (string, error) {
+	key := memberKey{userID, workspaceID}
+	now := time.Now()
+	s.mu.Lock()
+	state, ok := s.roles[key]
+	s.mu.Unlock()
+	if ok && now.Before(state.expires) {
+		return state.role, nil
+	}
+
+	state = memberState{expires: now.Add(sessionCacheTTL)}
+	wsID, wsErr := primitive.ObjectIDFromHex(workspaceID)
+	uID, uErr := primitive.ObjectIDFromHex(userID)
+	if wsErr == nil && uErr == nil {
+		member, err := s.members.Find(ctx, wsID, uID)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch membership: %w", err)
+		}
+		if member != nil {
+			state.role = member.Role
+		}
+	}
+
+	s.mu.Lock()
+	if len(s.roles) >= sessionCachePruneAt {
+		for k, st := range s.roles {
+			if now.After(st.expires) {
+				delete(s.roles, k)
+			}
+		}
+	}
+	s.roles[key] = state
+	s.mu.Unlock()
+	return state.role, nil
+}
+
+// RequiresMFA implements middleware.SessionValidator. It reports whether the
+// workspace requires members to have completed MFA.
+func (s *SessionService) RequiresMFA(ctx context.Context, workspaceID string) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	state, ok := s.spaces[workspaceID]
+	s.mu.Unlock()
+	if ok && now.Before(state.expires) {
+		return state.requireMFA, nil
+	}
+
+	ws, err := s.workspaces.FindByID(ctx, workspaceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch workspace: %w", err)
+	}
+	state = workspaceState{expires: now.Add(sessionCacheTTL)}
+	if ws != nil {
+		state.requireMFA = ws.RequireMFA
+	}
+
+	s.mu.Lock()
+	if len(s.spaces) >= sessionCachePruneAt {
+		for id, st := range s.spaces {
+			if now.After(st.expires) {
+				delete(s.spaces, id)
+			}
+		}
+	}
+	s.spaces[workspaceID] = state
+	s.mu.Unlock()
+	return state.requireMFA, nil
+}
+
+// Forget drops the cached state of a user after a change on this instance
+func (s *SessionService) Forget(userID string) {
+	s.mu.Lock()
+	delete(s.cache, userID)
+	s.mu.Unlock()
+}
+
+// ForgetMembership drops a user's cached role in a workspace after it changed
+// on this instance
+func (s *SessionService) ForgetMembership(userID, workspaceID string) {
+	s.mu.Lock()
+	delete(s.roles, memberKey{userID, workspaceID})
+	s.mu.Unlock()
+}
+
+// ForgetWorkspace drops the cached state of a workspace after it changed on
+// this instance
+func (s *SessionService) ForgetWorkspace(workspaceID string) {
+	s.mu.Lock()
+	delete(s.spaces, workspaceID)
+	s.mu.Unlock()
+}
+
+func (s *SessionService) state(ctx context.Context, userID string) (sessionState, error) {
+	now := time.Now()
+	s.mu.Lock()
+	state, ok := s.cache[userID]
+	s.mu.Unlock()
+	if ok && now.Before(state.expires) {
+		return state, nil
+	}
+
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return sessionState{}, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	state = sessionState{expires: now.Add(sessionCacheTTL)}
+	if user != nil {
+		state.exists = true
+		state.disabled = user.DisabledAt != nil
+		state.gen = user.SessionGen
+		state.validAfter = user.SessionsValidAfter
+	}
+
+	s.mu.Lock()
+	if len(s.cache) >= sessionCachePruneAt {
+		for id, st := range s.cache {
+			if now.After(st.expires) {
+				delete(s.cache, id)
+			}
+		}
+	}
+	s.cache[userID] = state
+	s.mu.Unlock()
+	return state, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"auth-microservice/internal/auth"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestValidateSessionRevocation(t *testing.T) {
+	revoked := time.Date(2026, 3, 1, 12, 0, 0, 400*int(time.Millisecond), time.UTC)
+	s := NewSessionService(nil, nil, nil)
+	expires := time.Now().Add(time.Hour)
+	s.cache["revoked"] = sessionState{exists: true, gen: 2, validAfter: &revoked, expires: expires}
+	s.cache["legacy"] = sessionState{exists: true, validAfter: &revoked, expires: expires}
+	s.cache["fresh"] = sessionState{exists: true, expires: expires}
+
+	cases := []struct {
+		name    string
+		user    string
+		gen     int64
+		iat     *jwt.NumericDate
+		revoked bool
+	}{
+		{"older generation", "revoked", 1, jwt.NewNumericDate(revoked.Add(-time.Second)), true},
+		{"older generation in the same second", "revoked", 1, jwt.NewNumericDate(revoked), true},
+		{"no generation", "revoked", 0, jwt.NewNumericDate(revoked.Add(time.Hour)), true},
+		{"current generation in the same second", "revoked", 2, jwt.NewNumericDate(revoked), false},
+		{"current generation", "revoked", 2, jwt.NewNumericDate(revoked.Add(time.Second)), false},
+		{"legacy before", "legacy", 0, jwt.NewNumericDate(revoked.Add(-time.Second)), true},
+		{"legacy same second", "legacy", 0, jwt.NewNumericDate(revoked), true},
+		{"legacy after", "legacy", 0, jwt.NewNumericDate(revoked.Add(time.Second)), false},
+		{"legacy no iat", "legacy", 0, nil, true},
+		{"never revoked", "fresh", 0, nil, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := &auth.JWTClaims{UserID: tc.user, SessionGen: tc.gen}
+			claims.IssuedAt = tc.iat
+			err := s.ValidateSession(context.Background(), claims)
+			if got := errors.Is(err, auth.ErrSessionRevoked); got != tc.revoked {
+				t.Fatalf("revoked = %v, want %v (err %v)", got, tc.revoked, err)
+			}
+		})
+	}
+}
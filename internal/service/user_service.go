@@ -3,9 +3,9 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 
+	"auth-microservice/internal/metrics"
 	"auth-microservice/internal/repository"
 
 	"github.com/sashabaranov/go-openai"
@@ -13,64 +13,24 @@ import (
 )
 
 type UserService struct {
-	users  *repository.UserRepo
-	client *openai.Client
+	users   *repository.UserRepo
+	client  *openai.Client
+	metrics *metrics.Metrics
+	usage   *LLMUsageService
+	audit   *AuditService
 }
 
 // Constructor
-func NewUserService(users *repository.UserRepo, apiKey string) *UserService {
+func NewUserService(users *repository.UserRepo, apiKey string, m *metrics.Metrics, usage *LLMUsageService, audit *AuditService) *UserService {
 	return &UserService{
-		users:  users,
-		client: openai.NewClient(apiKey),
+		users:   users,
+		client:  openai.NewClient(apiKey),
+		metrics: m,
+		usage:   usage,
+		audit:   audit,
 	}
 }
 
-// AddCompetitor adds a competitor to a user's record
-func (s *UserService) AddCompetitor(ctx context.Context, email string, competitor []repository.Competitor) error {
-	user, err := s.users.FindByEmail(ctx, email)
-	if err != nil {
-		return err
-	}
-	if user == nil {
-		return errors.New("user does not exist")
-	}
-	return s.users.AddCompetitor(ctx, email, competitor)
-}
-
-// GetCompetitor returns a paginated list of competitors for a user
-func (s *UserService) GetCompetitor(ctx context.Context, email string, page, limit int) ([]repository.Competitor, int, error) {
-	// check if user exists
-	user, err := s.users.FindByEmail(ctx, email)
-	if err != nil {
-		return nil, 0, err
-	}
-	if user == nil {
-		return nil, 0, errors.New("user does not exist")
-	}
-
-	// fetch competitors with pagination
-	competitors, total, err := s.users.GetCompetitor(ctx, email, page, limit)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	return competitors, total, nil
-}
-
-func (s *UserService) UpdateUserProfile(ctx context.Context, email, brandName, domain, country string) error {
-	profile := &repository.User{
-		BrandName: brandName,
-		Domain:    domain,
-		Country:   country,
-	}
-
-	// Call repo to update DB
-	if err := s.users.UpdateProfile(ctx, email, profile); err != nil {
-		return err
-	}
-	return nil
-}
-
 type UserDomainCountry struct {
 	ID      primitive.ObjectID
 	Domain  string
@@ -143,7 +103,7 @@ Irrelevant or international-only competitors not present in the target country.
 
 	userPrompt := "Domain: " + domain + "\nCountry: " + country
 
-	resp, err := s.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	resp, err := chatCompletion(ctx, s.client, s.metrics, s.usage, LLMPurposeCompetitorGeneration, openai.ChatCompletionRequest{
 		Model: "gpt-4o-mini",
 		Messages: []openai.ChatCompletionMessage{
 			{Role: "system", Content: systemPrompt},
@@ -152,7 +112,7 @@ Irrelevant or international-only competitors not present in the target country.
 		MaxTokens: 300,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("openai error: %w", err)
+		return nil, errLLM(fmt.Errorf("openai error: %w", err))
 	}
 
 	content := resp.Choices[0].Message.Content
@@ -160,8 +120,14 @@ Irrelevant or international-only competitors not present in the target country.
 	// Unmarshal into a slice
 	var competitors []Competitor
 	if err := json.Unmarshal([]byte(content), &competitors); err != nil {
-		return nil, fmt.Errorf("invalid json from model: %w", err)
+		return nil, errLLM(fmt.Errorf("invalid json from model: %w", err))
 	}
 
+	s.audit.Record(ctx, repository.AuditEvent{
+		Action:     AuditCompetitorsSuggested,
+		TargetType: "domain",
+		TargetID:   domain,
+		Metadata:   map[string]any{"country": country, "suggested": len(competitors)},
+	})
 	return competitors, nil
 }
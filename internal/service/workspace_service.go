@@ -0,0 +1,501 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"auth-microservice/internal/apperr"
+	"auth-microservice/internal/auth"
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/mailer"
+	"auth-microservice/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrWorkspaceNotFound = apperr.New(apperr.NotFound, "workspace_not_found", "workspace not found")
+	ErrNotMember         = apperr.New(apperr.Forbidden, "not_a_member", "not a member of this workspace")
+	ErrInsufficientRole  = apperr.New(apperr.Forbidden, "insufficient_role", "your role does not allow this action")
+	ErrLastOwner         = apperr.New(apperr.Conflict, "last_owner", "a workspace must keep at least one owner")
+	ErrInvalidRole       = apperr.New(apperr.Validation, "invalid_role", "invalid role")
+	ErrInviteMismatch    = apperr.New(apperr.Forbidden, "invite_email_mismatch", "invitation was sent to a different email")
+	ErrAlreadyMember     = apperr.New(apperr.Conflict, "already_a_member", "user is already a member of this workspace")
+	ErrInvalidInvite     = apperr.New(apperr.Validation, "invalid_invite", "invalid or expired invitation")
+	ErrMFARequired       = apperr.New(apperr.Forbidden, "mfa_required", "this workspace requires two-factor authentication")
+)
+
+const inviteTTL = 7 * 24 * time.Hour
+
+type WorkspaceService struct {
+	workspaces *repository.WorkspaceRepo
+	members    *repository.MemberRepo
+	users      *repository.UserRepo
+	tokens     *repository.TokenRepo
+	prompts    *repository.PromptRepo
+	projects   *ProjectService
+	sessions   *SessionService
+	mail       mailer.Mailer
+	tpl        *mailer.Templates
+	audit      *AuditService
+	cfg        *config.Config
+}
+
+func NewWorkspaceService(
+	w *repository.WorkspaceRepo,
+	m *repository.MemberRepo,
+	u *repository.UserRepo,
+	t *repository.TokenRepo,
+	p *repository.PromptRepo,
+	projects *ProjectService,
+	sessions *SessionService,
+	mail mailer.Mailer,
+	tpl *mailer.Templates,
+	audit *AuditService,
+	cfg *config.Config,
+) *WorkspaceService {
+	return &WorkspaceService{workspaces: w, members: m, users: u, tokens: t, prompts: p, projects: projects, sessions: sessions, mail: mail, tpl: tpl, audit: audit, cfg: cfg}
+}
+
+// WorkspaceWithRole is a workspace as seen by one of its members
+type WorkspaceWithRole struct {
+	repository.Workspace
+	Role string `json:"role"`
+}
+
+// ResolveActive returns the workspace a user signs into: their oldest membership.
+// On first sign in a personal workspace is created, seeded with the user's legacy
+// brand profile, and their existing analysis rows are moved into it and its
+// default project.
+func (s *WorkspaceService) ResolveActive(ctx context.Context, user *repository.User) (*repository.Workspace, *repository.Membership, error) {
+	memberships, err := s.members.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	for _, m := range memberships {
+		ws, err := s.workspaces.FindByID(ctx, m.WorkspaceID.Hex())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch workspace: %w", err)
+		}
+		if ws != nil {
+			member := m
+			return ws, &member, nil
+		}
+	}
+
+	return s.createPersonal(ctx, user)
+}
+
+func (s *WorkspaceService) createPersonal(ctx context.Context, user *repository.User) (*repository.Workspace, *repository.Membership, error) {
+	name := user.BrandName
+	if name == "" {
+		name = user.Email
+	}
+
+	ws := &repository.Workspace{
+		Name:       name,
+		OwnerID:    user.ID,
+		BrandName:  user.BrandName,
+		Domain:     user.Domain,
+		Country:    user.Country,
+		Competitor: user.Competitor,
+	}
+	if err := s.workspaces.Create(ctx, ws); err != nil {
+		return nil, nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	member := &repository.Membership{
+		WorkspaceID: ws.ID,
+		UserID:      user.ID,
+		Email:       user.Email,
+		Role:        repository.RoleOwner,
+	}
+	if err := s.members.Add(ctx, member); err != nil {
+		return nil, nil, fmt.Errorf("failed to add owner: %w", err)
+	}
+
+	if err := s.prompts.AssignWorkspace(ctx, user.ID.Hex(), ws.ID.Hex()); err != nil {
+		return nil, nil, fmt.Errorf("failed to move analyses into workspace: %w", err)
+	}
+	if _, err := s.projects.CreateDefault(ctx, ws); err != nil {
+		return nil, nil, err
+	}
+
+	return ws, member, nil
+}
+
+// Membership returns the caller's membership in a workspace
+func (s *WorkspaceService) Membership(ctx context.Context, userID, workspaceID string) (*repository.Workspace, *repository.Membership, error) {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, nil, ErrNotMember
+	}
+	ws, err := s.workspaces.FindByID(ctx, workspaceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch workspace: %w", err)
+	}
+	if ws == nil {
+		return nil, nil, ErrWorkspaceNotFound
+	}
+
+	member, err := s.members.Find(ctx, ws.ID, uid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch membership: %w", err)
+	}
+	if member == nil {
+		return nil, nil, ErrNotMember
+	}
+	return ws, member, nil
+}
+
+// ListForUser returns every workspace the user belongs to, with their role in each
+func (s *WorkspaceService) ListForUser(ctx context.Context, userID string) ([]WorkspaceWithRole, error) {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrNotMember
+	}
+
+	memberships, err := s.members.ListByUser(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	roles := make(map[primitive.ObjectID]string, len(memberships))
+	ids := make([]primitive.ObjectID, 0, len(memberships))
+	for _, m := range memberships {
+		roles[m.WorkspaceID] = m.Role
+		ids = append(ids, m.WorkspaceID)
+	}
+
+	workspaces, err := s.workspaces.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch workspaces: %w", err)
+	}
+
+	result := make([]WorkspaceWithRole, 0, len(workspaces))
+	for _, ws := range workspaces {
+		result = append(result, WorkspaceWithRole{Workspace: ws, Role: roles[ws.ID]})
+	}
+	return result, nil
+}
+
+// Create makes a new workspace owned by the caller, with an empty default project
+func (s *WorkspaceService) Create(ctx context.Context, userID, email, name string) (*repository.Workspace, *repository.Membership, error) {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, nil, ErrNotMember
+	}
+
+	ws := &repository.Workspace{Name: name, OwnerID: uid}
+	if err := s.workspaces.Create(ctx, ws); err != nil {
+		return nil, nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	member := &repository.Membership{
+		WorkspaceID: ws.ID,
+		UserID:      uid,
+		Email:       email,
+		Role:        repository.RoleOwner,
+	}
+	if err := s.members.Add(ctx, member); err != nil {
+		return nil, nil, fmt.Errorf("failed to add owner: %w", err)
+	}
+	if _, err := s.projects.CreateDefault(ctx, ws); err != nil {
+		return nil, nil, err
+	}
+	return ws, member, nil
+}
+
+// GetWorkspace returns a workspace by ID
+func (s *WorkspaceService) GetWorkspace(ctx context.Context, workspaceID string) (*repository.Workspace, error) {
+	ws, err := s.workspaces.FindByID(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch workspace: %w", err)
+	}
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	return ws, nil
+}
+
+// ListMembers returns the members of a workspace
+func (s *WorkspaceService) ListMembers(ctx context.Context, workspaceID string) ([]repository.Membership, error) {
+	ws, err := s.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	return s.members.ListByWorkspace(ctx, ws.ID)
+}
+
+// Invite emails an accept link for the workspace to the given address, which
+// is lowercased and trimmed as at sign-up. Only owners and admins may invite,
+// only owners may invite owners, and members cannot be invited again. The
+// email's language follows the invitee's country, then acceptLanguage.
+func (s *WorkspaceService) Invite(ctx context.Context, workspaceID, actorRole, inviterEmail, email, role, acceptLanguage string) (string, error) {
+	if !repository.ValidRole(role) {
+		return "", ErrInvalidRole
+	}
+	if !canManageMembers(actorRole) || (role == repository.RoleOwner && actorRole != repository.RoleOwner) {
+		return "", ErrInsufficientRole
+	}
+
+	ws, err := s.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return "", err
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	invitee, err := s.users.FindByEmail(ctx, email)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch invitee: %w", err)
+	}
+	if invitee != nil {
+		member, err := s.members.Find(ctx, ws.ID, invitee.ID)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch membership: %w", err)
+		}
+		if member != nil {
+			return "", ErrAlreadyMember
+		}
+	}
+
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	rec := &repository.TokenRecord{
+		TokenHash:   hash,
+		Email:       email,
+		Purpose:     "workspace_invite",
+		WorkspaceID: ws.ID.Hex(),
+		Role:        role,
+		InvitedBy:   inviterEmail,
+		ExpiresAt:   time.Now().UTC().Add(inviteTTL),
+	}
+	if err := s.tokens.Create(ctx, rec); err != nil {
+		return "", fmt.Errorf("failed to save invitation: %w", err)
+	}
+
+	acceptURL := fmt.Sprintf("%s/invite/accept?token=%s", s.cfg.FrontendURL, token)
+
+	var country string
+	if invitee != nil {
+		country = invitee.Country
+	}
+	locale := mailer.ResolveLocale(acceptLanguage, country, s.tpl.Names()[mailer.TemplateWorkspaceInvite])
+	msg, err := s.tpl.Render(mailer.TemplateWorkspaceInvite, locale, email, map[string]any{
+		"WorkspaceName": ws.Name,
+		"InvitedBy":     inviterEmail,
+		"Role":          role,
+		"AcceptURL":     acceptURL,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render invitation email: %w", err)
+	}
+	msg.IdempotencyKey = "workspace_invite:" + hash
+	msg.WorkspaceID = ws.ID.Hex()
+
+	if err := s.mail.Send(ctx, msg); err != nil {
+		return "", fmt.Errorf("failed to send invitation email: %w", err)
+	}
+
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &ws.ID,
+		Action:      AuditMemberInvited,
+		TargetType:  "email",
+		TargetID:    rec.Email,
+		After:       map[string]any{"role": role},
+	})
+	return acceptURL, nil
+}
+
+// AcceptInvite consumes an invitation token and adds the caller to its workspace
+func (s *WorkspaceService) AcceptInvite(ctx context.Context, token, userID, email string) (*repository.Workspace, *repository.Membership, error) {
+	hash := auth.HashToken(token)
+	rec, err := s.tokens.FindValid(ctx, hash, "workspace_invite")
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil, ErrInvalidInvite
+		}
+		return nil, nil, err
+	}
+	if !strings.EqualFold(rec.Email, email) {
+		return nil, nil, ErrInviteMismatch
+	}
+
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, nil, ErrNotMember
+	}
+	ws, err := s.GetWorkspace(ctx, rec.WorkspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	existing, err := s.members.Find(ctx, ws.ID, uid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch membership: %w", err)
+	}
+	if existing != nil {
+		_ = s.tokens.Delete(ctx, hash)
+		return nil, nil, ErrAlreadyMember
+	}
+
+	member := &repository.Membership{
+		WorkspaceID: ws.ID,
+		UserID:      uid,
+		Email:       email,
+		Role:        rec.Role,
+	}
+	if err := s.members.Add(ctx, member); err != nil {
+		return nil, nil, fmt.Errorf("failed to add member: %w", err)
+	}
+	s.sessions.ForgetMembership(userID, ws.ID.Hex())
+	_ = s.tokens.Delete(ctx, hash)
+
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &ws.ID,
+		Action:      AuditMemberJoined,
+		TargetType:  "user",
+		TargetID:    userID,
+		After:       map[string]any{"role": rec.Role},
+		Metadata:    map[string]any{"invited_by": rec.InvitedBy},
+	})
+	return ws, member, nil
+}
+
+// UpdateMemberRole changes a member's role. Admins cannot touch owners or grant ownership.
+func (s *WorkspaceService) UpdateMemberRole(ctx context.Context, workspaceID, actorRole, memberUserID, role string) error {
+	if !repository.ValidRole(role) {
+		return ErrInvalidRole
+	}
+	ws, target, err := s.Membership(ctx, memberUserID, workspaceID)
+	if err != nil {
+		return err
+	}
+	if !canManageMembers(actorRole) {
+		return ErrInsufficientRole
+	}
+	if actorRole != repository.RoleOwner && (role == repository.RoleOwner || target.Role == repository.RoleOwner) {
+		return ErrInsufficientRole
+	}
+	if target.Role == repository.RoleOwner && role != repository.RoleOwner {
+		if err := s.ensureAnotherOwner(ctx, ws.ID); err != nil {
+			return err
+		}
+	}
+	if err := s.members.UpdateRole(ctx, ws.ID, target.UserID, role); err != nil {
+		return err
+	}
+	// Tokens carry the old role; the auth middleware reads the current one
+	s.sessions.ForgetMembership(memberUserID, ws.ID.Hex())
+	before, after := auditChanges(map[string]any{"role": target.Role}, map[string]any{"role": role})
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &ws.ID,
+		Action:      AuditMemberRoleChanged,
+		TargetType:  "user",
+		TargetID:    memberUserID,
+		Before:      before,
+		After:       after,
+	})
+	return nil
+}
+
+// RemoveMember removes a user from a workspace. Members may always remove themselves.
+func (s *WorkspaceService) RemoveMember(ctx context.Context, workspaceID, actorRole, actorUserID, memberUserID string) error {
+	ws, target, err := s.Membership(ctx, memberUserID, workspaceID)
+	if err != nil {
+		return err
+	}
+	if actorUserID != memberUserID {
+		if !canManageMembers(actorRole) {
+			return ErrInsufficientRole
+		}
+		if actorRole != repository.RoleOwner && target.Role == repository.RoleOwner {
+			return ErrInsufficientRole
+		}
+	}
+	if target.Role == repository.RoleOwner {
+		if err := s.ensureAnotherOwner(ctx, ws.ID); err != nil {
+			return err
+		}
+	}
+	if err := s.members.Remove(ctx, ws.ID, target.UserID); err != nil {
+		return err
+	}
+	s.sessions.ForgetMembership(memberUserID, ws.ID.Hex())
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &ws.ID,
+		Action:      AuditMemberRemoved,
+		TargetType:  "user",
+		TargetID:    memberUserID,
+		Before:      map[string]any{"email": target.Email, "role": target.Role},
+	})
+	return nil
+}
+
+// SetRequireMFA turns the MFA requirement of a workspace on or off. The admin
+// turning it on must have completed MFA themselves so they are not locked out.
+// Members' tokens and API keys without MFA stop working in the workspace.
+func (s *WorkspaceService) SetRequireMFA(ctx context.Context, workspaceID, actorRole string, actorMFA, require bool) (*repository.Workspace, error) {
+	if !auth.RoleHasPermission(actorRole, auth.PermAdminSecurity) {
+		return nil, ErrInsufficientRole
+	}
+	if require && !actorMFA {
+		return nil, ErrMFARequired
+	}
+	ws, err := s.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.workspaces.SetRequireMFA(ctx, ws.ID, require); err != nil {
+		return nil, fmt.Errorf("failed to update workspace: %w", err)
+	}
+	s.sessions.ForgetWorkspace(ws.ID.Hex())
+	before, after := auditChanges(map[string]any{"require_mfa": ws.RequireMFA}, map[string]any{"require_mfa": require})
+	s.audit.Record(ctx, repository.AuditEvent{
+		WorkspaceID: &ws.ID,
+		Action:      AuditRequireMFAChanged,
+		TargetType:  "workspace",
+		TargetID:    ws.ID.Hex(),
+		Before:      before,
+		After:       after,
+	})
+	ws.RequireMFA = require
+	return ws, nil
+}
+
+// AnyRequiresMFA reports whether any workspace the user belongs to requires MFA
+func (s *WorkspaceService) AnyRequiresMFA(ctx context.Context, userID string) (bool, error) {
+	workspaces, err := s.ListForUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, ws := range workspaces {
+		if ws.RequireMFA {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *WorkspaceService) ensureAnotherOwner(ctx context.Context, workspaceID primitive.ObjectID) error {
+	owners, err := s.members.CountByRole(ctx, workspaceID, repository.RoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to count owners: %w", err)
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func canManageMembers(role string) bool {
+	return role == repository.RoleOwner || role == repository.RoleAdmin
+}
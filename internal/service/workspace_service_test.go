@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"auth-microservice/internal/config"
+	"auth-microservice/internal/mailer"
+	"auth-microservice/internal/mongotest"
+	"auth-microservice/internal/repository"
+)
+
+// sentMail records the messages given to it
+type sentMail struct {
+	mu   sync.Mutex
+	msgs []mailer.Message
+}
+
+func (m *sentMail) Send(_ context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.msgs = append(m.msgs, msg)
+	return nil
+}
+
+// workspaceFixture is a workspace service over a scratch database with one
+// workspace. Member roles are keyed by a short name, e.g. "owner".
+type workspaceFixture struct {
+	svc     *WorkspaceService
+	users   *repository.UserRepo
+	members *repository.MemberRepo
+	mail    *sentMail
+	ws      *repository.Workspace
+	ids     map[string]string // member name -> user hex ID
+}
+
+func newWorkspaceFixture(t *testing.T, roles map[string]string) *workspaceFixture {
+	t.Helper()
+	ctx := context.Background()
+	db := mongotest.Database(t)
+	tpl, err := mailer.NewTemplates(mailer.Brand{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspaces := repository.NewWorkspaceRepo(db, "workspaces")
+	f := &workspaceFixture{
+		users:   repository.NewUserRepo(db, "users"),
+		members: repository.NewMemberRepo(db, "members"),
+		mail:    &sentMail{},
+		ws:      &repository.Workspace{Name: "acme"},
+		ids:     map[string]string{},
+	}
+	f.svc = NewWorkspaceService(workspaces, f.members, f.users, repository.NewTokenRepo(db, "tokens"), nil, nil,
+		NewSessionService(f.users, f.members, workspaces), f.mail, tpl,
+		NewAuditService(repository.NewAuditRepo(db, "audit")), &config.Config{FrontendURL: "https://app.example.com"})
+
+	if err := workspaces.Create(ctx, f.ws); err != nil {
+		t.Fatal(err)
+	}
+	for name, role := range roles {
+		u, err := f.users.CreateUser(ctx, name+"@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.members.Add(ctx, &repository.Membership{WorkspaceID: f.ws.ID, UserID: u.ID, Email: u.Email, Role: role}); err != nil {
+			t.Fatal(err)
+		}
+		f.ids[name] = u.ID.Hex()
+	}
+	return f
+}
+
+func (f *workspaceFixture) role(t *testing.T, name string) string {
+	t.Helper()
+	_, m, err := f.svc.Membership(context.Background(), f.ids[name], f.ws.ID.Hex())
+	if err != nil {
+		t.Fatalf("membership of %s: %v", name, err)
+	}
+	return m.Role
+}
+
+func TestWorkspaceInvite(t *testing.T) {
+	f := newWorkspaceFixture(t, map[string]string{"owner": repository.RoleOwner, "editor": repository.RoleEditor})
+	ctx := context.Background()
+	ws := f.ws.ID.Hex()
+
+	refused := []struct {
+		name, actorRole, email, role string
+		want                         error
+	}{
+		{"unknown role", repository.RoleOwner, "new@example.com", "superuser", ErrInvalidRole},
+		{"editor inviting", repository.RoleEditor, "new@example.com", repository.RoleViewer, ErrInsufficientRole},
+		{"admin inviting an owner", repository.RoleAdmin, "new@example.com", repository.RoleOwner, ErrInsufficientRole},
+		{"existing member, differently written", repository.RoleOwner, " Editor@Example.com ", repository.RoleViewer, ErrAlreadyMember},
+	}
+	for _, tt := range refused {
+		if _, err := f.svc.Invite(ctx, ws, tt.actorRole, "owner@example.com", tt.email, tt.role, ""); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if len(f.mail.msgs) != 0 {
+		t.Fatalf("refused invitations sent %d emails", len(f.mail.msgs))
+	}
+
+	acceptURL, err := f.svc.Invite(ctx, ws, repository.RoleAdmin, "owner@example.com", " New@Example.com", repository.RoleEditor, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.mail.msgs) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(f.mail.msgs))
+	}
+	msg := f.mail.msgs[0]
+	if msg.To != "new@example.com" || msg.WorkspaceID != ws || !strings.HasPrefix(msg.IdempotencyKey, "workspace_invite:") || !strings.Contains(msg.Text, acceptURL) {
+		t.Errorf("invitation %+v does not go to the normalised address with the accept link %s", msg, acceptURL)
+	}
+	u, err := url.Parse(acceptURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := u.Query().Get("token")
+
+	invitee, err := f.users.CreateUser(ctx, "new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The link only works for the address it was sent to
+	if _, _, err := f.svc.AcceptInvite(ctx, token, f.ids["editor"], "editor@example.com"); !errors.Is(err, ErrInviteMismatch) {
+		t.Fatalf("accept by another address: err %v, want ErrInviteMismatch", err)
+	}
+	_, member, err := f.svc.AcceptInvite(ctx, token, invitee.ID.Hex(), "New@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if member.Role != repository.RoleEditor || member.UserID != invitee.ID {
+		t.Errorf("joined as %+v, want editor", member)
+	}
+	if _, _, err := f.svc.AcceptInvite(ctx, token, invitee.ID.Hex(), "new@example.com"); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("reused invitation: err %v, want ErrInvalidInvite", err)
+	}
+	if _, _, err := f.svc.AcceptInvite(ctx, "not-a-token", invitee.ID.Hex(), "new@example.com"); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("unknown invitation: err %v, want ErrInvalidInvite", err)
+	}
+}
+
+func TestWorkspaceRoleChanges(t *testing.T) {
+	f := newWorkspaceFixture(t, map[string]string{
+		"owner":  repository.RoleOwner,
+		"admin":  repository.RoleAdmin,
+		"editor": repository.RoleEditor,
+	})
+	ctx := context.Background()
+	ws := f.ws.ID.Hex()
+
+	steps := []struct {
+		name, actorRole, member, role string
+		want                          error
+	}{
+		{"unknown role", repository.RoleOwner, "editor", "superuser", ErrInvalidRole},
+		{"editor changing roles", repository.RoleEditor, "editor", repository.RoleAdmin, ErrInsufficientRole},
+		{"admin granting ownership", repository.RoleAdmin, "editor", repository.RoleOwner, ErrInsufficientRole},
+		{"admin demoting the owner", repository.RoleAdmin, "owner", repository.RoleViewer, ErrInsufficientRole},
+		{"last owner stepping down", repository.RoleOwner, "owner", repository.RoleAdmin, ErrLastOwner},
+		{"admin demoting an editor", repository.RoleAdmin, "editor", repository.RoleViewer, nil},
+		{"owner granting ownership", repository.RoleOwner, "admin", repository.RoleOwner, nil},
+		{"owner stepping down beside another", repository.RoleOwner, "owner", repository.RoleAdmin, nil},
+		{"new last owner stepping down", repository.RoleOwner, "admin", repository.RoleEditor, ErrLastOwner},
+	}
+	for _, tt := range steps {
+		before := f.role(t, tt.member)
+		err := f.svc.UpdateMemberRole(ctx, ws, tt.actorRole, f.ids[tt.member], tt.role)
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("%s: err %v, want %v", tt.name, err, tt.want)
+		}
+		want := tt.role
+		if tt.want != nil {
+			want = before
+		}
+		if got := f.role(t, tt.member); got != want {
+			t.Fatalf("%s: %s is %s, want %s", tt.name, tt.member, got, want)
+		}
+	}
+}
+
+func TestWorkspaceRemoveMember(t *testing.T) {
+	f := newWorkspaceFixture(t, map[string]string{
+		"owner":  repository.RoleOwner,
+		"admin":  repository.RoleAdmin,
+		"editor": repository.RoleEditor,
+		"viewer": repository.RoleViewer,
+	})
+	ctx := context.Background()
+	ws := f.ws.ID.Hex()
+
+	steps := []struct {
+		name, actorRole, actor, member string
+		want                           error
+	}{
+		{"editor removing another member", repository.RoleEditor, "editor", "viewer", ErrInsufficientRole},
+		{"admin removing the owner", repository.RoleAdmin, "admin", "owner", ErrInsufficientRole},
+		{"last owner leaving", repository.RoleOwner, "owner", "owner", ErrLastOwner},
+		{"viewer leaving", repository.RoleViewer, "viewer", "viewer", nil},
+		{"admin removing an editor", repository.RoleAdmin, "admin", "editor", nil},
+		{"owner removing an admin", repository.RoleOwner, "owner", "admin", nil},
+		{"removing a former member", repository.RoleOwner, "owner", "admin", ErrNotMember},
+	}
+	for _, tt := range steps {
+		err := f.svc.RemoveMember(ctx, ws, tt.actorRole, f.ids[tt.actor], f.ids[tt.member])
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	members, err := f.members.ListByWorkspace(ctx, f.ws.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].Role != repository.RoleOwner {
+		t.Errorf("members left %+v, want the owner alone", members)
+	}
+}
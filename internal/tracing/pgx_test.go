@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPgxTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	tests := []struct {
+		sql      string
+		err      error
+		wantName string
+		wantOp   string
+	}{
+		{sql: "\n\t\tselect id FROM llm_call WHERE workspace_id = $1", wantName: "postgres SELECT", wantOp: "SELECT"},
+		{sql: "INSERT INTO llm_call (id) VALUES ($1)", err: errors.New("duplicate key"), wantName: "postgres INSERT", wantOp: "INSERT"},
+		{sql: "   ", wantName: "postgres QUERY", wantOp: "QUERY"},
+	}
+	for _, tt := range tests {
+		exporter.Reset()
+		var tr PgxTracer
+		ctx := tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: tt.sql, Args: []any{"secret"}})
+		tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: tt.err})
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 {
+			t.Fatalf("%q: got %d spans, want 1", tt.sql, len(spans))
+		}
+		span := spans[0]
+		if span.Name != tt.wantName {
+			t.Errorf("%q: span name %q, want %q", tt.sql, span.Name, tt.wantName)
+		}
+		if span.SpanKind != trace.SpanKindClient {
+			t.Errorf("%q: span kind %v, want client", tt.sql, span.SpanKind)
+		}
+
+		attrs := map[attribute.Key]string{}
+		for _, kv := range span.Attributes {
+			attrs[kv.Key] = kv.Value.Emit()
+		}
+		if attrs["db.system.name"] != "postgresql" {
+			t.Errorf("%q: db.system.name = %q", tt.sql, attrs["db.system.name"])
+		}
+		if attrs["db.operation.name"] != tt.wantOp {
+			t.Errorf("%q: db.operation.name = %q, want %q", tt.sql, attrs["db.operation.name"], tt.wantOp)
+		}
+		if attrs["db.query.text"] != tt.sql {
+			t.Errorf("%q: db.query.text = %q", tt.sql, attrs["db.query.text"])
+		}
+
+		wantStatus := codes.Unset
+		if tt.err != nil {
+			wantStatus = codes.Error
+		}
+		if span.Status.Code != wantStatus {
+			t.Errorf("%q: status %v, want %v", tt.sql, span.Status.Code, wantStatus)
+		}
+	}
+}